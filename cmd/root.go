@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"crypto/ed25519"
 	"math"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
@@ -15,11 +17,18 @@ import (
 	"github.com/containrrr/watchtower/internal/handlers"
 	"github.com/containrrr/watchtower/internal/meta"
 	"github.com/containrrr/watchtower/internal/middleware"
+	"github.com/containrrr/watchtower/pkg/bundle"
+	"github.com/containrrr/watchtower/pkg/certs"
 	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/device"
 	"github.com/containrrr/watchtower/pkg/filters"
+	"github.com/containrrr/watchtower/pkg/hold"
+	"github.com/containrrr/watchtower/pkg/maintenance"
 	"github.com/containrrr/watchtower/pkg/metrics"
 	"github.com/containrrr/watchtower/pkg/notifications"
+	"github.com/containrrr/watchtower/pkg/stack"
 	t "github.com/containrrr/watchtower/pkg/types"
+	"github.com/containrrr/watchtower/pkg/update"
 	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron"
 	log "github.com/sirupsen/logrus"
@@ -42,6 +51,12 @@ var (
 	rollingRestart    bool
 	scope             string
 	labelPrecedence   bool
+	rollbackGrace     time.Duration
+	rolledBack        *update.Rollbacks
+	stackStore        *stack.Store
+	holds             *hold.Store
+	roles             device.RoleSource
+	gate              t.UpdateGate
 )
 
 var rootCmd = NewRootCommand()
@@ -99,6 +114,7 @@ func PreRun(cmd *cobra.Command, _ []string) {
 	rollingRestart, _ = f.GetBool("rolling-restart")
 	scope, _ = f.GetString("scope")
 	labelPrecedence, _ = f.GetBool("label-take-precedence")
+	rollbackGrace, _ = f.GetDuration("rollback-grace-period")
 
 	if scope != "" {
 		log.Debugf(`Using scope %q`, scope)
@@ -141,9 +157,44 @@ func Run(c *cobra.Command, names []string) {
 	// enableMetricsAPI, _ := c.PersistentFlags().GetBool("http-api-metrics")
 	// unblockHTTPAPI, _ := c.PersistentFlags().GetBool("http-api-periodic-polls")
 	apiToken, _ := c.PersistentFlags().GetString("http-api-token")
+	apiTokensFile, _ := c.PersistentFlags().GetString("http-api-tokens-file")
+	apiTLSCert, _ := c.PersistentFlags().GetString("http-api-tls-cert")
+	apiTLSKey, _ := c.PersistentFlags().GetString("http-api-tls-key")
+	apiTLSClientCA, _ := c.PersistentFlags().GetString("http-api-tls-client-ca")
+	apiAllowedOrigins, _ := c.PersistentFlags().GetStringSlice("http-api-allowed-origins")
 	healthCheck, _ := c.PersistentFlags().GetBool("health-check")
 	port, _ := c.PersistentFlags().GetString("port")
 	updateOnStartup, _ := c.PersistentFlags().GetBool("update-on-startup")
+	hostProc, _ := c.PersistentFlags().GetString("host-proc")
+	hostSys, _ := c.PersistentFlags().GetString("host-sys")
+	storageMounts, _ := c.PersistentFlags().GetStringSlice("storage-mounts")
+	powerSensorFile, _ := c.PersistentFlags().GetString("power-sensor-file")
+	powerMinVoltage, _ := c.PersistentFlags().GetFloat64("power-min-voltage")
+	powerMaxVoltage, _ := c.PersistentFlags().GetFloat64("power-max-voltage")
+	batteryCapacity, _ := c.PersistentFlags().GetFloat64("battery-capacity")
+	batteryLowThreshold, _ := c.PersistentFlags().GetFloat64("battery-low-threshold")
+	batteryCriticalThreshold, _ := c.PersistentFlags().GetFloat64("battery-critical-threshold")
+	powerCheckInterval, _ := c.PersistentFlags().GetDuration("power-check-interval")
+	composeDir, _ := c.PersistentFlags().GetString("compose-dir")
+	composeEnv, _ := c.PersistentFlags().GetStringSlice("compose-env")
+	dependencyTimeout, _ := c.PersistentFlags().GetDuration("dependency-timeout")
+	stateDir, _ := c.PersistentFlags().GetString("state-dir")
+	reconcileInterval, _ := c.PersistentFlags().GetDuration("reconcile-interval")
+	deviceWatchInterval, _ := c.PersistentFlags().GetDuration("device-watch-interval")
+	bundleRoots, _ := c.PersistentFlags().GetStringSlice("bundle-roots")
+	bundleKeysFile, _ := c.PersistentFlags().GetString("bundle-public-keys")
+	bundleSigningKeyFile, _ := c.PersistentFlags().GetString("bundle-private-key")
+	mediaWatchInterval, _ := c.PersistentFlags().GetDuration("media-watch-interval")
+	mountInfo, _ := c.PersistentFlags().GetString("mount-info")
+	deviceRole, _ := c.PersistentFlags().GetString("device-role")
+	deviceRoleFile, _ := c.PersistentFlags().GetString("device-role-file")
+	roleWatchInterval, _ := c.PersistentFlags().GetDuration("role-watch-interval")
+	maintenanceWindows, _ := c.PersistentFlags().GetString("maintenance-windows")
+	busyProbeURL, _ := c.PersistentFlags().GetString("busy-probe-url")
+	busyProbeFile, _ := c.PersistentFlags().GetString("busy-probe-file")
+	busyProbeContainer, _ := c.PersistentFlags().GetString("busy-probe-container")
+	busyProbeCommand, _ := c.PersistentFlags().GetString("busy-probe-command")
+	deferredRetryInterval, _ := c.PersistentFlags().GetDuration("deferred-retry-interval")
 
 	if healthCheck {
 		// health check should not have pid 1
@@ -158,15 +209,121 @@ func Run(c *cobra.Command, names []string) {
 		log.Fatal("Rolling restarts is not compatible with the global monitor only flag")
 	}
 
+	if deferredRetryInterval <= 0 {
+		log.Fatal("The deferred retry interval must be positive")
+	}
+
+	var bundleKeys []ed25519.PublicKey
+	if bundleKeysFile != "" {
+		var err error
+		if bundleKeys, err = bundle.LoadPublicKeys(bundleKeysFile); err != nil {
+			log.Fatalf("Unable to read the bundle public keys: %v", err)
+		}
+	}
+	var bundleSigningKey ed25519.PrivateKey
+	if bundleSigningKeyFile != "" {
+		var err error
+		if bundleSigningKey, err = bundle.LoadPrivateKey(bundleSigningKeyFile); err != nil {
+			log.Fatalf("Unable to read the bundle private key: %v", err)
+		}
+	}
+
+	apiTokens := middleware.Tokens{}
+	if apiTokensFile != "" {
+		var err error
+		if apiTokens, err = middleware.LoadTokens(apiTokensFile); err != nil {
+			log.Fatalf("Unable to read the HTTP API tokens: %v", err)
+		}
+	}
+	if apiToken != "" {
+		apiTokens = append(apiTokens, middleware.Token{Name: "default", Secret: apiToken, Role: middleware.Admin})
+	}
+	if len(apiTokens) == 0 {
+		log.Warn("No HTTP API token is set, the API accepts every request")
+	}
+
+	roles = device.RoleSource{Default: deviceRole, File: deviceRoleFile}
+	if _, err := roles.Role(); err != nil {
+		log.Fatalf("Unable to read the device role: %v", err)
+	}
+
+	var apiCerts *certs.Reloader
+	if apiTLSCert != "" && apiTLSKey != "" {
+		serial := device.Serial(hostProc)
+		if generated, err := certs.EnsureSelfSigned(apiTLSCert, apiTLSKey, serial); err != nil {
+			log.Fatalf("Unable to generate the HTTP API certificate: %v", err)
+		} else if generated {
+			log.Infof("Generated a self-signed HTTP API certificate for device %s", serial)
+		}
+		var err error
+		if apiCerts, err = certs.NewReloader(apiTLSCert, apiTLSKey, apiTLSClientCA); err != nil {
+			log.Fatalf("Unable to read the HTTP API certificates: %v", err)
+		}
+	} else if apiTLSCert != "" || apiTLSKey != "" || apiTLSClientCA != "" {
+		log.Fatal("Both --http-api-tls-cert and --http-api-tls-key are required to serve the HTTP API over TLS")
+	}
+
+	updateMachine, err := update.NewMachine(stateDir)
+	if err != nil {
+		log.Fatalf("Unable to read the update state: %v", err)
+	}
+	if holds, err = hold.NewStore(stateDir); err != nil {
+		log.Fatalf("Unable to read the held containers: %v", err)
+	}
+	if rolledBack, err = update.NewRollbacks(stateDir); err != nil {
+		log.Fatalf("Unable to read the rolled back images: %v", err)
+	}
+	stackStore = stack.NewStore(stateDir)
+
+	// Containers are only stopped for updates within the maintenance windows, while the robot is idle
+	windows, err := maintenance.ParseWindows(maintenanceWindows)
+	if err != nil {
+		log.Fatalf("Unable to read the maintenance windows: %v", err)
+	}
+	probes := []maintenance.Probe{}
+	if busyProbeURL != "" {
+		probes = append(probes, maintenance.HTTPProbe{URL: busyProbeURL})
+	}
+	if busyProbeFile != "" {
+		probes = append(probes, maintenance.FileProbe{Path: busyProbeFile})
+	}
+	if busyProbeContainer != "" && busyProbeCommand != "" {
+		probes = append(probes, maintenance.CommandProbe{Client: client, Container: busyProbeContainer, Command: busyProbeCommand})
+	}
+	var maintenanceGate *maintenance.Gate
+	if len(windows) > 0 || len(probes) > 0 {
+		maintenanceGate = &maintenance.Gate{Windows: windows, Probes: probes}
+		gate = maintenanceGate
+	}
+
 	awaitDockerClient()
 
 	if err := actions.CheckForSanity(client, filter, rollingRestart); err != nil {
 		logNotifyExit(err)
 	}
 
+	// The parameters are shared by every update, whether it is run on schedule, through the HTTP API or from removable media
+	updateParams := t.UpdateParams{
+		Filter:              filter,
+		Cleanup:             cleanup,
+		NoRestart:           noRestart,
+		Timeout:             timeout,
+		MonitorOnly:         monitorOnly,
+		LifecycleHooks:      lifecycleHooks,
+		RollingRestart:      rollingRestart,
+		LabelPrecedence:     labelPrecedence,
+		NoPull:              noPull,
+		RollbackGracePeriod: rollbackGrace,
+		RolledBack:          rolledBack,
+		Stack:               stackStore,
+		Holds:               holds,
+		Roles:               roles,
+		Gate:                gate,
+	}
+
 	if runOnce {
 		writeStartupMessage(c, time.Time{}, filterDesc)
-		runUpdatesWithNotifications(filter)
+		runUpdatesWithNotifications(updateParams)
 		notifier.Close()
 		os.Exit(0)
 		return
@@ -180,18 +337,58 @@ func Run(c *cobra.Command, names []string) {
 	clientLock := make(chan bool, 1)
 	clientLock <- true
 
+	// Updates deferred by the maintenance windows or a busy robot are retried until they go through.
+	// Outside of the windows they are retried once the next window opens.
+	retrier := &actions.Retrier{
+		Interval: deferredRetryInterval,
+		Gate:     gate,
+		Notifier: notifier,
+		Lock:     clientLock,
+	}
+	if len(windows) > 0 {
+		retrier.Windows = maintenanceGate
+	}
+
+	// Updated containers are watched in the background, failed ones are rolled back once the lock is free
+	rollbacks := &actions.RollbackWatcher{
+		Client:   client,
+		Notifier: notifier,
+		Lock:     clientLock,
+	}
+	// The update of a single run exits right away, so only the later updates watch the updated containers
+	updateParams.Rollbacks = rollbacks
+
+	// Updates are downloaded on schedule, and only applied once approved through the HTTP API
+	updateWorkflow := &actions.UpdateWorkflow{
+		Client:  client,
+		Machine: updateMachine,
+		Params:  updateParams,
+	}
+
 	// Create a new Gin router
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
 	// Use default recovery
 	router.Use(gin.Recovery())
 	// Add CORS middleware
-	router.Use(middleware.CORSMiddleware())
+	router.Use(middleware.CORSMiddleware(apiAllowedOrigins))
+	// Audit the denied and the mutating requests
+	router.Use(middleware.Audit())
 	// Add authentication
-	router.Use(middleware.AuthMiddleware(apiToken))
+	router.Use(middleware.AuthMiddleware(apiTokens))
 	// Add logging
 	router.Use(middleware.Logger())
 
+	mediaMonitor := &actions.MediaMonitor{
+		Watcher:  &device.DeviceWatcher{Source: device.MountSource{MountInfo: mountInfo, Roots: bundleRoots}},
+		Client:   client,
+		Keys:     bundleKeys,
+		Params:   updateParams,
+		Notifier: notifier,
+		Lock:     clientLock,
+		Retrier:  retrier,
+	}
+
 	// Create handlers
 	watchtowerHandler := handlers.WatchtowerHandler{
 		Client:            &client,
@@ -209,33 +406,129 @@ func Run(c *cobra.Command, names []string) {
 		RollingRestart:    rollingRestart,
 		Scope:             scope,
 		LabelPrecedence:   labelPrecedence,
+		Params:            updateParams,
+		Lock:              clientLock,
+		BundleRoots:       bundleRoots,
+		BundleKeys:        bundleKeys,
+		BundleSigningKey:  bundleSigningKey,
+		Media:             mediaMonitor,
+		Workflow:          updateWorkflow,
+		Retrier:           retrier,
+	}
+
+	powerReader := device.NewPowerReader(device.PowerOptions{
+		SysRoot:         hostSys,
+		SensorFile:      powerSensorFile,
+		MinVoltage:      powerMinVoltage,
+		MaxVoltage:      powerMaxVoltage,
+		BatteryCapacity: batteryCapacity,
+	})
+	if err := powerReader.Validate(); err != nil {
+		log.Fatalf("Unable to monitor the power sensor: %v", err)
+	}
+	hardwareCollector := device.NewHardwareCollector(device.HardwareOptions{
+		ProcRoot:    hostProc,
+		SysRoot:     hostSys,
+		MountPoints: storageMounts,
+	})
+	hardwareCollector.Power = powerReader
+
+	reconciler := &actions.Reconciler{
+		Client:            client,
+		Store:             stackStore,
+		DependencyTimeout: dependencyTimeout,
 		Lock:              clientLock,
 	}
 
+	deviceMonitor := &actions.DeviceMonitor{
+		Watcher:    &device.DeviceWatcher{Source: device.NewUSBSource(hostSys)},
+		Reconciler: reconciler,
+		Notifier:   notifier,
+	}
+
 	deviceHandler := handlers.DeviceHandler{
 		Client:                  client,
+		Hardware:                hardwareCollector,
+		Power:                   powerReader,
+		Devices:                 deviceMonitor,
+		Roles:                   roles,
 		HardwareStatusFrequency: 0.1, // Once every 10 seconds
 	}
 
-	containerHandler := handlers.NewContainerHandler(client, 1)
+	containerHandler := handlers.NewContainerHandler(client, 1, composeDir, composeEnv, reconciler)
+	stackHandler := handlers.StackHandler{
+		Reconciler: reconciler,
+	}
+	holdHandler := handlers.HoldHandler{
+		Client: client,
+		Holds:  holds,
+	}
 
 	// Set routes
-	api.SetRoutes(router, &deviceHandler, &watchtowerHandler, containerHandler)
+	api.SetRoutes(router, &deviceHandler, &watchtowerHandler, containerHandler, &stackHandler, &holdHandler)
 
-	log.Infof("Serving api at port %v", port)
 	// Start api
 	go func() {
-		router.Run(":" + port)
+		server := &http.Server{Addr: ":" + port, Handler: router}
+		var err error
+		if apiCerts != nil {
+			log.Infof("Serving api over TLS at port %v", port)
+			server.TLSConfig = apiCerts.Config()
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			log.Infof("Serving api at port %v", port)
+			err = server.ListenAndServe()
+		}
+		log.Errorf("The HTTP API stopped: %v", err)
 	}()
 
+	// Watch the battery and notify when it runs low
+	powerMonitor := device.PowerMonitor{
+		Reader:            powerReader,
+		Notifier:          notifier,
+		LowThreshold:      batteryLowThreshold,
+		CriticalThreshold: batteryCriticalThreshold,
+	}
+	if powerCheckInterval > 0 {
+		go powerMonitor.Run(powerCheckInterval)
+	}
+
+	// Recreate stack containers that went missing or drifted from their definition
+	if reconcileInterval > 0 {
+		go reconciler.Run(reconcileInterval)
+	}
+
+	// Restart or recreate stack containers when their devices are plugged in again
+	if deviceWatchInterval > 0 {
+		go deviceMonitor.Run(deviceWatchInterval)
+	}
+
+	// Load the offline update bundles on removable media as soon as it is mounted
+	if mediaWatchInterval > 0 {
+		go mediaMonitor.Run(mediaWatchInterval)
+	}
+
+	// Switch the containers to the release channel of the device whenever its role changes
+	if roleWatchInterval > 0 {
+		channelMonitor := &actions.ChannelMonitor{
+			Client:   client,
+			Params:   updateWorkflow.Params,
+			Notifier: notifier,
+			Lock:     clientLock,
+		}
+		go channelMonitor.Run(roleWatchInterval)
+	}
+
 	// Run update once startup to check and download updates from the cloud
 	if updateOnStartup {
-		runCheckForUpdates(filter)
-		metric := runUpdatesWithNotifications(filter)
-		metrics.RegisterScan(metric)
+		runCheckForUpdates(updateWorkflow)
+		if updateMachine.State().Phase == update.PhaseDownloaded {
+			metric := runApplyWithNotifications(updateWorkflow, retrier)
+			metrics.RegisterScan(metric)
+		}
 	}
 
-	if err := runChecksOnSchedule(c, filter, filterDesc, clientLock); err != nil {
+	if err := runChecksOnSchedule(c, updateWorkflow, filterDesc, clientLock); err != nil {
 		log.Error(err)
 	}
 
@@ -341,7 +634,7 @@ func writeStartupMessage(c *cobra.Command, sched time.Time, filtering string) {
 	}
 }
 
-func runChecksOnSchedule(c *cobra.Command, filter t.Filter, filtering string, lock chan bool) error {
+func runChecksOnSchedule(c *cobra.Command, workflow *actions.UpdateWorkflow, filtering string, lock chan bool) error {
 	if lock == nil {
 		lock = make(chan bool, 1)
 		lock <- true
@@ -354,7 +647,7 @@ func runChecksOnSchedule(c *cobra.Command, filter t.Filter, filtering string, lo
 			v := <-lock
 			defer func() { lock <- v }()
 			// Check for updates from registry and from local devices
-			runCheckForUpdates(filter)
+			runCheckForUpdates(workflow)
 		})
 
 	if err != nil {
@@ -377,46 +670,40 @@ func runChecksOnSchedule(c *cobra.Command, filter t.Filter, filtering string, lo
 	return nil
 }
 
-func runCheckForUpdates(filter t.Filter) {
-	updateParams := t.UpdateParams{
-		Filter:          filter,
-		Cleanup:         cleanup,
-		NoRestart:       noRestart,
-		Timeout:         timeout,
-		MonitorOnly:     monitorOnly,
-		LifecycleHooks:  lifecycleHooks,
-		RollingRestart:  rollingRestart,
-		LabelPrecedence: labelPrecedence,
-	}
-	// Check for updates from registry first
-	if updateAvailable, err := actions.CheckForNewUpdateFromRegistry(client, updateParams); err != nil {
+func runCheckForUpdates(workflow *actions.UpdateWorkflow) {
+	// Only download the updates, they are applied once approved
+	state, err := workflow.Download()
+	if err != nil {
 		log.Error(err)
-	} else if updateAvailable {
-		log.Info("Updates available from registry. Attempting to pull updates now...")
-		err := actions.DownloadUpdate(client, updateParams)
-		if err != nil {
-			log.Error(err)
-		}
-	} else if !updateAvailable {
-		log.Debug("Updates not available from upstream")
-	} else {
-		log.Debug("Unable to check for update from upstream registry")
+	} else if state.Phase == update.PhaseDownloaded {
+		log.Infof("Updates for %d containers are downloaded and waiting to be applied", len(state.Staged))
 	}
 }
 
-func runUpdatesWithNotifications(filter t.Filter) *metrics.Metric {
+func runApplyWithNotifications(workflow *actions.UpdateWorkflow, retrier *actions.Retrier) *metrics.Metric {
 	notifier.StartNotification()
-	updateParams := t.UpdateParams{
-		Filter:          filter,
-		Cleanup:         cleanup,
-		NoRestart:       noRestart,
-		Timeout:         timeout,
-		MonitorOnly:     monitorOnly,
-		LifecycleHooks:  lifecycleHooks,
-		RollingRestart:  rollingRestart,
-		LabelPrecedence: labelPrecedence,
-		NoPull:          noPull,
+	result, state, err := workflow.Apply()
+	if err != nil {
+		log.Error(err)
 	}
+	if result == nil {
+		notifier.SendNotification(nil)
+		return &metrics.Metric{}
+	}
+	notifier.SendNotification(result)
+	workflow.RetryApply(retrier, result)
+	metricResults := metrics.NewMetric(result)
+	notifications.LocalLog.WithFields(log.Fields{
+		"Scanned": metricResults.Scanned,
+		"Updated": metricResults.Updated,
+		"Failed":  metricResults.Failed,
+		"Phase":   state.Phase,
+	}).Info("Session done")
+	return metricResults
+}
+
+func runUpdatesWithNotifications(updateParams t.UpdateParams) *metrics.Metric {
+	notifier.StartNotification()
 	// Run and check for updated on the cloud. Do not attempt to load local image
 	log.Info("Update requested. Updating...")
 	result, err := actions.Update(client, updateParams)
@@ -0,0 +1,117 @@
+package actions
+
+import (
+	"time"
+
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/filters"
+	"github.com/containrrr/watchtower/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// setChannels selects the image tags of the containers tracking the release channel of the device role
+func setChannels(containers []types.Container, roles types.RoleSource) error {
+	if roles == nil {
+		return nil
+	}
+	role, err := roles.Role()
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		c.SetChannel(role)
+	}
+	return nil
+}
+
+// SwitchChannel recreates the containers that run the image of another release channel than the
+// one of the device role from the image of its channel
+func SwitchChannel(client container.Client, params types.UpdateParams) (types.Report, error) {
+	if params.Roles == nil {
+		return nil, nil
+	}
+	role, err := params.Roles.Role()
+	if err != nil {
+		return nil, err
+	}
+	containers, err := client.ListContainers(params.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, c := range containers {
+		current := c.ImageName()
+		c.SetChannel(role)
+		if c.ImageName() != current {
+			log.WithFields(log.Fields{"container": c.Name(), "from": current, "to": c.ImageName()}).Info("Switching the release channel")
+			names = append(names, c.Name())
+		}
+	}
+	if len(names) == 0 {
+		log.Debug("All containers run the image of their release channel")
+		return nil, nil
+	}
+
+	params.Filter = filters.FilterByNames(names, params.Filter)
+	return Update(client, params)
+}
+
+// ChannelMonitor switches the containers to the release channel of the device whenever its role changes
+type ChannelMonitor struct {
+	Client   container.Client
+	Params   types.UpdateParams
+	Notifier types.Notifier
+	// Lock is shared with the other updates, the channel is switched once they are done
+	Lock chan bool
+	role string
+}
+
+// Run checks the role of the device once every interval. It never returns.
+func (m *ChannelMonitor) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for ; true; <-ticker.C {
+		if _, err := m.Check(); err != nil {
+			log.WithError(err).Error("Unable to switch the release channel")
+		}
+	}
+}
+
+// Check switches the containers to the release channel of the device role, if the role changed
+// since the last check. The first check switches the containers that do not track the role yet.
+// A deferred switch is tried again on the next check.
+func (m *ChannelMonitor) Check() (types.Report, error) {
+	role, err := m.Params.Roles.Role()
+	if err != nil {
+		return nil, err
+	}
+	if role == m.role {
+		return nil, nil
+	}
+	if m.role != "" {
+		log.WithFields(log.Fields{"from": m.role, "to": role}).Info("The device role changed, switching the release channel")
+	}
+
+	if m.Lock != nil {
+		v := <-m.Lock
+		defer func() { m.Lock <- v }()
+	}
+	if m.Notifier != nil {
+		m.Notifier.StartNotification()
+	}
+	report, err := SwitchChannel(m.Client, m.Params)
+	if m.Notifier != nil {
+		m.Notifier.SendNotification(report)
+	}
+	if err != nil {
+		return report, err
+	}
+	if report != nil && len(report.Deferred()) > 0 {
+		// Switched on a later check, once the update is allowed
+		return report, nil
+	}
+	m.role = role
+	return report, nil
+}
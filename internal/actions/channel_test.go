@@ -0,0 +1,93 @@
+package actions_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/device"
+	"github.com/containrrr/watchtower/pkg/filters"
+	"github.com/containrrr/watchtower/pkg/stack"
+	"github.com/containrrr/watchtower/pkg/types"
+	dockerContainer "github.com/docker/docker/api/types/container"
+
+	. "github.com/containrrr/watchtower/internal/actions/mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("release channels", func() {
+	var dir string
+	var client MockClient
+	var monitor *actions.ChannelMonitor
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "channel")
+		Expect(err).NotTo(HaveOccurred())
+
+		client = CreateMockClient(&TestData{
+			Containers: []types.Container{
+				CreateMockContainerWithConfig("planner-id", "/planner", "robot/planner:nightly", true, false, time.Now(), &dockerContainer.Config{
+					Image: "robot/planner:nightly",
+					Labels: map[string]string{
+						"com.centurylinklabs.watchtower.channels": "nightly=nightly,production=stable",
+					},
+				}),
+				CreateMockContainerWithConfig("driver-id", "/driver", "robot/driver:2.1", true, false, time.Now(), &dockerContainer.Config{
+					Image:  "robot/driver:2.1",
+					Labels: map[string]string{},
+				}),
+			},
+		}, false, false)
+		monitor = &actions.ChannelMonitor{
+			Client: client,
+			Params: types.UpdateParams{
+				Filter: filters.NoFilter,
+				Roles:  device.RoleSource{Default: device.Nightly, File: filepath.Join(dir, "role")},
+			},
+		}
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should leave the containers already tracking the role alone", func() {
+		report, err := monitor.Check()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report).To(BeNil())
+		Expect(client.TestData.StoppedContainers).To(BeEmpty())
+	})
+
+	It("should recreate the containers tracking a channel when the role changes", func() {
+		_, err := monitor.Check()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.WriteFile(filepath.Join(dir, "role"), []byte("production"), 0644)).To(Succeed())
+		report, err := monitor.Check()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report).NotTo(BeNil())
+		images := []string{}
+		for _, c := range report.Updated() {
+			images = append(images, c.ImageName())
+		}
+		Expect(images).To(ContainElement("robot/planner:stable"))
+		Expect(client.TestData.StoppedContainers).To(ContainElement("planner"))
+	})
+	It("should record the image of the new channel for the stack services", func() {
+		store := stack.NewStore(dir)
+		Expect(store.Save(stack.State{Services: []container.Service{{Name: "planner", Image: "robot/planner:nightly"}}})).To(Succeed())
+		client.TestData.Containers[0].ContainerInfo().Config.Labels["com.centurylinklabs.watchtower.stack.service"] = "planner"
+		monitor.Params.Stack = store
+
+		Expect(os.WriteFile(filepath.Join(dir, "role"), []byte("production"), 0644)).To(Succeed())
+		_, err := monitor.Check()
+		Expect(err).NotTo(HaveOccurred())
+
+		state, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Services[0].Image).To(Equal("robot/planner:stable"))
+	})
+})
@@ -86,6 +86,26 @@ func cleanupExcessWatchtowers(containers []types.Container, client container.Cli
 	return nil
 }
 
-func CheckUpdatesReady() bool {
-	return true
+// CheckUpdatesReady returns whether updates are available for the containers, and all of them
+// have been downloaded so that they can be applied without reaching the registry
+func CheckUpdatesReady(client container.Client, params types.UpdateParams) (bool, error) {
+	statuses, err := CheckForUpdates(client, params)
+	if err != nil {
+		return false, err
+	}
+	return UpdatesReady(statuses), nil
+}
+
+// UpdatesReady returns whether any of the statuses has an update available, and every available update is downloaded
+func UpdatesReady(statuses []types.UpdateStatus) bool {
+	available := false
+	for _, status := range statuses {
+		if status.UpdateAvailable {
+			if !status.Downloaded {
+				return false
+			}
+			available = true
+		}
+	}
+	return available
 }
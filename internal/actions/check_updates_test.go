@@ -0,0 +1,57 @@
+package actions_test
+
+import (
+	"time"
+
+	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/pkg/filters"
+	"github.com/containrrr/watchtower/pkg/types"
+
+	. "github.com/containrrr/watchtower/internal/actions/mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("checking for updates", func() {
+	var client MockClient
+	params := types.UpdateParams{Filter: filters.NoFilter}
+
+	BeforeEach(func() {
+		client = CreateMockClient(&TestData{
+			Containers: []types.Container{
+				CreateMockContainer("planner-id", "/planner", "robot/planner:1.0", time.Now()),
+				CreateMockContainer("driver-id", "/driver", "robot/driver:2.1", time.Now()),
+				CreateMockContainer("mapper-id", "/mapper", "robot/mapper:3.0", time.Now()),
+			},
+			UpdateStatuses: map[string]types.UpdateStatus{},
+		}, false, false)
+	})
+
+	It("should report the status of every container, even after a failed check", func() {
+		client.TestData.UpdateStatuses["/planner"] = types.UpdateStatus{Container: "planner", Error: "registry unreachable"}
+		client.TestData.UpdateStatuses["/driver"] = types.UpdateStatus{Container: "driver", UpdateAvailable: true}
+
+		statuses, err := actions.CheckForUpdates(client, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statuses).To(HaveLen(3))
+		Expect(statuses[0].Error).To(Equal("registry unreachable"))
+		Expect(statuses[1].UpdateAvailable).To(BeTrue())
+		Expect(statuses[2].Container).To(Equal("mapper"))
+
+		Expect(actions.CheckForNewUpdateFromRegistry(client, params)).To(BeTrue())
+	})
+
+	It("should report no update when every image is up to date", func() {
+		Expect(actions.CheckForNewUpdateFromRegistry(client, params)).To(BeFalse())
+		Expect(actions.CheckUpdatesReady(client, params)).To(BeFalse())
+	})
+
+	It("should only be ready once every available update is downloaded", func() {
+		client.TestData.UpdateStatuses["/planner"] = types.UpdateStatus{UpdateAvailable: true, Downloaded: true}
+		client.TestData.UpdateStatuses["/driver"] = types.UpdateStatus{UpdateAvailable: true}
+		Expect(actions.CheckUpdatesReady(client, params)).To(BeFalse())
+
+		client.TestData.UpdateStatuses["/driver"] = types.UpdateStatus{UpdateAvailable: true, Downloaded: true}
+		Expect(actions.CheckUpdatesReady(client, params)).To(BeTrue())
+	})
+})
@@ -13,6 +13,7 @@ import (
 	"github.com/containrrr/watchtower/pkg/types"
 	dockerTypes "github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/strslice"
 	"github.com/docker/go-connections/nat"
@@ -37,7 +38,7 @@ func StopContainer(client containerService.Client, service *containerService.Ser
 		}
 		if container.Name()[1:] == service.ContainerName {
 			// 10 seconds stop timeout
-			err := client.StopContainer(container, 10)
+			err := client.StopContainer(container, 10*time.Second)
 			return err
 		}
 	}
@@ -150,43 +151,100 @@ func makeContainerCreateOptions(
 
 func makeContainerConfig(service *containerService.Service) container.Config {
 	return container.Config{
-		Hostname:   service.Hostname,
-		Domainname: service.Domainname,
-		User:       service.User,
-		Tty:        service.Tty,
-		Cmd:        strslice.StrSlice(service.Command),
-		Entrypoint: strslice.StrSlice(service.EntryPoint),
-		Image:      service.Image,
-		WorkingDir: service.WorkingDir,
-		StopSignal: "SIGTERM",
-		Env:        service.Environment,
+		Hostname:     service.Hostname,
+		Domainname:   service.Domainname,
+		User:         service.User,
+		Tty:          service.Tty,
+		Cmd:          strslice.StrSlice(service.Command),
+		Entrypoint:   strslice.StrSlice(service.EntryPoint),
+		Image:        service.Image,
+		WorkingDir:   service.WorkingDir,
+		StopSignal:   "SIGTERM",
+		Env:          service.Environment,
+		ExposedPorts: getExposedPorts(service),
+		Labels:       makeLabels(service),
+		Healthcheck:  makeHealthConfig(service),
+	}
+}
+
+// makeLabels returns the labels of the service, marking the container as managed by the stack reconciler
+// and recording the definition it was created from
+func makeLabels(service *containerService.Service) map[string]string {
+	labels := map[string]string{}
+	for key, value := range service.Labels {
+		labels[key] = value
+	}
+	labels[containerService.StackServiceLabel] = service.Name
+	labels[containerService.StackConfigHashLabel] = service.ConfigHash()
+	return labels
+}
+
+func makeHealthConfig(service *containerService.Service) *container.HealthConfig {
+	if service.Healthcheck == nil {
+		return nil
+	}
+	return &container.HealthConfig{
+		Test:        service.Healthcheck.Test,
+		Interval:    service.Healthcheck.Interval,
+		Timeout:     service.Healthcheck.Timeout,
+		StartPeriod: service.Healthcheck.StartPeriod,
+		Retries:     service.Healthcheck.Retries,
 	}
 }
 
 func makeNetworkConfig(service *containerService.Service) network.NetworkingConfig {
-	// If the current working environment is dev-related
-	// the we fuse the service network with host settings
 	endPointConfig := map[string]*network.EndpointSettings{}
+	for _, serviceNetwork := range service.Networks {
+		endpoint := &network.EndpointSettings{
+			// Other services reach the service by its name, just like with docker compose
+			Aliases: append([]string{service.Name}, serviceNetwork.Aliases...),
+		}
+		if serviceNetwork.IPv4 != "" || serviceNetwork.IPv6 != "" {
+			endpoint.IPAMConfig = &network.EndpointIPAMConfig{
+				IPv4Address: serviceNetwork.IPv4,
+				IPv6Address: serviceNetwork.IPv6,
+			}
+		}
+		endPointConfig[serviceNetwork.Name] = endpoint
+	}
 	return network.NetworkingConfig{
 		EndpointsConfig: endPointConfig,
 	}
 }
 
+// getNetworkMode returns the network mode requested by the service. Without a network mode,
+// the container joins its first network, or the default bridge network if it has none.
+func getNetworkMode(service *containerService.Service) container.NetworkMode {
+	switch {
+	case strings.HasPrefix(service.NetworkMode, "service:"):
+		// Services are referred to by their container name
+		return container.NetworkMode("container:" + strings.TrimPrefix(service.NetworkMode, "service:"))
+	case service.NetworkMode != "":
+		return container.NetworkMode(service.NetworkMode)
+	case len(service.Networks) > 0:
+		return container.NetworkMode(service.Networks[0].Name)
+	default:
+		return container.NetworkMode("default")
+	}
+}
+
 func makeHostConfig(service *containerService.Service) container.HostConfig {
 	// Prepare binding
 	extraHost := make([]string, 0)
 	return container.HostConfig{
 		AutoRemove:    false,
 		Binds:         prepareVolumeBinding(service),
+		Mounts:        makeMounts(service),
 		CapAdd:        service.CapAdd,
 		CapDrop:       service.CapDrop,
 		ExtraHosts:    extraHost,
-		NetworkMode:   container.NetworkMode("host"),
+		NetworkMode:   getNetworkMode(service),
 		RestartPolicy: getRestartPolicy(service),
 		LogConfig: container.LogConfig{
 			Type: "json-file",
 		},
 		IpcMode:      container.IpcMode(service.IpcMode),
+		PidMode:      container.PidMode(service.PidMode),
 		PortBindings: getPortBinding(service),
 		Resources:    getResouces(service),
 		Sysctls:      service.Sysctls,
@@ -197,6 +255,9 @@ func makeHostConfig(service *containerService.Service) container.HostConfig {
 func prepareVolumeBinding(service *containerService.Service) []string {
 	output := []string{}
 	for _, volume := range service.Volumes {
+		if volume.Type != containerService.VolumeTypeBind {
+			continue
+		}
 		if len(volume.Source) > 0 && len(volume.Destination) > 0 {
 			bindMount := volume.Source + ":" + volume.Destination
 			if len(volume.Option) > 0 {
@@ -208,6 +269,34 @@ func prepareVolumeBinding(service *containerService.Service) []string {
 	return output
 }
 
+// makeMounts returns the named volumes and tmpfs mounts of the service. Bind mounts are passed as binds instead.
+func makeMounts(service *containerService.Service) []mount.Mount {
+	output := []mount.Mount{}
+	for _, volume := range service.Volumes {
+		switch volume.Type {
+		case containerService.VolumeTypeVolume:
+			output = append(output, mount.Mount{
+				Type:          mount.TypeVolume,
+				Source:        volume.Source,
+				Target:        volume.Destination,
+				ReadOnly:      volume.ReadOnly,
+				VolumeOptions: &mount.VolumeOptions{NoCopy: volume.NoCopy},
+			})
+		case containerService.VolumeTypeTmpfs:
+			output = append(output, mount.Mount{
+				Type:     mount.TypeTmpfs,
+				Target:   volume.Destination,
+				ReadOnly: volume.ReadOnly,
+				TmpfsOptions: &mount.TmpfsOptions{
+					SizeBytes: volume.TmpfsSize,
+					Mode:      volume.TmpfsMode,
+				},
+			})
+		}
+	}
+	return output
+}
+
 func getRestartPolicy(service *containerService.Service) container.RestartPolicy {
 	restart := container.RestartPolicy{}
 	if service.Restart != "" {
@@ -238,35 +327,40 @@ func getPortBinding(service *containerService.Service) nat.PortMap {
 	return bindingMap
 }
 
+// getExposedPorts returns the ports exposed by the service, including all published ports
+func getExposedPorts(service *containerService.Service) nat.PortSet {
+	exposed, _, err := nat.ParsePortSpecs(service.Expose)
+	if err != nil {
+		log.WithField("service", service.Name).Warnf("Ignoring invalid exposed ports: %v", err)
+		exposed = nat.PortSet{}
+	}
+	for _, port := range service.Ports {
+		exposed[nat.Port(port.Target+"/"+port.Protocol)] = struct{}{}
+	}
+	return exposed
+}
+
 func getResouces(service *containerService.Service) container.Resources {
 	serviceResources := service.Resources
 	deviceMappingList := []container.DeviceMapping{}
 	for _, device := range service.Devices {
-		deviceSplit := strings.Split(device, ":")
-		deviceMapping := container.DeviceMapping{
-			CgroupPermissions: "rwm",
-		}
-		switch len(deviceSplit) {
-		case 3:
-			deviceMapping.CgroupPermissions = deviceSplit[2]
-			fallthrough
-		case 2:
-			deviceMapping.PathInContainer = deviceSplit[1]
-			fallthrough
-		case 1:
-			deviceMapping.PathInContainer = deviceSplit[0]
+		mappings, err := containerService.ResolveDevice(device)
+		if err != nil {
+			log.WithField("service", service.Name).Warnf("Skipping device: %v", err)
+			continue
 		}
-		deviceMappingList = append(deviceMappingList, deviceMapping)
+		deviceMappingList = append(deviceMappingList, mappings...)
 	}
 
 	resources := container.Resources{
-		CgroupParent:   service.CgroupParent,
-		OomKillDisable: &serviceResources.OomKillDisable,
-		Devices:        deviceMappingList,
-		CPUPeriod:      serviceResources.CPUPeriod,
-		CPUQuota:       serviceResources.CPUQuota,
-		CpusetCpus:     serviceResources.CpusetCpus,
-		Memory:         serviceResources.MemoryLimit,
+		CgroupParent:      service.CgroupParent,
+		OomKillDisable:    &serviceResources.OomKillDisable,
+		Devices:           deviceMappingList,
+		DeviceCgroupRules: service.DeviceCgroupRules,
+		CPUPeriod:         serviceResources.CPUPeriod,
+		CPUQuota:          serviceResources.CPUQuota,
+		CpusetCpus:        serviceResources.CpusetCpus,
+		Memory:            serviceResources.MemoryLimit,
 	}
 
 	return resources
@@ -0,0 +1,183 @@
+package actions
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/filters"
+	"github.com/containrrr/watchtower/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// checkGate returns why every container that would be restarted has to wait, if the update gate
+// does not allow containers to be stopped right now
+func checkGate(containers []types.Container, params types.UpdateParams) map[types.ContainerID]error {
+	if params.Gate == nil || params.NoRestart {
+		return nil
+	}
+	restarting := []types.Container{}
+	for _, c := range containers {
+		if c.ToRestart() {
+			restarting = append(restarting, c)
+		}
+	}
+	if len(restarting) == 0 {
+		return nil
+	}
+
+	reason := params.Gate.Allow()
+	if reason == nil {
+		return nil
+	}
+	log.Infof("Deferring the update of %d containers: %v", len(restarting), reason)
+	deferrals := make(map[types.ContainerID]error, len(restarting))
+	for _, c := range restarting {
+		deferrals[c.ID()] = reason
+	}
+	return deferrals
+}
+
+// deferredParams returns the parameters that update only the deferred containers of the report,
+// to the images they were deferred with
+func deferredParams(params types.UpdateParams, report types.Report) types.UpdateParams {
+	names := []string{}
+	versionTags := map[string]string{}
+	for _, c := range report.Deferred() {
+		name := strings.TrimPrefix(c.Name(), "/")
+		names = append(names, name)
+		versionTags[name] = imageTag(c.ImageName())
+	}
+	// The images are already present, so they must not be pulled again
+	params.NoPull = true
+	params.Filter = filters.FilterByNames(names, params.Filter)
+	params.VersionTags = versionTags
+	return params
+}
+
+// RetryDeferred retries the update of the containers the report deferred, if it deferred any.
+// The retried update does not pull the images again.
+func RetryDeferred(retrier *Retrier, client container.Client, params types.UpdateParams, report types.Report) {
+	if report == nil || len(report.Deferred()) == 0 {
+		return
+	}
+	retryParams := deferredParams(params, report)
+	retrier.Retry(report, func() (types.Report, error) {
+		return Update(client, retryParams)
+	})
+}
+
+// deferralReason returns why the report deferred its containers, or an empty string if it did not
+func deferralReason(report types.Report) string {
+	if report == nil || len(report.Deferred()) == 0 {
+		return ""
+	}
+	return report.Deferred()[0].Error()
+}
+
+// DefaultRetryInterval is how often deferred updates are retried if the interval is not positive
+const DefaultRetryInterval = time.Minute
+
+// Retrier runs deferred updates again once every interval, until they are no longer deferred
+type Retrier struct {
+	Interval time.Duration
+	// Gate is checked before every retry, if set. The update is only run again, and notified, once
+	// the gate allows it or defers it for another reason than the last time.
+	Gate types.UpdateGate
+	// Windows delays the retries outside of the maintenance windows until the next one opens, if set
+	Windows  types.WindowSchedule
+	Notifier types.Notifier
+	// Lock is shared with the other updates, a retry waits for them to be done
+	Lock chan bool
+
+	mutex sync.Mutex
+	next  func() (types.Report, error)
+	// reason is why the update being retried was last deferred
+	reason string
+	// generation counts the deferred updates, to tell whether the one being retried was replaced
+	generation int
+}
+
+// Retry runs the update again after the interval, for as long as it defers containers. Only the
+// latest deferred update is retried, it replaces the one that was waiting. The report is the one
+// that deferred the update. A nil Retrier does not retry.
+func (r *Retrier) Retry(report types.Report, update func() (types.Report, error)) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	waiting := r.next != nil
+	r.next = update
+	r.reason = deferralReason(report)
+	r.generation++
+	if !waiting {
+		go r.run()
+	}
+}
+
+func (r *Retrier) run() {
+	for {
+		time.Sleep(r.delay(time.Now()))
+		r.mutex.Lock()
+		update, reason, generation := r.next, r.reason, r.generation
+		r.mutex.Unlock()
+
+		reason = r.attempt(update, reason)
+
+		r.mutex.Lock()
+		// Keep retrying while the update is deferred, or if another one was deferred in the meantime
+		if generation == r.generation {
+			if reason == "" {
+				r.next = nil
+				r.mutex.Unlock()
+				return
+			}
+			r.reason = reason
+		}
+		r.mutex.Unlock()
+	}
+}
+
+// delay returns how long to wait before the next retry: until the next maintenance window opens
+// if the time is outside of the windows, and the interval otherwise
+func (r *Retrier) delay(now time.Time) time.Duration {
+	if r.Windows != nil {
+		if next := r.Windows.NextWindow(now); next.After(now) {
+			return next.Sub(now)
+		}
+	}
+	// Retrying without a delay would keep the lock busy
+	if r.Interval <= 0 {
+		return DefaultRetryInterval
+	}
+	return r.Interval
+}
+
+// attempt runs the update again, unless the gate still defers it for the same reason. It returns
+// why the update is still deferred, or an empty string if it went through.
+func (r *Retrier) attempt(update func() (types.Report, error), reason string) string {
+	if r.Lock != nil {
+		v := <-r.Lock
+		defer func() { r.Lock <- v }()
+	}
+	if r.Gate != nil {
+		if err := r.Gate.Allow(); err != nil && err.Error() == reason {
+			log.WithField("reason", reason).Debug("The update is still deferred")
+			return reason
+		}
+	}
+	log.Info("Retrying the deferred update")
+	if r.Notifier != nil {
+		r.Notifier.StartNotification()
+	}
+	report, err := update()
+	if err != nil {
+		log.WithError(err).Error("Unable to retry the deferred update")
+	}
+	if r.Notifier != nil {
+		r.Notifier.SendNotification(report)
+	}
+	return deferralReason(report)
+}
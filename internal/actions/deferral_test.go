@@ -0,0 +1,176 @@
+package actions_test
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/pkg/filters"
+	"github.com/containrrr/watchtower/pkg/types"
+	"github.com/containrrr/watchtower/pkg/update"
+	dockerContainer "github.com/docker/docker/api/types/container"
+
+	. "github.com/containrrr/watchtower/internal/actions/mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// busyGate defers the updates for as many checks as it is busy for
+type busyGate struct {
+	mutex sync.Mutex
+	busy  int
+}
+
+func (g *busyGate) Allow() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.busy > 0 {
+		g.busy--
+		return errors.New("the robot is busy")
+	}
+	return nil
+}
+
+// countingNotifier counts the notifications it sends
+type countingNotifier struct {
+	mutex sync.Mutex
+	sent  int
+}
+
+func (n *countingNotifier) StartNotification() {}
+func (n *countingNotifier) SendNotification(types.Report) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.sent++
+}
+func (n *countingNotifier) AddLogHook()        {}
+func (n *countingNotifier) GetNames() []string { return nil }
+func (n *countingNotifier) GetURLs() []string  { return nil }
+func (n *countingNotifier) Close()             {}
+
+func (n *countingNotifier) Sent() int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.sent
+}
+
+// nextWindow is a maintenance window schedule that opens a window after a delay
+type nextWindow time.Duration
+
+func (w nextWindow) NextWindow(t time.Time) time.Time {
+	return t.Add(time.Duration(w))
+}
+
+var _ = Describe("deferred updates", func() {
+	var client MockClient
+	var gate *busyGate
+
+	BeforeEach(func() {
+		client = CreateMockClient(getCommonTestData(""), false, false)
+		gate = &busyGate{busy: 1}
+	})
+
+	It("should defer the update without stopping containers while the gate does not allow it", func() {
+		report, err := actions.Update(client, types.UpdateParams{Filter: filters.NoFilter, Gate: gate})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Deferred()).NotTo(BeEmpty())
+		Expect(report.Deferred()[0].State()).To(Equal("Deferred"))
+		Expect(report.Deferred()[0].Error()).To(Equal("the robot is busy"))
+		Expect(report.Updated()).To(BeEmpty())
+		Expect(client.TestData.StoppedContainers).To(BeEmpty())
+	})
+
+	It("should update the containers once the gate allows it", func() {
+		gate.busy = 0
+		report, err := actions.Update(client, types.UpdateParams{Filter: filters.NoFilter, Gate: gate})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Deferred()).To(BeEmpty())
+		Expect(client.TestData.StoppedContainers).NotTo(BeEmpty())
+	})
+
+	It("should retry the deferred update until it goes through", func() {
+		gate.busy = 2
+		params := types.UpdateParams{Filter: filters.NoFilter, Gate: gate}
+		report, err := actions.Update(client, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Deferred()).NotTo(BeEmpty())
+
+		retrier := &actions.Retrier{Interval: 10 * time.Millisecond}
+		actions.RetryDeferred(retrier, client, params, report)
+		Eventually(func() []string { return client.TestData.StoppedContainers }).ShouldNot(BeEmpty())
+	})
+
+	It("should not retry right away without a retry interval", func() {
+		params := types.UpdateParams{Filter: filters.NoFilter, Gate: gate}
+		report, err := actions.Update(client, params)
+		Expect(err).NotTo(HaveOccurred())
+
+		retrier := &actions.Retrier{}
+		actions.RetryDeferred(retrier, client, params, report)
+		Consistently(func() []string { return client.TestData.StoppedContainers }, 50*time.Millisecond).Should(BeEmpty())
+	})
+
+	It("should only notify the retry once the update is no longer deferred for the same reason", func() {
+		gate.busy = 5
+		params := types.UpdateParams{Filter: filters.NoFilter, Gate: gate}
+		report, err := actions.Update(client, params)
+		Expect(err).NotTo(HaveOccurred())
+
+		notifier := &countingNotifier{}
+		retrier := &actions.Retrier{Interval: 10 * time.Millisecond, Gate: gate, Notifier: notifier}
+		actions.RetryDeferred(retrier, client, params, report)
+		Eventually(func() []string { return client.TestData.StoppedContainers }).ShouldNot(BeEmpty())
+		Consistently(notifier.Sent, 50*time.Millisecond).Should(Equal(1))
+	})
+
+	It("should retry an update deferred outside of the maintenance windows once the next window opens", func() {
+		params := types.UpdateParams{Filter: filters.NoFilter, Gate: gate}
+		report, err := actions.Update(client, params)
+		Expect(err).NotTo(HaveOccurred())
+
+		retrier := &actions.Retrier{Interval: time.Hour, Windows: nextWindow(10 * time.Millisecond)}
+		actions.RetryDeferred(retrier, client, params, report)
+		Eventually(func() []string { return client.TestData.StoppedContainers }).ShouldNot(BeEmpty())
+	})
+
+	It("should keep a deferred update downloaded", func() {
+		dir, err := os.MkdirTemp("", "deferral")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		machine, err := update.NewMachine(dir)
+		Expect(err).NotTo(HaveOccurred())
+		client = CreateMockClient(&TestData{
+			Containers: []types.Container{
+				CreateMockContainerWithConfig("planner-id", "/planner", "robot/planner:1.0", true, false, time.Now(), &dockerContainer.Config{
+					Image:  "robot/planner:1.0",
+					Labels: map[string]string{},
+				}),
+			},
+			UpdateStatuses: map[string]types.UpdateStatus{
+				"/planner": {Container: "planner", UpdateAvailable: true},
+			},
+		}, false, false)
+		workflow := &actions.UpdateWorkflow{
+			Client:  client,
+			Machine: machine,
+			Params:  types.UpdateParams{Filter: filters.NoFilter, Gate: gate},
+		}
+
+		state, err := workflow.Download()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Phase).To(Equal(update.PhaseDownloaded))
+
+		report, state, err := workflow.Apply()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Deferred()).NotTo(BeEmpty())
+		Expect(state.Phase).To(Equal(update.PhaseDownloaded))
+		Expect(state.Error).To(ContainSubstring("the robot is busy"))
+		Expect(state.Staged).To(HaveLen(1))
+
+		_, state, err = workflow.Apply()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Phase).To(Equal(update.PhaseDone))
+	})
+})
@@ -2,6 +2,7 @@ package actions
 
 import (
 	"encoding/json"
+	"sync"
 	"time"
 
 	containerService "github.com/containrrr/watchtower/pkg/container"
@@ -12,8 +13,8 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func GetDeviceInfo(client containerService.Client) types.Device {
-	device, err := device.MakeDevice()
+func GetDeviceInfo(client containerService.Client, roles device.RoleSource) types.Device {
+	device, err := device.MakeDevice(roles)
 	if err != nil {
 		log.Error(err)
 	}
@@ -28,7 +29,12 @@ func GetDeviceInfo(client containerService.Client) types.Device {
 	return *device
 }
 
-func BroadcastHardwareStatus(conn *websocket.Conn, client containerService.Client, freq float64) {
+// GetPowerStatus reads the battery or power sensor of the device
+func GetPowerStatus(reader *device.PowerReader) (types.PowerStatus, error) {
+	return reader.GetPowerStatus()
+}
+
+func BroadcastHardwareStatus(conn *websocket.Conn, collector *device.HardwareCollector, freq float64) {
 	defer func() {
 		if err := conn.Close(); err != nil {
 			log.Error("Unable to close websocket connection")
@@ -37,8 +43,9 @@ func BroadcastHardwareStatus(conn *websocket.Conn, client containerService.Clien
 	}()
 
 	for {
-		resources, err := device.GetHardwareStatus()
+		resources, err := collector.GetHardwareStatus()
 		if err != nil {
+			log.Error(err)
 			return
 		}
 		data, _ := json.Marshal(resources)
@@ -49,3 +56,126 @@ func BroadcastHardwareStatus(conn *websocket.Conn, client containerService.Clien
 		time.Sleep(time.Duration(1/freq) * time.Second)
 	}
 }
+
+// DeviceChange is sent to the subscribers of a DeviceMonitor whenever devices are plugged in or unplugged
+type DeviceChange struct {
+	Events   []device.DeviceEvent `json:"events"`
+	Services []ServiceResult      `json:"services"`
+}
+
+// DeviceMonitor remaps the devices of the stack containers whenever a device is plugged in or unplugged
+type DeviceMonitor struct {
+	Watcher     *device.DeviceWatcher
+	Reconciler  *Reconciler
+	Notifier    types.Notifier
+	subscribers map[chan DeviceChange]bool
+	sync.Mutex
+}
+
+// Run records the current device nodes, then watches the devices once every interval. It never returns.
+func (m *DeviceMonitor) Run(interval time.Duration) {
+	if _, err := m.Reconciler.RemapDevices(); err != nil {
+		log.WithError(err).Error("Unable to check the stack devices")
+	}
+	m.Watcher.Run(interval, func(events []device.DeviceEvent) {
+		m.HandleEvents(events)
+	})
+}
+
+// HandleEvents remaps the devices of the stack containers, notifies about every affected
+// service and publishes the change to the subscribers
+func (m *DeviceMonitor) HandleEvents(events []device.DeviceEvent) DeviceChange {
+	for _, event := range events {
+		log.WithFields(log.Fields{"device": event.Device, "action": event.Action}).Debug("Device changed")
+	}
+
+	change := DeviceChange{Events: events}
+	results, err := m.Reconciler.RemapDevices()
+	if err != nil {
+		log.WithError(err).Error("Unable to remap the stack devices")
+	}
+	change.Services = results
+
+	if len(results) > 0 {
+		if m.Notifier != nil {
+			m.Notifier.StartNotification()
+		}
+		for _, result := range results {
+			fields := log.Fields{"service": result.Service, "container": result.Container}
+			if result.Failed() {
+				log.WithFields(fields).Errorf("Unable to remap the devices of the service: %s", result.Error)
+			} else {
+				log.WithFields(fields).Warnf("Service %s after its devices changed", result.Result)
+			}
+		}
+		if m.Notifier != nil {
+			m.Notifier.SendNotification(nil)
+		}
+	}
+
+	m.publish(change)
+	return change
+}
+
+// Subscribe returns a channel receiving every device change, until it is unsubscribed
+func (m *DeviceMonitor) Subscribe() chan DeviceChange {
+	m.Lock()
+	defer m.Unlock()
+	if m.subscribers == nil {
+		m.subscribers = map[chan DeviceChange]bool{}
+	}
+	changes := make(chan DeviceChange, 8)
+	m.subscribers[changes] = true
+	return changes
+}
+
+// Unsubscribe stops sending changes to the channel and closes it
+func (m *DeviceMonitor) Unsubscribe(changes chan DeviceChange) {
+	m.Lock()
+	defer m.Unlock()
+	if m.subscribers[changes] {
+		delete(m.subscribers, changes)
+		close(changes)
+	}
+}
+
+func (m *DeviceMonitor) publish(change DeviceChange) {
+	m.Lock()
+	defer m.Unlock()
+	for changes := range m.subscribers {
+		// Slow subscribers miss changes rather than holding up the monitor
+		select {
+		case changes <- change:
+		default:
+		}
+	}
+}
+
+// BroadcastDeviceChanges sends every device change to the WebSocket connection, until it is closed
+func BroadcastDeviceChanges(conn *websocket.Conn, monitor *DeviceMonitor) {
+	changes := monitor.Subscribe()
+	defer func() {
+		monitor.Unsubscribe(changes)
+		if err := conn.Close(); err != nil {
+			log.Error("Unable to close websocket connection")
+		}
+		log.Info("Connection closed")
+	}()
+
+	// The client never sends anything, reading only notices when it goes away
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				monitor.Unsubscribe(changes)
+				return
+			}
+		}
+	}()
+
+	for change := range changes {
+		data, _ := json.Marshal(change)
+		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package actions
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/containrrr/watchtower/pkg/bundle"
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+var unsafeFileCharacters = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// exportedImage is an image to export, with the tags and containers using it
+type exportedImage struct {
+	id       types.ImageID
+	tags     []string
+	services []string
+}
+
+// ExportBundle saves the images of the containers matching the filter into a new bundle directory,
+// so that they can be carried to robots that cannot reach a registry. The bundle is signed with
+// the key, unless it is nil.
+func ExportBundle(client container.Client, filter types.Filter, dir string, name string, key ed25519.PrivateKey) (*bundle.Bundle, error) {
+	containers, err := client.ListContainers(filter)
+	if err != nil {
+		return nil, err
+	}
+	images := exportedImages(containers)
+	if len(images) == 0 {
+		return nil, errors.New("no containers with images to export")
+	}
+
+	writer, err := bundle.NewWriter(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := writeBundle(client, writer, images, key)
+	if err != nil {
+		// Do not leave a partial bundle behind on the media
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if key == nil {
+		log.WithField("path", dir).Warn("The exported bundle is not signed, and has to be signed before it can be loaded")
+	}
+	return b, nil
+}
+
+func writeBundle(client container.Client, writer *bundle.Writer, images []exportedImage, key ed25519.PrivateKey) (*bundle.Bundle, error) {
+	for _, image := range images {
+		log.WithField("image", strings.Join(image.tags, ", ")).Info("Exporting image")
+		archive, err := client.SaveImage(image.tags)
+		if err != nil {
+			return nil, fmt.Errorf("could not save image %s: %w", image.tags[0], err)
+		}
+		err = writer.AddImage(bundle.Image{
+			File:     "images/" + unsafeFileCharacters.ReplaceAllString(image.tags[0], "_") + ".tar",
+			Digest:   string(image.id),
+			Tags:     image.tags,
+			Services: image.services,
+		}, archive)
+		archive.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not write image %s: %w", image.tags[0], err)
+		}
+	}
+	return writer.Close(key)
+}
+
+// exportedImages groups the containers by image. Images are exported by their tags, as the
+// tags are lost when exporting by ID.
+func exportedImages(containers []types.Container) []exportedImage {
+	byID := map[types.ImageID]*exportedImage{}
+	ids := []types.ImageID{}
+	for _, c := range containers {
+		fields := log.Fields{"container": c.Name(), "image": c.ImageName()}
+		if !c.HasImageInfo() {
+			log.WithFields(fields).Warn("Skipping container without image info")
+			continue
+		}
+		if strings.HasPrefix(c.ImageName(), "sha256:") {
+			log.WithFields(fields).Warn("Skipping container that was not started from a tagged image")
+			continue
+		}
+
+		image, found := byID[c.ImageID()]
+		if !found {
+			image = &exportedImage{id: c.ImageID()}
+			byID[c.ImageID()] = image
+			ids = append(ids, c.ImageID())
+		}
+		if !containsAll(image.tags, []string{c.ImageName()}) {
+			image.tags = append(image.tags, c.ImageName())
+		}
+		image.services = append(image.services, strings.TrimPrefix(c.Name(), "/"))
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	images := make([]exportedImage, 0, len(ids))
+	for _, id := range ids {
+		sort.Strings(byID[id].tags)
+		sort.Strings(byID[id].services)
+		images = append(images, *byID[id])
+	}
+	return images
+}
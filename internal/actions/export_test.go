@@ -0,0 +1,77 @@
+package actions_test
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/pkg/filters"
+	"github.com/containrrr/watchtower/pkg/types"
+	dockerTypes "github.com/docker/docker/api/types"
+
+	. "github.com/containrrr/watchtower/internal/actions/mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	plannerImageID = "sha256:c4e8a2f6d0b3e7a1c5f9d2b6e0a4c8f1d5b9e3a7c2f6d0b4e8a1c5f9d3b7e2a6"
+	driverImageID  = "sha256:5b8e2f1a9c3d7e4b6a0f2d8c1e5b9a3f7d2c6e0a4b8f1d5c9e3a7b2f6d0c4e8a"
+)
+
+var _ = Describe("the export action", func() {
+	var dir string
+	var client MockClient
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "export")
+		Expect(err).NotTo(HaveOccurred())
+		client = CreateMockClient(&TestData{
+			Containers: []types.Container{
+				CreateMockContainerWithImageInfo("planner-id", "/planner", "robot/planner:1.0", time.Now(), dockerTypes.ImageInspect{ID: plannerImageID}),
+				CreateMockContainerWithImageInfo("driver-id", "/driver", "robot/driver:2.1", time.Now(), dockerTypes.ImageInspect{ID: driverImageID}),
+			},
+		}, false, false)
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should save the image of every container into a signed bundle", func() {
+		publicKey, privateKey, err := ed25519.GenerateKey(nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		b, err := actions.ExportBundle(client, filters.NoFilter, filepath.Join(dir, "fleet"), "fleet", privateKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.TestData.SavedImages).To(Equal([][]string{{"robot/driver:2.1"}, {"robot/planner:1.0"}}))
+		Expect(b.Manifest.Images).To(HaveLen(2))
+		Expect(b.Manifest.Images[0].File).To(Equal("images/robot_driver_2.1.tar"))
+		Expect(b.Manifest.Images[0].Services).To(Equal([]string{"driver"}))
+		Expect(b.Manifest.Images[1].Tags).To(Equal([]string{"robot/planner:1.0"}))
+		Expect(filepath.Join(dir, "fleet", "images", "robot_planner_1.0.tar")).To(BeARegularFile())
+		Expect(b.Manifest.Images[0].Digest).To(Equal(driverImageID))
+		Expect(b.Verify([]ed25519.PublicKey{publicKey})).To(Succeed())
+	})
+
+	It("should group the containers by image and skip untagged images", func() {
+		client.TestData.Containers = append(client.TestData.Containers,
+			CreateMockContainerWithImageInfo("planner-2-id", "/planner-2", "robot/planner:1.0", time.Now(), dockerTypes.ImageInspect{ID: plannerImageID}),
+			CreateMockContainer("debug-id", "/debug", "sha256:0123456789abcdef", time.Now()))
+
+		b, err := actions.ExportBundle(client, filters.NoFilter, filepath.Join(dir, "planner"), "planner", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.TestData.SavedImages).To(HaveLen(2))
+		Expect(b.Manifest.Images[1].Services).To(Equal([]string{"planner", "planner-2"}))
+		Expect(filepath.Join(dir, "planner", "manifest.json.sig")).NotTo(BeAnExistingFile())
+	})
+
+	It("should not leave a bundle behind when there is nothing to export", func() {
+		client.TestData.Containers = nil
+		_, err := actions.ExportBundle(client, filters.NoFilter, filepath.Join(dir, "empty"), "empty", nil)
+		Expect(err).To(HaveOccurred())
+		Expect(filepath.Join(dir, "empty")).NotTo(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,112 @@
+package actions
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/types"
+)
+
+// ContainerStatus is the status of a container shown on the dashboard
+type ContainerStatus struct {
+	Name         string     `json:"name"`
+	ID           string     `json:"id"`
+	Image        string     `json:"image"`
+	ImageID      string     `json:"image_id"`
+	Digest       string     `json:"digest,omitempty"`
+	State        string     `json:"state"`
+	Health       string     `json:"health,omitempty"`
+	RestartCount int        `json:"restart_count"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	// Uptime is how long the container has been running, in seconds
+	Uptime  int64    `json:"uptime"`
+	Ports   []string `json:"ports"`
+	Devices []string `json:"devices"`
+	// Managed containers are updated by watchtower, unless they are monitor only, pinned or held
+	Managed     bool `json:"managed"`
+	MonitorOnly bool `json:"monitor_only"`
+	// Pinned containers use an image referenced by its ID or digest, which cannot be updated
+	Pinned bool `json:"pinned"`
+	Held   bool `json:"held"`
+}
+
+// ListContainers returns the status of every container accepted by the filter, including the
+// stopped and restarting ones. The update filter and the monitor-only settings of the params tell
+// which containers are managed by watchtower.
+func ListContainers(client container.Client, filter types.Filter, params types.UpdateParams) ([]ContainerStatus, error) {
+	containers, err := client.ListAllContainers(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]ContainerStatus, 0, len(containers))
+	for _, c := range containers {
+		statuses = append(statuses, containerStatus(c, params, time.Now()))
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses, nil
+}
+
+func containerStatus(c types.Container, params types.UpdateParams, now time.Time) ContainerStatus {
+	imageName := c.ImageName()
+	status := ContainerStatus{
+		Name:        strings.TrimPrefix(c.Name(), "/"),
+		ID:          string(c.ID()),
+		Image:       imageName,
+		ImageID:     string(c.SafeImageID()),
+		Ports:       []string{},
+		Devices:     []string{},
+		Managed:     params.Filter == nil || params.Filter(c),
+		MonitorOnly: c.IsMonitorOnly(params),
+		Pinned:      strings.HasPrefix(imageName, "sha256:") || strings.Contains(imageName, "@"),
+		Held:        params.Holds != nil && params.Holds.IsHeld(c.Name()),
+	}
+	if c.HasImageInfo() {
+		for _, repoDigest := range c.ImageInfo().RepoDigests {
+			if _, digest, found := strings.Cut(repoDigest, "@"); found {
+				status.Digest = digest
+				break
+			}
+		}
+	}
+
+	info := c.ContainerInfo()
+	if info == nil || info.ContainerJSONBase == nil {
+		return status
+	}
+	status.RestartCount = info.RestartCount
+	if state := info.State; state != nil {
+		status.State = state.Status
+		if state.Health != nil {
+			status.Health = state.Health.Status
+		}
+		if startedAt, err := time.Parse(time.RFC3339Nano, state.StartedAt); err == nil && !startedAt.IsZero() {
+			status.StartedAt = &startedAt
+			if state.Running {
+				status.Uptime = int64(now.Sub(startedAt).Seconds())
+			}
+		}
+	}
+	if info.NetworkSettings != nil {
+		for port, bindings := range info.NetworkSettings.Ports {
+			if len(bindings) == 0 {
+				status.Ports = append(status.Ports, string(port))
+			}
+			for _, binding := range bindings {
+				status.Ports = append(status.Ports, fmt.Sprintf("%s:%s->%s", binding.HostIP, binding.HostPort, port))
+			}
+		}
+		sort.Strings(status.Ports)
+	}
+	if info.HostConfig != nil {
+		for _, device := range info.HostConfig.Devices {
+			status.Devices = append(status.Devices, device.PathOnHost+":"+device.PathInContainer)
+		}
+	}
+	return status
+}
@@ -0,0 +1,109 @@
+package actions_test
+
+import (
+	"time"
+
+	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/filters"
+	"github.com/containrrr/watchtower/pkg/types"
+	dockerTypes "github.com/docker/docker/api/types"
+	dockerContainer "github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+
+	. "github.com/containrrr/watchtower/internal/actions/mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type listHolds map[string]bool
+
+func (h listHolds) IsHeld(name string) bool {
+	return h[name]
+}
+
+var _ = Describe("listing containers", func() {
+	startedAt := time.Now().Add(-90 * time.Second).UTC()
+
+	camera := container.NewContainer(&dockerTypes.ContainerJSON{
+		ContainerJSONBase: &dockerTypes.ContainerJSONBase{
+			ID:           "camera-id",
+			Name:         "/camera",
+			Image:        "sha256:c4m3r4",
+			RestartCount: 2,
+			State: &dockerTypes.ContainerState{
+				Status:    "running",
+				Running:   true,
+				StartedAt: startedAt.Format(time.RFC3339Nano),
+				Health:    &dockerTypes.Health{Status: "healthy"},
+			},
+			HostConfig: &dockerContainer.HostConfig{
+				Resources: dockerContainer.Resources{
+					Devices: []dockerContainer.DeviceMapping{{PathOnHost: "/dev/video0", PathInContainer: "/dev/camera"}},
+				},
+			},
+		},
+		Config: &dockerContainer.Config{
+			Image:  "robot/camera:1.2",
+			Labels: map[string]string{"com.centurylinklabs.watchtower.monitor-only": "true"},
+		},
+		NetworkSettings: &dockerTypes.NetworkSettings{
+			NetworkSettingsBase: dockerTypes.NetworkSettingsBase{
+				Ports: nat.PortMap{
+					"8080/tcp": {{HostIP: "0.0.0.0", HostPort: "18080"}},
+					"9090/tcp": nil,
+				},
+			},
+		},
+	}, &dockerTypes.ImageInspect{ID: "sha256:c4m3r4", RepoDigests: []string{"robot/camera@sha256:d1g35t"}})
+
+	pinned := CreateMockContainerWithConfig("arm-id", "/arm", "robot/arm@sha256:4rm", false, false, time.Now(), &dockerContainer.Config{
+		Image:  "robot/arm@sha256:4rm",
+		Labels: map[string]string{},
+	})
+
+	list := func(params types.UpdateParams) []actions.ContainerStatus {
+		client := CreateMockClient(&TestData{Containers: []types.Container{pinned, camera}}, false, false)
+		statuses, err := actions.ListContainers(client, filters.NoFilter, params)
+		Expect(err).NotTo(HaveOccurred())
+		return statuses
+	}
+
+	It("should report the rich status of every container, by name", func() {
+		statuses := list(types.UpdateParams{Filter: filters.NoFilter})
+		Expect(statuses).To(HaveLen(2))
+		arm, status := statuses[0], statuses[1]
+		Expect(arm.Name).To(Equal("arm"))
+
+		Expect(status.Name).To(Equal("camera"))
+		Expect(status.Image).To(Equal("robot/camera:1.2"))
+		Expect(status.ImageID).To(Equal("sha256:c4m3r4"))
+		Expect(status.Digest).To(Equal("sha256:d1g35t"))
+		Expect(status.State).To(Equal("running"))
+		Expect(status.Health).To(Equal("healthy"))
+		Expect(status.RestartCount).To(Equal(2))
+		Expect(status.StartedAt.Equal(startedAt)).To(BeTrue())
+		Expect(status.Uptime).To(BeNumerically("~", 90, 5))
+		Expect(status.Ports).To(Equal([]string{"0.0.0.0:18080->8080/tcp", "9090/tcp"}))
+		Expect(status.Devices).To(Equal([]string{"/dev/video0:/dev/camera"}))
+	})
+
+	It("should tell how watchtower manages every container", func() {
+		statuses := list(types.UpdateParams{
+			Filter: filters.FilterByNames([]string{"camera"}, filters.NoFilter),
+			Holds:  listHolds{"/arm": true},
+		})
+		arm, camera := statuses[0], statuses[1]
+
+		Expect(camera.Managed).To(BeTrue())
+		Expect(camera.MonitorOnly).To(BeTrue())
+		Expect(camera.Pinned).To(BeFalse())
+		Expect(camera.Held).To(BeFalse())
+
+		Expect(arm.Managed).To(BeFalse())
+		Expect(arm.MonitorOnly).To(BeFalse())
+		Expect(arm.Pinned).To(BeTrue())
+		Expect(arm.Held).To(BeTrue())
+		Expect(arm.Uptime).To(BeZero())
+	})
+})
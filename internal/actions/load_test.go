@@ -0,0 +1,161 @@
+package actions_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/pkg/bundle"
+	"github.com/containrrr/watchtower/pkg/types"
+
+	. "github.com/containrrr/watchtower/internal/actions/mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const bundleImageID = "9d1e3a5c7b2f4e6a8c0d1f3b5a7e9c2d4f6b8a0c1e3d5f7a9b2c4e6d8f0a1b3c"
+
+// testImage is an image written to a test bundle
+type testImage struct {
+	tag      string
+	id       string
+	services []string
+}
+
+// writeBundle writes a bundle with a single image archive tagged fake-image:latest, signed with the key
+func writeBundle(dir string, key ed25519.PrivateKey) []byte {
+	return writeBundleImages(dir, key, testImage{tag: "fake-image:latest", id: bundleImageID})[0]
+}
+
+// writeBundleImages writes a bundle with an archive for each image, signed with the key, and returns the archives
+func writeBundleImages(dir string, key ed25519.PrivateKey, images ...testImage) [][]byte {
+	archives := [][]byte{}
+	manifestImages := []bundle.Image{}
+	for i, image := range images {
+		var archive bytes.Buffer
+		tw := tar.NewWriter(&archive)
+		dockerManifest := []byte(`[{"Config": "` + image.id + `.json", "RepoTags": ["` + image.tag + `"]}]`)
+		Expect(tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(dockerManifest))})).To(Succeed())
+		_, err := tw.Write(dockerManifest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tw.Close()).To(Succeed())
+
+		file := fmt.Sprintf("image-%d.tar", i)
+		Expect(os.WriteFile(filepath.Join(dir, file), archive.Bytes(), 0644)).To(Succeed())
+		sum := sha256.Sum256(archive.Bytes())
+		manifestImages = append(manifestImages, bundle.Image{
+			File:     file,
+			SHA256:   hex.EncodeToString(sum[:]),
+			Digest:   "sha256:" + image.id,
+			Tags:     []string{image.tag},
+			Services: image.services,
+		})
+		archives = append(archives, archive.Bytes())
+	}
+
+	manifest, err := json.Marshal(bundle.Manifest{
+		Version: bundle.ManifestVersion,
+		Created: time.Now(),
+		Images:  manifestImages,
+	})
+	Expect(err).NotTo(HaveOccurred())
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest))
+
+	Expect(os.WriteFile(filepath.Join(dir, bundle.ManifestFile), manifest, 0644)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(dir, bundle.SignatureFile), []byte(signature), 0644)).To(Succeed())
+	return archives
+}
+
+var _ = Describe("the load action", func() {
+	var dir string
+	var publicKey ed25519.PublicKey
+	var privateKey ed25519.PrivateKey
+	var archive []byte
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "bundle")
+		Expect(err).NotTo(HaveOccurred())
+		publicKey, privateKey, err = ed25519.GenerateKey(nil)
+		Expect(err).NotTo(HaveOccurred())
+		archive = writeBundle(dir, privateKey)
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	When("the bundle is signed by a trusted key", func() {
+		It("should load its images and update the containers", func() {
+			client := CreateMockClient(getCommonTestData(""), false, false)
+			b, err := bundle.Open(dir)
+			Expect(err).NotTo(HaveOccurred())
+
+			report, err := actions.LoadUpdate(client, b, []ed25519.PublicKey{publicKey}, types.UpdateParams{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.TestData.LoadedArchives).To(Equal([][]byte{archive}))
+			Expect(client.TestData.TaggedImages).To(HaveKeyWithValue("fake-image:latest", types.ImageID("sha256:"+bundleImageID)))
+			Expect(report.Updated()).NotTo(BeEmpty())
+		})
+	})
+
+	When("only some images of the bundle list their services", func() {
+		It("should update every container running an image without services", func() {
+			otherImageID := "1f3b5a7e9c2d4f6b8a0c1e3d5f7a9b2c4e6d8f0a1b3c9d1e3a5c7b2f4e6a8c0d"
+			writeBundleImages(dir, privateKey,
+				testImage{tag: "fake-image:latest", id: bundleImageID},
+				testImage{tag: "other-image:latest", id: otherImageID, services: []string{"navigation"}},
+			)
+			client := CreateMockClient(&TestData{
+				Containers: []types.Container{
+					CreateMockContainer("base-1", "/base-1", "fake-image:latest", time.Now()),
+					CreateMockContainer("base-2", "/base-2", "fake-image:latest", time.Now()),
+					CreateMockContainer("navigation", "/navigation", "other-image:latest", time.Now()),
+					CreateMockContainer("mapping", "/mapping", "other-image:latest", time.Now()),
+				},
+				ApplyFilters: true,
+			}, false, false)
+			b, err := bundle.Open(dir)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = actions.LoadUpdate(client, b, []ed25519.PublicKey{publicKey}, types.UpdateParams{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.TestData.LoadedArchives).To(HaveLen(2))
+			Expect(client.TestData.StoppedContainers).To(ConsistOf("base-1", "base-2", "navigation"))
+		})
+	})
+
+	When("an image archive was changed after signing", func() {
+		It("should not load anything", func() {
+			client := CreateMockClient(getCommonTestData(""), false, false)
+			b, err := bundle.Open(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(filepath.Join(dir, "image-0.tar"), append(archive, 0), 0644)).To(Succeed())
+
+			_, err = actions.LoadUpdate(client, b, []ed25519.PublicKey{publicKey}, types.UpdateParams{})
+			Expect(err).To(MatchError(bundle.ErrChecksumMismatch))
+			Expect(client.TestData.LoadedArchives).To(BeEmpty())
+		})
+	})
+
+	When("the bundle is not signed by a trusted key", func() {
+		It("should not load anything", func() {
+			client := CreateMockClient(getCommonTestData(""), false, false)
+			b, err := bundle.Open(dir)
+			Expect(err).NotTo(HaveOccurred())
+
+			otherKey, _, _ := ed25519.GenerateKey(nil)
+			_, err = actions.LoadUpdate(client, b, []ed25519.PublicKey{otherKey}, types.UpdateParams{})
+			Expect(err).To(MatchError(bundle.ErrInvalidSignature))
+			Expect(client.TestData.LoadedArchives).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,187 @@
+package actions
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/containrrr/watchtower/pkg/bundle"
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/device"
+	"github.com/containrrr/watchtower/pkg/metrics"
+	"github.com/containrrr/watchtower/pkg/types"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// Stages of loading an offline update bundle from removable media
+const (
+	LoadFound   = "found"
+	LoadQueued  = "queued"
+	LoadLoading = "loading"
+	LoadDone    = "done"
+	LoadFailed  = "failed"
+)
+
+// LoadProgress is sent to the subscribers of a MediaMonitor while an offline update bundle is loaded
+type LoadProgress struct {
+	Stage   string          `json:"stage"`
+	Media   []string        `json:"media"`
+	Bundle  string          `json:"bundle,omitempty"`
+	Name    string          `json:"name,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Metrics *metrics.Metric `json:"metrics,omitempty"`
+	Time    time.Time       `json:"time"`
+}
+
+// MediaMonitor loads the latest offline update bundle on removable media as soon as it is mounted
+type MediaMonitor struct {
+	Watcher  *device.DeviceWatcher
+	Client   container.Client
+	Keys     []ed25519.PublicKey
+	Params   types.UpdateParams
+	Notifier types.Notifier
+	// Lock is shared with the other updates, the bundle is loaded once they are done
+	Lock chan bool
+	// Retrier updates the containers again if loading the bundle deferred them, if set
+	Retrier     *Retrier
+	subscribers map[chan LoadProgress]bool
+	mutex       sync.Mutex
+}
+
+// Run records the media that is already mounted, then watches the mounts once every interval. It never returns.
+func (m *MediaMonitor) Run(interval time.Duration) {
+	m.Watcher.Run(interval, func(events []device.DeviceEvent) {
+		m.HandleEvents(events)
+	})
+}
+
+// HandleEvents looks for an update bundle on the newly mounted media, and loads the latest one.
+// It returns the final progress of the load, or nil if no bundle was found.
+func (m *MediaMonitor) HandleEvents(events []device.DeviceEvent) *LoadProgress {
+	media := []string{}
+	for _, event := range events {
+		log.WithFields(log.Fields{"media": event.Device, "action": event.Action}).Debug("Media changed")
+		if event.Action == device.DeviceAdded {
+			media = append(media, event.Device)
+		}
+	}
+	if len(media) == 0 {
+		return nil
+	}
+
+	b, err := bundle.Latest(media)
+	if errors.Is(err, bundle.ErrNoBundle) {
+		log.WithField("media", media).Debug("No update bundle on the mounted media")
+		return nil
+	} else if err != nil {
+		log.WithError(err).Error("Unable to search the mounted media for update bundles")
+		return nil
+	}
+
+	progress := LoadProgress{Media: media, Bundle: b.Path, Name: b.Manifest.Name}
+	m.report(&progress, LoadFound)
+	log.WithFields(log.Fields{"bundle": b.Manifest.Name, "path": b.Path}).Info("Found an offline update bundle on the mounted media")
+
+	var lockValue bool
+	select {
+	case lockValue = <-m.Lock:
+	default:
+		m.report(&progress, LoadQueued)
+		log.Info("Waiting for the running update to finish")
+		lockValue = <-m.Lock
+	}
+	defer func() {
+		m.Lock <- lockValue
+	}()
+
+	m.report(&progress, LoadLoading)
+	if m.Notifier != nil {
+		m.Notifier.StartNotification()
+	}
+	result, err := LoadUpdate(m.Client, b, m.Keys, m.Params)
+	if err != nil {
+		log.WithError(err).Error("Unable to load the offline update bundle")
+		progress.Error = err.Error()
+		m.report(&progress, LoadFailed)
+	} else {
+		progress.Metrics = metrics.NewMetric(result)
+		m.report(&progress, LoadDone)
+		RetryDeferred(m.Retrier, m.Client, m.Params, result)
+	}
+	if m.Notifier != nil {
+		m.Notifier.SendNotification(result)
+	}
+	return &progress
+}
+
+func (m *MediaMonitor) report(progress *LoadProgress, stage string) {
+	progress.Stage = stage
+	progress.Time = time.Now()
+	m.publish(*progress)
+}
+
+// Subscribe returns a channel receiving the progress of every load, until it is unsubscribed
+func (m *MediaMonitor) Subscribe() chan LoadProgress {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.subscribers == nil {
+		m.subscribers = map[chan LoadProgress]bool{}
+	}
+	progress := make(chan LoadProgress, 8)
+	m.subscribers[progress] = true
+	return progress
+}
+
+// Unsubscribe stops sending progress to the channel and closes it
+func (m *MediaMonitor) Unsubscribe(progress chan LoadProgress) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.subscribers[progress] {
+		delete(m.subscribers, progress)
+		close(progress)
+	}
+}
+
+func (m *MediaMonitor) publish(progress LoadProgress) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for subscriber := range m.subscribers {
+		// Slow subscribers miss progress rather than holding up the load
+		select {
+		case subscriber <- progress:
+		default:
+		}
+	}
+}
+
+// BroadcastLoadProgress sends the progress of every offline update to the WebSocket connection, until it is closed
+func BroadcastLoadProgress(conn *websocket.Conn, monitor *MediaMonitor) {
+	progress := monitor.Subscribe()
+	defer func() {
+		monitor.Unsubscribe(progress)
+		if err := conn.Close(); err != nil {
+			log.Error("Unable to close websocket connection")
+		}
+		log.Info("Connection closed")
+	}()
+
+	// The client never sends anything, reading only notices when it goes away
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				monitor.Unsubscribe(progress)
+				return
+			}
+		}
+	}()
+
+	for update := range progress {
+		data, _ := json.Marshal(update)
+		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			return
+		}
+	}
+}
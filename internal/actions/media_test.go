@@ -0,0 +1,109 @@
+package actions_test
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+
+	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/pkg/device"
+
+	. "github.com/containrrr/watchtower/internal/actions/mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the media monitor", func() {
+	var dir string
+	var monitor *actions.MediaMonitor
+	var client MockClient
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "media")
+		Expect(err).NotTo(HaveOccurred())
+		publicKey, privateKey, err := ed25519.GenerateKey(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Join(dir, "usb", "release"), 0755)).To(Succeed())
+		writeBundle(filepath.Join(dir, "usb", "release"), privateKey)
+
+		client = CreateMockClient(getCommonTestData(""), false, false)
+		lock := make(chan bool, 1)
+		lock <- true
+		monitor = &actions.MediaMonitor{
+			Client: client,
+			Keys:   []ed25519.PublicKey{publicKey},
+			Lock:   lock,
+		}
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	mounted := func(paths ...string) []device.DeviceEvent {
+		events := []device.DeviceEvent{}
+		for _, path := range paths {
+			events = append(events, device.DeviceEvent{Action: device.DeviceAdded, Device: path})
+		}
+		return events
+	}
+
+	stagesOf := func(progress chan actions.LoadProgress) []string {
+		stages := []string{}
+		for {
+			select {
+			case update := <-progress:
+				stages = append(stages, update.Stage)
+			default:
+				return stages
+			}
+		}
+	}
+
+	It("should load the bundle on newly mounted media", func() {
+		progress := monitor.Subscribe()
+		defer monitor.Unsubscribe(progress)
+
+		result := monitor.HandleEvents(mounted(filepath.Join(dir, "usb")))
+		Expect(result).NotTo(BeNil())
+		Expect(result.Stage).To(Equal(actions.LoadDone))
+		Expect(result.Bundle).To(Equal(filepath.Join(dir, "usb", "release")))
+		Expect(client.TestData.LoadedArchives).To(HaveLen(1))
+		Expect(stagesOf(progress)).To(Equal([]string{actions.LoadFound, actions.LoadLoading, actions.LoadDone}))
+		Expect(monitor.Lock).To(HaveLen(1))
+	})
+
+	It("should ignore media without a bundle and unmounted media", func() {
+		Expect(os.MkdirAll(filepath.Join(dir, "empty"), 0755)).To(Succeed())
+		Expect(monitor.HandleEvents(mounted(filepath.Join(dir, "empty")))).To(BeNil())
+		Expect(monitor.HandleEvents([]device.DeviceEvent{{Action: device.DeviceRemoved, Device: filepath.Join(dir, "usb")}})).To(BeNil())
+		Expect(client.TestData.LoadedArchives).To(BeEmpty())
+	})
+
+	It("should report untrusted bundles as failed", func() {
+		otherKey, _, _ := ed25519.GenerateKey(nil)
+		monitor.Keys = []ed25519.PublicKey{otherKey}
+
+		result := monitor.HandleEvents(mounted(filepath.Join(dir, "usb")))
+		Expect(result.Stage).To(Equal(actions.LoadFailed))
+		Expect(result.Error).NotTo(BeEmpty())
+		Expect(client.TestData.LoadedArchives).To(BeEmpty())
+	})
+
+	It("should wait for the running update to finish", func() {
+		progress := monitor.Subscribe()
+		defer monitor.Unsubscribe(progress)
+
+		lockValue := <-monitor.Lock
+		done := make(chan *actions.LoadProgress)
+		go func() {
+			done <- monitor.HandleEvents(mounted(filepath.Join(dir, "usb")))
+		}()
+		Eventually(progress).Should(Receive(HaveField("Stage", actions.LoadFound)))
+		Eventually(progress).Should(Receive(HaveField("Stage", actions.LoadQueued)))
+		Consistently(done).ShouldNot(Receive())
+
+		monitor.Lock <- lockValue
+		Eventually(done).Should(Receive(HaveField("Stage", actions.LoadDone)))
+	})
+})
@@ -1,11 +1,20 @@
 package mocks
 
 import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"time"
 
+	"github.com/containrrr/watchtower/pkg/container"
 	t "github.com/containrrr/watchtower/pkg/types"
+	"github.com/docker/docker/api/types"
+	dockerContainer "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
 )
 
 // MockClient is a mock that passes as a watchtower Client
@@ -21,6 +30,33 @@ type TestData struct {
 	NameOfContainerToKeep   string
 	Containers              []t.Container
 	Staleness               map[string]bool
+	// States is the state given to containers created through StartContainer, by container name
+	States              map[string]*types.ContainerState
+	StartedContainers   []string
+	StoppedContainers   []string
+	PausedContainers    []string
+	UnpausedContainers  []string
+	RestartedContainers []string
+	// Networks are the networks that exist, by name
+	Networks map[string]container.Network
+	// Volumes are the named volumes that exist, by name
+	Volumes map[string]container.Volume
+	// LoadedArchives are the image archives passed to LoadImage
+	LoadedArchives [][]byte
+	// UpdateStatuses are the results of CheckForUpdate, by container name
+	UpdateStatuses map[string]t.UpdateStatus
+	// SavedImages are the images passed to SaveImage
+	SavedImages [][]string
+	// RemovedContainers are hidden from GetContainerByName once stopped, if set
+	RemovedContainers map[t.ContainerID]bool
+	// TaggedImages are the images tagged through TagImage, by tag
+	TaggedImages map[string]t.ImageID
+	// ImageTags are the tags of the image repositories returned by ListImageTags, by container name
+	ImageTags map[string][]string
+	// LatestImages are the newest images returned by IsContainerStale, by container name
+	LatestImages map[string]t.ImageID
+	// ApplyFilters makes ListContainers only return the containers matching its filter
+	ApplyFilters bool
 }
 
 // TriedToRemoveImage is a test helper function to check whether RemoveImageByID has been called
@@ -38,8 +74,20 @@ func CreateMockClient(data *TestData, pullImages bool, removeVolumes bool) MockC
 }
 
 // ListContainers is a mock method returning the provided container testdata
-func (client MockClient) ListContainers(_ t.Filter) ([]t.Container, error) {
-	return client.TestData.Containers, nil
+func (client MockClient) ListContainers(filter t.Filter) ([]t.Container, error) {
+	// Return a copy, as the update sorts the containers in place
+	containers := []t.Container{}
+	for _, c := range client.TestData.Containers {
+		if !client.TestData.ApplyFilters || filter(c) {
+			containers = append(containers, c)
+		}
+	}
+	return containers, nil
+}
+
+// ListAllContainers is a mock method returning the provided container testdata
+func (client MockClient) ListAllContainers(filter t.Filter) ([]t.Container, error) {
+	return client.ListContainers(filter)
 }
 
 // StopContainer is a mock method
@@ -47,12 +95,16 @@ func (client MockClient) StopContainer(c t.Container, _ time.Duration) error {
 	if c.Name() == client.TestData.NameOfContainerToKeep {
 		return errors.New("tried to stop the instance we want to keep")
 	}
+	client.TestData.StoppedContainers = append(client.TestData.StoppedContainers, strings.TrimPrefix(c.Name(), "/"))
+	if client.TestData.RemovedContainers != nil {
+		client.TestData.RemovedContainers[c.ID()] = true
+	}
 	return nil
 }
 
-// StartContainerWithExistingConfig is a mock method
-func (client MockClient) StartContainerWithExistingConfig(_ t.Container) (t.ContainerID, error) {
-	return "", nil
+// StartContainerWithExistingConfig is a mock method, returning the ID of the container it was given
+func (client MockClient) StartContainerWithExistingConfig(c t.Container) (t.ContainerID, error) {
+	return c.ID(), nil
 }
 
 // RenameContainer is a mock method
@@ -66,11 +118,119 @@ func (client MockClient) RemoveImageByID(_ t.ImageID) error {
 	return nil
 }
 
-// GetContainer is a mock method
-func (client MockClient) GetContainer(_ t.ContainerID) (t.Container, error) {
+// TagImage records the tag in TestData.TaggedImages
+func (client MockClient) TagImage(id t.ImageID, tag string) error {
+	if client.TestData.TaggedImages == nil {
+		client.TestData.TaggedImages = map[string]t.ImageID{}
+	}
+	client.TestData.TaggedImages[tag] = id
+	return nil
+}
+
+// GetImageID returns the image tagged with the name in TestData
+func (client MockClient) GetImageID(name string) (t.ImageID, error) {
+	id, found := client.TestData.TaggedImages[name]
+	if !found {
+		return "", fmt.Errorf("no such image: %s", name)
+	}
+	return id, nil
+}
+
+// StartContainer creates a mock container with the given name, and the state set for it in TestData
+func (client MockClient) StartContainer(name string, config dockerContainer.Config, hostConfig dockerContainer.HostConfig, _ network.NetworkingConfig) (t.ContainerID, error) {
+	state := client.TestData.States[name]
+	if state == nil {
+		state = &types.ContainerState{Running: true, Status: "running"}
+	}
+	created := CreateMockContainerWithConfig(name, "/"+name, config.Image, state.Running, false, time.Now(), &config)
+	created.ContainerInfo().State = state
+	created.ContainerInfo().HostConfig = &hostConfig
+
+	replaced := false
+	for i, existing := range client.TestData.Containers {
+		if existing.ID() == created.ID() {
+			client.TestData.Containers[i] = created
+			replaced = true
+		}
+	}
+	if !replaced {
+		client.TestData.Containers = append(client.TestData.Containers, created)
+	}
+	delete(client.TestData.RemovedContainers, created.ID())
+	client.TestData.StartedContainers = append(client.TestData.StartedContainers, name)
+	return t.ContainerID(name), nil
+}
+
+// GetContainer returns the container with the given ID, or the first container if there is no such container
+func (client MockClient) GetContainer(id t.ContainerID) (t.Container, error) {
+	for _, c := range client.TestData.Containers {
+		if c.ID() == id {
+			return c, nil
+		}
+	}
 	return client.TestData.Containers[0], nil
 }
 
+// GetContainerByName returns the container with the given name from the provided container testdata
+func (client MockClient) GetContainerByName(name string) (t.Container, error) {
+	for _, c := range client.TestData.Containers {
+		if strings.TrimPrefix(c.Name(), "/") == name && !client.TestData.RemovedContainers[c.ID()] {
+			return c, nil
+		}
+	}
+	return nil, container.ErrContainerNotFound
+}
+
+// PauseContainer marks the container as paused
+func (client MockClient) PauseContainer(c t.Container) error {
+	c.ContainerInfo().State.Paused = true
+	client.TestData.PausedContainers = append(client.TestData.PausedContainers, strings.TrimPrefix(c.Name(), "/"))
+	return nil
+}
+
+// UnpauseContainer marks the container as no longer paused
+func (client MockClient) UnpauseContainer(c t.Container) error {
+	c.ContainerInfo().State.Paused = false
+	client.TestData.UnpausedContainers = append(client.TestData.UnpausedContainers, strings.TrimPrefix(c.Name(), "/"))
+	return nil
+}
+
+// RestartContainer is a mock method
+func (client MockClient) RestartContainer(c t.Container, _ time.Duration) error {
+	client.TestData.RestartedContainers = append(client.TestData.RestartedContainers, strings.TrimPrefix(c.Name(), "/"))
+	return nil
+}
+
+// EnsureNetwork adds the network to the TestData networks, unless it is external
+func (client MockClient) EnsureNetwork(n container.Network) (string, error) {
+	if _, found := client.TestData.Networks[n.Name]; found {
+		return n.Name, nil
+	}
+	if n.External {
+		return "", fmt.Errorf("external network %s does not exist", n.Name)
+	}
+	if client.TestData.Networks == nil {
+		client.TestData.Networks = map[string]container.Network{}
+	}
+	client.TestData.Networks[n.Name] = n
+	return n.Name, nil
+}
+
+// EnsureVolume adds the volume to the TestData volumes, unless it is external
+func (client MockClient) EnsureVolume(v container.Volume) (string, error) {
+	if _, found := client.TestData.Volumes[v.Name]; found {
+		return v.Name, nil
+	}
+	if v.External {
+		return "", fmt.Errorf("external volume %s does not exist", v.Name)
+	}
+	if client.TestData.Volumes == nil {
+		client.TestData.Volumes = map[string]container.Volume{}
+	}
+	client.TestData.Volumes[v.Name] = v
+	return v.Name, nil
+}
+
 // ExecuteCommand is a mock method
 func (client MockClient) ExecuteCommand(_ t.ContainerID, command string, _ int) (SkipUpdate bool, err error) {
 	switch command {
@@ -86,15 +246,121 @@ func (client MockClient) ExecuteCommand(_ t.ContainerID, command string, _ int)
 }
 
 // IsContainerStale is true if not explicitly stated in TestData for the mock client
-func (client MockClient) IsContainerStale(cont t.Container, params t.UpdateParams, load_local_image bool) (bool, t.ImageID, error) {
+func (client MockClient) IsContainerStale(cont t.Container, params t.UpdateParams) (bool, t.ImageID, error) {
+	if params.Holds != nil && params.Holds.IsHeld(cont.Name()) {
+		return false, cont.SafeImageID(), nil
+	}
 	stale, found := client.TestData.Staleness[cont.Name()]
 	if !found {
 		stale = true
 	}
-	return stale, "", nil
+	return stale, client.TestData.LatestImages[cont.Name()], nil
 }
 
 // WarnOnHeadPullFailed is always true for the mock client
 func (client MockClient) WarnOnHeadPullFailed(_ t.Container) bool {
 	return true
 }
+
+// LoadImage reads the archive into the TestData loaded archives, and tags the images listed in
+// the manifest of the archive like the docker daemon would
+func (client MockClient) LoadImage(archive io.Reader) error {
+	data, err := io.ReadAll(archive)
+	if err != nil {
+		return err
+	}
+	client.TestData.LoadedArchives = append(client.TestData.LoadedArchives, data)
+
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if header.Name != "manifest.json" {
+			continue
+		}
+		var manifests []struct {
+			Config   string
+			RepoTags []string
+		}
+		if err := json.NewDecoder(tr).Decode(&manifests); err != nil {
+			return err
+		}
+		for _, manifest := range manifests {
+			id := t.ImageID("sha256:" + strings.TrimSuffix(manifest.Config, ".json"))
+			for _, tag := range manifest.RepoTags {
+				if err := client.TagImage(id, tag); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// SaveImage returns an archive with the manifest of a `docker save` archive of the images,
+// which refers to the configuration of the image of the first container running them
+func (client MockClient) SaveImage(images []string) (io.ReadCloser, error) {
+	client.TestData.SavedImages = append(client.TestData.SavedImages, images)
+	config := "config.json"
+	for _, c := range client.TestData.Containers {
+		if c.ImageName() == images[0] && c.HasImageInfo() {
+			config = strings.TrimPrefix(string(c.ImageID()), "sha256:") + ".json"
+			break
+		}
+	}
+	manifest, err := json.Marshal([]map[string]interface{}{{"Config": config, "RepoTags": images}})
+	if err != nil {
+		return nil, err
+	}
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	if err := writer.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(manifest))}); err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(manifest); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(&archive), nil
+}
+
+// CheckDigestAndPullImage is a mock method
+func (client MockClient) CheckDigestAndPullImage(_ t.Container) error {
+	return nil
+}
+
+// CheckForUpdate returns the update status in TestData, no update is available if not set
+func (client MockClient) CheckForUpdate(c t.Container) (t.UpdateStatus, error) {
+	status, found := client.TestData.UpdateStatuses[c.Name()]
+	if !found {
+		status = t.UpdateStatus{Container: strings.TrimPrefix(c.Name(), "/"), Image: c.ImageName()}
+	}
+	if status.Error != "" {
+		return status, errors.New(status.Error)
+	}
+	return status, nil
+}
+
+// PullImage is a mock method
+func (client MockClient) PullImage(_ t.Container) error {
+	return nil
+}
+
+// ListImageTags is a mock method returning the image tags set for the container in the test data
+func (client MockClient) ListImageTags(c t.Container) ([]string, error) {
+	tags, found := client.TestData.ImageTags[c.Name()]
+	if !found {
+		return nil, errors.New("no tags found for the image")
+	}
+	return tags, nil
+}
+
+// StreamLogs is a mock method returning no logs
+func (client MockClient) StreamLogs(_ t.Container, _ bool) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("")), nil
+}
@@ -14,6 +14,8 @@ func CreateMockProgressReport(states ...session.State) wt.Report {
 	stateNums := make(map[session.State]int)
 	progress := session.Progress{}
 	failed := make(map[wt.ContainerID]error)
+	rolledBack := make(map[wt.ContainerID]error)
+	deferred := make(map[wt.ContainerID]error)
 
 	for _, state := range states {
 		index := stateNums[state]
@@ -33,11 +35,24 @@ func CreateMockProgressReport(states ...session.State) wt.Report {
 			c, newImage := CreateContainerForProgress(index, 21, "fail%d")
 			progress.AddScanned(c, newImage)
 			failed[c.ID()] = errors.New("accidentally the whole container")
+		case session.RolledBackState:
+			c, newImage := CreateContainerForProgress(index, 51, "roll%d")
+			progress.AddScanned(c, newImage)
+			rolledBack[c.ID()] = errors.New("container became unhealthy")
+		case session.HeldState:
+			c, _ := CreateContainerForProgress(index, 61, "hold%d")
+			progress.AddHeld(c)
+		case session.DeferredState:
+			c, newImage := CreateContainerForProgress(index, 71, "dfrd%d")
+			progress.AddScanned(c, newImage)
+			deferred[c.ID()] = errors.New("the robot is busy")
 		}
 
 		stateNums[state] = index + 1
 	}
 	progress.UpdateFailed(failed)
+	progress.UpdateRolledBack(rolledBack)
+	progress.UpdateDeferred(deferred)
 
 	return progress.Report()
 
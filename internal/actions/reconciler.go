@@ -0,0 +1,383 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	containerService "github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/stack"
+	"github.com/containrrr/watchtower/pkg/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	log "github.com/sirupsen/logrus"
+)
+
+// Reconciler keeps the containers of the applied stack in their desired state. The last applied
+// definition of every service is kept in the store, and periodically compared to the containers,
+// recreating any container that has gone missing or drifted from its definition.
+type Reconciler struct {
+	Client            containerService.Client
+	Store             *stack.Store
+	DependencyTimeout time.Duration
+	// Lock is shared with the updater, so that containers being updated are not mistaken for missing ones
+	Lock chan bool
+	// deviceNodes are the device nodes seen by the last RemapDevices, by host path
+	deviceNodes map[string]os.FileInfo
+}
+
+// ErrUpdateRunning is returned when the stack cannot be applied because an update is running
+var ErrUpdateRunning = errors.New("another update process is already running")
+
+// Apply reconciles the services of the project and stores them as the desired state.
+// If action is set, it overrides the action of every service. ErrUpdateRunning is returned
+// without waiting if an update is running.
+func (r *Reconciler) Apply(project *containerService.Project, action string) ([]ServiceResult, error) {
+	if r.Lock != nil {
+		select {
+		case v := <-r.Lock:
+			defer func() { r.Lock <- v }()
+		default:
+			return nil, ErrUpdateRunning
+		}
+	}
+
+	opts := StackOptions{
+		Action:            action,
+		DependencyTimeout: r.DependencyTimeout,
+		Networks:          project.Networks,
+		Volumes:           project.Volumes,
+	}
+	results, err := ReconcileStack(r.Client, project.Services, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	desired := make([]containerService.Service, len(project.Services))
+	copy(desired, project.Services)
+	for i := range desired {
+		if action != "" {
+			desired[i].Action = action
+		}
+		// A restart is a one-off, the service should be kept running afterwards
+		if desired[i].Action == containerService.ActionRestart {
+			desired[i].Action = containerService.ActionRun
+		}
+	}
+	if _, err := r.Store.Merge(stack.State{Services: desired, Networks: project.Networks, Volumes: project.Volumes}); err != nil {
+		return results, fmt.Errorf("could not store the stack definition: %w", err)
+	}
+	return results, nil
+}
+
+// Status compares every stored service with its container
+func (r *Reconciler) Status() ([]stack.ServiceStatus, error) {
+	state, err := r.Store.Load()
+	if err != nil {
+		return nil, err
+	}
+	services := state.Services
+
+	statuses := make([]stack.ServiceStatus, 0, len(services))
+	for i := range services {
+		status, err := r.serviceStatus(&services[i])
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (r *Reconciler) serviceStatus(service *containerService.Service) (stack.ServiceStatus, error) {
+	status := stack.ServiceStatus{Service: service.Name, Action: service.Action, Status: stack.StatusInSync}
+
+	existing, err := r.Client.GetContainerByName(service.ContainerName)
+	if errors.Is(err, containerService.ErrContainerNotFound) {
+		if service.Action != containerService.ActionStop {
+			status.Status = stack.StatusMissing
+		}
+		return status, nil
+	} else if err != nil {
+		return status, err
+	}
+
+	status.Container = string(existing.ID())
+	status.Drift = serviceDrift(service, existing)
+	if len(status.Drift) > 0 {
+		status.Status = stack.StatusDrifted
+	}
+	return status, nil
+}
+
+// Reconcile recreates every stored service that is missing or has drifted from its definition.
+// It is skipped if an update is running.
+func (r *Reconciler) Reconcile() ([]ServiceResult, error) {
+	if r.Lock != nil {
+		select {
+		case v := <-r.Lock:
+			defer func() { r.Lock <- v }()
+		default:
+			log.Debug("Skipping stack reconciliation, an update is running")
+			return nil, nil
+		}
+	}
+
+	state, err := r.Store.Load()
+	if err != nil {
+		return nil, err
+	}
+	services := state.Services
+
+	outdated := []containerService.Service{}
+	for i := range services {
+		service := &services[i]
+		status, err := r.serviceStatus(service)
+		if err != nil {
+			return nil, err
+		}
+		if status.Status == stack.StatusInSync {
+			continue
+		}
+
+		fields := log.Fields{"service": service.Name, "drift": status.Drift}
+		if status.Status == stack.StatusMissing {
+			log.WithFields(fields).Warn("Service container is missing, recreating it")
+		} else {
+			log.WithFields(fields).Warn("Service container drifted from its definition, reconciling it")
+		}
+
+		// Containers with an outdated configuration have to be replaced, as it cannot be changed in place
+		if status.Status == stack.StatusDrifted && hasConfigDrift(status.Drift) && service.Action != containerService.ActionStop {
+			existing, err := r.Client.GetContainerByName(service.ContainerName)
+			if err == nil {
+				err = r.Client.StopContainer(existing, serviceStopTimeout)
+			}
+			if err != nil && !errors.Is(err, containerService.ErrContainerNotFound) {
+				log.WithFields(fields).Error(err)
+				continue
+			}
+		}
+		outdated = append(outdated, *service)
+	}
+
+	if len(outdated) == 0 {
+		return nil, nil
+	}
+	return ReconcileStack(r.Client, outdated, StackOptions{
+		DependencyTimeout: r.DependencyTimeout,
+		Networks:          state.Networks,
+		Volumes:           state.Volumes,
+		Services:          state.Services,
+	})
+}
+
+// RemapDevices restarts or recreates the running stack containers whose devices changed, e.g. after
+// a device was unplugged and plugged in again. Containers whose devices now resolve to other device
+// nodes are recreated, and containers whose device nodes were recreated are restarted. The first
+// call only records the device nodes.
+func (r *Reconciler) RemapDevices() ([]ServiceResult, error) {
+	if r.Lock != nil {
+		v := <-r.Lock
+		defer func() { r.Lock <- v }()
+	}
+
+	state, err := r.Store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := map[string]os.FileInfo{}
+	results := []ServiceResult{}
+	for i := range state.Services {
+		service := &state.Services[i]
+		if len(service.Devices) == 0 || service.Action != containerService.ActionRun {
+			continue
+		}
+
+		devices := getResouces(service).Devices
+		replugged, unplugged := false, false
+		for _, device := range devices {
+			node, err := os.Stat(device.PathOnHost)
+			if err != nil {
+				unplugged = true
+				continue
+			}
+			nodes[device.PathOnHost] = node
+			if r.deviceNodes == nil {
+				continue
+			}
+			if previous, found := r.deviceNodes[device.PathOnHost]; !found || !os.SameFile(previous, node) {
+				replugged = true
+			}
+		}
+
+		// The container is left alone until its devices are plugged in again, as it cannot be created without them
+		if unplugged {
+			continue
+		}
+
+		existing, err := r.Client.GetContainerByName(service.ContainerName)
+		if errors.Is(err, containerService.ErrContainerNotFound) {
+			continue
+		} else if err != nil {
+			return results, err
+		}
+		if !existing.IsRunning() || isPaused(existing) {
+			continue
+		}
+
+		fields := log.Fields{"service": service.Name}
+		var result ServiceResult
+		switch {
+		case !sameElements(formatDevices(existing.ContainerInfo().HostConfig.Devices), formatDevices(devices)):
+			log.WithFields(fields).Warn("Service devices were remapped, recreating its container")
+			if err := r.Client.StopContainer(existing, serviceStopTimeout); err != nil {
+				log.WithFields(fields).Error(err)
+				result = ServiceResult{Service: service.Name, Action: service.Action, Result: ResultFailed, Error: err.Error()}
+				break
+			}
+			result = ReconcileService(r.Client, service)
+		case replugged:
+			log.WithFields(fields).Warn("Service devices were plugged in again, restarting its container")
+			result = ServiceResult{
+				Service:   service.Name,
+				Container: string(existing.ID()),
+				Action:    containerService.ActionRestart,
+				Result:    ResultRestarted,
+			}
+			if err := r.Client.RestartContainer(existing, serviceStopTimeout); err != nil {
+				log.WithFields(fields).Error(err)
+				result.Result = ResultFailed
+				result.Error = err.Error()
+			}
+		default:
+			continue
+		}
+		results = append(results, result)
+	}
+	r.deviceNodes = nodes
+	return results, nil
+}
+
+// Run reconciles the stack once every interval. It never returns.
+func (r *Reconciler) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := r.Reconcile(); err != nil {
+			log.WithError(err).Error("Unable to reconcile the stack")
+		}
+	}
+}
+
+// Fields that are compared between a service and its container
+const (
+	driftState      = "state"
+	driftImage      = "image"
+	driftEnv        = "environment"
+	driftVolumes    = "volumes"
+	driftDevices    = "devices"
+	driftPrivileged = "privileged"
+)
+
+func hasConfigDrift(drift []string) bool {
+	for _, field := range drift {
+		if field != driftState {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceDrift returns the fields in which the container differs from the service definition
+func serviceDrift(service *containerService.Service, existing types.Container) []string {
+	drift := []string{}
+	info := existing.ContainerInfo()
+
+	switch service.Action {
+	case containerService.ActionStop:
+		return append(drift, driftState)
+	case containerService.ActionPause:
+		if !isPaused(existing) {
+			drift = append(drift, driftState)
+		}
+	default:
+		if !existing.IsRunning() || isPaused(existing) {
+			drift = append(drift, driftState)
+		}
+	}
+
+	config, _, hostConfig := makeContainerCreateOptions(service, nil)
+	if info.Config != nil {
+		if info.Config.Image != config.Image {
+			drift = append(drift, driftImage)
+		}
+		// The container environment also contains the variables defined by the image
+		if !containsAll(info.Config.Env, config.Env) {
+			drift = append(drift, driftEnv)
+		}
+	}
+	if info.HostConfig != nil {
+		if !sameElements(info.HostConfig.Binds, hostConfig.Binds) ||
+			!sameElements(formatMounts(info.HostConfig.Mounts), formatMounts(hostConfig.Mounts)) {
+			drift = append(drift, driftVolumes)
+		}
+		if !sameElements(formatDevices(info.HostConfig.Devices), formatDevices(hostConfig.Devices)) ||
+			!sameElements(info.HostConfig.DeviceCgroupRules, hostConfig.DeviceCgroupRules) {
+			drift = append(drift, driftDevices)
+		}
+		if info.HostConfig.Privileged != hostConfig.Privileged {
+			drift = append(drift, driftPrivileged)
+		}
+	}
+	return drift
+}
+
+func formatDevices(devices []container.DeviceMapping) []string {
+	output := make([]string, 0, len(devices))
+	for _, device := range devices {
+		output = append(output, device.PathOnHost+":"+device.PathInContainer+":"+device.CgroupPermissions)
+	}
+	return output
+}
+
+func formatMounts(mounts []mount.Mount) []string {
+	output := make([]string, 0, len(mounts))
+	for _, m := range mounts {
+		output = append(output, fmt.Sprintf("%s:%s:%s:%t", m.Type, m.Source, m.Target, m.ReadOnly))
+	}
+	return output
+}
+
+func containsAll(values []string, required []string) bool {
+	present := map[string]bool{}
+	for _, value := range values {
+		present[value] = true
+	}
+	for _, value := range required {
+		if !present[value] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameElements(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string{}, a...)
+	sortedB := append([]string{}, b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,184 @@
+package actions_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/stack"
+	"github.com/containrrr/watchtower/pkg/types"
+	dockerTypes "github.com/docker/docker/api/types"
+
+	. "github.com/containrrr/watchtower/internal/actions/mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the stack reconciler", func() {
+	var testData *TestData
+	var reconciler *actions.Reconciler
+	var stateDir string
+
+	BeforeEach(func() {
+		var err error
+		stateDir, err = os.MkdirTemp("", "stack")
+		Expect(err).NotTo(HaveOccurred())
+
+		testData = &TestData{
+			Containers:        []types.Container{},
+			States:            map[string]*dockerTypes.ContainerState{},
+			RemovedContainers: map[types.ContainerID]bool{},
+		}
+		reconciler = &actions.Reconciler{
+			Client: CreateMockClient(testData, false, false),
+			Store:  stack.NewStore(stateDir),
+		}
+	})
+	AfterEach(func() {
+		os.RemoveAll(stateDir)
+	})
+
+	statusOf := func() map[string]string {
+		statuses, err := reconciler.Status()
+		Expect(err).NotTo(HaveOccurred())
+		output := map[string]string{}
+		for _, status := range statuses {
+			output[status.Service] = status.Status
+		}
+		return output
+	}
+
+	When("a stack has been applied", func() {
+		BeforeEach(func() {
+			services := []container.Service{makeStackService("api", nil), makeStackService("db", nil)}
+			_, err := reconciler.Apply(&container.Project{Services: services}, "")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should store the services", func() {
+			state, err := reconciler.Store.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.Services).To(HaveLen(2))
+		})
+
+		It("should report the services as in sync", func() {
+			Expect(statusOf()).To(Equal(map[string]string{
+				"api": stack.StatusInSync,
+				"db":  stack.StatusInSync,
+			}))
+		})
+
+		It("should recreate removed containers", func() {
+			db := testData.Containers[1]
+			testData.RemovedContainers[db.ID()] = true
+			Expect(statusOf()["db"]).To(Equal(stack.StatusMissing))
+
+			results, err := reconciler.Reconcile()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Result).To(Equal(actions.ResultStarted))
+			Expect(statusOf()["db"]).To(Equal(stack.StatusInSync))
+		})
+
+		It("should replace containers that drifted from their definition", func() {
+			testData.Containers[0].ContainerInfo().Config.Image = "api:manual"
+			statuses, err := reconciler.Status()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statuses[0].Status).To(Equal(stack.StatusDrifted))
+			Expect(statuses[0].Drift).To(Equal([]string{"image"}))
+
+			_, err = reconciler.Reconcile()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testData.StoppedContainers).To(Equal([]string{"api"}))
+			Expect(statusOf()["api"]).To(Equal(stack.StatusInSync))
+		})
+
+		It("should keep stopped services stopped", func() {
+			_, err := reconciler.Apply(&container.Project{Services: []container.Service{makeStackService("api", nil)}}, container.ActionStop)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusOf()["api"]).To(Equal(stack.StatusInSync))
+
+			results, err := reconciler.Reconcile()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(BeEmpty())
+		})
+
+		It("should not apply a stack while an update is running", func() {
+			reconciler.Lock = make(chan bool, 1)
+
+			results, err := reconciler.Apply(&container.Project{Services: []container.Service{makeStackService("web", nil)}}, "")
+			Expect(err).To(MatchError(actions.ErrUpdateRunning))
+			Expect(results).To(BeNil())
+			Expect(testData.StartedContainers).NotTo(ContainElement("web"))
+		})
+
+		It("should not reconcile while an update is running", func() {
+			reconciler.Lock = make(chan bool, 1)
+			testData.RemovedContainers[testData.Containers[0].ID()] = true
+
+			results, err := reconciler.Reconcile()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(BeNil())
+			Expect(statusOf()["api"]).To(Equal(stack.StatusMissing))
+		})
+	})
+
+	When("the devices of a service change", func() {
+		var devDir string
+
+		BeforeEach(func() {
+			var err error
+			devDir, err = os.MkdirTemp("", "devices")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(filepath.Join(devDir, "ttyUSB0"), nil, 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(devDir, "ttyUSB1"), nil, 0644)).To(Succeed())
+			Expect(os.Symlink("ttyUSB0", filepath.Join(devDir, "lidar"))).To(Succeed())
+
+			lidar := makeStackService("lidar", nil)
+			lidar.Devices = []string{filepath.Join(devDir, "lidar") + ":/dev/lidar"}
+			_, err = reconciler.Apply(&container.Project{Services: []container.Service{lidar}}, "")
+			Expect(err).NotTo(HaveOccurred())
+
+			results, err := reconciler.RemapDevices()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(BeEmpty())
+		})
+		AfterEach(func() {
+			os.RemoveAll(devDir)
+		})
+
+		It("should leave the container alone while its devices stay the same", func() {
+			results, err := reconciler.RemapDevices()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(BeEmpty())
+		})
+
+		It("should restart the container when its device node is recreated", func() {
+			Expect(os.Remove(filepath.Join(devDir, "ttyUSB0"))).To(Succeed())
+			results, err := reconciler.RemapDevices()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(BeEmpty())
+
+			Expect(os.WriteFile(filepath.Join(devDir, "ttyUSB0"), nil, 0644)).To(Succeed())
+			results, err = reconciler.RemapDevices()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resultsOf(results)).To(Equal(map[string]string{"lidar": actions.ResultRestarted}))
+			Expect(testData.RestartedContainers).To(Equal([]string{"lidar"}))
+		})
+
+		It("should recreate the container when its device resolves to another node", func() {
+			Expect(os.Remove(filepath.Join(devDir, "lidar"))).To(Succeed())
+			Expect(os.Symlink("ttyUSB1", filepath.Join(devDir, "lidar"))).To(Succeed())
+
+			results, err := reconciler.RemapDevices()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resultsOf(results)).To(Equal(map[string]string{"lidar": actions.ResultStarted}))
+			Expect(testData.StoppedContainers).To(Equal([]string{"lidar"}))
+
+			existing, err := reconciler.Client.GetContainerByName("lidar")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(existing.ContainerInfo().HostConfig.Devices[0].PathOnHost).To(Equal(filepath.Join(devDir, "ttyUSB1")))
+		})
+	})
+})
@@ -0,0 +1,239 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/session"
+	"github.com/containrrr/watchtower/pkg/types"
+	dockerTypes "github.com/docker/docker/api/types"
+	dockerContainer "github.com/docker/docker/api/types/container"
+	log "github.com/sirupsen/logrus"
+)
+
+// healthCheckInterval is how often an updated container is inspected during the grace period
+var healthCheckInterval = time.Second
+
+// rolledBackError is the reason an updated container was rolled back to its previous image
+type rolledBackError struct {
+	reason error
+}
+
+func (e rolledBackError) Error() string {
+	return e.reason.Error()
+}
+
+func (e rolledBackError) Unwrap() error {
+	return e.reason
+}
+
+// rollbackTag returns the tag that keeps the previous image of a container around while the
+// updated container is watched, e.g. robot/planner:1.2-rollback for robot/planner:1.2
+func rollbackTag(imageName string) string {
+	name, tag := imageName, "latest"
+	if i := strings.LastIndex(imageName, ":"); i > strings.LastIndex(imageName, "/") {
+		name, tag = imageName[:i], imageName[i+1:]
+	}
+	return fmt.Sprintf("%s:%s-rollback", name, tag)
+}
+
+// Defaults of the docker engine for the healthcheck options that are not set
+const (
+	defaultHealthcheckInterval = 30 * time.Second
+	defaultHealthcheckTimeout  = 30 * time.Second
+	defaultHealthcheckRetries  = 3
+)
+
+// healthcheckDeadline returns how long the healthcheck can take to report a result after the
+// container started: the start period, and every retry taking the full interval and timeout
+func healthcheckDeadline(healthcheck *dockerContainer.HealthConfig) time.Duration {
+	if healthcheck == nil {
+		return 0
+	}
+	interval, timeout, retries := healthcheck.Interval, healthcheck.Timeout, healthcheck.Retries
+	if interval == 0 {
+		interval = defaultHealthcheckInterval
+	}
+	if timeout == 0 {
+		timeout = defaultHealthcheckTimeout
+	}
+	if retries == 0 {
+		retries = defaultHealthcheckRetries
+	}
+	return healthcheck.StartPeriod + time.Duration(retries+1)*(interval+timeout)
+}
+
+// watchUpdatedContainer inspects the updated container until the grace period is over, and
+// returns why it failed if it stopped, restarted or became unhealthy during it. A container whose
+// healthcheck is still starting once the grace period is over, e.g. because its start period is
+// longer, is watched until the healthcheck reports a result.
+func watchUpdatedContainer(client container.Client, id types.ContainerID, gracePeriod time.Duration) error {
+	started := time.Now()
+	deadline := started.Add(gracePeriod)
+	for {
+		c, err := client.GetContainer(id)
+		if err != nil {
+			return err
+		}
+		state := c.ContainerInfo().State
+		if state == nil {
+			return fmt.Errorf("container %s has no state", id.ShortID())
+		}
+
+		switch {
+		case state.Restarting || c.ContainerInfo().RestartCount > 0:
+			return fmt.Errorf("container restarted %d times", c.ContainerInfo().RestartCount)
+		case !state.Running:
+			return fmt.Errorf("container exited with code %d", state.ExitCode)
+		case state.Health != nil && state.Health.Status == dockerTypes.Unhealthy:
+			return fmt.Errorf("container became unhealthy")
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if state.Health == nil || state.Health.Status != dockerTypes.Starting {
+				return nil
+			}
+			var healthcheck *dockerContainer.HealthConfig
+			if config := c.ContainerInfo().Config; config != nil {
+				healthcheck = config.Healthcheck
+			}
+			remaining = time.Until(started.Add(healthcheckDeadline(healthcheck)))
+			if remaining <= 0 {
+				return fmt.Errorf("container did not become healthy within %s", time.Since(started).Round(time.Second))
+			}
+		}
+		if remaining > healthCheckInterval {
+			remaining = healthCheckInterval
+		}
+		time.Sleep(remaining)
+	}
+}
+
+// watchUpdatedContainers watches all the updated containers at the same time, and returns why
+// the ones that failed within the grace period failed, by the ID of the container before the update
+func watchUpdatedContainers(client container.Client, updated []types.UpdatedContainer, gracePeriod time.Duration) map[types.ContainerID]error {
+	failures := make(map[types.ContainerID]error)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, u := range updated {
+		wg.Add(1)
+		go func(u types.UpdatedContainer) {
+			defer wg.Done()
+			log.WithField("container", u.Previous.Name()).Debugf("Watching the updated container for %s", gracePeriod)
+			if failure := watchUpdatedContainer(client, u.ID, gracePeriod); failure != nil {
+				mutex.Lock()
+				failures[u.Previous.ID()] = failure
+				mutex.Unlock()
+			}
+		}(u)
+	}
+	wg.Wait()
+	return failures
+}
+
+// rollBackFailed rolls back the updated containers that failed, and returns the result by the ID
+// of the container before the update. The previous images of the containers that did not fail are
+// cleaned up, unless another container was rolled back to them.
+func rollBackFailed(client container.Client, updated []types.UpdatedContainer, failures map[types.ContainerID]error, params types.UpdateParams) map[types.ContainerID]error {
+	results := make(map[types.ContainerID]error, len(failures))
+	cleanupImageIDs := make(map[types.ImageID]bool, len(updated))
+	keepImageIDs := make(map[types.ImageID]bool, len(failures))
+	for _, u := range updated {
+		failure, failed := failures[u.Previous.ID()]
+		if !failed {
+			cleanupImageIDs[u.Previous.ImageID()] = true
+			continue
+		}
+		keepImageIDs[u.Previous.ImageID()] = true
+		log.WithField("container", u.Previous.Name()).Errorf("The updated container failed: %v. Rolling back to %s", failure, u.Previous.ImageID().ShortID())
+		if err := rollbackContainer(client, u.Previous, u.ID, params); err != nil {
+			log.Error(err)
+			results[u.Previous.ID()] = fmt.Errorf("%v, and could not be rolled back: %w", failure, err)
+		} else {
+			results[u.Previous.ID()] = rolledBackError{reason: failure}
+		}
+	}
+
+	if params.Cleanup {
+		for id := range keepImageIDs {
+			delete(cleanupImageIDs, id)
+		}
+		cleanupImages(client, cleanupImageIDs)
+	}
+	return results
+}
+
+// rollbackContainer replaces the failed updated container with one created from the previous
+// image and the configuration of the container before the update. The image of the failed
+// container is remembered, so that the container is not updated to it again.
+func rollbackContainer(client container.Client, previous types.Container, updatedID types.ContainerID, params types.UpdateParams) error {
+	updated, err := client.GetContainer(updatedID)
+	if err != nil {
+		return err
+	}
+	if params.RolledBack != nil {
+		if err := params.RolledBack.AddRolledBack(previous.Name(), updated.SafeImageID()); err != nil {
+			log.WithField("container", previous.Name()).Warnf("Unable to remember the failed image: %v", err)
+		}
+	}
+	// Point the tag back at the previous image, so that the container is recreated from it.
+	// A container moved to a newer version tag or to another release channel goes back to the
+	// tag it was running, leaving the tag it was moved to on the failed image.
+	previous.SetVersionTag("")
+	previous.SetChannel("")
+	if err := client.TagImage(previous.ImageID(), previous.ImageName()); err != nil {
+		return err
+	}
+	if err := client.StopContainer(updated, params.Timeout); err != nil {
+		return err
+	}
+	if _, err = client.StartContainerWithExistingConfig(previous); err != nil {
+		return err
+	}
+	setStackImage(previous, previous.ImageName(), params)
+	return nil
+}
+
+// RollbackWatcher watches updated containers in the background, so that neither the update nor
+// the lock it holds wait for the rollback grace period. The containers that fail within it are
+// rolled back while holding the lock, and reported in a notification of their own.
+type RollbackWatcher struct {
+	Client   container.Client
+	Notifier types.Notifier
+	// Lock is shared with the updates, the failed containers are rolled back once they are done
+	Lock chan bool
+}
+
+// Watch starts watching the updated containers, and returns right away
+func (w *RollbackWatcher) Watch(updated []types.UpdatedContainer, params types.UpdateParams) {
+	go w.watch(updated, params)
+}
+
+// watch watches the updated containers until the grace period is over, rolls back the ones that
+// failed, and returns the report of the watched containers
+func (w *RollbackWatcher) watch(updated []types.UpdatedContainer, params types.UpdateParams) types.Report {
+	failures := watchUpdatedContainers(w.Client, updated, params.RollbackGracePeriod)
+
+	if w.Lock != nil {
+		v := <-w.Lock
+		defer func() { w.Lock <- v }()
+	}
+	if len(failures) > 0 && w.Notifier != nil {
+		w.Notifier.StartNotification()
+	}
+	progress := &session.Progress{}
+	for _, u := range updated {
+		progress.AddScanned(u.Previous, "")
+		progress.MarkForUpdate(u.Previous.ID())
+	}
+	updateFailed(*progress, rollBackFailed(w.Client, updated, failures, params))
+	report := progress.Report()
+	if len(failures) > 0 && w.Notifier != nil {
+		w.Notifier.SendNotification(report)
+	}
+	return report
+}
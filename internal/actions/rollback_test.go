@@ -0,0 +1,190 @@
+package actions_test
+
+import (
+	"os"
+	"time"
+
+	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/device"
+	"github.com/containrrr/watchtower/pkg/filters"
+	"github.com/containrrr/watchtower/pkg/stack"
+	"github.com/containrrr/watchtower/pkg/types"
+	"github.com/containrrr/watchtower/pkg/update"
+	dockerTypes "github.com/docker/docker/api/types"
+	dockerContainer "github.com/docker/docker/api/types/container"
+
+	. "github.com/containrrr/watchtower/internal/actions/mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("rolling back failed updates", func() {
+	var client MockClient
+	var planner types.Container
+	var params types.UpdateParams
+
+	BeforeEach(func() {
+		planner = CreateMockContainerWithConfig("planner-id", "/planner", "robot/planner:1.0", true, false, time.Now(), &dockerContainer.Config{
+			Image:  "robot/planner:1.0",
+			Labels: map[string]string{},
+		})
+		client = CreateMockClient(&TestData{
+			Containers: []types.Container{planner},
+		}, false, false)
+		params = types.UpdateParams{
+			Filter:              filters.NoFilter,
+			Cleanup:             true,
+			RollbackGracePeriod: 10 * time.Millisecond,
+		}
+	})
+
+	It("should keep the updated container once the grace period is over", func() {
+		report, err := actions.Update(client, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Updated()).To(HaveLen(1))
+		Expect(report.RolledBack()).To(BeEmpty())
+		Expect(client.TestData.TaggedImages).To(HaveKeyWithValue("robot/planner:1.0-rollback", planner.ImageID()))
+		Expect(client.TestData.TriedToRemoveImage()).To(BeTrue())
+	})
+
+	It("should roll back a container that becomes unhealthy", func() {
+		planner.ContainerInfo().State.Health = &dockerTypes.Health{Status: dockerTypes.Unhealthy}
+
+		report, err := actions.Update(client, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Updated()).To(BeEmpty())
+		Expect(report.Failed()).To(BeEmpty())
+		Expect(report.RolledBack()).To(HaveLen(1))
+		Expect(report.RolledBack()[0].State()).To(Equal("RolledBack"))
+		Expect(report.RolledBack()[0].Error()).To(Equal("container became unhealthy"))
+
+		// The previous image is tagged again and kept, instead of being cleaned up
+		Expect(client.TestData.TaggedImages).To(HaveKeyWithValue("robot/planner:1.0", planner.ImageID()))
+		Expect(client.TestData.StoppedContainers).To(Equal([]string{"planner", "planner"}))
+		Expect(client.TestData.TriedToRemoveImage()).To(BeFalse())
+	})
+
+	It("should roll back a container that keeps restarting", func() {
+		planner.ContainerInfo().RestartCount = 3
+
+		report, err := actions.Update(client, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.RolledBack()).To(HaveLen(1))
+		Expect(report.RolledBack()[0].Error()).To(Equal("container restarted 3 times"))
+	})
+
+	It("should not watch the containers without a grace period", func() {
+		planner.ContainerInfo().State.Health = &dockerTypes.Health{Status: dockerTypes.Unhealthy}
+		params.RollbackGracePeriod = 0
+
+		report, err := actions.Update(client, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Updated()).To(HaveLen(1))
+		Expect(client.TestData.TaggedImages).To(BeEmpty())
+	})
+
+	It("should wait for the healthcheck start period before rolling back a starting container", func() {
+		planner.ContainerInfo().State.Health = &dockerTypes.Health{Status: dockerTypes.Starting}
+		planner.ContainerInfo().Config.Healthcheck = &dockerContainer.HealthConfig{
+			StartPeriod: 100 * time.Millisecond,
+			Interval:    time.Millisecond,
+			Timeout:     time.Millisecond,
+			Retries:     1,
+		}
+
+		started := time.Now()
+		report, err := actions.Update(client, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(started)).To(BeNumerically(">=", 100*time.Millisecond))
+		Expect(report.RolledBack()).To(HaveLen(1))
+		Expect(report.RolledBack()[0].Error()).To(HavePrefix("container did not become healthy"))
+	})
+
+	When("the rolled back images are remembered", func() {
+		var dir string
+		var rollbacks *update.Rollbacks
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "rollbacks")
+			Expect(err).NotTo(HaveOccurred())
+			rollbacks, err = update.NewRollbacks(dir)
+			Expect(err).NotTo(HaveOccurred())
+			params.RolledBack = rollbacks
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should not update to the failed image again", func() {
+			planner.ContainerInfo().State.Health = &dockerTypes.Health{Status: dockerTypes.Unhealthy}
+			report, err := actions.Update(client, params)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.RolledBack()).To(HaveLen(1))
+			Expect(rollbacks.IsRolledBack("planner", planner.ImageID())).To(BeTrue())
+
+			// The registry still has the image the container was rolled back from
+			client.TestData.LatestImages = map[string]types.ImageID{"/planner": planner.ImageID()}
+			report, err = actions.Update(client, params)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Updated()).To(BeEmpty())
+			Expect(report.RolledBack()).To(BeEmpty())
+			Expect(client.TestData.StoppedContainers).To(HaveLen(2))
+
+			// Until it has a newer one
+			client.TestData.LatestImages = map[string]types.ImageID{"/planner": "sha256:newer"}
+			report, err = actions.Update(client, params)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.RolledBack()).To(HaveLen(1))
+		})
+	})
+
+	It("should watch the updated containers in the background with a rollback watcher", func() {
+		planner.ContainerInfo().State.Health = &dockerTypes.Health{Status: dockerTypes.Unhealthy}
+		lock := make(chan bool, 1)
+		params.Rollbacks = &actions.RollbackWatcher{Client: client, Lock: lock}
+
+		// The update returns while it still holds the lock, before the container is rolled back
+		report, err := actions.Update(client, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Updated()).To(HaveLen(1))
+		Expect(report.RolledBack()).To(BeEmpty())
+		Consistently(lock, 50*time.Millisecond).ShouldNot(Receive())
+
+		lock <- true
+		Eventually(lock).Should(Receive())
+		Expect(client.TestData.TaggedImages).To(HaveKeyWithValue("robot/planner:1.0", planner.ImageID()))
+		Expect(client.TestData.StoppedContainers).To(Equal([]string{"planner", "planner"}))
+	})
+	It("should roll back a container moved to another release channel to the tag it was running", func() {
+		dir, err := os.MkdirTemp("", "stack")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		store := stack.NewStore(dir)
+		Expect(store.Save(stack.State{Services: []container.Service{{Name: "planner", Image: "robot/planner:stable"}}})).To(Succeed())
+
+		planner = CreateMockContainerWithConfig("planner-id", "/planner", "robot/planner:stable", true, false, time.Now(), &dockerContainer.Config{
+			Image: "robot/planner:stable",
+			Labels: map[string]string{
+				"com.centurylinklabs.watchtower.channels":      "nightly=nightly,production=stable",
+				"com.centurylinklabs.watchtower.stack.service": "planner",
+			},
+		})
+		planner.ContainerInfo().State.Health = &dockerTypes.Health{Status: dockerTypes.Unhealthy}
+		client.TestData.Containers = []types.Container{planner}
+		params.Roles = device.RoleSource{Default: device.Nightly}
+		params.Stack = store
+
+		report, err := actions.Update(client, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.RolledBack()).To(HaveLen(1))
+
+		// The stable tag is restored, the nightly tag is not moved to the previous image
+		Expect(client.TestData.TaggedImages).To(HaveKeyWithValue("robot/planner:stable", planner.ImageID()))
+		Expect(client.TestData.TaggedImages).NotTo(HaveKey("robot/planner:nightly"))
+		state, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Services[0].Image).To(Equal("robot/planner:stable"))
+	})
+})
@@ -0,0 +1,56 @@
+package actions
+
+import (
+	"strings"
+
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/semver"
+	"github.com/containrrr/watchtower/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// setVersionTags moves the containers following a semantic version policy to the highest tag of
+// their image matching it, e.g. from myimg:1.4.2 to myimg:1.4.7 for ~1.4.
+// A container whose tags cannot be listed keeps its tag, and is checked for updates as before.
+// Held containers and containers whose images are not pulled are left alone.
+func setVersionTags(client container.Client, containers []types.Container, params types.UpdateParams) {
+	for _, c := range containers {
+		policy := c.VersionPolicy()
+		if policy == "" {
+			continue
+		}
+		if tag, found := params.VersionTags[strings.TrimPrefix(c.Name(), "/")]; found {
+			c.SetVersionTag(tag)
+			continue
+		}
+		if c.IsNoPull(params) || (params.Holds != nil && params.Holds.IsHeld(c.Name())) {
+			continue
+		}
+		fields := log.Fields{"container": c.Name(), "policy": policy}
+
+		constraint, err := semver.ParseConstraint(policy)
+		if err != nil {
+			log.WithFields(fields).WithError(err).Warn("Ignoring the version policy of the container")
+			continue
+		}
+		tags, err := client.ListImageTags(c)
+		if err != nil {
+			log.WithFields(fields).WithError(err).Warn("Unable to list the tags of the container image")
+			continue
+		}
+
+		current := imageTag(c.ImageName())
+		if latest, found := constraint.Latest(tags, current); found {
+			log.WithFields(fields).WithField("tag", latest).Infof("Found a newer version than %s", current)
+			c.SetVersionTag(latest)
+		}
+	}
+}
+
+// imageTag returns the tag of an image name, which may include a registry port
+func imageTag(imageName string) string {
+	if i := strings.LastIndex(imageName, ":"); i > strings.LastIndex(imageName, "/") {
+		return imageName[i+1:]
+	}
+	return "latest"
+}
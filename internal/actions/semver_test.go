@@ -0,0 +1,122 @@
+package actions_test
+
+import (
+	"os"
+	"time"
+
+	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/filters"
+	"github.com/containrrr/watchtower/pkg/stack"
+	"github.com/containrrr/watchtower/pkg/types"
+	dockerTypes "github.com/docker/docker/api/types"
+	dockerContainer "github.com/docker/docker/api/types/container"
+
+	. "github.com/containrrr/watchtower/internal/actions/mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("semantic version policies", func() {
+	var client MockClient
+	var planner types.Container
+	params := types.UpdateParams{Filter: filters.NoFilter}
+
+	BeforeEach(func() {
+		planner = CreateMockContainerWithConfig("planner-id", "/planner", "robot/planner:1.4.2", true, false, time.Now(), &dockerContainer.Config{
+			Image: "robot/planner:1.4.2",
+			Labels: map[string]string{
+				"com.centurylinklabs.watchtower.semver": "~1.4",
+			},
+		})
+		client = CreateMockClient(&TestData{
+			Containers: []types.Container{
+				planner,
+				CreateMockContainerWithConfig("driver-id", "/driver", "robot/driver:2.1", true, false, time.Now(), &dockerContainer.Config{
+					Image:  "robot/driver:2.1",
+					Labels: map[string]string{},
+				}),
+			},
+			ImageTags: map[string][]string{
+				"/planner": {"1.4.2", "1.4.7", "1.5.0", "latest"},
+				"/driver":  {"2.1", "2.2"},
+			},
+		}, false, false)
+	})
+
+	It("should check the highest tag matching the policy for updates", func() {
+		statuses, err := actions.CheckForUpdates(client, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statuses).To(ContainElement(HaveField("Image", "robot/planner:1.4.7")))
+		Expect(statuses).To(ContainElement(HaveField("Image", "robot/driver:2.1")))
+	})
+
+	It("should update the container to the highest tag matching the policy", func() {
+		report, err := actions.Update(client, params)
+		Expect(err).NotTo(HaveOccurred())
+		images := []string{}
+		for _, c := range report.Updated() {
+			images = append(images, c.ImageName())
+		}
+		Expect(images).To(ContainElement("robot/planner:1.4.7"))
+		Expect(planner.ImageName()).To(Equal("robot/planner:1.4.7"))
+	})
+
+	It("should use the given version tags instead of listing the tags", func() {
+		client.TestData.ImageTags = nil
+		pinned := params
+		pinned.NoPull = true
+		pinned.VersionTags = map[string]string{"planner": "1.4.5"}
+		_, err := actions.Update(client, pinned)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(planner.ImageName()).To(Equal("robot/planner:1.4.5"))
+	})
+
+	It("should keep the tag of the container when its tags cannot be listed", func() {
+		client.TestData.ImageTags = nil
+		_, err := actions.Update(client, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(planner.ImageName()).To(Equal("robot/planner:1.4.2"))
+	})
+	When("the container belongs to a stack service", func() {
+		var dir string
+		var store *stack.Store
+		var stackParams types.UpdateParams
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "stack")
+			Expect(err).NotTo(HaveOccurred())
+			store = stack.NewStore(dir)
+			Expect(store.Save(stack.State{Services: []container.Service{{Name: "planner", Image: "robot/planner:1.4.2"}}})).To(Succeed())
+			planner.ContainerInfo().Config.Labels["com.centurylinklabs.watchtower.stack.service"] = "planner"
+			stackParams = params
+			stackParams.Stack = store
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		serviceImage := func() string {
+			state, err := store.Load()
+			Expect(err).NotTo(HaveOccurred())
+			return state.Services[0].Image
+		}
+
+		It("should record the new version tag as the image of the service", func() {
+			_, err := actions.Update(client, stackParams)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(serviceImage()).To(Equal("robot/planner:1.4.7"))
+		})
+
+		It("should record the previous version tag once the container was rolled back", func() {
+			planner.ContainerInfo().State.Health = &dockerTypes.Health{Status: dockerTypes.Unhealthy}
+			stackParams.RollbackGracePeriod = 10 * time.Millisecond
+
+			report, err := actions.Update(client, stackParams)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.RolledBack()).To(HaveLen(1))
+			Expect(serviceImage()).To(Equal("robot/planner:1.4.2"))
+		})
+	})
+})
@@ -0,0 +1,405 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	containerService "github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/sorter"
+	"github.com/containrrr/watchtower/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultDependencyTimeout is how long to wait for a dependency to become healthy if no timeout is set
+const DefaultDependencyTimeout = 2 * time.Minute
+
+// serviceStopTimeout is how long a service is given to stop gracefully before it is killed
+const serviceStopTimeout = 10 * time.Second
+
+// dependencyPollInterval is how often the state of a dependency is checked while waiting for it
+var dependencyPollInterval = time.Second
+
+// Results of reconciling a single service
+const (
+	ResultStarted   = "started"
+	ResultStopped   = "stopped"
+	ResultPaused    = "paused"
+	ResultUnpaused  = "unpaused"
+	ResultRestarted = "restarted"
+	ResultRecreated = "recreated"
+	ResultUnchanged = "unchanged"
+	ResultSkipped   = "skipped"
+	ResultFailed    = "failed"
+)
+
+// ServiceResult is the outcome of reconciling a single service
+type ServiceResult struct {
+	Service   string `json:"service"`
+	Container string `json:"container,omitempty"`
+	Action    string `json:"action"`
+	Result    string `json:"result"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Failed returns whether the service could not be reconciled
+func (r ServiceResult) Failed() bool {
+	return r.Result == ResultFailed || r.Result == ResultSkipped
+}
+
+// StackOptions contains the options for reconciling a stack of services
+type StackOptions struct {
+	// Action overrides the action of every service in the stack, if set
+	Action string
+	// DependencyTimeout is how long to wait for a dependency to meet its depends_on condition
+	DependencyTimeout time.Duration
+	// Networks are the networks defined by the stack, which are created when a service needs them
+	Networks []containerService.Network
+	// Volumes are the named volumes defined by the stack, which are created when a service needs them
+	Volumes []containerService.Volume
+	// Services are all services of the stack, which defaults to the reconciled services. Dependencies
+	// on services of the stack that are not reconciled are looked up by their container name.
+	Services []containerService.Service
+}
+
+// ReconcileStack applies the action of every service in the stack. Services that are stopped or
+// paused are handled first, in reverse dependency order, so that no service loses a dependency
+// while it is still running. The remaining services are then started or restarted in dependency
+// order, after each of their dependencies meets its depends_on condition. Services depending on a
+// service that failed are skipped. The returned error is only set if the stack itself is invalid,
+// e.g. when a service depends on a service that is not part of the stack.
+func ReconcileStack(client containerService.Client, services []containerService.Service, opts StackOptions) ([]ServiceResult, error) {
+	containerNames, err := stackContainerNames(services, opts.Services)
+	if err != nil {
+		return nil, err
+	}
+	sorted, err := sorter.SortServicesByDependencies(services)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DependencyTimeout <= 0 {
+		opts.DependencyTimeout = DefaultDependencyTimeout
+	}
+	for i := range sorted {
+		if opts.Action != "" {
+			sorted[i].Action = opts.Action
+		}
+	}
+
+	results := make([]ServiceResult, 0, len(sorted))
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if action := sorted[i].Action; action == containerService.ActionStop || action == containerService.ActionPause {
+			results = append(results, ReconcileService(client, &sorted[i]))
+		}
+	}
+
+	containers := map[string]types.ContainerID{}
+	failed := map[string]bool{}
+	for _, service := range sorted {
+		if service.Action == containerService.ActionStop || service.Action == containerService.ActionPause {
+			continue
+		}
+
+		if err := waitForDependencies(client, &service, containerNames, containers, failed, opts.DependencyTimeout); err != nil {
+			log.WithField("service", service.Name).Error(err)
+			failed[service.Name] = true
+			results = append(results, ServiceResult{
+				Service: service.Name,
+				Action:  service.Action,
+				Result:  ResultSkipped,
+				Error:   err.Error(),
+			})
+			continue
+		}
+
+		err := ensureServiceNetworks(client, &service, opts.Networks)
+		if err == nil {
+			err = ensureServiceVolumes(client, &service, opts.Volumes)
+		}
+		if err != nil {
+			log.WithField("service", service.Name).Error(err)
+			failed[service.Name] = true
+			results = append(results, ServiceResult{
+				Service: service.Name,
+				Action:  service.Action,
+				Result:  ResultFailed,
+				Error:   err.Error(),
+			})
+			continue
+		}
+
+		result := ReconcileService(client, &service)
+		if result.Failed() {
+			failed[service.Name] = true
+		} else {
+			containers[service.Name] = types.ContainerID(result.Container)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// stackContainerNames returns the container name of every service of the stack, by service name.
+// A *ValidationError is returned if any of the reconciled services depends on a service outside of the stack.
+func stackContainerNames(services []containerService.Service, stack []containerService.Service) (map[string]string, error) {
+	containerNames := map[string]string{}
+	for _, service := range stack {
+		containerNames[service.Name] = service.ContainerName
+	}
+	for _, service := range services {
+		containerNames[service.Name] = service.ContainerName
+	}
+
+	errs := &containerService.ValidationError{}
+	for _, service := range services {
+		for _, dependency := range service.DependsOn {
+			if _, found := containerNames[dependency]; !found {
+				errs.Add(service.Name, "depends_on", fmt.Errorf("service %s is not part of the stack", dependency))
+			}
+		}
+	}
+	if errs.HasErrors() {
+		return nil, errs
+	}
+	return containerNames, nil
+}
+
+// ReconcileService brings the container of the service into the state requested by its action
+func ReconcileService(client containerService.Client, service *containerService.Service) ServiceResult {
+	result := ServiceResult{Service: service.Name, Action: service.Action}
+	fields := log.Fields{"service": service.Name, "action": service.Action}
+
+	outcome, id, err := reconcileService(client, service)
+	result.Container = string(id)
+	if err != nil {
+		log.WithFields(fields).Error(err)
+		result.Result = ResultFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	log.WithFields(fields).Infof("Service %s", outcome)
+	result.Result = outcome
+	return result
+}
+
+func reconcileService(client containerService.Client, service *containerService.Service) (string, types.ContainerID, error) {
+	existing, err := client.GetContainerByName(service.ContainerName)
+	if err != nil && !errors.Is(err, containerService.ErrContainerNotFound) {
+		return "", "", err
+	}
+	if existing == nil {
+		switch service.Action {
+		case containerService.ActionStop:
+			return ResultUnchanged, "", nil
+		case containerService.ActionPause:
+			return "", "", errors.New("container is not running")
+		}
+		id, err := createServiceContainer(client, service)
+		return ResultStarted, id, err
+	}
+
+	if existing.IsWatchtower() {
+		return "", "", errors.New("refusing to manage the watchtower container")
+	}
+
+	id := existing.ID()
+	paused := isPaused(existing)
+	switch service.Action {
+	case containerService.ActionRun:
+		if paused {
+			return ResultUnpaused, id, client.UnpauseContainer(existing)
+		}
+		outcome := ResultStarted
+		if existing.IsRunning() {
+			if hash, _ := existing.Label(containerService.StackConfigHashLabel); hash == service.ConfigHash() {
+				return ResultUnchanged, id, nil
+			}
+			outcome = ResultRecreated
+		}
+		// Stopped containers are replaced, as their configuration may be outdated
+		if err := client.StopContainer(existing, serviceStopTimeout); err != nil {
+			return "", id, err
+		}
+		id, err := createServiceContainer(client, service)
+		return outcome, id, err
+	case containerService.ActionStop:
+		// A paused container cannot handle the stop signal
+		if paused {
+			if err := client.UnpauseContainer(existing); err != nil {
+				return "", id, err
+			}
+		}
+		return ResultStopped, id, client.StopContainer(existing, serviceStopTimeout)
+	case containerService.ActionPause:
+		if paused {
+			return ResultUnchanged, id, nil
+		}
+		if !existing.IsRunning() {
+			return "", id, errors.New("container is not running")
+		}
+		return ResultPaused, id, client.PauseContainer(existing)
+	case containerService.ActionRestart:
+		if paused {
+			if err := client.UnpauseContainer(existing); err != nil {
+				return "", id, err
+			}
+		}
+		return ResultRestarted, id, client.RestartContainer(existing, serviceStopTimeout)
+	default:
+		return "", id, fmt.Errorf("unknown action %q", service.Action)
+	}
+}
+
+// ensureServiceNetworks creates the networks the service is attached to. Networks that are
+// not defined by the stack have to exist already.
+func ensureServiceNetworks(client containerService.Client, service *containerService.Service, networks []containerService.Network) error {
+	for _, serviceNetwork := range service.Networks {
+		definition := containerService.Network{Name: serviceNetwork.Name, External: true}
+		for _, network := range networks {
+			if network.Name == serviceNetwork.Name {
+				definition = network
+				break
+			}
+		}
+		if _, err := client.EnsureNetwork(definition); err != nil {
+			return fmt.Errorf("network %s: %w", serviceNetwork.Name, err)
+		}
+	}
+	return nil
+}
+
+// ensureServiceVolumes creates the named volumes the service mounts. Volumes that are
+// not defined by the stack have to exist already.
+func ensureServiceVolumes(client containerService.Client, service *containerService.Service, volumes []containerService.Volume) error {
+	for _, serviceVolume := range service.Volumes {
+		// Anonymous volumes are created along with the container
+		if serviceVolume.Type != containerService.VolumeTypeVolume || serviceVolume.Source == "" {
+			continue
+		}
+		definition := containerService.Volume{Name: serviceVolume.Source, External: true}
+		for _, volume := range volumes {
+			if volume.Name == serviceVolume.Source {
+				definition = volume
+				break
+			}
+		}
+		if _, err := client.EnsureVolume(definition); err != nil {
+			return fmt.Errorf("volume %s: %w", serviceVolume.Source, err)
+		}
+	}
+	return nil
+}
+
+func createServiceContainer(client containerService.Client, service *containerService.Service) (types.ContainerID, error) {
+	containerConfig, networkConfig, hostConfig := makeContainerCreateOptions(service, nil)
+	return client.StartContainer(service.ContainerName, containerConfig, hostConfig, networkConfig)
+}
+
+func isPaused(container types.Container) bool {
+	state := container.ContainerInfo().State
+	return state != nil && state.Paused
+}
+
+// waitForDependencies blocks until every dependency of the service meets its depends_on condition
+func waitForDependencies(
+	client containerService.Client,
+	service *containerService.Service,
+	containerNames map[string]string,
+	containers map[string]types.ContainerID,
+	failed map[string]bool,
+	timeout time.Duration) error {
+
+	for _, dependency := range service.DependsOn {
+		if failed[dependency] {
+			return fmt.Errorf("dependency %s failed", dependency)
+		}
+		condition := service.DependsOnCondition[dependency]
+		if err := waitForDependency(client, containerNames, containers, dependency, condition, timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForDependency blocks until the dependency meets the condition, or the timeout expires.
+// Dependencies that are not being reconciled are looked up by the container name of their service.
+func waitForDependency(
+	client containerService.Client,
+	containerNames map[string]string,
+	containers map[string]types.ContainerID,
+	dependency string,
+	condition string,
+	timeout time.Duration) error {
+
+	id, found := containers[dependency]
+	if !found {
+		existing, err := client.GetContainerByName(containerNames[dependency])
+		if err != nil {
+			return fmt.Errorf("dependency %s: %w", dependency, err)
+		}
+		id = existing.ID()
+	}
+
+	if condition == "" || condition == containerService.DependencyStarted {
+		return nil
+	}
+
+	log.WithField("dependency", dependency).Debugf("Waiting for condition %s", condition)
+	deadline := time.Now().Add(timeout)
+	for {
+		container, err := client.GetContainer(id)
+		if err != nil {
+			return fmt.Errorf("dependency %s: %w", dependency, err)
+		}
+
+		done, err := dependencyConditionMet(container, condition)
+		if err != nil {
+			return fmt.Errorf("dependency %s: %w", dependency, err)
+		}
+		if done {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("dependency %s: timed out after %s waiting for %s", dependency, timeout, condition)
+		}
+		time.Sleep(dependencyPollInterval)
+	}
+}
+
+// dependencyConditionMet returns whether the container meets the condition. An error is returned
+// if the condition can no longer be met, e.g. when the container reports as unhealthy.
+func dependencyConditionMet(container types.Container, condition string) (bool, error) {
+	state := container.ContainerInfo().State
+	if state == nil {
+		return false, nil
+	}
+
+	switch condition {
+	case containerService.DependencyHealthy:
+		if state.Health == nil {
+			return false, errors.New("container has no healthcheck")
+		}
+		switch state.Health.Status {
+		case "healthy":
+			return true, nil
+		case "unhealthy":
+			return false, errors.New("container is unhealthy")
+		}
+		if !state.Running && !state.Restarting {
+			return false, errors.New("container exited before becoming healthy")
+		}
+		return false, nil
+	case containerService.DependencyCompleted:
+		if state.Running || state.Restarting || state.Status == "created" {
+			return false, nil
+		}
+		if state.ExitCode != 0 {
+			return false, fmt.Errorf("container exited with code %d", state.ExitCode)
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown condition %q", condition)
+	}
+}
@@ -0,0 +1,335 @@
+package actions_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/types"
+	dockerTypes "github.com/docker/docker/api/types"
+	dockerContainer "github.com/docker/docker/api/types/container"
+
+	. "github.com/containrrr/watchtower/internal/actions/mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func makeStackService(name string, conditions map[string]string) container.Service {
+	dependsOn := []string{}
+	for dependency := range conditions {
+		dependsOn = append(dependsOn, dependency)
+	}
+	return container.Service{
+		Name:               name,
+		Action:             container.ActionRun,
+		ContainerName:      name,
+		Image:              name + ":latest",
+		DependsOn:          dependsOn,
+		DependsOnCondition: conditions,
+	}
+}
+
+func makeExistingContainer(name string, running bool, paused bool) types.Container {
+	c := CreateMockContainerWithConfig(name, "/"+name, name+":latest", running, false, time.Now(), &dockerContainer.Config{
+		Labels: map[string]string{},
+	})
+	c.ContainerInfo().State.Paused = paused
+	return c
+}
+
+// makeServiceContainer returns a running container created from the current definition of the service
+func makeServiceContainer(service container.Service, paused bool) types.Container {
+	c := makeExistingContainer(service.ContainerName, true, paused)
+	c.ContainerInfo().Config.Labels[container.StackConfigHashLabel] = service.ConfigHash()
+	return c
+}
+
+func resultsOf(results []actions.ServiceResult) map[string]string {
+	output := map[string]string{}
+	for _, result := range results {
+		output[result.Service] = result.Result
+	}
+	return output
+}
+
+var _ = Describe("the stack actions", func() {
+	var testData *TestData
+	var client MockClient
+
+	BeforeEach(func() {
+		testData = &TestData{
+			Containers: []types.Container{},
+			States:     map[string]*dockerTypes.ContainerState{},
+		}
+		client = CreateMockClient(testData, false, false)
+	})
+
+	stack := func() []container.Service {
+		return []container.Service{
+			makeStackService("web", map[string]string{"api": container.DependencyStarted}),
+			makeStackService("api", map[string]string{"db": container.DependencyHealthy}),
+			makeStackService("db", nil),
+		}
+	}
+
+	When("starting a stack", func() {
+		It("should start the services after their dependencies", func() {
+			testData.States["db"] = &dockerTypes.ContainerState{
+				Running: true,
+				Health:  &dockerTypes.Health{Status: "healthy"},
+			}
+			results, err := actions.ReconcileStack(client, stack(), actions.StackOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testData.StartedContainers).To(Equal([]string{"db", "api", "web"}))
+			Expect(resultsOf(results)).To(Equal(map[string]string{
+				"db":  actions.ResultStarted,
+				"api": actions.ResultStarted,
+				"web": actions.ResultStarted,
+			}))
+		})
+
+		It("should skip dependents of an unhealthy service", func() {
+			testData.States["db"] = &dockerTypes.ContainerState{
+				Running: true,
+				Health:  &dockerTypes.Health{Status: "unhealthy"},
+			}
+			results, err := actions.ReconcileStack(client, stack(), actions.StackOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testData.StartedContainers).To(Equal([]string{"db"}))
+			Expect(results[1].Error).To(Equal("dependency db: container is unhealthy"))
+			Expect(resultsOf(results)).To(Equal(map[string]string{
+				"db":  actions.ResultStarted,
+				"api": actions.ResultSkipped,
+				"web": actions.ResultSkipped,
+			}))
+		})
+
+		It("should fail when waiting on the health of a service without a healthcheck", func() {
+			results, err := actions.ReconcileStack(client, stack(), actions.StackOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results[1].Error).To(Equal("dependency db: container has no healthcheck"))
+		})
+
+		It("should wait for one-off services to complete", func() {
+			services := []container.Service{
+				makeStackService("app", map[string]string{"migrate": container.DependencyCompleted}),
+				makeStackService("migrate", nil),
+			}
+			testData.States["migrate"] = &dockerTypes.ContainerState{Status: "exited", ExitCode: 1}
+			results, err := actions.ReconcileStack(client, services, actions.StackOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results[1].Error).To(Equal("dependency migrate: container exited with code 1"))
+		})
+
+		It("should refuse circular dependencies", func() {
+			services := []container.Service{
+				makeStackService("a", map[string]string{"b": container.DependencyStarted}),
+				makeStackService("b", map[string]string{"a": container.DependencyStarted}),
+			}
+			_, err := actions.ReconcileStack(client, services, actions.StackOptions{})
+			Expect(err).To(HaveOccurred())
+			Expect(testData.StartedContainers).To(BeEmpty())
+		})
+
+		It("should refuse dependencies on services outside of the stack", func() {
+			testData.Containers = []types.Container{makeExistingContainer("missing", true, false)}
+			services := []container.Service{makeStackService("app", map[string]string{"missing": container.DependencyStarted})}
+			_, err := actions.ReconcileStack(client, services, actions.StackOptions{})
+			var validationErr *container.ValidationError
+			Expect(errors.As(err, &validationErr)).To(BeTrue())
+			Expect(validationErr.Errors).To(ConsistOf(
+				container.FieldError{Service: "app", Field: "depends_on", Message: "service missing is not part of the stack"},
+			))
+			Expect(testData.StartedContainers).To(BeEmpty())
+		})
+
+		It("should look up dependencies that are not reconciled by the container name of their service", func() {
+			testData.Containers = []types.Container{makeExistingContainer("stack-db", true, false)}
+			db := makeStackService("db", nil)
+			db.ContainerName = "stack-db"
+			app := makeStackService("app", map[string]string{"db": container.DependencyStarted})
+			results, err := actions.ReconcileStack(client, []container.Service{app}, actions.StackOptions{
+				Services: []container.Service{app, db},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resultsOf(results)).To(Equal(map[string]string{"app": actions.ResultStarted}))
+		})
+
+		It("should fail on dependencies of the stack without a container", func() {
+			db := makeStackService("db", nil)
+			app := makeStackService("app", map[string]string{"db": container.DependencyStarted})
+			results, _ := actions.ReconcileStack(client, []container.Service{app}, actions.StackOptions{
+				Services: []container.Service{app, db},
+			})
+			Expect(results[0].Error).To(Equal("dependency db: cannot find container"))
+		})
+
+		It("should create the networks of the services", func() {
+			api := makeStackService("api", nil)
+			api.Networks = []container.ServiceNetwork{{Name: "backend", Aliases: []string{"rest"}}}
+			networks := []container.Network{{Name: "backend", Driver: "bridge"}, {Name: "unused"}}
+
+			results, err := actions.ReconcileStack(client, []container.Service{api}, actions.StackOptions{Networks: networks})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results[0].Result).To(Equal(actions.ResultStarted))
+			Expect(testData.Networks).To(HaveKey("backend"))
+			Expect(testData.Networks).NotTo(HaveKey("unused"))
+		})
+
+		It("should fail on networks that are neither defined nor existing", func() {
+			api := makeStackService("api", nil)
+			api.Networks = []container.ServiceNetwork{{Name: "elsewhere"}}
+
+			results, err := actions.ReconcileStack(client, []container.Service{api}, actions.StackOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results[0].Result).To(Equal(actions.ResultFailed))
+			Expect(results[0].Error).To(Equal("network elsewhere: external network elsewhere does not exist"))
+			Expect(testData.StartedContainers).To(BeEmpty())
+		})
+
+		It("should create the named volumes of the services", func() {
+			mapper := makeStackService("mapper", nil)
+			mapper.Volumes = []container.ServiceVolume{
+				{Type: container.VolumeTypeVolume, Source: "maps", Destination: "/maps"},
+				{Type: container.VolumeTypeVolume, Destination: "/cache"},
+				{Type: container.VolumeTypeTmpfs, Destination: "/scratch"},
+			}
+			volumes := []container.Volume{{Name: "maps", Driver: "local"}}
+
+			results, err := actions.ReconcileStack(client, []container.Service{mapper}, actions.StackOptions{Volumes: volumes})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results[0].Result).To(Equal(actions.ResultStarted))
+			Expect(testData.Volumes).To(Equal(map[string]container.Volume{"maps": volumes[0]}))
+		})
+
+		It("should fail on volumes that are neither defined nor existing", func() {
+			mapper := makeStackService("mapper", nil)
+			mapper.Volumes = []container.ServiceVolume{{Type: container.VolumeTypeVolume, Source: "maps", Destination: "/maps"}}
+
+			results, err := actions.ReconcileStack(client, []container.Service{mapper}, actions.StackOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results[0].Result).To(Equal(actions.ResultFailed))
+			Expect(results[0].Error).To(Equal("volume maps: external volume maps does not exist"))
+		})
+
+		It("should leave running services unchanged and unpause paused services", func() {
+			services := []container.Service{
+				makeStackService("api", map[string]string{"db": container.DependencyStarted}),
+				makeStackService("db", nil),
+			}
+			testData.Containers = []types.Container{
+				makeServiceContainer(services[1], false),
+				makeServiceContainer(services[0], true),
+			}
+			results, err := actions.ReconcileStack(client, services, actions.StackOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testData.StartedContainers).To(BeEmpty())
+			Expect(testData.UnpausedContainers).To(Equal([]string{"api"}))
+			Expect(resultsOf(results)).To(Equal(map[string]string{
+				"db":  actions.ResultUnchanged,
+				"api": actions.ResultUnpaused,
+			}))
+		})
+
+		It("should recreate running services whose definition changed", func() {
+			db := makeStackService("db", nil)
+			cache := makeStackService("cache", nil)
+			testData.Containers = []types.Container{
+				makeServiceContainer(db, false),
+				makeServiceContainer(cache, false),
+				makeExistingContainer("legacy", true, false),
+			}
+			db.Environment = []string{"POSTGRES_DB=robot"}
+			legacy := makeStackService("legacy", nil)
+
+			results, err := actions.ReconcileStack(client, []container.Service{db, cache, legacy}, actions.StackOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testData.StoppedContainers).To(ConsistOf("db", "legacy"))
+			Expect(testData.StartedContainers).To(ConsistOf("db", "legacy"))
+			Expect(resultsOf(results)).To(Equal(map[string]string{
+				"db":     actions.ResultRecreated,
+				"cache":  actions.ResultUnchanged,
+				"legacy": actions.ResultRecreated,
+			}))
+		})
+
+		It("should not recreate services whose action changed", func() {
+			worker := makeStackService("worker", nil)
+			testData.Containers = []types.Container{makeServiceContainer(worker, false)}
+			worker.Action = container.ActionRestart
+
+			results, err := actions.ReconcileStack(client, []container.Service{worker}, actions.StackOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testData.StartedContainers).To(BeEmpty())
+			Expect(resultsOf(results)).To(Equal(map[string]string{"worker": actions.ResultRestarted}))
+		})
+
+		It("should apply the action of each service", func() {
+			testData.Containers = []types.Container{
+				makeExistingContainer("worker", true, false),
+				makeExistingContainer("legacy", true, false),
+			}
+			worker := makeStackService("worker", nil)
+			worker.Action = container.ActionPause
+			legacy := makeStackService("legacy", nil)
+			legacy.Action = container.ActionStop
+
+			results, err := actions.ReconcileStack(client, []container.Service{worker, legacy}, actions.StackOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testData.PausedContainers).To(Equal([]string{"worker"}))
+			Expect(testData.StoppedContainers).To(Equal([]string{"legacy"}))
+			Expect(resultsOf(results)).To(Equal(map[string]string{
+				"worker": actions.ResultPaused,
+				"legacy": actions.ResultStopped,
+			}))
+		})
+	})
+
+	When("stopping a stack", func() {
+		It("should stop the services in reverse dependency order", func() {
+			testData.Containers = []types.Container{
+				makeExistingContainer("db", true, false),
+				makeExistingContainer("api", true, false),
+				makeExistingContainer("web", true, true),
+			}
+			results, err := actions.ReconcileStack(client, stack(), actions.StackOptions{Action: container.ActionStop})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testData.StoppedContainers).To(Equal([]string{"web", "api", "db"}))
+			Expect(testData.UnpausedContainers).To(Equal([]string{"web"}))
+			for _, result := range results {
+				Expect(result.Result).To(Equal(actions.ResultStopped))
+			}
+		})
+
+		It("should leave services without a container unchanged", func() {
+			results, err := actions.ReconcileStack(client, stack(), actions.StackOptions{Action: container.ActionStop})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testData.StoppedContainers).To(BeEmpty())
+			for _, result := range results {
+				Expect(result.Result).To(Equal(actions.ResultUnchanged))
+			}
+		})
+	})
+
+	When("pausing or restarting a stack", func() {
+		It("should fail to pause services that are not running", func() {
+			results, _ := actions.ReconcileStack(client, stack(), actions.StackOptions{Action: container.ActionPause})
+			for _, result := range results {
+				Expect(result.Result).To(Equal(actions.ResultFailed))
+				Expect(result.Error).To(Equal("container is not running"))
+			}
+		})
+
+		It("should restart existing services and start missing ones", func() {
+			testData.Containers = []types.Container{makeExistingContainer("worker", true, false)}
+			services := []container.Service{makeStackService("worker", nil), makeStackService("cache", nil)}
+			results, err := actions.ReconcileStack(client, services, actions.StackOptions{Action: container.ActionRestart})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resultsOf(results)).To(Equal(map[string]string{
+				"worker": actions.ResultRestarted,
+				"cache":  actions.ResultStarted,
+			}))
+		})
+	})
+})
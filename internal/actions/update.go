@@ -1,10 +1,15 @@
 package actions
 
 import (
+	"crypto/ed25519"
 	"errors"
+	"fmt"
+	"os"
 
 	"github.com/containrrr/watchtower/internal/util"
+	"github.com/containrrr/watchtower/pkg/bundle"
 	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/filters"
 	"github.com/containrrr/watchtower/pkg/lifecycle"
 	"github.com/containrrr/watchtower/pkg/session"
 	"github.com/containrrr/watchtower/pkg/sorter"
@@ -29,11 +34,19 @@ func Update(client container.Client, params types.UpdateParams) (types.Report, e
 	if err != nil {
 		return nil, err
 	}
+	if err := setChannels(containers, params.Roles); err != nil {
+		return nil, err
+	}
+	setVersionTags(client, containers, params)
 
 	staleCheckFailed := 0
 
 	for i, targetContainer := range containers {
 		stale, newestImage, err := client.IsContainerStale(targetContainer, params)
+		if err == nil && stale && params.RolledBack != nil && params.RolledBack.IsRolledBack(targetContainer.Name(), newestImage) {
+			log.WithField("container", targetContainer.Name()).Infof("Not updating to %s again, as the container was rolled back from it", newestImage.ShortID())
+			stale = false
+		}
 		shouldUpdate := stale && !params.NoRestart && !targetContainer.IsMonitorOnly(params)
 		if err == nil && shouldUpdate {
 			// Check to make sure we have all the necessary information for recreating the container
@@ -54,6 +67,8 @@ func Update(client container.Client, params types.UpdateParams) (types.Report, e
 			stale = false
 			staleCheckFailed++
 			progress.AddSkipped(targetContainer, err)
+		} else if params.Holds != nil && params.Holds.IsHeld(targetContainer.Name()) {
+			progress.AddHeld(targetContainer)
 		} else {
 			progress.AddScanned(targetContainer, newestImage)
 		}
@@ -79,13 +94,22 @@ func Update(client container.Client, params types.UpdateParams) (types.Report, e
 		}
 	}
 
-	if params.RollingRestart {
-		progress.UpdateFailed(performRollingRestart(containersToUpdate, client, params))
+	if deferrals := checkGate(containersToUpdate, params); len(deferrals) > 0 {
+		progress.UpdateDeferred(deferrals)
 	} else {
-		failedStop, stoppedImages := stopContainersInReversedOrder(containersToUpdate, client, params)
-		progress.UpdateFailed(failedStop)
-		failedStart := reStartContainerWithExistingConfigsInSortedOrder(containersToUpdate, client, params, stoppedImages)
-		progress.UpdateFailed(failedStart)
+		var updated []types.UpdatedContainer
+		if params.RollingRestart {
+			var failed map[types.ContainerID]error
+			failed, updated = performRollingRestart(containersToUpdate, client, params)
+			progress.UpdateFailed(failed)
+		} else {
+			failedStop, stoppedImages := stopContainersInReversedOrder(containersToUpdate, client, params)
+			progress.UpdateFailed(failedStop)
+			var failedStart map[types.ContainerID]error
+			failedStart, updated = reStartContainerWithExistingConfigsInSortedOrder(containersToUpdate, client, params, stoppedImages)
+			progress.UpdateFailed(failedStart)
+		}
+		watchUpdates(client, progress, updated, params)
 	}
 
 	if params.LifecycleHooks {
@@ -94,16 +118,73 @@ func Update(client container.Client, params types.UpdateParams) (types.Report, e
 	return progress.Report(), nil
 }
 
-func CheckForNewUpdateFromRegistry(client container.Client, params types.UpdateParams) (bool, error) {
+// watchUpdates watches the updated containers for the rollback grace period, in the background
+// if the parameters have a rollback watcher, and otherwise before reporting the rolled back ones
+func watchUpdates(client container.Client, progress *session.Progress, updated []types.UpdatedContainer, params types.UpdateParams) {
+	if params.Rollbacks != nil {
+		params.Rollbacks.Watch(updated, params)
+		return
+	}
+	if len(updated) == 0 {
+		return
+	}
+	failures := watchUpdatedContainers(client, updated, params.RollbackGracePeriod)
+	updateFailed(*progress, rollBackFailed(client, updated, failures, params))
+}
+
+// updateFailed marks the containers as failed, or as rolled back if they were restored to their previous image
+func updateFailed(progress session.Progress, failures map[types.ContainerID]error) {
+	rolledBack := make(map[types.ContainerID]error)
+	for id, err := range failures {
+		if errors.As(err, &rolledBackError{}) {
+			rolledBack[id] = err
+			delete(failures, id)
+		}
+	}
+	progress.UpdateFailed(failures)
+	progress.UpdateRolledBack(rolledBack)
+}
+
+// CheckForUpdates checks the registry for a newer image of every container matching the filter,
+// except the held ones.
+// A failed check is reported in the status of the container, and does not stop the other checks.
+func CheckForUpdates(client container.Client, params types.UpdateParams) ([]types.UpdateStatus, error) {
 	log.Debug("Checking for updated images from registry")
-	containers, err := client.ListContainers(params.Filter)
+	containers, err := client.ListContainers(filters.FilterByHolds(params.Holds, params.Filter))
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	if err := setChannels(containers, params.Roles); err != nil {
+		return nil, err
+	}
+	setVersionTags(client, containers, params)
+
+	return checkContainers(client, containers), nil
+}
 
+// checkContainers returns the update status of every container, in the same order
+func checkContainers(client container.Client, containers []types.Container) []types.UpdateStatus {
+	statuses := make([]types.UpdateStatus, 0, len(containers))
 	for _, targetContainer := range containers {
-		if match, err := client.CheckImageDigest(targetContainer); err != nil {
-			return !match, err
+		status, err := client.CheckForUpdate(targetContainer)
+		if err != nil {
+			log.WithField("container", targetContainer.Name()).Warnf("Unable to check for updates: %v", err)
+			status.Error = err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// CheckForNewUpdateFromRegistry returns whether a newer image is available for any of the containers
+func CheckForNewUpdateFromRegistry(client container.Client, params types.UpdateParams) (bool, error) {
+	statuses, err := CheckForUpdates(client, params)
+	if err != nil {
+		return false, err
+	}
+	for _, status := range statuses {
+		if status.UpdateAvailable {
+			return true, nil
 		}
 	}
 	return false, nil
@@ -124,17 +205,76 @@ func DownloadUpdate(client container.Client, params types.UpdateParams) error {
 	return nil
 }
 
-// TODO
-func LoadUpdate(client container.Client, params types.UpdateParams) error {
-	if err := client.LoadImageFromUSB("robotics_base.tar"); err != nil {
+// LoadUpdate verifies the offline update bundle against the trusted keys and loads its images.
+// The containers running the images are then updated like after pulling them from a registry.
+// The image archives are staged in the temporary directory (TMPDIR) one at a time while they
+// are verified, so that only the checked copies are loaded.
+func LoadUpdate(client container.Client, b *bundle.Bundle, keys []ed25519.PublicKey, params types.UpdateParams) (types.Report, error) {
+	fields := log.Fields{"bundle": b.Manifest.Name, "path": b.Path}
+	if err := b.VerifySignature(keys); err != nil {
+		return nil, err
+	}
+	log.WithFields(fields).Info("Loading offline update bundle")
+
+	stagingDir, err := os.MkdirTemp("", "watchtower-bundle")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stagingDir)
+
+	// Each image updates the containers running one of its tags, limited to its services if it lists any
+	imageFilters := make([]types.Filter, 0, len(b.Manifest.Images))
+	for _, image := range b.Manifest.Images {
+		if err := loadBundleImage(client, b, image, stagingDir); err != nil {
+			return nil, fmt.Errorf("image %s: %w", image.File, err)
+		}
+		imageFilters = append(imageFilters, filters.FilterByNames(image.Services, filters.FilterByImageTags(image.Tags, filters.NoFilter)))
+	}
+
+	// The images are already present, so they must not be pulled
+	params.NoPull = true
+	baseFilter := params.Filter
+	if baseFilter == nil {
+		baseFilter = filters.NoFilter
+	}
+	params.Filter = filters.FilterByAny(imageFilters, baseFilter)
+	return Update(client, params)
+}
+
+// loadBundleImage loads a staged copy of the image archive, and checks that the loaded tags
+// refer to the image listed in the manifest
+func loadBundleImage(client container.Client, b *bundle.Bundle, image bundle.Image, stagingDir string) error {
+	staged, err := b.StageImage(image, stagingDir)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(staged)
+
+	archive, err := os.Open(staged)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	if err := client.LoadImage(archive); err != nil {
 		return err
 	}
+
+	for _, tag := range image.Tags {
+		id, err := client.GetImageID(tag)
+		if err != nil {
+			return err
+		}
+		if string(id) != image.Digest {
+			return fmt.Errorf("loaded image %s is %s instead of %s", tag, id.ShortID(), types.ImageID(image.Digest).ShortID())
+		}
+	}
 	return nil
 }
 
-func performRollingRestart(containers []types.Container, client container.Client, params types.UpdateParams) map[types.ContainerID]error {
+func performRollingRestart(containers []types.Container, client container.Client, params types.UpdateParams) (map[types.ContainerID]error, []types.UpdatedContainer) {
 	cleanupImageIDs := make(map[types.ImageID]bool, len(containers))
 	failed := make(map[types.ContainerID]error, len(containers))
+	updated := []types.UpdatedContainer{}
 
 	for i := len(containers) - 1; i >= 0; i-- {
 		if containers[i].ToRestart() {
@@ -142,8 +282,11 @@ func performRollingRestart(containers []types.Container, client container.Client
 			if err != nil {
 				failed[containers[i].ID()] = err
 			} else {
-				if err := restartStaleContainer(containers[i], client, params); err != nil {
+				if newContainerID, err := restartStaleContainer(containers[i], client, params); err != nil {
 					failed[containers[i].ID()] = err
+				} else if watchesRollback(containers[i], params) {
+					// The previous image is cleaned up once the container was watched
+					updated = append(updated, types.UpdatedContainer{Previous: containers[i], ID: newContainerID})
 				} else if containers[i].IsStale() {
 					// Only add (previously) stale containers' images to cleanup
 					cleanupImageIDs[containers[i].ImageID()] = true
@@ -155,7 +298,7 @@ func performRollingRestart(containers []types.Container, client container.Client
 	if params.Cleanup {
 		cleanupImages(client, cleanupImageIDs)
 	}
-	return failed
+	return failed, updated
 }
 
 func stopContainersInReversedOrder(containers []types.Container, client container.Client, params types.UpdateParams) (failed map[types.ContainerID]error, stopped map[types.ImageID]bool) {
@@ -210,17 +353,21 @@ func stopStaleContainer(container types.Container, client container.Client, para
 	return nil
 }
 
-func reStartContainerWithExistingConfigsInSortedOrder(containers []types.Container, client container.Client, params types.UpdateParams, stoppedImages map[types.ImageID]bool) map[types.ContainerID]error {
+func reStartContainerWithExistingConfigsInSortedOrder(containers []types.Container, client container.Client, params types.UpdateParams, stoppedImages map[types.ImageID]bool) (map[types.ContainerID]error, []types.UpdatedContainer) {
 	cleanupImageIDs := make(map[types.ImageID]bool, len(containers))
 	failed := make(map[types.ContainerID]error, len(containers))
+	updated := []types.UpdatedContainer{}
 
 	for _, c := range containers {
 		if !c.ToRestart() {
 			continue
 		}
 		if stoppedImages[c.SafeImageID()] {
-			if err := restartStaleContainer(c, client, params); err != nil {
+			if newContainerID, err := restartStaleContainer(c, client, params); err != nil {
 				failed[c.ID()] = err
+			} else if watchesRollback(c, params) {
+				// The previous image is cleaned up once the container was watched
+				updated = append(updated, types.UpdatedContainer{Previous: c, ID: newContainerID})
 			} else if c.IsStale() {
 				// Only add (previously) stale containers' images to cleanup
 				cleanupImageIDs[c.ImageID()] = true
@@ -232,7 +379,7 @@ func reStartContainerWithExistingConfigsInSortedOrder(containers []types.Contain
 		cleanupImages(client, cleanupImageIDs)
 	}
 
-	return failed
+	return failed, updated
 }
 
 func cleanupImages(client container.Client, imageIDs map[types.ImageID]bool) {
@@ -246,7 +393,13 @@ func cleanupImages(client container.Client, imageIDs map[types.ImageID]bool) {
 	}
 }
 
-func restartStaleContainer(container types.Container, client container.Client, params types.UpdateParams) error {
+// watchesRollback returns whether the container is watched for the rollback grace period once it was updated
+func watchesRollback(container types.Container, params types.UpdateParams) bool {
+	return params.RollbackGracePeriod > 0 && !params.NoRestart && container.IsStale() && !container.IsWatchtower()
+}
+
+// restartStaleContainer recreates the container, and returns the ID of the new container
+func restartStaleContainer(container types.Container, client container.Client, params types.UpdateParams) (types.ContainerID, error) {
 	// Since we can't shutdown a watchtower container immediately, we need to
 	// start the new one while the old one is still running. This prevents us
 	// from re-using the same container name so we first rename the current
@@ -254,19 +407,44 @@ func restartStaleContainer(container types.Container, client container.Client, p
 	if container.IsWatchtower() {
 		if err := client.RenameContainer(container, util.RandName()); err != nil {
 			log.Error(err)
-			return nil
+			return "", nil
 		}
 	}
 
-	if !params.NoRestart {
-		if newContainerID, err := client.StartContainerWithExistingConfig(container); err != nil {
-			log.Error(err)
-			return err
-		} else if container.ToRestart() && params.LifecycleHooks {
-			lifecycle.ExecutePostUpdateCommand(client, newContainerID)
+	if params.NoRestart {
+		return "", nil
+	}
+
+	// Keep the previous image tagged, so that it is neither pruned nor cleaned up while the
+	// updated container might still have to be rolled back to it
+	if watchesRollback(container, params) {
+		if err := client.TagImage(container.ImageID(), rollbackTag(container.ImageName())); err != nil {
+			log.WithField("container", container.Name()).Warnf("Unable to tag the previous image: %v", err)
 		}
 	}
-	return nil
+
+	newContainerID, err := client.StartContainerWithExistingConfig(container)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	setStackImage(container, container.ImageName(), params)
+	if container.ToRestart() && params.LifecycleHooks {
+		lifecycle.ExecutePostUpdateCommand(client, newContainerID)
+	}
+	return newContainerID, nil
+}
+
+// setStackImage records the image of a recreated stack service container as the image of its
+// service, so that a container moved to another tag is not taken for a drifted one
+func setStackImage(c types.Container, imageName string, params types.UpdateParams) {
+	service, found := c.Label(container.StackServiceLabel)
+	if !found || params.Stack == nil {
+		return
+	}
+	if err := params.Stack.SetServiceImage(service, imageName); err != nil {
+		log.WithField("container", c.Name()).Warnf("Unable to update the image of the stack service: %v", err)
+	}
 }
 
 // UpdateImplicitRestart iterates through the passed containers, setting the
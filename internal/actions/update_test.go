@@ -1,9 +1,11 @@
 package actions_test
 
 import (
+	"os"
 	"time"
 
 	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/pkg/hold"
 	"github.com/containrrr/watchtower/pkg/types"
 	dockerTypes "github.com/docker/docker/api/types"
 	dockerContainer "github.com/docker/docker/api/types/container"
@@ -469,4 +471,22 @@ var _ = Describe("the update action", func() {
 		})
 
 	})
+	When("a container is held", func() {
+		It("should report it as held, and not update it", func() {
+			dir, err := os.MkdirTemp("", "hold")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			holds, err := hold.NewStore(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(holds.Set(hold.Hold{Container: "test-container-01", Digest: "sha256:4f2a8e6d1c0b9a8877665544332211ffeeddccbbaa99887766554433221100aa"})).To(Succeed())
+
+			client := CreateMockClient(getCommonTestData(""), false, false)
+			report, err := actions.Update(client, types.UpdateParams{Cleanup: true, Holds: holds})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Held()).To(HaveLen(1))
+			Expect(report.Held()[0].State()).To(Equal("Held"))
+			Expect(report.Fresh()).To(BeEmpty())
+			Expect(client.TestData.StoppedContainers).NotTo(ContainElement("test-container-01"))
+		})
+	})
 })
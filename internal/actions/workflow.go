@@ -0,0 +1,246 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/filters"
+	"github.com/containrrr/watchtower/pkg/types"
+	"github.com/containrrr/watchtower/pkg/update"
+	log "github.com/sirupsen/logrus"
+)
+
+// UpdateWorkflow downloads updates and applies them in two separate steps, recording the
+// progress in the update state machine. Downloaded images stay staged until Apply is called,
+// e.g. once the operator approved the update while the robot is docked.
+type UpdateWorkflow struct {
+	Client  container.Client
+	Machine *update.Machine
+	Params  types.UpdateParams
+}
+
+// Download checks the registry for newer images of the containers that are not held and pulls
+// them, without applying them. It returns the state the update ended up in. An update that was
+// downloaded before stays downloaded if none of the containers could be checked.
+func (w *UpdateWorkflow) Download() (update.State, error) {
+	previous := w.Machine.State()
+	if _, err := w.Machine.Transition(update.PhaseChecking, "", nil); err != nil {
+		return w.Machine.State(), err
+	}
+
+	containers, err := w.Client.ListContainers(filters.FilterByHolds(w.Params.Holds, w.Params.Filter))
+	if err != nil {
+		return w.nothingStaged(previous, err.Error(), false)
+	}
+	if err := setChannels(containers, w.Params.Roles); err != nil {
+		return w.nothingStaged(previous, err.Error(), false)
+	}
+	setVersionTags(w.Client, containers, w.Params)
+	available := []types.Container{}
+	toPull := []types.Container{}
+	checkErrors := []string{}
+	// checked is whether any of the containers could be checked
+	checked := false
+	for i, status := range checkContainers(w.Client, containers) {
+		if status.Error != "" {
+			checkErrors = append(checkErrors, fmt.Sprintf("%s: %s", status.Container, status.Error))
+		} else if status.UpdateAvailable {
+			available = append(available, containers[i])
+			if !status.Downloaded {
+				toPull = append(toPull, containers[i])
+			}
+		} else {
+			checked = true
+		}
+	}
+	if len(available) == 0 {
+		log.Debug("Updates not available from upstream")
+		return w.nothingStaged(previous, strings.Join(checkErrors, "; "), checked)
+	}
+
+	if len(toPull) > 0 {
+		if _, err := w.Machine.Transition(update.PhaseDownloading, "", nil); err != nil {
+			return w.Machine.State(), err
+		}
+		log.Infof("Updates available for %d containers. Downloading...", len(toPull))
+	}
+	failed := map[string]string{}
+	for _, c := range toPull {
+		if err := w.Client.PullImage(c); err != nil {
+			log.WithField("container", c.Name()).Errorf("Unable to download the update: %v", err)
+			failed[c.Name()] = err.Error()
+		}
+	}
+
+	staged := []update.StagedImage{}
+	noPull := w.Params
+	noPull.NoPull = true
+	for _, c := range available {
+		if _, failedPull := failed[c.Name()]; failedPull {
+			continue
+		}
+		_, latestImage, err := w.Client.IsContainerStale(c, noPull)
+		if err != nil {
+			failed[c.Name()] = err.Error()
+			continue
+		}
+		checked = true
+		if w.Params.RolledBack != nil && w.Params.RolledBack.IsRolledBack(c.Name(), latestImage) {
+			log.WithField("container", c.Name()).Infof("Not staging %s again, as the container was rolled back from it", latestImage.ShortID())
+			continue
+		}
+		staged = append(staged, update.StagedImage{
+			Container: strings.TrimPrefix(c.Name(), "/"),
+			Image:     c.ImageName(),
+			CurrentID: string(c.SafeImageID()),
+			StagedID:  string(latestImage),
+		})
+	}
+
+	for name, message := range failed {
+		checkErrors = append(checkErrors, fmt.Sprintf("%s: %s", strings.TrimPrefix(name, "/"), message))
+	}
+	if len(staged) == 0 {
+		return w.nothingStaged(previous, strings.Join(checkErrors, "; "), checked)
+	}
+	log.Infof("Downloaded updates for %d containers, waiting for them to be applied", len(staged))
+	return w.Machine.Transition(update.PhaseDownloaded, strings.Join(checkErrors, "; "), staged)
+}
+
+// nothingStaged ends a download that did not stage any image. If none of the containers could be
+// checked, e.g. while the registry is unreachable, a previously downloaded update keeps its staged
+// images, so that it can still be applied. Otherwise the update goes back to idle.
+func (w *UpdateWorkflow) nothingStaged(previous update.State, message string, checked bool) (update.State, error) {
+	if !checked && previous.Phase == update.PhaseDownloaded && len(previous.Staged) > 0 {
+		log.Warnf("Unable to check for updates, keeping the downloaded updates for %d containers", len(previous.Staged))
+		return w.Machine.Transition(update.PhaseDownloaded, message, previous.Staged)
+	}
+	return w.Machine.Transition(update.PhaseIdle, message, []update.StagedImage{})
+}
+
+// Apply updates the containers to their staged images, and verifies that they are running them.
+// The update ends up rolled back if any of the updated containers had to be rolled back, and
+// downloaded again if it was deferred. It fails unless an update has been downloaded.
+// With a rollback watcher, the updated containers are watched in the background, and the update
+// stays verifying until the grace period is over.
+func (w *UpdateWorkflow) Apply() (types.Report, update.State, error) {
+	// Without staged images the filter would match every container
+	if current := w.Machine.State(); len(current.Staged) == 0 {
+		return nil, current, fmt.Errorf("%w: no images are staged", update.ErrInvalidTransition)
+	}
+	state, err := w.Machine.Transition(update.PhaseApplying, "", nil)
+	if err != nil {
+		return nil, state, err
+	}
+
+	names := make([]string, 0, len(state.Staged))
+	// The staged images are applied with their tags, without looking them up again
+	versionTags := map[string]string{}
+	for _, staged := range state.Staged {
+		names = append(names, staged.Container)
+		versionTags[staged.Container] = imageTag(staged.Image)
+	}
+	params := w.Params
+	params.NoPull = true
+	params.Filter = filters.FilterByNames(names, w.Params.Filter)
+	params.VersionTags = versionTags
+	// The updated containers are collected, to verify the update once they have been watched
+	watcher, watchInBackground := w.Params.Rollbacks.(*RollbackWatcher)
+	pending := &pendingRollbacks{}
+	if watchInBackground {
+		params.Rollbacks = pending
+	}
+
+	log.Infof("Applying the updates of %d containers", len(names))
+	report, err := Update(w.Client, params)
+	if err != nil {
+		state, _ = w.Machine.Transition(update.PhaseFailed, err.Error(), nil)
+		return report, state, err
+	}
+
+	if deferred := report.Deferred(); len(deferred) > 0 {
+		message := fmt.Sprintf("deferred: %s", deferred[0].Error())
+		state, err = w.Machine.Transition(update.PhaseDownloaded, message, nil)
+		return report, state, err
+	}
+
+	verifying, err := w.Machine.Transition(update.PhaseVerifying, "", nil)
+	if err != nil {
+		return report, w.Machine.State(), err
+	}
+	if watchInBackground && len(pending.updated) > 0 {
+		go func() {
+			watched := watcher.watch(pending.updated, pending.params)
+			if _, err := w.finish(watched, state.Staged); err != nil {
+				log.WithError(err).Error("Unable to finish verifying the update")
+			}
+		}()
+		return report, verifying, nil
+	}
+	state, err = w.finish(report, state.Staged)
+	return report, state, err
+}
+
+// finish moves the update from verifying to rolled back if the report has rolled back
+// containers, to failed if they are not running the staged images, and to done otherwise
+func (w *UpdateWorkflow) finish(report types.Report, staged []update.StagedImage) (update.State, error) {
+	if rolledBack := report.RolledBack(); len(rolledBack) > 0 {
+		problems := make([]string, 0, len(rolledBack))
+		for _, c := range rolledBack {
+			problems = append(problems, fmt.Sprintf("%s: %s", strings.TrimPrefix(c.Name(), "/"), c.Error()))
+		}
+		message := strings.Join(problems, "; ")
+		log.Errorf("The update was rolled back: %s", message)
+		return w.Machine.Transition(update.PhaseRolledBack, message, nil)
+	}
+	if problems := w.verify(staged); len(problems) > 0 {
+		message := strings.Join(problems, "; ")
+		log.Errorf("The update could not be verified: %s", message)
+		return w.Machine.Transition(update.PhaseFailed, message, nil)
+	}
+	return w.Machine.Transition(update.PhaseDone, "", []update.StagedImage{})
+}
+
+// pendingRollbacks collects the containers an update passes to the rollback watcher
+type pendingRollbacks struct {
+	updated []types.UpdatedContainer
+	params  types.UpdateParams
+}
+
+func (p *pendingRollbacks) Watch(updated []types.UpdatedContainer, params types.UpdateParams) {
+	p.updated = append(p.updated, updated...)
+	p.params = params
+}
+
+// verify returns why the containers are not running their staged images, if they are not.
+// Held containers keep their current image.
+func (w *UpdateWorkflow) verify(staged []update.StagedImage) []string {
+	problems := []string{}
+	for _, image := range staged {
+		if w.Params.Holds != nil && w.Params.Holds.IsHeld(image.Container) {
+			// Held after the download, so it was not updated
+			continue
+		}
+		c, err := w.Client.GetContainerByName(image.Container)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", image.Container, err))
+		} else if !c.IsRunning() {
+			problems = append(problems, fmt.Sprintf("%s: not running", image.Container))
+		} else if image.StagedID != "" && string(c.SafeImageID()) != image.StagedID {
+			problems = append(problems, fmt.Sprintf("%s: running %s instead of %s", image.Container, c.SafeImageID().ShortID(), types.ImageID(image.StagedID).ShortID()))
+		}
+	}
+	return problems
+}
+
+// RetryApply applies the update again through the retrier, if the report deferred it
+func (w *UpdateWorkflow) RetryApply(retrier *Retrier, report types.Report) {
+	if report == nil || len(report.Deferred()) == 0 {
+		return
+	}
+	retrier.Retry(report, func() (types.Report, error) {
+		report, _, err := w.Apply()
+		return report, err
+	})
+}
@@ -0,0 +1,149 @@
+package actions_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/pkg/filters"
+	"github.com/containrrr/watchtower/pkg/types"
+	"github.com/containrrr/watchtower/pkg/update"
+	dockerTypes "github.com/docker/docker/api/types"
+	dockerContainer "github.com/docker/docker/api/types/container"
+
+	. "github.com/containrrr/watchtower/internal/actions/mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the two-phase update workflow", func() {
+	var dir string
+	var client MockClient
+	var workflow *actions.UpdateWorkflow
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "workflow")
+		Expect(err).NotTo(HaveOccurred())
+		machine, err := update.NewMachine(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		running := func(id string, name string, image string) types.Container {
+			return CreateMockContainerWithConfig(id, name, image, true, false, time.Now(), &dockerContainer.Config{
+				Image:  image,
+				Labels: map[string]string{},
+			})
+		}
+		client = CreateMockClient(&TestData{
+			Containers: []types.Container{
+				running("planner-id", "/planner", "robot/planner:1.0"),
+				running("driver-id", "/driver", "robot/driver:2.1"),
+			},
+			UpdateStatuses: map[string]types.UpdateStatus{
+				"/planner": {Container: "planner", UpdateAvailable: true},
+			},
+		}, false, false)
+		workflow = &actions.UpdateWorkflow{
+			Client:  client,
+			Machine: machine,
+			Params:  types.UpdateParams{Filter: filters.NoFilter},
+		}
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should stage the downloaded images until they are applied", func() {
+		state, err := workflow.Download()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Phase).To(Equal(update.PhaseDownloaded))
+		Expect(state.Staged).To(HaveLen(1))
+		Expect(state.Staged[0].Container).To(Equal("planner"))
+		Expect(client.TestData.StoppedContainers).To(BeEmpty())
+
+		_, state, err = workflow.Apply()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Phase).To(Equal(update.PhaseDone))
+		Expect(state.Staged).To(BeEmpty())
+	})
+
+	It("should return to idle when no update is available", func() {
+		client.TestData.UpdateStatuses = map[string]types.UpdateStatus{}
+		state, err := workflow.Download()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Phase).To(Equal(update.PhaseIdle))
+	})
+
+	It("should keep the downloaded update when no container can be checked", func() {
+		_, err := workflow.Download()
+		Expect(err).NotTo(HaveOccurred())
+
+		client.TestData.UpdateStatuses = map[string]types.UpdateStatus{
+			"/planner": {Container: "planner", Error: "registry unreachable"},
+			"/driver":  {Container: "driver", Error: "registry unreachable"},
+		}
+		state, err := workflow.Download()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Phase).To(Equal(update.PhaseDownloaded))
+		Expect(state.Error).To(ContainSubstring("registry unreachable"))
+		Expect(state.Staged).To(HaveLen(1))
+		Expect(state.Staged[0].Container).To(Equal("planner"))
+	})
+
+	It("should drop the downloaded update when the containers are up to date", func() {
+		_, err := workflow.Download()
+		Expect(err).NotTo(HaveOccurred())
+
+		client.TestData.UpdateStatuses = map[string]types.UpdateStatus{
+			"/planner": {Container: "planner", Error: "registry unreachable"},
+		}
+		state, err := workflow.Download()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Phase).To(Equal(update.PhaseIdle))
+		Expect(state.Staged).To(BeEmpty())
+	})
+
+	It("should refuse to apply a downloaded update without staged images", func() {
+		Expect(os.WriteFile(filepath.Join(dir, "update.json"), []byte(`{"phase": "downloaded", "staged": []}`), 0644)).To(Succeed())
+		machine, err := update.NewMachine(dir)
+		Expect(err).NotTo(HaveOccurred())
+		workflow.Machine = machine
+
+		_, state, err := workflow.Apply()
+		Expect(err).To(MatchError(update.ErrInvalidTransition))
+		Expect(state.Phase).To(Equal(update.PhaseDownloaded))
+		Expect(client.TestData.StoppedContainers).To(BeEmpty())
+	})
+
+	It("should refuse to apply without a downloaded update", func() {
+		_, state, err := workflow.Apply()
+		Expect(err).To(MatchError(update.ErrInvalidTransition))
+		Expect(state.Phase).To(Equal(update.PhaseIdle))
+	})
+
+	It("should fail when the updated containers are not running", func() {
+		_, err := workflow.Download()
+		Expect(err).NotTo(HaveOccurred())
+		client.TestData.Containers[0].ContainerInfo().State.Running = false
+
+		_, state, err := workflow.Apply()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Phase).To(Equal(update.PhaseFailed))
+		Expect(state.Error).To(ContainSubstring("planner: not running"))
+	})
+
+	It("should stay verifying until the updated containers were watched in the background", func() {
+		_, err := workflow.Download()
+		Expect(err).NotTo(HaveOccurred())
+		client.TestData.Containers[0].ContainerInfo().State.Health = &dockerTypes.Health{Status: dockerTypes.Unhealthy}
+		workflow.Params.RollbackGracePeriod = 10 * time.Millisecond
+		workflow.Params.Rollbacks = &actions.RollbackWatcher{Client: client}
+
+		_, state, err := workflow.Apply()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Phase).To(Equal(update.PhaseVerifying))
+		Eventually(func() string { return workflow.Machine.State().Phase }).Should(Equal(update.PhaseRolledBack))
+		Expect(workflow.Machine.State().Error).To(Equal("planner: container became unhealthy"))
+	})
+})
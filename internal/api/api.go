@@ -2,32 +2,67 @@ package api
 
 import (
 	"github.com/containrrr/watchtower/internal/handlers"
+	"github.com/containrrr/watchtower/internal/middleware"
 	"github.com/gin-gonic/gin"
 )
 
-// SetRoutes sets up the API routes.
+// SetRoutes sets up the API routes. Every route group requires the viewer role, the routes that
+// change the containers require the operator role, and the ones that update them the admin role.
 func SetRoutes(router *gin.Engine,
 	deviceHandler *handlers.DeviceHandler,
 	watchtowerHandler *handlers.WatchtowerHandler,
-	containerHandler *handlers.ContainerHandler) {
+	containerHandler *handlers.ContainerHandler,
+	stackHandler *handlers.StackHandler,
+	holdHandler *handlers.HoldHandler) {
+
+	operator := middleware.RequireRole(middleware.Operator)
+	admin := middleware.RequireRole(middleware.Admin)
 
 	v1 := router.Group("/api/v1")
 	{
-		deviceSubgroup := v1.Group("/device")
+		// Device information and hardware status: viewer
+		deviceSubgroup := v1.Group("/device", middleware.RequireRole(middleware.Viewer))
 		{
 			deviceSubgroup.GET("/info", deviceHandler.HandleGetDeviceInfo)
 			deviceSubgroup.GET("/hardware-status", deviceHandler.HandlerWSHardwareStatus)
+			deviceSubgroup.GET("/power", deviceHandler.HandleGetPowerStatus)
+			deviceSubgroup.GET("/events", deviceHandler.HandleWSDeviceEvents)
 		}
 
-		watchtowerSubgroup := v1.Group("/watchtower")
+		// State and logs: viewer, container lifecycle: operator, updates: admin
+		watchtowerSubgroup := v1.Group("/watchtower", middleware.RequireRole(middleware.Viewer))
 		{
-			watchtowerSubgroup.POST("/update", watchtowerHandler.HandlePostUpdate)
-			watchtowerSubgroup.POST("/download", watchtowerHandler.HandlePostDownload)
+			watchtowerSubgroup.POST("/update", admin, watchtowerHandler.HandlePostUpdate)
+			watchtowerSubgroup.POST("/download", admin, watchtowerHandler.HandlePostDownload)
+			watchtowerSubgroup.POST("/apply", admin, watchtowerHandler.HandlePostApply)
+			watchtowerSubgroup.GET("/state", watchtowerHandler.HandleGetState)
+			watchtowerSubgroup.POST("/load", admin, watchtowerHandler.HandlePostLoad)
+			watchtowerSubgroup.GET("/load-progress", watchtowerHandler.HandleWSLoadProgress)
+			watchtowerSubgroup.POST("/export", admin, watchtowerHandler.HandlePostExport)
 			watchtowerSubgroup.GET("/log-stream", containerHandler.HandleWSLogs)
-			watchtowerSubgroup.GET("/list", containerHandler.HandleContainerStart)
-			watchtowerSubgroup.POST("/start", containerHandler.HandleContainerStart)
-			watchtowerSubgroup.POST("/stop", containerHandler.HandleContainerStop)
+			watchtowerSubgroup.GET("/list", watchtowerHandler.HandleGetContainers)
+			watchtowerSubgroup.POST("/start", operator, containerHandler.HandleContainerStart)
+			watchtowerSubgroup.POST("/stop", operator, containerHandler.HandleContainerStop)
+			watchtowerSubgroup.POST("/pause", operator, containerHandler.HandleContainerPause)
+			watchtowerSubgroup.POST("/restart", operator, containerHandler.HandleContainerRestart)
 			watchtowerSubgroup.GET("/inspect", containerHandler.HandleContainerInspect)
 		}
+
+		v1.GET("/updates", middleware.RequireRole(middleware.Viewer), watchtowerHandler.HandleGetUpdates)
+
+		// Holds: viewer, placing and releasing them: admin
+		holdSubgroup := v1.Group("/holds", middleware.RequireRole(middleware.Viewer))
+		{
+			holdSubgroup.GET("", holdHandler.HandleGetHolds)
+			holdSubgroup.GET("/:container", holdHandler.HandleGetHold)
+			holdSubgroup.PUT("/:container", admin, holdHandler.HandlePutHold)
+			holdSubgroup.DELETE("/:container", admin, holdHandler.HandleDeleteHold)
+		}
+
+		// Stack status: viewer
+		stackSubgroup := v1.Group("/stack", middleware.RequireRole(middleware.Viewer))
+		{
+			stackSubgroup.GET("/status", stackHandler.HandleGetStackStatus)
+		}
 	}
 }
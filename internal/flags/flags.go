@@ -170,6 +170,31 @@ func RegisterSystemFlags(rootCmd *cobra.Command) {
 		envString("WATCHTOWER_HTTP_API_TOKEN"),
 		"Sets an authentication token to HTTP API requests.")
 
+	flags.String(
+		"http-api-tokens-file",
+		envString("WATCHTOWER_HTTP_API_TOKENS_FILE"),
+		"File with the named tokens accepted by the HTTP API, one \"<name> <token> [viewer|operator|admin]\" entry per line. Tokens without a role are admin tokens")
+
+	flags.String(
+		"http-api-tls-cert",
+		envString("WATCHTOWER_HTTP_API_TLS_CERT"),
+		"Certificate file of the HTTP API, which is served over TLS when it is set together with the key file. A self-signed certificate is generated if neither file exists. The files are reloaded when they change")
+
+	flags.String(
+		"http-api-tls-key",
+		envString("WATCHTOWER_HTTP_API_TLS_KEY"),
+		"Key file of the HTTP API certificate")
+
+	flags.String(
+		"http-api-tls-client-ca",
+		envString("WATCHTOWER_HTTP_API_TLS_CLIENT_CA"),
+		"Certificate authority file that the HTTP API clients must present a certificate from (mutual TLS)")
+
+	flags.StringSlice(
+		"http-api-allowed-origins",
+		envStringSlice("WATCHTOWER_HTTP_API_ALLOWED_ORIGINS"),
+		"Comma-separated list of the origins of the web pages allowed to use the HTTP API, where * matches any part of an origin, e.g. https://*.robots.local")
+
 	flags.BoolP(
 		"http-api-periodic-polls",
 		"",
@@ -212,10 +237,165 @@ func RegisterSystemFlags(rootCmd *cobra.Command) {
 		envBool("WATCHTOWER_LABEL_TAKE_PRECEDENCE"),
 		"Label applied to containers take precedence over arguments")
 
+	flags.Duration(
+		"rollback-grace-period",
+		envDuration("WATCHTOWER_ROLLBACK_GRACE_PERIOD"),
+		"How long updated containers are watched, and rolled back to their previous image if they stop or become unhealthy, 0 to disable")
+
 	flags.String(
 		"port",
 		envString("WATCHTOWER_UPDATE_PORT"),
 		"Port to for update api to connect to")
+
+	flags.String(
+		"host-proc",
+		envString("WATCHTOWER_HOST_PROC"),
+		"Path where the host procfs is mounted, used for hardware telemetry")
+
+	flags.String(
+		"host-sys",
+		envString("WATCHTOWER_HOST_SYS"),
+		"Path where the host sysfs is mounted, used for hardware telemetry")
+
+	flags.StringSlice(
+		"storage-mounts",
+		envStringSlice("WATCHTOWER_STORAGE_MOUNTS"),
+		"Comma-separated list of mount points included in the storage usage")
+
+	flags.String(
+		"power-sensor-file",
+		envString("WATCHTOWER_POWER_SENSOR_FILE"),
+		"File containing an INA219-style voltage and current reading, used instead of the sysfs battery")
+
+	flags.Float64(
+		"power-min-voltage",
+		envFloat64("WATCHTOWER_POWER_MIN_VOLTAGE"),
+		"Battery voltage considered empty, used to estimate the charge from the power sensor")
+
+	flags.Float64(
+		"power-max-voltage",
+		envFloat64("WATCHTOWER_POWER_MAX_VOLTAGE"),
+		"Battery voltage considered full, used to estimate the charge from the power sensor")
+
+	flags.Float64(
+		"battery-capacity",
+		envFloat64("WATCHTOWER_BATTERY_CAPACITY"),
+		"Rated battery capacity in ampere-hours, used to estimate the time remaining from the power sensor")
+
+	flags.Float64(
+		"battery-low-threshold",
+		envFloat64("WATCHTOWER_BATTERY_LOW_THRESHOLD"),
+		"Battery percentage below which a low battery notification is sent")
+
+	flags.Float64(
+		"battery-critical-threshold",
+		envFloat64("WATCHTOWER_BATTERY_CRITICAL_THRESHOLD"),
+		"Battery percentage below which a critical battery notification is sent")
+
+	flags.Duration(
+		"power-check-interval",
+		envDuration("WATCHTOWER_POWER_CHECK_INTERVAL"),
+		"How often the battery is checked against the notification thresholds")
+
+	flags.String(
+		"compose-dir",
+		envString("WATCHTOWER_COMPOSE_DIR"),
+		"Directory containing the .env file and env_file paths referenced by uploaded compose files")
+
+	flags.StringSlice(
+		"compose-env",
+		envStringSlice("WATCHTOWER_COMPOSE_ENV"),
+		"Comma-separated list of the watchtower environment variables that uploaded compose files may interpolate")
+
+	flags.Duration(
+		"dependency-timeout",
+		envDuration("WATCHTOWER_DEPENDENCY_TIMEOUT"),
+		"How long to wait for a depends_on condition, such as service_healthy, before a stack start fails")
+
+	flags.String(
+		"state-dir",
+		envString("WATCHTOWER_STATE_DIR"),
+		"Directory where the last applied stack definition is stored")
+
+	flags.Duration(
+		"reconcile-interval",
+		envDuration("WATCHTOWER_RECONCILE_INTERVAL"),
+		"How often running containers are compared to the applied stack definition, 0 to disable")
+
+	flags.Duration(
+		"device-watch-interval",
+		envDuration("WATCHTOWER_DEVICE_WATCH_INTERVAL"),
+		"How often USB devices are checked for being plugged in or unplugged, 0 to disable")
+
+	flags.String(
+		"device-role",
+		envString("WATCHTOWER_DEVICE_ROLE"),
+		"Role of the device, selecting the release channel of the containers: develop, nightly, uat or production")
+
+	flags.String(
+		"device-role-file",
+		envString("WATCHTOWER_DEVICE_ROLE_FILE"),
+		"File containing the role of the device, taking precedence over the device role so that it can be changed at runtime")
+
+	flags.Duration(
+		"role-watch-interval",
+		envDuration("WATCHTOWER_ROLE_WATCH_INTERVAL"),
+		"How often the device role is checked for changes, switching the containers to its release channel, 0 to disable")
+
+	flags.String(
+		"maintenance-windows",
+		envString("WATCHTOWER_MAINTENANCE_WINDOWS"),
+		"Semicolon-separated cron specs matching the minutes in which containers may be stopped for updates, e.g. \"* 2-4 * * *\". Updates are allowed at any time without them")
+
+	flags.String(
+		"busy-probe-url",
+		envString("WATCHTOWER_BUSY_PROBE_URL"),
+		"URL that must report the robot as idle before containers are stopped for updates")
+
+	flags.String(
+		"busy-probe-file",
+		envString("WATCHTOWER_BUSY_PROBE_FILE"),
+		"File flagging the robot as busy while it exists, deferring the updates")
+
+	flags.String(
+		"busy-probe-container",
+		envString("WATCHTOWER_BUSY_PROBE_CONTAINER"),
+		"Container in which the busy probe command is executed")
+
+	flags.String(
+		"busy-probe-command",
+		envString("WATCHTOWER_BUSY_PROBE_COMMAND"),
+		"Command executed in the busy probe container, exiting with code 75 while the robot is busy")
+
+	flags.Duration(
+		"deferred-retry-interval",
+		envDuration("WATCHTOWER_DEFERRED_RETRY_INTERVAL"),
+		"How often deferred updates are retried")
+
+	flags.StringSlice(
+		"bundle-roots",
+		envStringSlice("WATCHTOWER_BUNDLE_ROOTS"),
+		"Comma-separated list of directories where removable media is mounted, searched for offline update bundles")
+
+	flags.String(
+		"bundle-public-keys",
+		envString("WATCHTOWER_BUNDLE_PUBLIC_KEYS"),
+		"File with the base64 encoded ed25519 public keys trusted to sign offline update bundles, one per line")
+
+	flags.String(
+		"bundle-private-key",
+		envString("WATCHTOWER_BUNDLE_PRIVATE_KEY"),
+		"File with the base64 encoded ed25519 private key exported bundles are signed with")
+
+	flags.Duration(
+		"media-watch-interval",
+		envDuration("WATCHTOWER_MEDIA_WATCH_INTERVAL"),
+		"How often the bundle roots are checked for newly mounted media with an offline update bundle, 0 to disable")
+
+	flags.String(
+		"mount-info",
+		envString("WATCHTOWER_MOUNT_INFO"),
+		"Mountinfo file listing the mounted media. If empty, the directories in the bundle roots are listed instead")
 }
 
 // RegisterNotificationFlags that are used by watchtower to send notifications
@@ -420,6 +600,11 @@ func envBool(key string) bool {
 	return viper.GetBool(key)
 }
 
+func envFloat64(key string) float64 {
+	viper.MustBindEnv(key)
+	return viper.GetFloat64(key)
+}
+
 func envDuration(key string) time.Duration {
 	viper.MustBindEnv(key)
 	return viper.GetDuration(key)
@@ -439,6 +624,23 @@ func SetDefaults() {
 	viper.SetDefault("WATCHTOWER_NOTIFICATION_SLACK_IDENTIFIER", "watchtower")
 	viper.SetDefault("WATCHTOWER_LOG_LEVEL", "info")
 	viper.SetDefault("WATCHTOWER_LOG_FORMAT", "auto")
+	viper.SetDefault("WATCHTOWER_HOST_PROC", "/proc")
+	viper.SetDefault("WATCHTOWER_HOST_SYS", "/sys")
+	viper.SetDefault("WATCHTOWER_STORAGE_MOUNTS", []string{"/"})
+	viper.SetDefault("WATCHTOWER_BATTERY_LOW_THRESHOLD", 20)
+	viper.SetDefault("WATCHTOWER_BATTERY_CRITICAL_THRESHOLD", 10)
+	viper.SetDefault("WATCHTOWER_POWER_CHECK_INTERVAL", time.Minute)
+	viper.SetDefault("WATCHTOWER_DEPENDENCY_TIMEOUT", 2*time.Minute)
+	viper.SetDefault("WATCHTOWER_STATE_DIR", "/var/lib/watchtower")
+	viper.SetDefault("WATCHTOWER_RECONCILE_INTERVAL", 30*time.Second)
+	viper.SetDefault("WATCHTOWER_DEVICE_WATCH_INTERVAL", 2*time.Second)
+	viper.SetDefault("WATCHTOWER_BUNDLE_ROOTS", []string{"/media", "/run/media", "/mnt"})
+	viper.SetDefault("WATCHTOWER_MEDIA_WATCH_INTERVAL", 2*time.Second)
+	viper.SetDefault("WATCHTOWER_MOUNT_INFO", "/proc/self/mountinfo")
+	viper.SetDefault("WATCHTOWER_ROLLBACK_GRACE_PERIOD", 30*time.Second)
+	viper.SetDefault("WATCHTOWER_DEVICE_ROLE", "develop")
+	viper.SetDefault("WATCHTOWER_ROLE_WATCH_INTERVAL", 10*time.Second)
+	viper.SetDefault("WATCHTOWER_DEFERRED_RETRY_INTERVAL", time.Minute)
 }
 
 // EnvConfig translates the command-line options into environment variables
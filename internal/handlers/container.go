@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"sync"
 
 	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/internal/middleware"
 	"github.com/containrrr/watchtower/pkg/container"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -14,14 +20,22 @@ import (
 type ContainerHandler struct {
 	client        container.Client
 	logsFrequency float64
+	composeDir    string
+	composeEnv    []string
+	reconciler    *actions.Reconciler
 	wsClients     ClientList
 	sync.Mutex
 }
 
-func NewContainerHandler(client container.Client, logFreq float64) *ContainerHandler {
+// NewContainerHandler returns a handler for the compose stack and container endpoints. Uploaded compose
+// files may only interpolate the process environment variables named in composeEnv.
+func NewContainerHandler(client container.Client, logFreq float64, composeDir string, composeEnv []string, reconciler *actions.Reconciler) *ContainerHandler {
 	return &ContainerHandler{
 		client:        client,
 		logsFrequency: logFreq,
+		composeDir:    composeDir,
+		composeEnv:    composeEnv,
+		reconciler:    reconciler,
 		wsClients:     make(ClientList),
 	}
 }
@@ -50,9 +64,8 @@ func (h *ContainerHandler) removeClient(client *Client) {
 
 func (h *ContainerHandler) HandleWSLogs(c *gin.Context) {
 	upgrader := websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		CheckOrigin:  middleware.CheckOrigin(c),
+		Subprotocols: []string{middleware.BearerProtocol},
 	}
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -69,56 +82,124 @@ func (h *ContainerHandler) HandleWSLogs(c *gin.Context) {
 
 func (h *ContainerHandler) HandleContainerStart(c *gin.Context) {
 	log.Info("Received HTTP request to start container")
-	// This should not be service body
-	var body map[string]interface{}
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+	// Every service is reconciled according to its own action, which defaults to start
+	h.reconcileStack(c, "")
+}
+
+func (h *ContainerHandler) HandleContainerStop(c *gin.Context) {
+	log.Info("Received HTTP request to stop container")
+	h.reconcileStack(c, container.ActionStop)
+}
+
+func (h *ContainerHandler) HandleContainerPause(c *gin.Context) {
+	log.Info("Received HTTP request to pause container")
+	h.reconcileStack(c, container.ActionPause)
+}
+
+func (h *ContainerHandler) HandleContainerRestart(c *gin.Context) {
+	log.Info("Received HTTP request to restart container")
+	h.reconcileStack(c, container.ActionRestart)
+}
+
+// reconcileStack applies the action to every service of the compose file sent with the request,
+// and responds with the result of each service. The services are stored as the desired state of the stack.
+// Only admins may start or restart services with access to the host, e.g. privileged services.
+func (h *ContainerHandler) reconcileStack(c *gin.Context, action string) {
+	project, ok := h.readProject(c)
+	if !ok {
 		return
 	}
-	log.Info("Running service handle")
-	services := []container.Service{}
-	rawServiceData := body["services"].(map[string]interface{})
+	if action != container.ActionStop && action != container.ActionPause && !middleware.HasRole(c, middleware.Admin) {
+		for _, service := range project.Services {
+			if access := service.HostAccess(h.composeDir, project.Volumes); len(access) > 0 {
+				c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("the admin role is required to start the service %s with host access (%s)", service.Name, strings.Join(access, ", "))})
+				return
+			}
+		}
+	}
 
-	// Extract services from the raw data
-	for name, config := range rawServiceData {
-		service := container.MakeService(config.(map[string]interface{}), name)
-		services = append(services, service)
+	results, err := h.reconciler.Apply(project, action)
+	if errors.Is(err, actions.ErrUpdateRunning) {
+		log.Info("Skipped. Another update process is already running.")
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil && results == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "services": results})
+		return
 	}
 
-	// Execute actions on the services
-	for _, service := range services {
-		if err := actions.StartContainer(h.client, &service); err != nil {
-			log.Error(err)
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Failed() {
+			status = http.StatusInternalServerError
 		}
 	}
-	c.JSON(http.StatusOK, nil)
+	c.JSON(status, gin.H{"services": results})
 }
 
-func (h *ContainerHandler) HandleContainerStop(c *gin.Context) {
-	log.Info("Received HTTP request to stop container")
-	// This should not be service body
-	var body map[string]interface{}
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
-		return
+// readProject parses the compose file sent with the request. The file is either the raw request body
+// (YAML or the legacy JSON `services` map), or the `compose` field of a multipart form, with an optional
+// `env` field used for interpolation. On failure the error response is written and false is returned.
+func (h *ContainerHandler) readProject(c *gin.Context) (*container.Project, bool) {
+	opts := container.ComposeOptions{
+		Name:       c.Query("project"),
+		WorkingDir: h.composeDir,
+		AllowedEnv: h.composeEnv,
 	}
-	log.Info("Running service handle")
-	services := []container.Service{}
-	rawServiceData := body["services"].(map[string]interface{})
 
-	// Extract services from the raw data
-	for name, config := range rawServiceData {
-		service := container.MakeService(config.(map[string]interface{}), name)
-		services = append(services, service)
+	var data []byte
+	var err error
+	if c.ContentType() == gin.MIMEMultipartPOSTForm {
+		data, err = readFormFile(c, "compose")
+		if err == nil {
+			var envData []byte
+			if envData, err = readFormFile(c, "env"); err == nil && envData != nil {
+				opts.Environment, err = container.ParseEnvFile(bytes.NewReader(envData))
+			}
+		}
+	} else {
+		data, err = io.ReadAll(c.Request.Body)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if data == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no compose file provided"})
+		return nil, false
 	}
 
-	// Execute actions on the services
-	for _, service := range services {
-		if err := actions.StartContainer(h.client, &service); err != nil {
-			log.Error(err)
+	project, err := container.LoadProject(data, opts)
+	if err != nil {
+		var validationErr *container.ValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "errors": validationErr.Errors})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		}
+		return nil, false
+	}
+	return project, true
+}
+
+// readFormFile returns the contents of a multipart form file, or nil if the field is missing
+func readFormFile(c *gin.Context, field string) ([]byte, error) {
+	header, err := c.FormFile(field)
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
 	}
-	c.JSON(http.StatusOK, nil)
+	defer file.Close()
+	return io.ReadAll(file)
 }
 
 func (h *ContainerHandler) HandleContainerInspect(c *gin.Context) {
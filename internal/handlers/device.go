@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/internal/middleware"
 	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/device"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
@@ -12,25 +15,55 @@ import (
 
 type DeviceHandler struct {
 	Client                  container.Client
+	Hardware                *device.HardwareCollector
+	Power                   *device.PowerReader
+	Devices                 *actions.DeviceMonitor
+	Roles                   device.RoleSource
 	HardwareStatusFrequency float64
 }
 
 func (d *DeviceHandler) HandleGetDeviceInfo(c *gin.Context) {
 	log.Info("Received HTTP request to get device-info")
-	output := actions.GetDeviceInfo(d.Client)
+	output := actions.GetDeviceInfo(d.Client, d.Roles)
+	c.JSON(http.StatusOK, output)
+}
+
+func (d *DeviceHandler) HandleGetPowerStatus(c *gin.Context) {
+	log.Info("Received HTTP request to get power status")
+	output, err := actions.GetPowerStatus(d.Power)
+	if errors.Is(err, device.ErrNoPowerSupply) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, output)
 }
 
 func (d *DeviceHandler) HandlerWSHardwareStatus(c *gin.Context) {
 	upgrader := websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		CheckOrigin:  middleware.CheckOrigin(c),
+		Subprotocols: []string{middleware.BearerProtocol},
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+
+	go actions.BroadcastHardwareStatus(conn, d.Hardware, d.HardwareStatusFrequency)
+}
+
+func (d *DeviceHandler) HandleWSDeviceEvents(c *gin.Context) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin:  middleware.CheckOrigin(c),
+		Subprotocols: []string{middleware.BearerProtocol},
 	}
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		return
 	}
 
-	go actions.BroadcastHardwareStatus(conn, d.Client, d.HardwareStatusFrequency)
+	go actions.BroadcastDeviceChanges(conn, d.Devices)
 }
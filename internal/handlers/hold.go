@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/hold"
+	"github.com/containrrr/watchtower/pkg/types"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// HoldHandler pins containers at their image, so that they are skipped by updates
+type HoldHandler struct {
+	Client container.Client
+	Holds  *hold.Store
+}
+
+func (h *HoldHandler) HandleGetHolds(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"holds": h.Holds.List()})
+}
+
+func (h *HoldHandler) HandleGetHold(c *gin.Context) {
+	held, err := h.Holds.Get(c.Param("container"))
+	if errors.Is(err, hold.ErrNotHeld) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, held)
+}
+
+// HandlePutHold holds the container at the image it is running. A digest parameter, either the
+// image ID or a repository digest of the image, is checked against the running image, so that
+// the container is not held at another image than the caller expects.
+func (h *HoldHandler) HandlePutHold(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("container"), "/")
+	log.WithField("container", name).Info("Received HTTP request to hold a container")
+
+	target, err := h.Client.GetContainerByName(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if digest := c.Query("digest"); digest != "" && !runsImage(target, digest) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("container %s is running %s, not %s", name, target.SafeImageID().ShortID(), digest)})
+		return
+	}
+
+	held := hold.Hold{
+		Container: name,
+		Image:     target.ImageName(),
+		Digest:    string(target.SafeImageID()),
+		Reason:    c.Query("reason"),
+	}
+	if previous, err := h.Holds.Get(name); err == nil {
+		held.CreatedAt = previous.CreatedAt
+	}
+	if err := h.Holds.Set(held); err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	held, _ = h.Holds.Get(name)
+	c.JSON(http.StatusOK, held)
+}
+
+// runsImage returns whether the container runs the image with the digest, which is either the
+// image ID or the digest of one of its repository digests
+func runsImage(target types.Container, digest string) bool {
+	if string(target.SafeImageID()) == digest {
+		return true
+	}
+	if !target.HasImageInfo() {
+		return false
+	}
+	for _, repoDigest := range target.ImageInfo().RepoDigests {
+		if repoDigest == digest || strings.HasSuffix(repoDigest, "@"+digest) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *HoldHandler) HandleDeleteHold(c *gin.Context) {
+	name := c.Param("container")
+	log.WithField("container", name).Info("Received HTTP request to release a held container")
+
+	err := h.Holds.Remove(name)
+	if errors.Is(err, hold.ErrNotHeld) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"container": strings.TrimPrefix(name, "/")})
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type StackHandler struct {
+	Reconciler *actions.Reconciler
+}
+
+func (h *StackHandler) HandleGetStackStatus(c *gin.Context) {
+	log.Info("Received HTTP request to get stack status")
+	statuses, err := h.Reconciler.Status()
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"services": statuses})
+}
@@ -1,17 +1,26 @@
 package handlers
 
 import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/containrrr/watchtower/internal/actions"
+	"github.com/containrrr/watchtower/internal/middleware"
+	"github.com/containrrr/watchtower/pkg/bundle"
 	"github.com/containrrr/watchtower/pkg/container"
 	"github.com/containrrr/watchtower/pkg/filters"
 	"github.com/containrrr/watchtower/pkg/metrics"
 	"github.com/containrrr/watchtower/pkg/notifications"
 	"github.com/containrrr/watchtower/pkg/types"
+	"github.com/containrrr/watchtower/pkg/update"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -31,9 +40,26 @@ type WatchtowerHandler struct {
 	RollingRestart    bool
 	Scope             string
 	LabelPrecedence   bool
-	Lock              chan bool
+	// Params are the parameters of the updates run through the API
+	Params types.UpdateParams
+	Lock   chan bool
+	// BundleRoots are the directories searched for offline update bundles, e.g. where removable media is mounted
+	BundleRoots []string
+	// BundleKeys are the public keys trusted to sign offline update bundles
+	BundleKeys []ed25519.PublicKey
+	// BundleSigningKey signs the exported bundles, which are left unsigned without it
+	BundleSigningKey ed25519.PrivateKey
+	// Media loads the update bundles found on removable media as it is mounted
+	Media *actions.MediaMonitor
+	// Workflow downloads updates and applies them once approved
+	Workflow *actions.UpdateWorkflow
+	// Retrier runs the updates that were deferred again
+	Retrier *actions.Retrier
 }
 
+// HandlePostUpdate downloads the available updates and applies them right away, without waiting
+// for them to be approved through apply. The update goes through the update workflow, so that its
+// progress is recorded in the update state like a download followed by an apply.
 func (w *WatchtowerHandler) HandlePostUpdate(c *gin.Context) {
 	select {
 	case chanValue := <-w.Lock:
@@ -42,39 +68,43 @@ func (w *WatchtowerHandler) HandlePostUpdate(c *gin.Context) {
 		}()
 		log.Info("Received HTTP request to apply updates")
 		imagesParams := c.Query("images")
-		images := strings.Split(imagesParams, ",")
-
-		// By default do not apply any filter
-		filter := filters.NoFilter
 
 		// If POST has any image then apply those images only
-		if len(images) > 0 {
-			filter = filters.FilterByImage(images, w.Filter)
-		}
-		w.Notifier.StartNotification()
-		updateParams := types.UpdateParams{
-			Filter:          filter,
-			Cleanup:         w.Cleanup,
-			NoRestart:       w.NoRestart,
-			Timeout:         w.Timeout,
-			MonitorOnly:     w.MonitorOnly,
-			LifecycleHooks:  w.LifecycleHooks,
-			RollingRestart:  w.RollingRestart,
-			LabelPrecedence: w.LabelPrecedence,
-			NoPull:          w.NoPull,
+		workflow := *w.Workflow
+		if imagesParams != "" {
+			workflow.Params.Filter = filters.FilterByImage(strings.Split(imagesParams, ","), w.Filter)
 		}
-		// Run and check for updated on the cloud. Do not attempt to load local image
 		log.Info("Update requested. Updating...")
-		result, err := actions.Update(*w.Client, updateParams)
-		if err != nil {
+		state, err := workflow.Download()
+		if errors.Is(err, update.ErrInvalidTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
 			log.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		w.Notifier.StartNotification()
+		var result types.Report
+		if state.Phase == update.PhaseDownloaded {
+			result, state, err = workflow.Apply()
+			if err != nil {
+				log.Error(err)
+			}
 		}
 		w.Notifier.SendNotification(result)
+		if result == nil {
+			c.JSON(http.StatusOK, &metrics.Metric{})
+			return
+		}
+		workflow.RetryApply(w.Retrier, result)
 		metricResults := metrics.NewMetric(result)
 		notifications.LocalLog.WithFields(log.Fields{
 			"Scanned": metricResults.Scanned,
 			"Updated": metricResults.Updated,
 			"Failed":  metricResults.Failed,
+			"Phase":   state.Phase,
 		}).Info("Session done")
 		c.JSON(http.StatusOK, metricResults)
 
@@ -84,6 +114,53 @@ func (w *WatchtowerHandler) HandlePostUpdate(c *gin.Context) {
 	}
 }
 
+func (w *WatchtowerHandler) HandleGetUpdates(c *gin.Context) {
+	log.Info("Received HTTP request to check for updates")
+	statuses, err := actions.CheckForUpdates(*w.Client, types.UpdateParams{Filter: w.Filter, Holds: w.Params.Holds, Roles: w.Params.Roles})
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	updateAvailable := false
+	for _, status := range statuses {
+		updateAvailable = updateAvailable || status.UpdateAvailable
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"update_available": updateAvailable,
+		"ready":            actions.UpdatesReady(statuses),
+		"containers":       statuses,
+	})
+}
+
+// HandleGetContainers lists the containers with their status. They can be filtered by scope, by
+// label ("key" or "key=value") and by name, where the label and name parameters may be repeated.
+func (w *WatchtowerHandler) HandleGetContainers(c *gin.Context) {
+	log.Info("Received HTTP request to list containers")
+	filter := filters.FilterByNames(c.QueryArray("name"), filters.NoFilter)
+	if scope := c.Query("scope"); scope != "" {
+		filter = filters.FilterByScope(scope, filter)
+	}
+	for _, label := range c.QueryArray("label") {
+		filter = filters.FilterByLabel(label, filter)
+	}
+
+	params := types.UpdateParams{
+		Filter:          w.Filter,
+		MonitorOnly:     w.MonitorOnly,
+		LabelPrecedence: w.LabelPrecedence,
+		Holds:           w.Params.Holds,
+	}
+	statuses, err := actions.ListContainers(*w.Client, filter, params)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"containers": statuses})
+}
+
 func (w *WatchtowerHandler) HandlePostDownload(c *gin.Context) {
 	select {
 	case chanValue := <-w.Lock:
@@ -94,36 +171,171 @@ func (w *WatchtowerHandler) HandlePostDownload(c *gin.Context) {
 		imagesParams := c.Query("images")
 		log.Info("Requested images: " + imagesParams)
 
-		images := strings.Split(imagesParams, ",")
+		// If POST has any image then download those images only
+		workflow := *w.Workflow
+		if imagesParams != "" {
+			workflow.Params.Filter = filters.FilterByImage(strings.Split(imagesParams, ","), w.Filter)
+		}
+		// Download updates, they are applied through apply
+		state, err := workflow.Download()
+		if errors.Is(err, update.ErrInvalidTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			log.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, state)
+
+	default:
+		log.Info("Skipped. Another download process is already running.")
+		c.JSON(http.StatusConflict, "Request dropped. Another download process is already running.")
+	}
+}
 
-		// By default do not apply any filter
-		filter := filters.NoFilter
+func (w *WatchtowerHandler) HandlePostApply(c *gin.Context) {
+	select {
+	case chanValue := <-w.Lock:
+		defer func() {
+			w.Lock <- chanValue
+		}()
+		log.Info("Received HTTP request to apply the downloaded updates")
 
-		// If POST has any image then apply those images only
-		if len(images) > 0 {
-			filter = filters.FilterByImage(images, w.Filter)
-		}
 		w.Notifier.StartNotification()
-		updateParams := types.UpdateParams{
-			Filter:          filter,
-			Cleanup:         w.Cleanup,
-			NoRestart:       w.NoRestart,
-			Timeout:         w.Timeout,
-			MonitorOnly:     w.MonitorOnly,
-			LifecycleHooks:  w.LifecycleHooks,
-			RollingRestart:  w.RollingRestart,
-			LabelPrecedence: w.LabelPrecedence,
-			NoPull:          w.NoPull,
+		result, state, err := w.Workflow.Apply()
+		if errors.Is(err, update.ErrInvalidTransition) {
+			w.Notifier.SendNotification(nil)
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			log.Error(err)
+			w.Notifier.SendNotification(result)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "state": state})
+			return
+		}
+		w.Notifier.SendNotification(result)
+		w.Workflow.RetryApply(w.Retrier, result)
+		c.JSON(http.StatusOK, gin.H{
+			"state":   state,
+			"metrics": metrics.NewMetric(result),
+		})
+
+	default:
+		log.Info("Skipped. Another update process is already running.")
+		c.JSON(http.StatusConflict, "Request dropped. Another update process is already running.")
+	}
+}
+
+func (w *WatchtowerHandler) HandleGetState(c *gin.Context) {
+	c.JSON(http.StatusOK, w.Workflow.Machine.State())
+}
+
+func (w *WatchtowerHandler) HandlePostLoad(c *gin.Context) {
+	select {
+	case chanValue := <-w.Lock:
+		defer func() {
+			w.Lock <- chanValue
+		}()
+		log.Info("Received HTTP request to load an offline update bundle")
+
+		// Without a path, the latest bundle on the removable media is loaded
+		var b *bundle.Bundle
+		var err error
+		if path := c.Query("path"); path != "" {
+			b, err = bundle.Open(path)
+		} else {
+			b, err = bundle.Latest(w.BundleRoots)
+		}
+		if errors.Is(err, bundle.ErrNoBundle) || errors.Is(err, os.ErrNotExist) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-		// Download updates
-		err := actions.DownloadUpdate(*w.Client, updateParams)
+
+		w.Notifier.StartNotification()
+		updateParams := w.Params
+		result, err := actions.LoadUpdate(*w.Client, b, w.BundleKeys, updateParams)
 		if err != nil {
 			log.Error(err)
+			w.Notifier.SendNotification(nil)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
-		c.JSON(http.StatusOK, nil)
+		w.Notifier.SendNotification(result)
+		actions.RetryDeferred(w.Retrier, *w.Client, updateParams, result)
+		c.JSON(http.StatusOK, metrics.NewMetric(result))
 
 	default:
-		log.Info("Skipped. Another download process is already running.")
-		c.JSON(http.StatusConflict, "Request dropped. Another download process is already running.")
+		log.Info("Skipped. Another update process is already running.")
+		c.JSON(http.StatusConflict, "Request dropped. Another update process is already running.")
+	}
+}
+
+func (w *WatchtowerHandler) HandlePostExport(c *gin.Context) {
+	select {
+	case chanValue := <-w.Lock:
+		defer func() {
+			w.Lock <- chanValue
+		}()
+		log.Info("Received HTTP request to export an offline update bundle")
+
+		target := c.Query("path")
+		if target == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the path to export the bundle to is required"})
+			return
+		}
+		name := c.Query("name")
+		if name == "" {
+			hostname, _ := os.Hostname()
+			name = fmt.Sprintf("%s-%s", hostname, time.Now().UTC().Format("20060102-150405"))
+		}
+		if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bundle name " + name})
+			return
+		}
+
+		// By default the images of every managed container are exported
+		filter := w.Filter
+		if containers := c.Query("containers"); containers != "" {
+			filter = filters.FilterByNames(strings.Split(containers, ","), w.Filter)
+		}
+
+		b, err := actions.ExportBundle(*w.Client, filter, filepath.Join(target, name), name, w.BundleSigningKey)
+		if errors.Is(err, os.ErrNotExist) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		} else if errors.Is(err, os.ErrExist) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			log.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"path":     b.Path,
+			"signed":   w.BundleSigningKey != nil,
+			"manifest": b.Manifest,
+		})
+
+	default:
+		log.Info("Skipped. Another update process is already running.")
+		c.JSON(http.StatusConflict, "Request dropped. Another update process is already running.")
 	}
 }
+
+func (w *WatchtowerHandler) HandleWSLoadProgress(c *gin.Context) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin:  middleware.CheckOrigin(c),
+		Subprotocols: []string{middleware.BearerProtocol},
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+
+	go actions.BroadcastLoadProgress(conn, w.Media)
+}
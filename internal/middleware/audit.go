@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Audit is a middleware that logs an audit entry for every mutating request, and for every request
+// denied by the authentication or the role checks. It must be registered before them.
+func Audit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		status := c.Writer.Status()
+		denied := status == http.StatusUnauthorized || status == http.StatusForbidden
+		if !denied && !isMutating(c.Request.Method) {
+			return
+		}
+
+		role, _ := c.Get(RoleKey)
+		if role == nil {
+			role = Role(0)
+		}
+		entry := log.WithFields(log.Fields{
+			"audit":  true,
+			"token":  c.GetString(TokenNameKey),
+			"role":   role,
+			"client": c.ClientIP(),
+			"method": c.Request.Method,
+			"path":   c.Request.URL.Path,
+			"status": status,
+		})
+		if denied {
+			entry.Warn("Denied HTTP API request")
+		} else {
+			entry.Info("Mutating HTTP API request")
+		}
+	}
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
@@ -1,21 +1,132 @@
 package middleware
 
 import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
 )
 
-// AuthMiddleware is a middleware that checks for a valid authentication token.
-func AuthMiddleware(token string) gin.HandlerFunc {
+// BearerProtocol is the websocket subprotocol accepted alongside a "bearer.<token>" subprotocol
+// carrying the token, as browsers cannot set the Authorization header of websocket requests
+const BearerProtocol = "bearer"
+
+// TokenNameKey is the context key of the name of the token a request was authenticated with
+const TokenNameKey = "token"
+
+// Token is a token accepted by the API, with the role it grants
+type Token struct {
+	Name   string
+	Secret string
+	Role   Role
+}
+
+// Tokens are the tokens accepted by the API
+type Tokens []Token
+
+// LoadTokens reads named tokens from a file, with one "<name> <token> [<role>]" entry per line.
+// Tokens without a role are admin tokens. Empty lines and lines starting with # are ignored.
+func LoadTokens(path string) (Tokens, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tokens := Tokens{}
+	names := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: expected a token name, a token and an optional role", path, line)
+		}
+		if names[fields[0]] {
+			return nil, fmt.Errorf("%s:%d: duplicate token name %q", path, line, fields[0])
+		}
+		token := Token{Name: fields[0], Secret: fields[1], Role: Admin}
+		if len(fields) == 3 {
+			if token.Role, err = ParseRole(fields[2]); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+		}
+		names[token.Name] = true
+		tokens = append(tokens, token)
+	}
+	return tokens, scanner.Err()
+}
+
+// Match returns the token with the given secret, comparing it to every token in constant time
+func (t Tokens) Match(secret string) (Token, bool) {
+	match, found := Token{}, false
+	for _, candidate := range t {
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(candidate.Secret)) == 1 {
+			match, found = candidate, true
+		}
+	}
+	return match, found
+}
+
+// AuthMiddleware is a middleware that checks for a valid authentication token. Requests must pass
+// it as a bearer token in the Authorization header. Websocket requests may pass it in the
+// access_token query parameter, or as a "bearer.<token>" subprotocol instead.
+// Without any tokens every request is accepted as an admin request.
+func AuthMiddleware(tokens Tokens) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := c.GetHeader("Authorization")
-		validToken := token // Replace with your actual valid token
+		if len(tokens) == 0 {
+			c.Set(RoleKey, Admin)
+			c.Next()
+			return
+		}
 
-		if token != validToken {
-			c.JSON(401, gin.H{"error": "Unauthorized"})
-			c.Abort()
+		token := requestToken(c.Request)
+		if token == "" {
+			unauthorized(c, "missing authentication token")
+			return
+		}
+		match, valid := tokens.Match(token)
+		if !valid {
+			unauthorized(c, "invalid authentication token")
 			return
 		}
 
+		c.Set(TokenNameKey, match.Name)
+		c.Set(RoleKey, match.Role)
 		c.Next()
 	}
 }
+
+func requestToken(r *http.Request) string {
+	if scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " "); found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return ""
+	}
+	if token := r.URL.Query().Get("access_token"); token != "" {
+		return token
+	}
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			if token, found := strings.CutPrefix(strings.TrimSpace(protocol), BearerProtocol+"."); found {
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+func unauthorized(c *gin.Context, reason string) {
+	log.WithFields(log.Fields{"client": c.ClientIP(), "path": c.Request.URL.Path}).Warnf("Rejected HTTP request: %s", reason)
+	c.Header("WWW-Authenticate", `Bearer realm="watchtower"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": reason})
+}
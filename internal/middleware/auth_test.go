@@ -0,0 +1,122 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/containrrr/watchtower/internal/middleware"
+	"github.com/gin-gonic/gin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the auth middleware", func() {
+	var router *gin.Engine
+	tokens := middleware.Tokens{
+		{Name: "operator", Secret: "s3cret", Role: middleware.Operator},
+		{Name: "dashboard", Secret: "d4shboard", Role: middleware.Viewer},
+	}
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	BeforeEach(func() {
+		router = gin.New()
+		router.Use(middleware.AuthMiddleware(tokens))
+		router.GET("/api/v1/state", func(c *gin.Context) {
+			role, _ := c.Get(middleware.RoleKey)
+			c.JSON(http.StatusOK, gin.H{"token": c.GetString(middleware.TokenNameKey), "role": role.(middleware.Role).String()})
+		})
+	})
+
+	It("should accept a valid bearer token", func() {
+		req := httptest.NewRequest("GET", "/api/v1/state", nil)
+		req.Header.Set("Authorization", "Bearer d4shboard")
+		rec := serve(req)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(MatchJSON(`{"token": "dashboard", "role": "viewer"}`))
+	})
+
+	It("should reject requests without a token", func() {
+		rec := serve(httptest.NewRequest("GET", "/api/v1/state", nil))
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+		Expect(rec.Body.String()).To(MatchJSON(`{"error": "missing authentication token"}`))
+		Expect(rec.Header().Get("WWW-Authenticate")).To(HavePrefix("Bearer"))
+	})
+
+	It("should reject an invalid token", func() {
+		req := httptest.NewRequest("GET", "/api/v1/state", nil)
+		req.Header.Set("Authorization", "Bearer s3cret-not")
+		rec := serve(req)
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+		Expect(rec.Body.String()).To(MatchJSON(`{"error": "invalid authentication token"}`))
+	})
+
+	It("should only accept the token as a query parameter on websocket requests", func() {
+		req := httptest.NewRequest("GET", "/api/v1/state?access_token=s3cret", nil)
+		Expect(serve(req).Code).To(Equal(http.StatusUnauthorized))
+
+		req = httptest.NewRequest("GET", "/api/v1/state?access_token=s3cret", nil)
+		req.Header.Set("Upgrade", "websocket")
+		Expect(serve(req).Code).To(Equal(http.StatusOK))
+	})
+
+	It("should accept the token as a websocket subprotocol", func() {
+		req := httptest.NewRequest("GET", "/api/v1/state", nil)
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Protocol", "bearer, bearer.s3cret")
+		Expect(serve(req).Code).To(Equal(http.StatusOK))
+	})
+
+	It("should accept every request as an admin request without tokens", func() {
+		router = gin.New()
+		router.Use(middleware.AuthMiddleware(middleware.Tokens{}), middleware.RequireRole(middleware.Admin))
+		router.GET("/api/v1/state", func(c *gin.Context) { c.Status(http.StatusOK) })
+		Expect(serve(httptest.NewRequest("GET", "/api/v1/state", nil)).Code).To(Equal(http.StatusOK))
+	})
+
+	Describe("loading tokens", func() {
+		var dir string
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "tokens")
+			Expect(err).NotTo(HaveOccurred())
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should read named tokens, skipping comments", func() {
+			path := filepath.Join(dir, "tokens")
+			Expect(os.WriteFile(path, []byte("# shop floor\noperator s3cret operator\n\ndashboard d4shboard viewer\n"), 0600)).To(Succeed())
+			loaded, err := middleware.LoadTokens(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(Equal(tokens))
+		})
+		It("should grant the admin role to tokens without a role", func() {
+			path := filepath.Join(dir, "tokens")
+			Expect(os.WriteFile(path, []byte("ci c1\n"), 0600)).To(Succeed())
+			loaded, err := middleware.LoadTokens(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(Equal(middleware.Tokens{{Name: "ci", Secret: "c1", Role: middleware.Admin}}))
+		})
+		It("should reject unknown roles", func() {
+			path := filepath.Join(dir, "tokens")
+			Expect(os.WriteFile(path, []byte("ci c1 root\n"), 0600)).To(Succeed())
+			_, err := middleware.LoadTokens(path)
+			Expect(err).To(MatchError(ContainSubstring("unknown role")))
+		})
+		It("should reject malformed lines", func() {
+			path := filepath.Join(dir, "tokens")
+			Expect(os.WriteFile(path, []byte("operator\n"), 0600)).To(Succeed())
+			_, err := middleware.LoadTokens(path)
+			Expect(err).To(MatchError(ContainSubstring(":1:")))
+		})
+	})
+})
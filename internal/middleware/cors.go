@@ -1,16 +1,93 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+	"net/url"
+	"strings"
 
-func CORSMiddleware() gin.HandlerFunc {
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// OriginsKey is the context key of the origins allowed by the CORS middleware
+const OriginsKey = "origins"
+
+// Origins are the origins of the web pages allowed to use the API, e.g. https://dashboard.local.
+// A * matches any part of an origin, as in https://*.robots.local, and a lone * allows every origin.
+// Pages served by the API itself are always allowed.
+type Origins []string
+
+// Allowed returns whether requests from the origin of the request are allowed. Requests without an
+// origin do not come from a web page, and are always allowed.
+func (o Origins) Allowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || sameOrigin(origin, r.Host) {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, pattern := range o {
+		if matchWildcard(strings.ToLower(strings.TrimSuffix(pattern, "/")), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameOrigin(origin string, host string) bool {
+	parsed, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(parsed.Host, host)
+}
+
+// matchWildcard matches the value to a pattern where every * matches any, possibly empty, text
+func matchWildcard(pattern string, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		index := strings.Index(value, part)
+		if index < 0 {
+			return false
+		}
+		value = value[index+len(part):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
+
+// CheckOrigin returns the origin check of the websocket upgraders, using the origins allowed by the
+// CORS middleware. Without it only pages served by the API itself may open websockets.
+func CheckOrigin(c *gin.Context) func(r *http.Request) bool {
+	origins, _ := c.Get(OriginsKey)
+	allowed, _ := origins.(Origins)
+	return allowed.Allowed
+}
+
+// CORSMiddleware allows the requests from the allowed origins, and rejects the ones from other web pages
+func CORSMiddleware(origins Origins) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		// c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
+		c.Set(OriginsKey, origins)
+		c.Writer.Header().Add("Vary", "Origin")
+
+		if !origins.Allowed(c.Request) {
+			log.WithFields(log.Fields{"origin": c.Request.Header.Get("Origin"), "path": c.Request.URL.Path}).
+				Warn("Rejected HTTP request from a web page whose origin is not allowed")
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "origin not allowed"})
+			return
+		}
+
+		if origin := c.Request.Header.Get("Origin"); origin != "" {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+			c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			c.Writer.Header().Set("Access-Control-Max-Age", "600")
+		}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(200)
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 
@@ -0,0 +1,80 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/containrrr/watchtower/internal/middleware"
+	"github.com/gin-gonic/gin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the CORS middleware", func() {
+	var router *gin.Engine
+	origins := middleware.Origins{"https://dashboard.local", "https://*.robots.local"}
+
+	serve := func(method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://robot.lan:8080/api/v1/holds/web", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", "DELETE")
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	BeforeEach(func() {
+		router = gin.New()
+		router.Use(middleware.CORSMiddleware(origins))
+		router.DELETE("/api/v1/holds/:container", func(c *gin.Context) { c.Status(http.StatusOK) })
+	})
+
+	It("should answer preflights for DELETE from allowed origins", func() {
+		rec := serve(http.MethodOptions, "https://dashboard.local")
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://dashboard.local"))
+		Expect(rec.Header().Get("Access-Control-Allow-Methods")).To(ContainSubstring("DELETE"))
+		Expect(rec.Header().Get("Access-Control-Allow-Methods")).To(ContainSubstring("PATCH"))
+	})
+
+	It("should match wildcard origins", func() {
+		Expect(serve(http.MethodDelete, "https://arm-3.robots.local").Code).To(Equal(http.StatusOK))
+		Expect(serve(http.MethodDelete, "https://robots.local.evil.com").Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("should reject other origins", func() {
+		rec := serve(http.MethodOptions, "https://evil.com")
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).To(BeEmpty())
+		Expect(serve(http.MethodDelete, "https://evil.com").Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("should allow requests without an origin and from the API itself", func() {
+		Expect(serve(http.MethodDelete, "").Code).To(Equal(http.StatusOK))
+		Expect(serve(http.MethodDelete, "http://robot.lan:8080").Code).To(Equal(http.StatusOK))
+	})
+
+	It("should allow every origin with a lone wildcard", func() {
+		router = gin.New()
+		router.Use(middleware.CORSMiddleware(middleware.Origins{"*"}))
+		router.DELETE("/api/v1/holds/:container", func(c *gin.Context) { c.Status(http.StatusOK) })
+		Expect(serve(http.MethodDelete, "https://anything.example").Code).To(Equal(http.StatusOK))
+	})
+
+	It("should check the origin of websocket upgrades", func() {
+		var check func(r *http.Request) bool
+		router.GET("/ws", func(c *gin.Context) { check = middleware.CheckOrigin(c) })
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ws", nil))
+
+		req := httptest.NewRequest(http.MethodGet, "http://robot.lan:8080/ws", nil)
+		req.Header.Set("Origin", "https://evil.com")
+		Expect(check(req)).To(BeFalse())
+		req.Header.Set("Origin", "https://cell-1.robots.local")
+		Expect(check(req)).To(BeTrue())
+	})
+})
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Role grants access to the API routes, every role includes the permissions of the ones before it
+type Role int
+
+const (
+	// Viewer may read the state of the device and its containers, including their logs
+	Viewer Role = iota + 1
+	// Operator may also start, stop, pause and restart containers without access to the host
+	Operator
+	// Admin may also update containers, hold them and start containers with access to the host,
+	// e.g. privileged ones
+	Admin
+)
+
+// RoleKey is the context key of the role of the token a request was authenticated with
+const RoleKey = "role"
+
+var roleNames = map[Role]string{Viewer: "viewer", Operator: "operator", Admin: "admin"}
+
+// ParseRole parses the name of a role
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role %q, expected viewer, operator or admin", name)
+}
+
+func (r Role) String() string {
+	if name, found := roleNames[r]; found {
+		return name
+	}
+	return "none"
+}
+
+// HasRole returns whether the request was authenticated with at least the given role
+func HasRole(c *gin.Context, role Role) bool {
+	granted, _ := c.Get(RoleKey)
+	if granted, ok := granted.(Role); ok {
+		return granted >= role
+	}
+	return false
+}
+
+// RequireRole is a middleware that rejects the requests not authenticated with at least the given role
+func RequireRole(role Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasRole(c, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("the %s role is required", role)})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,92 @@
+package middleware_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/containrrr/watchtower/internal/middleware"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the role middleware", func() {
+	var router *gin.Engine
+	var logs *bytes.Buffer
+	tokens := middleware.Tokens{
+		{Name: "screen", Secret: "v", Role: middleware.Viewer},
+		{Name: "floor", Secret: "o", Role: middleware.Operator},
+		{Name: "ci", Secret: "a", Role: middleware.Admin},
+	}
+
+	request := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	BeforeEach(func() {
+		logs = &bytes.Buffer{}
+		log.SetOutput(logs)
+		router = gin.New()
+		router.Use(middleware.Audit(), middleware.AuthMiddleware(tokens))
+		ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+		group := router.Group("/watchtower", middleware.RequireRole(middleware.Viewer))
+		group.GET("/state", ok)
+		group.POST("/stop", middleware.RequireRole(middleware.Operator), ok)
+		group.POST("/update", middleware.RequireRole(middleware.Admin), ok)
+	})
+	AfterEach(func() {
+		log.SetOutput(GinkgoWriter)
+	})
+
+	It("should let every role read", func() {
+		Expect(request("GET", "/watchtower/state", "v")).To(Equal(http.StatusOK))
+		Expect(request("GET", "/watchtower/state", "o")).To(Equal(http.StatusOK))
+		Expect(request("GET", "/watchtower/state", "a")).To(Equal(http.StatusOK))
+	})
+
+	It("should only let operators and admins change containers", func() {
+		Expect(request("POST", "/watchtower/stop", "v")).To(Equal(http.StatusForbidden))
+		Expect(request("POST", "/watchtower/stop", "o")).To(Equal(http.StatusOK))
+		Expect(request("POST", "/watchtower/stop", "a")).To(Equal(http.StatusOK))
+	})
+
+	It("should only let admins update", func() {
+		Expect(request("POST", "/watchtower/update", "o")).To(Equal(http.StatusForbidden))
+		Expect(request("POST", "/watchtower/update", "a")).To(Equal(http.StatusOK))
+	})
+
+	Describe("the audit log", func() {
+		It("should log denied requests", func() {
+			request("POST", "/watchtower/update", "o")
+			Expect(logs.String()).To(ContainSubstring("Denied HTTP API request"))
+			Expect(logs.String()).To(ContainSubstring("token=floor"))
+			Expect(logs.String()).To(ContainSubstring("role=operator"))
+		})
+		It("should log requests rejected by the authentication", func() {
+			request("GET", "/watchtower/state", "nope")
+			Expect(logs.String()).To(ContainSubstring("Denied HTTP API request"))
+		})
+		It("should log mutating requests", func() {
+			request("POST", "/watchtower/stop", "o")
+			Expect(logs.String()).To(ContainSubstring("Mutating HTTP API request"))
+			Expect(logs.String()).To(ContainSubstring("status=200"))
+		})
+		It("should not log reading requests", func() {
+			request("GET", "/watchtower/state", "v")
+			Expect(logs.String()).To(BeEmpty())
+		})
+	})
+
+	It("should parse role names", func() {
+		Expect(middleware.ParseRole("operator")).To(Equal(middleware.Operator))
+		_, err := middleware.ParseRole("root")
+		Expect(err).To(HaveOccurred())
+	})
+})
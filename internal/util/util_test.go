@@ -1,6 +1,8 @@
 package util
 
 import (
+	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
 
@@ -76,3 +78,17 @@ func TestGenerateRandomPrefixedSHA256(t *testing.T) {
 	res := GenerateRandomPrefixedSHA256()
 	assert.Regexp(t, regexp.MustCompile("sha256:[0-9|a-f]{64}"), res)
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	assert.NoError(t, WriteFileAtomic(path, []byte("first"), 0600))
+	assert.NoError(t, WriteFileAtomic(path, []byte("second"), 0600))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+	assert.NoFileExists(t, path+".tmp")
+
+	assert.Error(t, WriteFileAtomic(filepath.Join(dir, "missing", "state.json"), []byte("third"), 0600))
+}
@@ -0,0 +1,391 @@
+// Package bundle reads offline update bundles. A bundle is either a directory or a tar archive
+// (optionally gzipped) containing a signed manifest and the image archives it lists, as written by
+// `docker save`. Bundles are used to ship releases to robots without an internet connection.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Files at the root of every bundle
+const (
+	ManifestFile  = "manifest.json"
+	SignatureFile = "manifest.json.sig"
+)
+
+// ManifestVersion is the version of the manifest format
+const ManifestVersion = 1
+
+var (
+	// ErrNotSigned is returned when verifying a bundle without a signature
+	ErrNotSigned = errors.New("bundle is not signed")
+	// ErrInvalidSignature is returned when the signature of a bundle does not match any of the trusted keys
+	ErrInvalidSignature = errors.New("bundle signature does not match any trusted key")
+	// ErrChecksumMismatch is returned when an image archive differs from the one listed in the manifest
+	ErrChecksumMismatch = errors.New("image archive does not match its checksum")
+)
+
+// Manifest describes the images shipped in a bundle
+type Manifest struct {
+	Version int       `json:"version"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Images  []Image   `json:"images"`
+}
+
+// Image is an image archive in a bundle
+type Image struct {
+	// File is the path of the archive, relative to the root of the bundle
+	File string `json:"file"`
+	// SHA256 is the hex encoded checksum of the archive
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	// Digest is the ID of the image, which is the digest of its configuration. It is checked
+	// against the archive and against the image loaded by the docker daemon.
+	Digest string   `json:"digest"`
+	Tags   []string `json:"tags"`
+	// Services are the names of the containers that should be updated to the image.
+	// If empty, every container running one of the tags is updated.
+	Services []string `json:"services,omitempty"`
+}
+
+// Bundle is an opened offline update bundle
+type Bundle struct {
+	Path      string
+	Manifest  Manifest
+	manifest  []byte
+	signature []byte
+	archive   bool
+}
+
+// Open reads the manifest of the bundle at path, which is either a directory or a tar archive.
+// The bundle is not verified until Verify is called.
+func Open(bundlePath string) (*Bundle, error) {
+	info, err := os.Stat(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{Path: bundlePath, archive: !info.IsDir()}
+	if b.archive {
+		err = b.walkArchive(func(name string, r io.Reader) error {
+			switch name {
+			case ManifestFile:
+				b.manifest, err = io.ReadAll(r)
+			case SignatureFile:
+				b.signature, err = io.ReadAll(r)
+			}
+			return err
+		})
+	} else {
+		b.manifest, err = os.ReadFile(filepath.Join(bundlePath, ManifestFile))
+		if err == nil {
+			b.signature, err = os.ReadFile(filepath.Join(bundlePath, SignatureFile))
+			if errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if b.manifest == nil {
+		return nil, fmt.Errorf("bundle has no %s", ManifestFile)
+	}
+
+	if err := json.Unmarshal(b.manifest, &b.Manifest); err != nil {
+		return nil, fmt.Errorf("could not parse the bundle manifest: %w", err)
+	}
+	if err := b.Manifest.Validate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Validate checks that the manifest is complete and only refers to files inside the bundle
+func (m *Manifest) Validate() error {
+	if m.Version != ManifestVersion {
+		return fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	if len(m.Images) == 0 {
+		return errors.New("manifest lists no images")
+	}
+	for _, image := range m.Images {
+		if image.File == "" || path.IsAbs(image.File) || path.Clean(image.File) != image.File || strings.HasPrefix(image.File, "../") {
+			return fmt.Errorf("image file %q must be a clean path inside the bundle", image.File)
+		}
+		if !isSHA256(image.SHA256) {
+			return fmt.Errorf("image %s: invalid sha256 %q", image.File, image.SHA256)
+		}
+		if digest, found := strings.CutPrefix(image.Digest, "sha256:"); !found || !isSHA256(digest) {
+			return fmt.Errorf("image %s: invalid digest %q", image.File, image.Digest)
+		}
+		if len(image.Tags) == 0 {
+			return fmt.Errorf("image %s: at least one tag is required", image.File)
+		}
+	}
+	return nil
+}
+
+// isSHA256 returns whether the value is a hex encoded sha256 checksum
+func isSHA256(value string) bool {
+	sum, err := hex.DecodeString(value)
+	return err == nil && len(sum) == sha256.Size
+}
+
+// Verify checks the signature of the manifest against the trusted keys, and every image
+// archive against the checksum, size, digest and tags listed in the manifest
+func (b *Bundle) Verify(keys []ed25519.PublicKey) error {
+	if err := b.VerifySignature(keys); err != nil {
+		return err
+	}
+	for _, image := range b.Manifest.Images {
+		archive, err := b.OpenImage(image)
+		if err != nil {
+			return fmt.Errorf("image %s: %w", image.File, err)
+		}
+		err = verifyImage(archive, image)
+		archive.Close()
+		if err != nil {
+			return fmt.Errorf("image %s: %w", image.File, err)
+		}
+	}
+	return nil
+}
+
+// VerifySignature checks the signature of the manifest against the trusted keys. The image
+// archives are not read, they have to be checked with StageImage before they are used.
+func (b *Bundle) VerifySignature(keys []ed25519.PublicKey) error {
+	if len(keys) == 0 {
+		return errors.New("no trusted keys to verify the bundle with")
+	}
+	if len(b.signature) == 0 {
+		return ErrNotSigned
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b.signature)))
+	if err != nil {
+		return fmt.Errorf("could not decode the bundle signature: %w", err)
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, b.manifest, signature) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// StageImage copies the image archive into a new file in dir, checking it against the checksum,
+// size, digest and tags listed in the manifest, and returns the path of the copy. Loading the copy
+// instead of the bundle makes sure that the archive cannot change on the media after it was checked.
+func (b *Bundle) StageImage(image Image, dir string) (string, error) {
+	archive, err := b.OpenImage(image)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+
+	file, err := os.CreateTemp(dir, "image-*.tar")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, archive)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = verifyImage(file, image)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// OpenImage returns the image archive, streamed from the bundle. Reading the archive to the
+// end fails with ErrChecksumMismatch if it was changed since the bundle was verified.
+func (b *Bundle) OpenImage(image Image) (io.ReadCloser, error) {
+	if !b.archive {
+		file, err := os.Open(filepath.Join(b.Path, filepath.FromSlash(image.File)))
+		if err != nil {
+			return nil, err
+		}
+		return newVerifyingReader(file, file, image), nil
+	}
+
+	file, err := os.Open(b.Path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := archiveReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			file.Close()
+			return nil, fmt.Errorf("bundle has no %s", image.File)
+		} else if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if cleanName(header.Name) == image.File {
+			return newVerifyingReader(tr, file, image), nil
+		}
+	}
+}
+
+// walkArchive calls fn with the name and content of every regular file in the bundle archive
+func (b *Bundle) walkArchive(fn func(name string, r io.Reader) error) error {
+	file, err := os.Open(b.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader, err := archiveReader(file)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("could not read the bundle archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(cleanName(header.Name), tr); err != nil {
+			return err
+		}
+	}
+}
+
+// archiveReader returns a reader for the tar stream of the file, decompressing gzipped archives
+func archiveReader(file *os.File) (io.Reader, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return nil, fmt.Errorf("could not read the bundle archive: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if bytes.Equal(header, []byte{0x1f, 0x8b}) {
+		return gzip.NewReader(file)
+	}
+	return file, nil
+}
+
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// dockerManifest is an entry in the manifest.json of a `docker save` archive
+type dockerManifest struct {
+	Config   string
+	RepoTags []string
+}
+
+// verifyImage reads the whole image archive, checking that it contains the image listed in the manifest
+func verifyImage(archive io.Reader, image Image) error {
+	var manifests []dockerManifest
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("not an image archive: %w", err)
+		}
+		if cleanName(header.Name) == "manifest.json" {
+			if err := json.NewDecoder(tr).Decode(&manifests); err != nil {
+				return fmt.Errorf("could not parse the image archive manifest: %w", err)
+			}
+		}
+	}
+	// Read the padding at the end of the archive, so that the whole file is checksummed
+	if _, err := io.Copy(io.Discard, archive); err != nil {
+		return err
+	}
+
+	for _, manifest := range manifests {
+		configDigest := "sha256:" + strings.TrimSuffix(path.Base(manifest.Config), ".json")
+		if configDigest != image.Digest {
+			continue
+		}
+		if containsAll(manifest.RepoTags, image.Tags) {
+			return nil
+		}
+	}
+	return fmt.Errorf("archive does not contain image %s tagged %s", image.Digest, strings.Join(image.Tags, ", "))
+}
+
+func containsAll(values []string, required []string) bool {
+	present := map[string]bool{}
+	for _, value := range values {
+		present[value] = true
+	}
+	for _, value := range required {
+		if !present[value] {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyingReader checksums an image archive while it is being read
+type verifyingReader struct {
+	reader io.Reader
+	closer io.Closer
+	hash   hash.Hash
+	size   int64
+	image  Image
+}
+
+func newVerifyingReader(reader io.Reader, closer io.Closer, image Image) *verifyingReader {
+	return &verifyingReader{reader: reader, closer: closer, hash: sha256.New(), image: image}
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hash.Write(p[:n])
+	r.size += int64(n)
+	if err == io.EOF {
+		if r.image.Size > 0 && r.size != r.image.Size {
+			return n, ErrChecksumMismatch
+		}
+		if hex.EncodeToString(r.hash.Sum(nil)) != r.image.SHA256 {
+			return n, ErrChecksumMismatch
+		}
+	}
+	return n, err
+}
+
+func (r *verifyingReader) Close() error {
+	return r.closer.Close()
+}
@@ -0,0 +1,16 @@
+package bundle_test
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestBundle(t *testing.T) {
+	RegisterFailHandler(Fail)
+	logrus.SetOutput(GinkgoWriter)
+	RunSpecs(t, "Bundle Suite")
+}
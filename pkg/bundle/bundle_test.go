@@ -0,0 +1,303 @@
+package bundle_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containrrr/watchtower/pkg/bundle"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const imageID = "4f2a8e6d1c0b9a8877665544332211ffeeddccbbaa99887766554433221100aa"
+
+func makeTar(files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})).To(Succeed())
+		_, err := tw.Write(content)
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(tw.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+// makeImageArchive returns an archive laid out like the output of docker save
+func makeImageArchive(tags ...string) []byte {
+	manifest, _ := json.Marshal([]map[string]interface{}{{"Config": imageID + ".json", "RepoTags": tags}})
+	return makeTar(map[string][]byte{
+		"manifest.json":   manifest,
+		imageID + ".json": []byte("{}"),
+	})
+}
+
+func makeManifest(archive []byte) []byte {
+	sum := sha256.Sum256(archive)
+	manifest, _ := json.Marshal(bundle.Manifest{
+		Version: bundle.ManifestVersion,
+		Name:    "release",
+		Created: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		Images: []bundle.Image{{
+			File:     "images/base.tar",
+			SHA256:   hex.EncodeToString(sum[:]),
+			Size:     int64(len(archive)),
+			Digest:   "sha256:" + imageID,
+			Tags:     []string{"robot/base:1.0"},
+			Services: []string{"planner"},
+		}},
+	})
+	return manifest
+}
+
+func sign(key ed25519.PrivateKey, manifest []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest)) + "\n")
+}
+
+var _ = Describe("offline update bundles", func() {
+	var dir string
+	var publicKey ed25519.PublicKey
+	var privateKey ed25519.PrivateKey
+	var archive []byte
+	var manifest []byte
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "bundle")
+		Expect(err).NotTo(HaveOccurred())
+		publicKey, privateKey, err = ed25519.GenerateKey(nil)
+		Expect(err).NotTo(HaveOccurred())
+		archive = makeImageArchive("robot/base:1.0", "robot/base:latest")
+		manifest = makeManifest(archive)
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writeDirectory := func(path string, signature []byte) {
+		Expect(os.MkdirAll(filepath.Join(path, "images"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(path, bundle.ManifestFile), manifest, 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(path, "images", "base.tar"), archive, 0644)).To(Succeed())
+		if signature != nil {
+			Expect(os.WriteFile(filepath.Join(path, bundle.SignatureFile), signature, 0644)).To(Succeed())
+		}
+	}
+
+	When("the bundle is a directory", func() {
+		var path string
+
+		BeforeEach(func() {
+			path = filepath.Join(dir, "release")
+		})
+
+		It("should verify and stream the images of a signed bundle", func() {
+			writeDirectory(path, sign(privateKey, manifest))
+			b, err := bundle.Open(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b.Manifest.Images[0].Services).To(Equal([]string{"planner"}))
+			Expect(b.Verify([]ed25519.PublicKey{publicKey})).To(Succeed())
+
+			image, err := b.OpenImage(b.Manifest.Images[0])
+			Expect(err).NotTo(HaveOccurred())
+			defer image.Close()
+			Expect(io.ReadAll(image)).To(Equal(archive))
+		})
+
+		It("should refuse unsigned bundles and untrusted signatures", func() {
+			writeDirectory(path, nil)
+			b, err := bundle.Open(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b.Verify([]ed25519.PublicKey{publicKey})).To(MatchError(bundle.ErrNotSigned))
+
+			_, otherKey, _ := ed25519.GenerateKey(nil)
+			writeDirectory(path, sign(otherKey, manifest))
+			b, err = bundle.Open(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b.Verify([]ed25519.PublicKey{publicKey})).To(MatchError(bundle.ErrInvalidSignature))
+			Expect(b.Verify(nil)).NotTo(Succeed())
+		})
+
+		It("should refuse tampered images", func() {
+			writeDirectory(path, sign(privateKey, manifest))
+			Expect(os.WriteFile(filepath.Join(path, "images", "base.tar"), makeImageArchive("robot/base:1.0", "robot/evil:1.0"), 0644)).To(Succeed())
+			b, err := bundle.Open(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.Is(b.Verify([]ed25519.PublicKey{publicKey}), bundle.ErrChecksumMismatch)).To(BeTrue())
+		})
+
+		It("should refuse images without the listed tags", func() {
+			archive = makeImageArchive("robot/other:1.0")
+			manifest = makeManifest(archive)
+			writeDirectory(path, sign(privateKey, manifest))
+			b, err := bundle.Open(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b.Verify([]ed25519.PublicKey{publicKey})).To(MatchError(ContainSubstring("does not contain image")))
+		})
+
+		It("should refuse images without a digest", func() {
+			manifest = bytes.Replace(manifest, []byte("sha256:"+imageID), []byte("robot/base:1.0"), 1)
+			writeDirectory(path, sign(privateKey, manifest))
+			_, err := bundle.Open(path)
+			Expect(err).To(MatchError(ContainSubstring("invalid digest")))
+		})
+
+		It("should stage checked copies of the images", func() {
+			writeDirectory(path, sign(privateKey, manifest))
+			b, err := bundle.Open(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b.VerifySignature([]ed25519.PublicKey{publicKey})).To(Succeed())
+
+			staged, err := b.StageImage(b.Manifest.Images[0], dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Dir(staged)).To(Equal(dir))
+			Expect(os.ReadFile(staged)).To(Equal(archive))
+
+			Expect(os.WriteFile(filepath.Join(path, "images", "base.tar"), append(archive, 0), 0644)).To(Succeed())
+			Expect(os.Remove(staged)).To(Succeed())
+			_, err = b.StageImage(b.Manifest.Images[0], dir)
+			Expect(err).To(MatchError(bundle.ErrChecksumMismatch))
+			Expect(filepath.Glob(filepath.Join(dir, "image-*"))).To(BeEmpty())
+		})
+
+		It("should refuse image files outside of the bundle", func() {
+			manifest = bytes.Replace(manifest, []byte("images/base.tar"), []byte("../base.tar"), 1)
+			writeDirectory(path, sign(privateKey, manifest))
+			_, err := bundle.Open(path)
+			Expect(err).To(MatchError(ContainSubstring("must be a clean path inside the bundle")))
+		})
+	})
+
+	When("the bundle is a gzipped archive", func() {
+		It("should verify and stream the images", func() {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			_, err := gz.Write(makeTar(map[string][]byte{
+				"./" + bundle.ManifestFile:  manifest,
+				"./" + bundle.SignatureFile: sign(privateKey, manifest),
+				"./images/base.tar":         archive,
+			}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gz.Close()).To(Succeed())
+			path := filepath.Join(dir, "release.bundle.tar.gz")
+			Expect(os.WriteFile(path, buf.Bytes(), 0644)).To(Succeed())
+
+			b, err := bundle.Open(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b.Verify([]ed25519.PublicKey{publicKey})).To(Succeed())
+
+			image, err := b.OpenImage(b.Manifest.Images[0])
+			Expect(err).NotTo(HaveOccurred())
+			defer image.Close()
+			Expect(io.ReadAll(image)).To(Equal(archive))
+		})
+	})
+
+	Describe("finding bundles", func() {
+		It("should find directories and archives on the media", func() {
+			writeDirectory(filepath.Join(dir, "usb", "releases", "2024"), nil)
+			writeDirectory(filepath.Join(dir, "usb", ".hidden"), nil)
+			writeDirectory(filepath.Join(dir, "usb", "a", "b", "c", "too-deep"), nil)
+			Expect(os.WriteFile(filepath.Join(dir, "usb", "robot.bundle.tar"), nil, 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "usb", "notes.tar"), nil, 0644)).To(Succeed())
+
+			found, err := bundle.Find([]string{dir, filepath.Join(dir, "missing")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(Equal([]string{
+				filepath.Join(dir, "usb", "releases", "2024"),
+				filepath.Join(dir, "usb", "robot.bundle.tar"),
+			}))
+		})
+
+		It("should return the latest valid bundle", func() {
+			writeDirectory(filepath.Join(dir, "old"), nil)
+			manifest = bytes.Replace(manifest, []byte("2024-05-01"), []byte("2024-06-01"), 1)
+			writeDirectory(filepath.Join(dir, "new"), nil)
+			Expect(os.WriteFile(filepath.Join(dir, "broken.bundle.tar"), []byte("garbage"), 0644)).To(Succeed())
+
+			b, err := bundle.Latest([]string{dir})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b.Path).To(Equal(filepath.Join(dir, "new")))
+
+			_, err = bundle.Latest([]string{filepath.Join(dir, "missing")})
+			Expect(err).To(MatchError(bundle.ErrNoBundle))
+		})
+	})
+
+	It("should load the trusted public keys", func() {
+		path := filepath.Join(dir, "keys")
+		data := "# release key\n" + base64.StdEncoding.EncodeToString(publicKey) + "\n\n"
+		Expect(os.WriteFile(path, []byte(data), 0644)).To(Succeed())
+		keys, err := bundle.LoadPublicKeys(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(Equal([]ed25519.PublicKey{publicKey}))
+
+		Expect(os.WriteFile(path, []byte("not a key\n"), 0644)).To(Succeed())
+		_, err = bundle.LoadPublicKeys(path)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("writing bundles", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "bundle")
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should write bundles that verify against the signing key", func() {
+		publicKey, privateKey, err := ed25519.GenerateKey(nil)
+		Expect(err).NotTo(HaveOccurred())
+		path := filepath.Join(dir, "export")
+		archive := makeImageArchive("robot/base:1.0")
+
+		writer, err := bundle.NewWriter(path, "export")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.AddImage(bundle.Image{
+			File:   "images/base.tar",
+			Digest: "sha256:" + imageID,
+			Tags:   []string{"robot/base:1.0"},
+		}, bytes.NewReader(archive))).To(Succeed())
+		b, err := writer.Close(privateKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(b.Manifest.Name).To(Equal("export"))
+		Expect(b.Manifest.Images[0].Size).To(Equal(int64(len(archive))))
+		Expect(b.Verify([]ed25519.PublicKey{publicKey})).To(Succeed())
+
+		_, err = bundle.NewWriter(path, "export")
+		Expect(err).To(MatchError(os.ErrExist))
+	})
+
+	It("should refuse to write bundles without images", func() {
+		writer, err := bundle.NewWriter(filepath.Join(dir, "empty"), "empty")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = writer.Close(nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should load private keys from a seed or a whole key", func() {
+		_, privateKey, _ := ed25519.GenerateKey(nil)
+		for _, encoded := range [][]byte{privateKey.Seed(), privateKey} {
+			path := filepath.Join(dir, "key")
+			Expect(os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(encoded)+"\n"), 0600)).To(Succeed())
+			Expect(bundle.LoadPrivateKey(path)).To(Equal(privateKey))
+		}
+	})
+})
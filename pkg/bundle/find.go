@@ -0,0 +1,139 @@
+package bundle
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxSearchDepth is how deep below a media root bundles are searched for, e.g. /media/<user>/<label>/<bundle>
+const maxSearchDepth = 3
+
+// archiveSuffixes are the file name suffixes of bundle archives
+var archiveSuffixes = []string{".bundle.tar", ".bundle.tar.gz", ".bundle.tgz"}
+
+// Find returns the paths of the bundles below the roots, e.g. the mount points of removable media.
+// Bundles are either directories containing a manifest, or archives named *.bundle.tar(.gz).
+// Roots that do not exist are skipped.
+func Find(roots []string) ([]string, error) {
+	found := []string{}
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if path == root && errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				// Unreadable directories, e.g. media of another user, are skipped
+				if entry != nil && entry.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			if entry.IsDir() {
+				if path != root && strings.HasPrefix(entry.Name(), ".") {
+					return fs.SkipDir
+				}
+				if _, err := os.Stat(filepath.Join(path, ManifestFile)); err == nil {
+					found = append(found, path)
+					return fs.SkipDir
+				}
+				if depth(root, path) >= maxSearchDepth {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			if entry.Type().IsRegular() && isArchiveName(entry.Name()) {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(found)
+	return found, nil
+}
+
+func isArchiveName(name string) bool {
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func depth(root string, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// LoadPublicKeys reads the trusted ed25519 public keys from a file, one base64 encoded key per line.
+// Empty lines and lines starting with # are ignored.
+func LoadPublicKeys(path string) ([]ed25519.PublicKey, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys := []ed25519.PublicKey{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%s:%d: expected a base64 encoded ed25519 public key", path, lineNumber)
+		}
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+	return keys, scanner.Err()
+}
+
+// ErrNoBundle is returned when no valid bundle was found
+var ErrNoBundle = errors.New("no update bundle found")
+
+// Latest opens every bundle below the roots and returns the most recently created one.
+// Bundles that cannot be opened are skipped.
+func Latest(roots []string) (*Bundle, error) {
+	paths, err := Find(roots)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *Bundle
+	for _, path := range paths {
+		b, err := Open(path)
+		if err != nil {
+			log.WithField("bundle", path).Warnf("Skipping invalid update bundle: %v", err)
+			continue
+		}
+		if latest == nil || b.Manifest.Created.After(latest.Manifest.Created) {
+			latest = b
+		}
+	}
+	if latest == nil {
+		return nil, ErrNoBundle
+	}
+	return latest, nil
+}
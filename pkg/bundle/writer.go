@@ -0,0 +1,107 @@
+package bundle
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Writer writes a bundle directory
+type Writer struct {
+	dir      string
+	manifest Manifest
+}
+
+// NewWriter creates the directory of a new bundle. The directory must not exist yet.
+func NewWriter(dir string, name string) (*Writer, error) {
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		dir: dir,
+		manifest: Manifest{
+			Version: ManifestVersion,
+			Name:    name,
+			Created: time.Now().UTC(),
+			Images:  []Image{},
+		},
+	}, nil
+}
+
+// AddImage copies the image archive into the bundle, and lists the image in the manifest
+// with the checksum and size of the archive
+func (w *Writer) AddImage(image Image, archive io.Reader) error {
+	path := filepath.Join(w.dir, filepath.FromSlash(image.File))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), archive)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	image.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	image.Size = size
+	w.manifest.Images = append(w.manifest.Images, image)
+	return nil
+}
+
+// Close writes the manifest, signed with the key unless it is nil, and returns the written bundle
+func (w *Writer) Close(key ed25519.PrivateKey) (*Bundle, error) {
+	if err := w.manifest.Validate(); err != nil {
+		return nil, err
+	}
+	manifest, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(w.dir, ManifestFile), manifest, 0644); err != nil {
+		return nil, err
+	}
+	if key != nil {
+		signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest)) + "\n"
+		if err := os.WriteFile(filepath.Join(w.dir, SignatureFile), []byte(signature), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return Open(w.dir)
+}
+
+// LoadPrivateKey reads the ed25519 key bundles are signed with, from a file containing either the
+// base64 encoded seed or the whole private key
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: expected a base64 encoded ed25519 private key", path)
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	default:
+		return nil, fmt.Errorf("%s: expected a base64 encoded ed25519 private key", path)
+	}
+}
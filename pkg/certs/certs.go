@@ -0,0 +1,102 @@
+// Package certs provides the certificates of the HTTP API server, generating a self-signed one for
+// the device on first boot and reloading them whenever their files change.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containrrr/watchtower/internal/util"
+)
+
+// validity is how long generated certificates are valid, robots are rarely reprovisioned
+const validity = 10 * 365 * 24 * time.Hour
+
+// EnsureSelfSigned generates a self-signed certificate for the device with the given UUID, unless
+// the certificate or the key file already exist. It returns whether a certificate was generated.
+func EnsureSelfSigned(certFile, keyFile, uuid string) (bool, error) {
+	for _, file := range []string{certFile, keyFile} {
+		if _, err := os.Stat(file); err == nil {
+			return false, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+	}
+
+	certPEM, keyPEM, err := SelfSigned(uuid, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if err := writeFile(keyFile, keyPEM, 0600); err != nil {
+		return false, err
+	}
+	if err := writeFile(certFile, certPEM, 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SelfSigned returns a PEM encoded certificate and key for the device with the given UUID. The
+// certificate names the device by its UUID, and is valid for its host name and the loopback addresses.
+func SelfSigned(uuid string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		names = append(names, hostname)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   uuid,
+			Organization: []string{"watchtower"},
+			SerialNumber: uuid,
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		DNSNames:              names,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(path, data, perm); err != nil {
+		return fmt.Errorf("unable to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package certs_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containrrr/watchtower/pkg/certs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the certificates", func() {
+	var dir, certFile, keyFile string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "certs")
+		Expect(err).NotTo(HaveOccurred())
+		certFile = filepath.Join(dir, "tls", "cert.pem")
+		keyFile = filepath.Join(dir, "tls", "key.pem")
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("generating a self-signed certificate", func() {
+		It("should name the device by its UUID", func() {
+			generated, err := certs.EnsureSelfSigned(certFile, keyFile, "10000000a1b2c3d4")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(BeTrue())
+
+			pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+			Expect(err).NotTo(HaveOccurred())
+			cert, err := x509.ParseCertificate(pair.Certificate[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cert.Subject.CommonName).To(Equal("10000000a1b2c3d4"))
+			Expect(cert.VerifyHostname("localhost")).To(Succeed())
+			Expect(cert.IsCA).To(BeFalse())
+			Expect(cert.ExtKeyUsage).To(ConsistOf(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth))
+
+			info, err := os.Stat(keyFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+		It("should keep existing certificates", func() {
+			Expect(certs.EnsureSelfSigned(certFile, keyFile, "first")).To(BeTrue())
+			before, _ := os.ReadFile(certFile)
+			Expect(certs.EnsureSelfSigned(certFile, keyFile, "second")).To(BeFalse())
+			after, _ := os.ReadFile(certFile)
+			Expect(after).To(Equal(before))
+		})
+	})
+
+	Describe("the reloader", func() {
+		var listener net.Listener
+
+		serve := func(clientCAFile string) {
+			reloader, err := certs.NewReloader(certFile, keyFile, clientCAFile)
+			Expect(err).NotTo(HaveOccurred())
+			listener, err = tls.Listen("tcp", "127.0.0.1:0", reloader.Config())
+			Expect(err).NotTo(HaveOccurred())
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						defer conn.Close()
+						_ = conn.(*tls.Conn).Handshake()
+						_, _ = conn.Read(make([]byte, 1))
+					}()
+				}
+			}()
+		}
+		dial := func(clientCerts ...tls.Certificate) (string, error) {
+			conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, Certificates: clientCerts})
+			if err != nil {
+				return "", err
+			}
+			defer conn.Close()
+			// Client certificates are rejected after the client side of the handshake is done
+			if _, err := conn.Write([]byte("x")); err != nil {
+				return "", err
+			}
+			if _, err := conn.Read(make([]byte, 1)); err != nil && err.Error() != "EOF" {
+				return "", err
+			}
+			return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+		}
+
+		BeforeEach(func() {
+			Expect(certs.EnsureSelfSigned(certFile, keyFile, "first")).To(BeTrue())
+		})
+		AfterEach(func() {
+			listener.Close()
+		})
+
+		It("should reload the certificate when its files change", func() {
+			serve("")
+			Expect(dial()).To(Equal("first"))
+
+			certPEM, keyPEM, err := certs.SelfSigned("second", time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(certFile, certPEM, 0644)).To(Succeed())
+			Expect(os.WriteFile(keyFile, keyPEM, 0600)).To(Succeed())
+			later := time.Now().Add(time.Minute)
+			Expect(os.Chtimes(certFile, later, later)).To(Succeed())
+			Expect(dial()).To(Equal("second"))
+		})
+
+		It("should keep the previous certificate when the new files are invalid", func() {
+			serve("")
+			Expect(os.WriteFile(certFile, []byte("garbage"), 0644)).To(Succeed())
+			later := time.Now().Add(time.Minute)
+			Expect(os.Chtimes(certFile, later, later)).To(Succeed())
+			Expect(dial()).To(Equal("first"))
+		})
+
+		It("should require a client certificate signed by the client CA", func() {
+			caFile := filepath.Join(dir, "ca.pem")
+			ca, caKey, caPEM := authority()
+			Expect(os.WriteFile(caFile, caPEM, 0644)).To(Succeed())
+			serve(caFile)
+
+			_, err := dial()
+			Expect(err).To(HaveOccurred())
+			Expect(dial(clientCert(ca, caKey))).To(Equal("first"))
+		})
+
+		It("should reject a client CA file without certificates", func() {
+			caFile := filepath.Join(dir, "ca.pem")
+			Expect(os.WriteFile(caFile, []byte("nothing"), 0644)).To(Succeed())
+			_, err := certs.NewReloader(certFile, keyFile, caFile)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+func authority() (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fleet"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func clientCert(ca *x509.Certificate, caKey *ecdsa.PrivateKey) tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "dashboard"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	Expect(err).NotTo(HaveOccurred())
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,116 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Reloader serves the certificate of the HTTP API server, and the certificate authority its clients
+// must be signed by for mutual TLS. The files are checked on every handshake and reloaded when they
+// change, so that certificates are renewed without restarting the supervisor.
+type Reloader struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is optional, without it clients are not asked for a certificate
+	ClientCAFile string
+
+	mutex     sync.Mutex
+	modTimes  []time.Time
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewReloader returns a reloader with the certificates loaded from the files
+func NewReloader(certFile, keyFile, clientCAFile string) (*Reloader, error) {
+	r := &Reloader{CertFile: certFile, KeyFile: keyFile, ClientCAFile: clientCAFile}
+	if err := r.load(r.stat()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Config returns the TLS configuration of the server, using the current certificates on every handshake
+func (r *Reloader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, clientCAs := r.current()
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+			}
+			if clientCAs != nil {
+				config.ClientCAs = clientCAs
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return config, nil
+		},
+	}
+}
+
+// current reloads the certificates if their files changed, keeping the previous ones if the new
+// files are invalid, e.g. while they are being replaced
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if modTimes := r.stat(); !equalTimes(modTimes, r.modTimes) {
+		if err := r.load(modTimes); err != nil {
+			log.WithError(err).Warn("Unable to reload the HTTP API certificates, keeping the previous ones")
+			// Retry once the files change again
+			r.modTimes = modTimes
+		} else {
+			log.Info("Reloaded the HTTP API certificates")
+		}
+	}
+	return r.cert, r.clientCAs
+}
+
+func (r *Reloader) load(modTimes []time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		return err
+	}
+	var clientCAs *x509.CertPool
+	if r.ClientCAFile != "" {
+		data, err := os.ReadFile(r.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificate found in %s", r.ClientCAFile)
+		}
+	}
+	r.cert, r.clientCAs, r.modTimes = &cert, clientCAs, modTimes
+	return nil
+}
+
+func (r *Reloader) stat() []time.Time {
+	modTimes := []time.Time{}
+	for _, file := range []string{r.CertFile, r.KeyFile, r.ClientCAFile} {
+		var modTime time.Time
+		if info, err := os.Stat(file); err == nil {
+			modTime = info.ModTime()
+		}
+		modTimes = append(modTimes, modTime)
+	}
+	return modTimes
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
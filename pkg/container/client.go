@@ -2,12 +2,11 @@ package container
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,13 +14,14 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
 	sdkClient "github.com/docker/docker/client"
-	"github.com/google/gousb"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 
 	"github.com/containrrr/watchtower/pkg/registry"
 	"github.com/containrrr/watchtower/pkg/registry/digest"
+	"github.com/containrrr/watchtower/pkg/registry/tags"
 	t "github.com/containrrr/watchtower/pkg/types"
 )
 
@@ -31,19 +31,30 @@ const defaultStopSignal = "SIGTERM"
 // Docker API.
 type Client interface {
 	ListContainers(t.Filter) ([]t.Container, error)
+	ListAllContainers(t.Filter) ([]t.Container, error)
 	GetContainer(containerID t.ContainerID) (t.Container, error)
+	GetContainerByName(name string) (t.Container, error)
 	StopContainer(t.Container, time.Duration) error
 	StartContainerWithExistingConfig(t.Container) (t.ContainerID, error)
 	StartContainer(string, container.Config, container.HostConfig, network.NetworkingConfig) (t.ContainerID, error)
 	RenameContainer(t.Container, string) error
+	EnsureNetwork(Network) (string, error)
+	EnsureVolume(Volume) (string, error)
+	PauseContainer(t.Container) error
+	UnpauseContainer(t.Container) error
+	RestartContainer(t.Container, time.Duration) error
 	IsContainerStale(t.Container, t.UpdateParams) (stale bool, latestImage t.ImageID, err error)
 	ExecuteCommand(containerID t.ContainerID, command string, timeout int) (SkipUpdate bool, err error)
 	RemoveImageByID(t.ImageID) error
+	TagImage(t.ImageID, string) error
+	GetImageID(name string) (t.ImageID, error)
 	WarnOnHeadPullFailed(container t.Container) bool
-	LoadImageFromUSB(string) error
+	LoadImage(io.Reader) error
+	SaveImage(images []string) (io.ReadCloser, error)
 	CheckDigestAndPullImage(t.Container) error
-	CheckImageDigest(t.Container) (bool, error)
+	CheckForUpdate(t.Container) (t.UpdateStatus, error)
 	PullImage(t.Container) error
+	ListImageTags(t.Container) ([]string, error)
 	StreamLogs(t.Container, bool) (io.ReadCloser, error)
 }
 
@@ -104,9 +115,6 @@ func (client dockerClient) WarnOnHeadPullFailed(container t.Container) bool {
 }
 
 func (client dockerClient) ListContainers(fn t.Filter) ([]t.Container, error) {
-	cs := []t.Container{}
-	bg := context.Background()
-
 	if client.IncludeStopped && client.IncludeRestarting {
 		log.Debug("Retrieving running, stopped, restarting and exited containers")
 	} else if client.IncludeStopped {
@@ -118,12 +126,21 @@ func (client dockerClient) ListContainers(fn t.Filter) ([]t.Container, error) {
 	}
 
 	filter := client.createListFilter()
-	containers, err := client.api.ContainerList(
-		bg,
-		types.ContainerListOptions{
-			Filters: filter,
-		})
+	return client.listContainers(types.ContainerListOptions{Filters: filter}, fn)
+}
+
+// ListAllContainers returns every container accepted by the filter whatever its state, unlike
+// ListContainers which only includes the stopped and restarting ones if the options say so
+func (client dockerClient) ListAllContainers(fn t.Filter) ([]t.Container, error) {
+	log.Debug("Retrieving all containers")
+	return client.listContainers(types.ContainerListOptions{All: true}, fn)
+}
+
+func (client dockerClient) listContainers(options types.ContainerListOptions, fn t.Filter) ([]t.Container, error) {
+	cs := []t.Container{}
+	bg := context.Background()
 
+	containers, err := client.api.ContainerList(bg, options)
 	if err != nil {
 		return nil, err
 	}
@@ -192,6 +209,19 @@ func (client dockerClient) GetContainer(containerID t.ContainerID) (t.Container,
 	return &Container{containerInfo: &containerInfo, imageInfo: &imageInfo}, nil
 }
 
+// GetContainerByName returns the container with the given name, regardless of its state.
+// ErrContainerNotFound is returned if there is no such container.
+func (client dockerClient) GetContainerByName(name string) (t.Container, error) {
+	c, err := client.GetContainer(t.ContainerID(name))
+	if sdkClient.IsErrNotFound(err) {
+		return nil, ErrContainerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
 func (client dockerClient) StopContainer(c t.Container, timeout time.Duration) error {
 	bg := context.Background()
 	signal := c.StopSignal()
@@ -310,32 +340,57 @@ func (client dockerClient) StartContainerWithExistingConfig(c t.Container) (t.Co
 
 }
 
+// primaryNetwork returns the network a container is attached to when it is created: the network of
+// its network mode if it has an endpoint for it, otherwise the first network by name
+func primaryNetwork(mode container.NetworkMode, endpoints map[string]*network.EndpointSettings) string {
+	if _, found := endpoints[string(mode)]; found {
+		return string(mode)
+	}
+	if names := sortedNetworks(endpoints); len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+func sortedNetworks(endpoints map[string]*network.EndpointSettings) []string {
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (client dockerClient) StartContainer(name string, config container.Config,
 	hostConfig container.HostConfig, networkConfig network.NetworkingConfig) (t.ContainerID, error) {
 	bg := context.Background()
 
+	// Older API versions only allow a single network to be attached when the container is created.
+	// It must be the network of the network mode, the other networks are connected afterwards.
+	// see: https://github.com/docker/docker/issues/29265
+	primary := primaryNetwork(hostConfig.NetworkMode, networkConfig.EndpointsConfig)
+	simpleNetworkConfig := network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{}}
+	if primary != "" {
+		simpleNetworkConfig.EndpointsConfig[primary] = networkConfig.EndpointsConfig[primary]
+	}
+
 	log.Debugf("Creating %s", name)
-	createdContainer, err := client.api.ContainerCreate(bg, &config, &hostConfig, &networkConfig, nil, name)
+	createdContainer, err := client.api.ContainerCreate(bg, &config, &hostConfig, &simpleNetworkConfig, nil, name)
 	if err != nil {
 		return "", err
 	}
 
-	if !(hostConfig.NetworkMode.IsHost()) {
-
-		for k := range networkConfig.EndpointsConfig {
-			err = client.api.NetworkDisconnect(bg, k, createdContainer.ID, true)
-			if err != nil {
-				return "", err
+	mode := hostConfig.NetworkMode
+	if !mode.IsHost() && !mode.IsNone() && !mode.IsContainer() {
+		for _, name := range sortedNetworks(networkConfig.EndpointsConfig) {
+			if name == primary {
+				continue
 			}
-		}
-
-		for k, v := range networkConfig.EndpointsConfig {
-			err = client.api.NetworkConnect(bg, k, createdContainer.ID, v)
+			err = client.api.NetworkConnect(bg, name, createdContainer.ID, networkConfig.EndpointsConfig[name])
 			if err != nil {
 				return "", err
 			}
 		}
-
 	}
 
 	createdContainerID := t.ContainerID(createdContainer.ID)
@@ -343,6 +398,40 @@ func (client dockerClient) StartContainer(name string, config container.Config,
 	return createdContainerID, client.doStartContainer(bg, c, createdContainer)
 }
 
+// EnsureNetwork creates the network unless a network with the same name already exists,
+// and returns its ID. External networks are never created.
+func (client dockerClient) EnsureNetwork(n Network) (string, error) {
+	bg := context.Background()
+
+	existing, err := client.api.NetworkInspect(bg, n.Name, types.NetworkInspectOptions{})
+	if err == nil {
+		return existing.ID, nil
+	}
+	if !sdkClient.IsErrNotFound(err) {
+		return "", err
+	}
+	if n.External {
+		return "", fmt.Errorf("external network %s does not exist", n.Name)
+	}
+
+	log.Infof("Creating network %s", n.Name)
+	ipam := n.Ipam
+	created, err := client.api.NetworkCreate(bg, n.Name, types.NetworkCreate{
+		CheckDuplicate: n.CheckDuplicate,
+		Driver:         n.Driver,
+		Internal:       n.Internal,
+		Attachable:     n.Attachable,
+		EnableIPv6:     n.EnableIPv6,
+		IPAM:           &ipam,
+		Options:        n.DriverOpts,
+		Labels:         n.Labels,
+	})
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
 func (client dockerClient) doStartContainer(bg context.Context, c t.Container, creation container.CreateResponse) error {
 	name := c.Name()
 
@@ -360,7 +449,30 @@ func (client dockerClient) RenameContainer(c t.Container, newName string) error
 	return client.api.ContainerRename(bg, string(c.ID()), newName)
 }
 
+func (client dockerClient) PauseContainer(c t.Container) error {
+	bg := context.Background()
+	log.Infof("Pausing %s (%s)", c.Name(), c.ID().ShortID())
+	return client.api.ContainerPause(bg, string(c.ID()))
+}
+
+func (client dockerClient) UnpauseContainer(c t.Container) error {
+	bg := context.Background()
+	log.Infof("Unpausing %s (%s)", c.Name(), c.ID().ShortID())
+	return client.api.ContainerUnpause(bg, string(c.ID()))
+}
+
+func (client dockerClient) RestartContainer(c t.Container, timeout time.Duration) error {
+	bg := context.Background()
+	seconds := int(timeout.Seconds())
+	log.Infof("Restarting %s (%s)", c.Name(), c.ID().ShortID())
+	return client.api.ContainerRestart(bg, string(c.ID()), container.StopOptions{Timeout: &seconds})
+}
+
 func (client dockerClient) IsContainerStale(container t.Container, params t.UpdateParams) (stale bool, latestImage t.ImageID, err error) {
+	if params.Holds != nil && params.Holds.IsHeld(container.Name()) {
+		log.Debugf("Skipping held container %s", container.Name())
+		return false, container.SafeImageID(), nil
+	}
 	if container.IsNoPull(params) {
 		log.Debugf("Skipping image pull.")
 	} else if err := client.CheckDigestAndPullImage(container); err != nil {
@@ -483,6 +595,21 @@ func (client dockerClient) RemoveImageByID(id t.ImageID) error {
 	return err
 }
 
+// TagImage adds the tag to the image, moving the tag if another image has it
+func (client dockerClient) TagImage(id t.ImageID, tag string) error {
+	log.Debugf("Tagging image %s as %s", id.ShortID(), tag)
+	return client.api.ImageTag(context.Background(), string(id), tag)
+}
+
+// GetImageID returns the ID of the local image with the name
+func (client dockerClient) GetImageID(name string) (t.ImageID, error) {
+	imageInfo, _, err := client.api.ImageInspectWithRaw(context.Background(), name)
+	if err != nil {
+		return "", err
+	}
+	return t.ImageID(imageInfo.ID), nil
+}
+
 func (client dockerClient) ExecuteCommand(containerID t.ContainerID, command string, timeout int) (SkipUpdate bool, err error) {
 	bg := context.Background()
 	clog := log.WithField("containerID", containerID)
@@ -601,75 +728,44 @@ func (client dockerClient) waitForStopOrTimeout(c t.Container, waitTime time.Dur
 	}
 }
 
-func (client dockerClient) LoadImageFromUSB(path string) error {
-	ctx := gousb.NewContext()
-	defer ctx.Close()
-
-	// Open the first found USB device
-	devs, err := ctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
-		return desc.Class == gousb.ClassMassStorage || desc.Class == gousb.ClassPerInterface
-	})
+// LoadImage loads the images of a `docker save` archive, streaming it to the docker daemon
+func (client dockerClient) LoadImage(archive io.Reader) error {
+	response, err := client.api.ImageLoad(context.Background(), archive, true)
 	if err != nil {
-		log.Fatal("Error opening device: ", err)
-	}
-	defer func() {
-		for _, d := range devs {
-			d.Close()
-		}
-	}()
-	if len(devs) == 0 {
-		return errors.New("NO USB DEVICE FOUND")
-	}
-	pID := devs[0].Desc.Product.String()
-	vID := devs[0].Desc.Vendor.String()
-
-	mountPath, err := getUSBMountPath(vID, pID)
-	if err != nil {
-		log.Error("Error obtaining mount path for USB: ", err)
 		return err
 	}
-	// Obtain mount
-	// Replace with the path to your Docker image on the USB device
-	imageData, err := os.ReadFile(mountPath + path)
-	if err != nil {
-		log.Error("Error reading Docker image from USB: ", err)
-		return err
-	}
-
-	responseBody, err := client.api.ImageLoad(context.Background(), bytes.NewReader(imageData), false)
-	if err != nil {
-		log.Error("Error loading Docker image: ", err)
-		return err
-	}
-	defer responseBody.Body.Close()
-
-	log.Info("Docker image loaded successfully.")
-
-	return nil
-}
+	defer response.Body.Close()
 
-func getUSBMountPath(vendorID, productID string) (string, error) {
-	usbDevicesPath := "/dev/disk/by-id/"
-	files, err := ioutil.ReadDir(usbDevicesPath)
-	if err != nil {
-		return "", err
-	}
-
-	for _, file := range files {
-		if strings.Contains(file.Name(), vendorID) && strings.Contains(file.Name(), productID) {
-			symlinkPath := filepath.Join(usbDevicesPath, file.Name())
-			realPath, err := filepath.EvalSymlinks(symlinkPath)
-			if err != nil {
-				return "", err
-			}
-			return realPath, nil
+	// Errors that occur while loading are only reported in the response stream
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var message struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		if err := decoder.Decode(&message); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if message.Error != "" {
+			return errors.New(message.Error)
+		}
+		if message.Stream != "" {
+			log.Info(strings.TrimSpace(message.Stream))
 		}
 	}
+}
 
-	return "", fmt.Errorf("USB device not found")
+// SaveImage returns a `docker save` archive of the images, streamed from the docker daemon
+func (client dockerClient) SaveImage(images []string) (io.ReadCloser, error) {
+	return client.api.ImageSave(context.Background(), images)
 }
 
-func (client dockerClient) CheckImageDigest(container t.Container) (bool, error) {
+// CheckForUpdate compares the digest of the image the container is running to the one the registry
+// reports for the image name. When they differ, the update counts as downloaded once the newer
+// image has been pulled, i.e. the image name locally refers to the image in the registry.
+func (client dockerClient) CheckForUpdate(container t.Container) (t.UpdateStatus, error) {
 	containerName := container.Name()
 	imageName := container.ImageName()
 
@@ -677,31 +773,52 @@ func (client dockerClient) CheckImageDigest(container t.Container) (bool, error)
 		"image":     imageName,
 		"container": containerName,
 	}
+	status := t.UpdateStatus{
+		Container: strings.TrimPrefix(containerName, "/"),
+		Image:     imageName,
+	}
+
+	if !container.HasImageInfo() {
+		return status, errors.New("container image info missing")
+	}
+	if repoDigests := container.ImageInfo().RepoDigests; len(repoDigests) > 0 {
+		status.LocalDigest = digest.LocalDigest(repoDigests[0])
+	}
+	if strings.HasPrefix(imageName, "sha256:") {
+		return status, fmt.Errorf("container uses a pinned image, and cannot be updated by watchtower")
+	}
 
 	log.WithFields(fields).Debugf("Trying to load authentication credentials.")
 	opts, err := registry.GetPullOptions(imageName)
 	if err != nil {
 		log.Debugf("Error loading authentication credentials %s", err)
-		return false, err
+		return status, err
 	}
 	if opts.RegistryAuth != "" {
 		log.Debug("Credentials loaded")
 	}
 
-	log.WithFields(fields).Debugf("Checking if pull is needed")
-
-	if match, err := digest.CompareDigest(container, opts.RegistryAuth); err != nil {
-		headLevel := log.DebugLevel
-		log.WithFields(fields).Logf(headLevel, "Could not do a head request for %q, falling back to regular pull.", imageName)
-		log.WithFields(fields).Log(headLevel, "Reason: ", err)
-		return false, err
-	} else if match {
-		log.Debug("No pull needed. Skipping image.")
-		return true, nil
-	} else {
-		log.Debug("Digests did not match, doing a pull.")
-		return false, nil
+	log.WithFields(fields).Debugf("Checking for a newer image")
+	if status.RemoteDigest, err = digest.FetchDigest(container, opts.RegistryAuth); err != nil {
+		log.WithFields(fields).Debugf("Could not do a head request for %q: %v", imageName, err)
+		return status, err
 	}
+	if digest.MatchesDigest(container.ImageInfo().RepoDigests, status.RemoteDigest) {
+		log.WithFields(fields).Debug("Image is up to date")
+		return status, nil
+	}
+	status.UpdateAvailable = true
+
+	latestImage, _, err := client.api.ImageInspectWithRaw(context.Background(), imageName)
+	if err != nil {
+		// The image name no longer refers to any local image, so the update still has to be pulled
+		log.WithFields(fields).Debugf("Unable to inspect the latest local image: %v", err)
+		return status, nil
+	}
+	status.Downloaded = latestImage.ID != container.ImageInfo().ID &&
+		digest.MatchesDigest(latestImage.RepoDigests, status.RemoteDigest)
+	log.WithFields(fields).WithField("downloaded", status.Downloaded).Debug("Found a newer image")
+	return status, nil
 }
 
 func (client dockerClient) PullImage(container t.Container) error {
@@ -714,6 +831,10 @@ func (client dockerClient) PullImage(container t.Container) error {
 		"container": containerName,
 	}
 
+	if strings.HasPrefix(imageName, "sha256:") {
+		return fmt.Errorf("container uses a pinned image, and cannot be updated by watchtower")
+	}
+
 	log.WithFields(fields).Debugf("Trying to load authentication credentials.")
 	opts, err := registry.GetPullOptions(imageName)
 	if err != nil {
@@ -736,6 +857,21 @@ func (client dockerClient) PullImage(container t.Container) error {
 	return nil
 }
 
+// ListImageTags returns the tags of the repository of the container image in its registry
+func (client dockerClient) ListImageTags(container t.Container) ([]string, error) {
+	imageName := container.ImageName()
+	if strings.HasPrefix(imageName, "sha256:") {
+		return nil, fmt.Errorf("container uses a pinned image, and has no tags")
+	}
+
+	opts, err := registry.GetPullOptions(imageName)
+	if err != nil {
+		log.Debugf("Error loading authentication credentials %s", err)
+		return nil, err
+	}
+	return tags.ListTags(container, opts.RegistryAuth)
+}
+
 func (client dockerClient) StreamLogs(c t.Container, follow bool) (io.ReadCloser, error) {
 	out, err := client.api.ContainerLogs(context.Background(), c.ContainerInfo().ID, types.ContainerLogsOptions{
 		ShowStdout: true, ShowStderr: true, Follow: follow, Details: true, Timestamps: true})
@@ -744,3 +880,32 @@ func (client dockerClient) StreamLogs(c t.Container, follow bool) (io.ReadCloser
 	}
 	return out, nil
 }
+
+// EnsureVolume creates the named volume unless it already exists, and returns its name.
+// External volumes are never created.
+func (client dockerClient) EnsureVolume(v Volume) (string, error) {
+	bg := context.Background()
+
+	existing, err := client.api.VolumeInspect(bg, v.Name)
+	if err == nil {
+		return existing.Name, nil
+	}
+	if !sdkClient.IsErrNotFound(err) {
+		return "", err
+	}
+	if v.External {
+		return "", fmt.Errorf("external volume %s does not exist", v.Name)
+	}
+
+	log.Infof("Creating volume %s", v.Name)
+	created, err := client.api.VolumeCreate(bg, volume.CreateOptions{
+		Name:       v.Name,
+		Driver:     v.Driver,
+		DriverOpts: v.DriverOpts,
+		Labels:     v.Labels,
+	})
+	if err != nil {
+		return "", err
+	}
+	return created.Name, nil
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/backend"
+	dockerContainer "github.com/docker/docker/api/types/container"
 	cli "github.com/docker/docker/client"
 	"github.com/docker/docker/errdefs"
 	"github.com/onsi/gomega/gbytes"
@@ -21,7 +22,6 @@ import (
 	. "github.com/onsi/gomega"
 	gt "github.com/onsi/gomega/types"
 
-	"context"
 	"net/http"
 )
 
@@ -70,7 +70,7 @@ var _ = Describe("the client", func() {
 			It("should gracefully fail with a useful message", func() {
 				c := dockerClient{}
 				pinnedContainer := MockContainer(WithImageName("sha256:fa5269854a5e615e51a72b17ad3fd1e01268f278a6684c8ed3c5f0cdce3f230b"))
-				err := c.PullImage(context.Background(), pinnedContainer)
+				err := c.PullImage(pinnedContainer)
 				Expect(err).To(MatchError(`container uses a pinned image, and cannot be updated by watchtower`))
 			})
 		})
@@ -192,6 +192,21 @@ var _ = Describe("the client", func() {
 				Expect(containers).To(ContainElement(havingRunningState(false)))
 			})
 		})
+		When(`listing all containers`, func() {
+			It("should return the containers in every state regardless of the include options", func() {
+				mockServer.AppendHandlers(mocks.ListAllContainersHandler())
+				mockServer.AppendHandlers(mocks.GetContainerHandlers(&mocks.Stopped, &mocks.Watchtower, &mocks.Running, &mocks.Restarting)...)
+				client := dockerClient{
+					api:           docker,
+					ClientOptions: ClientOptions{},
+				}
+				containers, err := client.ListAllContainers(filters.NoFilter)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(containers).To(HaveLen(4))
+				Expect(containers).To(ContainElement(havingRunningState(false)))
+				Expect(containers).To(ContainElement(havingRestartingState(true)))
+			})
+		})
 		When(`include restarting is enabled`, func() {
 			It("should return both restarting and running containers", func() {
 				mockServer.AppendHandlers(mocks.ListContainersHandler("running", "restarting"))
@@ -335,6 +350,22 @@ var _ = Describe("the client", func() {
 			})
 		})
 	})
+	Describe(`primaryNetwork`, func() {
+		endpoints := map[string]*network.EndpointSettings{
+			`robot_sensors`: {},
+			`robot_backend`: {},
+			`robot_control`: {},
+		}
+		It(`should pick the network of the network mode`, func() {
+			Expect(primaryNetwork(dockerContainer.NetworkMode(`robot_control`), endpoints)).To(Equal(`robot_control`))
+		})
+		It(`should fall back to the first network by name`, func() {
+			Expect(primaryNetwork(dockerContainer.NetworkMode(`default`), endpoints)).To(Equal(`robot_backend`))
+		})
+		It(`should return nothing without networks`, func() {
+			Expect(primaryNetwork(dockerContainer.NetworkMode(`host`), nil)).To(BeEmpty())
+		})
+	})
 })
 
 // Capture logrus output in buffer
@@ -0,0 +1,694 @@
+package container
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/network"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultNetworkID is the key of the network that services without networks or network mode are attached to
+const DefaultNetworkID = "default"
+
+// defaultProjectName is used to name the default network if neither the project nor its directory are named
+const defaultProjectName = "stack"
+
+// ComposeOptions contains the options used when loading a compose file
+type ComposeOptions struct {
+	// Name is the project name. If empty, the top-level `name` key of the compose file is used.
+	Name string
+	// WorkingDir is the directory that the .env file and relative env_file paths are resolved against
+	WorkingDir string
+	// Environment contains additional variables used for interpolation.
+	// They take precedence over both the .env file and the process environment.
+	Environment map[string]string
+	// AllowedEnv are the names of the process environment variables available for interpolation.
+	// No other variable of the process environment is ever exposed to a compose file.
+	AllowedEnv []string
+}
+
+// Project is a parsed compose file
+type Project struct {
+	Name     string    `json:"name"`
+	Services []Service `json:"services"`
+	Networks []Network `json:"networks"`
+	Volumes  []Volume  `json:"volumes"`
+}
+
+// LoadProject parses a docker-compose file (v3 schema), interpolating ${VAR} references and
+// resolving env_file entries. All invalid fields are reported together in a *ValidationError.
+func LoadProject(data []byte, opts ComposeOptions) (*Project, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("could not parse compose file: %w", err)
+	}
+	if raw == nil {
+		return nil, errors.New("compose file is empty")
+	}
+
+	env, err := loadInterpolationEnvironment(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := &ValidationError{}
+	interpolated := interpolateValue(raw, env, nil, errs)
+	config, ok := interpolated.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("compose file must be a mapping, got %T", interpolated)
+	}
+
+	project := &Project{Name: opts.Name}
+	if project.Name == "" {
+		if project.Name, err = MakeString(config, "name"); err != nil {
+			errs.Add("", "name", err)
+		}
+	}
+
+	networkNames := map[string]string{}
+	if project.Networks, err = MakeProjectNetworks(config); err != nil {
+		errs.Add("", "networks", err)
+	}
+	for _, network := range project.Networks {
+		networkNames[network.ID] = network.Name
+	}
+	// Like with docker compose, services without networks join the default network of the project,
+	// which can be configured under the `default` key
+	defaultNetwork := Network{ID: DefaultNetworkID, Name: defaultNetworkName(project.Name, opts.WorkingDir), CheckDuplicate: true}
+	defaultDefined := networkNames[DefaultNetworkID] != ""
+	if !defaultDefined {
+		networkNames[DefaultNetworkID] = defaultNetwork.Name
+	}
+	defaultUsed := false
+
+	volumeNames := map[string]string{}
+	if project.Volumes, err = MakeProjectVolumes(config); err != nil {
+		errs.Add("", "volumes", err)
+	}
+	for _, volume := range project.Volumes {
+		volumeNames[volume.ID] = volume.Name
+	}
+
+	rawServices, err := toMap(config["services"])
+	if err != nil {
+		errs.Add("", "services", err)
+	} else if len(rawServices) == 0 {
+		errs.Add("", "services", errors.New("at least one service is required"))
+	}
+
+	names := make([]string, 0, len(rawServices))
+	for name := range rawServices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		serviceConfig, err := toMap(rawServices[name])
+		if err != nil {
+			errs.Add(name, "", err)
+			continue
+		}
+		if serviceConfig == nil {
+			serviceConfig = map[string]interface{}{}
+		}
+
+		service, err := MakeService(serviceConfig, name)
+		if err != nil {
+			errs.Add(name, "", err)
+			continue
+		}
+
+		if err := resolveServiceEnvironment(&service, env, opts.WorkingDir); err != nil {
+			errs.Add(name, "env_file", err)
+			continue
+		}
+
+		if service.NetworkMode == "" && len(service.Networks) == 0 {
+			service.Networks = []ServiceNetwork{{Name: DefaultNetworkID}}
+		}
+
+		// Refer to networks by the name they are created with
+		undefined := false
+		for i, serviceNetwork := range service.Networks {
+			if serviceNetwork.Name == DefaultNetworkID {
+				defaultUsed = true
+			}
+			realName, found := networkNames[serviceNetwork.Name]
+			if !found {
+				errs.Add(name, "networks", fmt.Errorf("network %s is not defined", serviceNetwork.Name))
+				undefined = true
+				continue
+			}
+			service.Networks[i].Name = realName
+		}
+		if undefined {
+			continue
+		}
+
+		if err := resolveServiceVolumes(&service, volumeNames, opts.WorkingDir); err != nil {
+			errs.Add(name, "volumes", err)
+			continue
+		}
+
+		project.Services = append(project.Services, service)
+	}
+
+	if defaultUsed && !defaultDefined {
+		project.Networks = append(project.Networks, defaultNetwork)
+	}
+
+	// Dependencies are only resolved within the project
+	for _, service := range project.Services {
+		for _, dependency := range service.DependsOn {
+			if _, found := rawServices[dependency]; !found {
+				errs.Add(service.Name, "depends_on", fmt.Errorf("service %s is not defined", dependency))
+			}
+		}
+	}
+
+	if errs.HasErrors() {
+		return nil, errs
+	}
+	return project, nil
+}
+
+// defaultNetworkName returns the name of the default network of the project. Like with docker compose,
+// it is prefixed with the project name, or with the name of the compose directory if the project is unnamed.
+func defaultNetworkName(project string, workingDir string) string {
+	if project == "" && workingDir != "" {
+		project = filepath.Base(workingDir)
+	}
+	if project == "" {
+		project = defaultProjectName
+	}
+	return project + "_" + DefaultNetworkID
+}
+
+// MakeProjectNetworks reads the top-level networks of a compose file.
+// The ID of each network is set to its key in the compose file.
+func MakeProjectNetworks(config map[string]interface{}) ([]Network, error) {
+	rawNetworks, err := toMap(config["networks"])
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(rawNetworks))
+	for key := range rawNetworks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	networks := make([]Network, 0, len(rawNetworks))
+	for _, key := range keys {
+		networkConfig, err := toMap(rawNetworks[key])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		network, err := makeProjectNetwork(key, networkConfig)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%w", key, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func makeProjectNetwork(key string, config map[string]interface{}) (Network, error) {
+	output := Network{ID: key, Name: key, CheckDuplicate: true}
+	var err error
+
+	if name, err := MakeString(config, "name"); err != nil {
+		return output, fmt.Errorf("name: %w", err)
+	} else if name != "" {
+		output.Name = name
+	}
+	if output.Driver, err = MakeString(config, "driver"); err != nil {
+		return output, fmt.Errorf("driver: %w", err)
+	}
+	if output.DriverOpts, err = makeStringMap(config, "driver_opts"); err != nil {
+		return output, fmt.Errorf("driver_opts: %w", err)
+	}
+	if output.Labels, err = MakeLabels(config); err != nil {
+		return output, fmt.Errorf("labels: %w", err)
+	}
+	if output.Internal, err = MakeBool(config, "internal"); err != nil {
+		return output, fmt.Errorf("internal: %w", err)
+	}
+	if output.Attachable, err = MakeBool(config, "attachable"); err != nil {
+		return output, fmt.Errorf("attachable: %w", err)
+	}
+	if output.EnableIPv6, err = MakeBool(config, "enable_ipv6"); err != nil {
+		return output, fmt.Errorf("enable_ipv6: %w", err)
+	}
+	if output.External, err = makeExternal(config); err != nil {
+		return output, fmt.Errorf("external: %w", err)
+	}
+	if output.Ipam, err = makeIPAM(config); err != nil {
+		return output, fmt.Errorf("ipam: %w", err)
+	}
+	return output, nil
+}
+
+func makeIPAM(config map[string]interface{}) (network.IPAM, error) {
+	ipam := network.IPAM{}
+	ipamConfig, err := toMap(config["ipam"])
+	if err != nil || ipamConfig == nil {
+		return ipam, err
+	}
+	if ipam.Driver, err = MakeString(ipamConfig, "driver"); err != nil {
+		return ipam, err
+	}
+	if ipam.Options, err = makeStringMap(ipamConfig, "options"); err != nil {
+		return ipam, err
+	}
+
+	pools, ok := ipamConfig["config"].([]interface{})
+	if !ok && ipamConfig["config"] != nil {
+		return ipam, fmt.Errorf("config: expected a list, got %T", ipamConfig["config"])
+	}
+	for _, rawPool := range pools {
+		pool, err := toMap(rawPool)
+		if err != nil {
+			return ipam, fmt.Errorf("config: %w", err)
+		}
+		poolConfig := network.IPAMConfig{}
+		if poolConfig.Subnet, err = MakeString(pool, "subnet"); err != nil {
+			return ipam, err
+		}
+		if poolConfig.IPRange, err = MakeString(pool, "ip_range"); err != nil {
+			return ipam, err
+		}
+		if poolConfig.Gateway, err = MakeString(pool, "gateway"); err != nil {
+			return ipam, err
+		}
+		if poolConfig.AuxAddress, err = makeStringMap(pool, "aux_addresses"); err != nil {
+			return ipam, err
+		}
+		ipam.Config = append(ipam.Config, poolConfig)
+	}
+	return ipam, nil
+}
+
+// MakeProjectVolumes reads the top-level named volumes of a compose file.
+// The ID of each volume is set to its key in the compose file.
+func MakeProjectVolumes(config map[string]interface{}) ([]Volume, error) {
+	rawVolumes, err := toMap(config["volumes"])
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(rawVolumes))
+	for key := range rawVolumes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	volumes := make([]Volume, 0, len(rawVolumes))
+	for _, key := range keys {
+		volumeConfig, err := toMap(rawVolumes[key])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		volume := Volume{ID: key, Name: key}
+		if name, err := MakeString(volumeConfig, "name"); err != nil {
+			return nil, fmt.Errorf("%s.name: %w", key, err)
+		} else if name != "" {
+			volume.Name = name
+		}
+		if volume.Driver, err = MakeString(volumeConfig, "driver"); err != nil {
+			return nil, fmt.Errorf("%s.driver: %w", key, err)
+		}
+		if volume.DriverOpts, err = makeStringMap(volumeConfig, "driver_opts"); err != nil {
+			return nil, fmt.Errorf("%s.driver_opts: %w", key, err)
+		}
+		if volume.Labels, err = MakeLabels(volumeConfig); err != nil {
+			return nil, fmt.Errorf("%s.labels: %w", key, err)
+		}
+		if volume.External, err = makeExternal(volumeConfig); err != nil {
+			return nil, fmt.Errorf("%s.external: %w", key, err)
+		}
+		volumes = append(volumes, volume)
+	}
+	return volumes, nil
+}
+
+// makeExternal reads the external key, which is either a boolean or the legacy `external: {name: ...}` form
+func makeExternal(config map[string]interface{}) (bool, error) {
+	if _, isMap := config["external"].(map[string]interface{}); isMap {
+		return true, nil
+	}
+	return MakeBool(config, "external")
+}
+
+func makeStringMap(config map[string]interface{}, field string) (map[string]string, error) {
+	list, err := MakeKeyValueList(config, field, "=")
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	output := make(map[string]string, len(list))
+	for _, entry := range list {
+		key, value, _ := strings.Cut(entry, "=")
+		output[key] = value
+	}
+	return output, nil
+}
+
+// loadInterpolationEnvironment merges the allowed process environment variables, the .env file
+// in the working directory and the explicitly passed variables, in increasing order of precedence
+func loadInterpolationEnvironment(opts ComposeOptions) (map[string]string, error) {
+	env := map[string]string{}
+	for _, key := range opts.AllowedEnv {
+		if value, found := os.LookupEnv(key); found {
+			env[key] = value
+		}
+	}
+
+	if opts.WorkingDir != "" {
+		file, err := os.Open(filepath.Join(opts.WorkingDir, ".env"))
+		if err == nil {
+			defer file.Close()
+			dotEnv, err := ParseEnvFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse .env file: %w", err)
+			}
+			for key, value := range dotEnv {
+				env[key] = value
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	for key, value := range opts.Environment {
+		env[key] = value
+	}
+	return env, nil
+}
+
+// resolveServiceVolumes refers to named volumes by the name they are created with, and
+// resolves relative bind mount sources against the working directory
+func resolveServiceVolumes(service *Service, volumeNames map[string]string, workingDir string) error {
+	for i, volume := range service.Volumes {
+		switch {
+		case volume.Type == VolumeTypeVolume && volume.Source != "":
+			realName, found := volumeNames[volume.Source]
+			if !found {
+				return fmt.Errorf("volume %s is not defined", volume.Source)
+			}
+			service.Volumes[i].Source = realName
+		case volume.Type == VolumeTypeBind && strings.HasPrefix(volume.Source, "~"):
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return err
+			}
+			service.Volumes[i].Source = filepath.Join(home, strings.TrimPrefix(volume.Source, "~"))
+		case volume.Type == VolumeTypeBind && !filepath.IsAbs(volume.Source):
+			service.Volumes[i].Source = filepath.Join(workingDir, volume.Source)
+		}
+	}
+	return nil
+}
+
+// resolveWithinDir resolves the path against the directory, following symbolic links, and fails
+// if it falls outside of the directory, so that a compose file cannot read arbitrary host files
+func resolveWithinDir(path string, dir string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("%s cannot be read without a compose directory", path)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	if !isWithinDir(resolved, root) {
+		return "", fmt.Errorf("%s is outside of the compose directory", path)
+	}
+	return resolved, nil
+}
+
+// resolveServiceEnvironment merges the service env_file entries into its environment and fills
+// in the values of variables that are only listed by name
+func resolveServiceEnvironment(service *Service, env map[string]string, workingDir string) error {
+	values := map[string]string{}
+	order := []string{}
+	set := func(key string, value string) {
+		if _, found := values[key]; !found {
+			order = append(order, key)
+		}
+		values[key] = value
+	}
+
+	for _, envFile := range service.EnvFile {
+		path, err := resolveWithinDir(envFile, workingDir)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		fileEnv, err := ParseEnvFile(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", envFile, err)
+		}
+
+		keys := make([]string, 0, len(fileEnv))
+		for key := range fileEnv {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			set(key, fileEnv[key])
+		}
+	}
+
+	for _, entry := range service.Environment {
+		key, value, found := strings.Cut(entry, "=")
+		if !found {
+			if value, found = env[key]; !found {
+				log.WithField("service", service.Name).Debugf("Skipping unset environment variable %q", key)
+				continue
+			}
+		}
+		set(key, value)
+	}
+
+	service.Environment = make([]string, 0, len(order))
+	for _, key := range order {
+		service.Environment = append(service.Environment, key+"="+values[key])
+	}
+	return nil
+}
+
+// ParseEnvFile parses a .env style file of KEY=VALUE lines
+func ParseEnvFile(reader io.Reader) (map[string]string, error) {
+	env := map[string]string{}
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNumber)
+		}
+
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			value = unquoted
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		default:
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = strings.TrimSpace(value[:comment])
+			}
+		}
+		env[key] = value
+	}
+	return env, scanner.Err()
+}
+
+// interpolateValue walks the raw compose document and substitutes variables in every string value
+func interpolateValue(value interface{}, env map[string]string, path []string, errs *ValidationError) interface{} {
+	switch v := value.(type) {
+	case string:
+		interpolated, err := Interpolate(v, env)
+		if err != nil {
+			service, field := splitPath(path)
+			errs.Add(service, field, err)
+			return v
+		}
+		return interpolated
+	case map[string]interface{}:
+		output := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			output[key] = interpolateValue(item, env, append(path, key), errs)
+		}
+		return output
+	case []interface{}:
+		output := make([]interface{}, len(v))
+		for i, item := range v {
+			output[i] = interpolateValue(item, env, append(path, strconv.Itoa(i)), errs)
+		}
+		return output
+	default:
+		return v
+	}
+}
+
+// splitPath returns the service name and the field path of a location in the compose document
+func splitPath(path []string) (string, string) {
+	if len(path) >= 2 && path[0] == "services" {
+		return path[1], strings.Join(path[2:], ".")
+	}
+	return "", strings.Join(path, ".")
+}
+
+// Interpolate substitutes $VAR and ${VAR} references using the compose file semantics, including
+// the ${VAR:-default}, ${VAR-default}, ${VAR:?error}, ${VAR?error}, ${VAR:+replacement} and
+// ${VAR+replacement} forms. A literal dollar sign is written as $$.
+func Interpolate(input string, env map[string]string) (string, error) {
+	var output strings.Builder
+	for i := 0; i < len(input); i++ {
+		if input[i] != '$' {
+			output.WriteByte(input[i])
+			continue
+		}
+		if i+1 >= len(input) {
+			output.WriteByte('$')
+			continue
+		}
+
+		next := input[i+1]
+		switch {
+		case next == '$':
+			output.WriteByte('$')
+			i++
+		case next == '{':
+			end := findClosingBrace(input, i+2)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable reference in %q", input)
+			}
+			value, err := expandBraced(input[i+2:end], env)
+			if err != nil {
+				return "", err
+			}
+			output.WriteString(value)
+			i = end
+		case isNameStart(next):
+			end := i + 1
+			for end < len(input) && isNameChar(input[end]) {
+				end++
+			}
+			output.WriteString(env[input[i+1:end]])
+			i = end - 1
+		default:
+			output.WriteByte('$')
+		}
+	}
+	return output.String(), nil
+}
+
+func findClosingBrace(input string, start int) int {
+	depth := 1
+	for i := start; i < len(input); i++ {
+		switch input[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func expandBraced(expression string, env map[string]string) (string, error) {
+	end := 0
+	for end < len(expression) && isNameChar(expression[end]) {
+		end++
+	}
+	name := expression[:end]
+	if name == "" || !isNameStart(name[0]) {
+		return "", fmt.Errorf("invalid variable name in ${%s}", expression)
+	}
+
+	value, set := env[name]
+	modifier := expression[end:]
+	if modifier == "" {
+		return value, nil
+	}
+
+	// The colon variants also treat an empty value as unset
+	checkEmpty := strings.HasPrefix(modifier, ":")
+	operator := strings.TrimPrefix(modifier, ":")
+	if operator == "" {
+		return "", fmt.Errorf("invalid variable reference ${%s}", expression)
+	}
+	unset := !set || (checkEmpty && value == "")
+
+	argument, err := Interpolate(operator[1:], env)
+	if err != nil {
+		return "", err
+	}
+
+	switch operator[0] {
+	case '-':
+		if unset {
+			return argument, nil
+		}
+		return value, nil
+	case '?':
+		if unset {
+			if argument == "" {
+				argument = "is not set"
+			}
+			return "", fmt.Errorf("required variable %s %s", name, argument)
+		}
+		return value, nil
+	case '+':
+		if unset {
+			return "", nil
+		}
+		return argument, nil
+	default:
+		return "", fmt.Errorf("invalid variable reference ${%s}", expression)
+	}
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,503 @@
+package container
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("compose files", func() {
+	Describe("Interpolate", func() {
+		env := map[string]string{"TAG": "1.2", "EMPTY": ""}
+
+		It("should substitute plain and braced variables", func() {
+			Expect(Interpolate("app:$TAG-${TAG}", env)).To(Equal("app:1.2-1.2"))
+		})
+		It("should keep escaped dollar signs", func() {
+			Expect(Interpolate("echo $$HOME", env)).To(Equal("echo $HOME"))
+		})
+		It("should apply default values", func() {
+			Expect(Interpolate("${EMPTY:-fallback}", env)).To(Equal("fallback"))
+			Expect(Interpolate("${EMPTY-fallback}", env)).To(Equal(""))
+			Expect(Interpolate("${MISSING-${TAG}}", env)).To(Equal("1.2"))
+		})
+		It("should apply replacement values", func() {
+			Expect(Interpolate("${TAG:+set}", env)).To(Equal("set"))
+			Expect(Interpolate("${MISSING:+set}", env)).To(Equal(""))
+		})
+		It("should fail on required variables that are unset", func() {
+			_, err := Interpolate("${MISSING:?must be set}", env)
+			Expect(err).To(MatchError("required variable MISSING must be set"))
+		})
+		It("should fail on unterminated references", func() {
+			_, err := Interpolate("${TAG", env)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("ParseEnvFile", func() {
+		It("should parse quoted, unquoted and exported values", func() {
+			env, err := ParseEnvFile(strings.NewReader(`
+# comment
+export A=1
+B="two words\n"
+C='$literal'
+D=value # trailing comment
+`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env).To(Equal(map[string]string{
+				"A": "1",
+				"B": "two words\n",
+				"C": "$literal",
+				"D": "value",
+			}))
+		})
+		It("should fail on lines without a value", func() {
+			_, err := ParseEnvFile(strings.NewReader("INVALID"))
+			Expect(err).To(MatchError("line 1: expected KEY=VALUE"))
+		})
+	})
+
+	Describe("LoadProject", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "compose")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(filepath.Join(dir, ".env"), []byte("TAG=from-dotenv\nREGISTRY=ghcr.io\n"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "web.env"), []byte("LEVEL=debug\nMODE=file\n"), 0644)).To(Succeed())
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should parse a complete compose file", func() {
+			project, err := LoadProject([]byte(`
+name: robot
+services:
+  web:
+    image: ${REGISTRY}/web:${TAG}
+    command: ./serve --port 8080
+    env_file: web.env
+    environment:
+      MODE: override
+      SECRET:
+    ports:
+      - "8080:80"
+    networks:
+      backend:
+        aliases: [api]
+    volumes:
+      - data:/var/lib/data:ro
+    restart: unless-stopped
+    depends_on: [db]
+  db:
+    image: postgres
+networks:
+  backend:
+    name: robot_backend
+    driver: bridge
+volumes:
+  data:
+    external: true
+`), ComposeOptions{WorkingDir: dir, Environment: map[string]string{"TAG": "2.0", "SECRET": "hunter2"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(project.Name).To(Equal("robot"))
+			Expect(project.Services).To(HaveLen(2))
+			Expect(project.Networks).To(HaveLen(2))
+			Expect(project.Networks[0].Name).To(Equal("robot_backend"))
+			Expect(project.Networks[1].Name).To(Equal("robot_default"))
+			Expect(project.Volumes).To(HaveLen(1))
+			Expect(project.Volumes[0].External).To(BeTrue())
+
+			db, web := project.Services[0], project.Services[1]
+			Expect(db.Name).To(Equal("db"))
+			Expect(db.ContainerName).To(Equal("db"))
+			Expect(db.Action).To(Equal(ActionRun))
+			Expect(db.Networks).To(Equal([]ServiceNetwork{{Name: "robot_default"}}))
+
+			Expect(web.Image).To(Equal("ghcr.io/web:2.0"))
+			Expect(web.Command).To(Equal(ShellCommand{"./serve", "--port", "8080"}))
+			Expect(web.Environment).To(Equal([]string{"LEVEL=debug", "MODE=override", "SECRET=hunter2"}))
+			Expect(web.Restart).To(Equal(RestartUnlessStopped))
+			Expect(web.DependsOn).To(Equal([]string{"db"}))
+			Expect(web.Networks).To(HaveLen(1))
+			Expect(web.Networks[0].Name).To(Equal("robot_backend"))
+			Expect(web.Networks[0].Aliases).To(Equal([]string{"api"}))
+		})
+
+		It("should parse dependency conditions and healthchecks", func() {
+			project, err := LoadProject([]byte(`
+services:
+  api:
+    image: api
+    depends_on:
+      db:
+        condition: service_healthy
+  db:
+    image: postgres
+    healthcheck:
+      test: pg_isready
+      interval: 5s
+      retries: 3
+`), ComposeOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			api, db := project.Services[0], project.Services[1]
+			Expect(api.DependsOn).To(Equal([]string{"db"}))
+			Expect(api.DependsOnCondition).To(Equal(map[string]string{"db": DependencyHealthy}))
+			Expect(db.Healthcheck).To(Equal(&ServiceHealthcheck{
+				Test:     []string{"CMD-SHELL", "pg_isready"},
+				Interval: 5 * time.Second,
+				Retries:  3,
+			}))
+		})
+
+		It("should accept the legacy JSON services map", func() {
+			project, err := LoadProject([]byte(`{"services": {"app": {"image": "alpine", "container_name": "custom"}}}`), ComposeOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(project.Services).To(HaveLen(1))
+			Expect(project.Services[0].ContainerName).To(Equal("custom"))
+		})
+
+		It("should report every invalid service", func() {
+			_, err := LoadProject([]byte(`
+services:
+  first:
+    restart: sometimes
+  second:
+    image: ${MISSING:?is required}
+`), ComposeOptions{})
+
+			var validationErr *ValidationError
+			Expect(errors.As(err, &validationErr)).To(BeTrue())
+			services := []string{}
+			for _, fieldErr := range validationErr.Errors {
+				services = append(services, fieldErr.Service)
+			}
+			Expect(services).To(ContainElements("first", "second"))
+		})
+
+		It("should refuse undefined networks and conflicting network modes", func() {
+			_, err := LoadProject([]byte(`
+services:
+  first:
+    image: alpine
+    networks: [missing]
+  second:
+    image: alpine
+    network_mode: host
+    networks: [backend]
+networks:
+  backend:
+`), ComposeOptions{})
+
+			var validationErr *ValidationError
+			Expect(errors.As(err, &validationErr)).To(BeTrue())
+			Expect(validationErr.Errors).To(ConsistOf(
+				FieldError{Service: "first", Field: "networks", Message: "network missing is not defined"},
+				FieldError{Service: "second", Field: "network_mode", Message: "cannot be combined with networks"},
+			))
+		})
+
+		It("should attach services without networks to the default network of the project", func() {
+			project, err := LoadProject([]byte(`
+services:
+  app:
+    image: app
+  proxy:
+    image: proxy
+    network_mode: service:app
+  worker:
+    image: worker
+    networks: [default]
+`), ComposeOptions{WorkingDir: dir})
+			Expect(err).NotTo(HaveOccurred())
+
+			name := filepath.Base(dir) + "_default"
+			Expect(project.Networks).To(Equal([]Network{{ID: "default", Name: name, CheckDuplicate: true}}))
+			app, proxy, worker := project.Services[0], project.Services[1], project.Services[2]
+			Expect(app.Networks).To(Equal([]ServiceNetwork{{Name: name}}))
+			Expect(proxy.Networks).To(BeEmpty())
+			Expect(worker.Networks).To(Equal([]ServiceNetwork{{Name: name}}))
+		})
+
+		It("should use the configured default network", func() {
+			project, err := LoadProject([]byte(`
+name: robot
+services:
+  app:
+    image: app
+  host:
+    image: monitor
+    network_mode: host
+networks:
+  default:
+    name: robot_net
+    internal: true
+`), ComposeOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(project.Networks).To(HaveLen(1))
+			Expect(project.Networks[0].Internal).To(BeTrue())
+			Expect(project.Services[0].Networks).To(Equal([]ServiceNetwork{{Name: "robot_net"}}))
+			Expect(project.Services[1].Networks).To(BeEmpty())
+		})
+
+		It("should not add a default network if every service has one", func() {
+			project, err := LoadProject([]byte(`
+name: robot
+services:
+  app:
+    image: app
+    networks: [backend]
+networks:
+  backend:
+`), ComposeOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(project.Networks).To(HaveLen(1))
+			Expect(project.Networks[0].Name).To(Equal("backend"))
+		})
+
+		It("should refuse dependencies on services outside of the project", func() {
+			_, err := LoadProject([]byte(`
+services:
+  app:
+    image: app
+    depends_on: [db, cache]
+  db:
+    image: postgres
+`), ComposeOptions{})
+
+			var validationErr *ValidationError
+			Expect(errors.As(err, &validationErr)).To(BeTrue())
+			Expect(validationErr.Errors).To(ConsistOf(
+				FieldError{Service: "app", Field: "depends_on", Message: "service cache is not defined"},
+			))
+		})
+
+		It("should parse named volumes, bind mounts and tmpfs mounts", func() {
+			project, err := LoadProject([]byte(`
+services:
+  mapper:
+    image: mapper
+    volumes:
+      - maps:/maps:ro
+      - ./config:/config
+      - /cache
+      - type: bind
+        source: /dev/bus
+        target: /dev/bus
+        read_only: true
+        bind:
+          propagation: rslave
+      - type: tmpfs
+        target: /scratch
+        tmpfs:
+          size: 64m
+          mode: 1777
+    tmpfs: /run:size=1k
+volumes:
+  maps:
+    name: robot_maps
+`), ComposeOptions{WorkingDir: dir})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(project.Volumes[0].ID).To(Equal("maps"))
+
+			Expect(project.Services[0].Volumes).To(Equal([]ServiceVolume{
+				{Type: VolumeTypeVolume, Source: "robot_maps", Destination: "/maps", Option: "ro", ReadOnly: true},
+				{Type: VolumeTypeBind, Source: filepath.Join(dir, "config"), Destination: "/config"},
+				{Type: VolumeTypeVolume, Destination: "/cache"},
+				{Type: VolumeTypeBind, Source: "/dev/bus", Destination: "/dev/bus", Option: "ro,rslave", ReadOnly: true, Propagation: "rslave"},
+				{Type: VolumeTypeTmpfs, Destination: "/scratch", TmpfsSize: 64 * 1024 * 1024, TmpfsMode: 01777},
+				{Type: VolumeTypeTmpfs, Destination: "/run", TmpfsSize: 1024},
+			}))
+		})
+
+		It("should refuse undefined and invalid volumes", func() {
+			_, err := LoadProject([]byte(`
+services:
+  first:
+    image: alpine
+    volumes: [missing:/data]
+  second:
+    image: alpine
+    volumes:
+      - type: tmpfs
+        source: /tmp
+        target: /tmp
+`), ComposeOptions{})
+
+			var validationErr *ValidationError
+			Expect(errors.As(err, &validationErr)).To(BeTrue())
+			Expect(validationErr.Errors).To(HaveLen(2))
+			Expect(validationErr.Errors[0].Message).To(Equal("volume missing is not defined"))
+			Expect(validationErr.Errors[1].Service).To(Equal("second"))
+		})
+
+		It("should parse devices and device cgroup rules", func() {
+			project, err := LoadProject([]byte(`
+services:
+  driver:
+    image: driver
+    devices:
+      - /dev/serial/by-id/usb-lidar:/dev/lidar
+      - /dev/video0:r
+    device_cgroup_rules: ["c 81:* rmw"]
+`), ComposeOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(project.Services[0].Devices).To(Equal([]string{"/dev/serial/by-id/usb-lidar:/dev/lidar", "/dev/video0:r"}))
+			Expect(project.Services[0].DeviceCgroupRules).To(Equal([]string{"c 81:* rmw"}))
+
+			_, err = LoadProject([]byte(`{"services": {"driver": {"image": "driver", "devices": ["ttyUSB0"]}}}`), ComposeOptions{})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should refuse env files outside of the compose directory", func() {
+			outside, err := os.MkdirTemp("", "outside")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(outside)
+			secret := filepath.Join(outside, "secret.env")
+			Expect(os.WriteFile(secret, []byte("SECRET=hunter2\n"), 0644)).To(Succeed())
+			Expect(os.Symlink(secret, filepath.Join(dir, "linked.env"))).To(Succeed())
+
+			for _, envFile := range []string{secret, "../" + filepath.Base(outside) + "/secret.env", "linked.env"} {
+				_, err := LoadProject([]byte(`{"services": {"app": {"image": "app", "env_file": "`+envFile+`"}}}`), ComposeOptions{WorkingDir: dir})
+
+				var validationErr *ValidationError
+				Expect(errors.As(err, &validationErr)).To(BeTrue(), envFile)
+				Expect(validationErr.Errors).To(HaveLen(1))
+				Expect(validationErr.Errors[0].Field).To(Equal("env_file"))
+				Expect(validationErr.Errors[0].Message).To(ContainSubstring("outside of the compose directory"))
+			}
+		})
+
+		It("should only interpolate the allowed process environment variables", func() {
+			os.Setenv("WATCHTOWER_TEST_SITE", "lab")
+			os.Setenv("WATCHTOWER_TEST_SECRET", "hunter2")
+			defer os.Unsetenv("WATCHTOWER_TEST_SITE")
+			defer os.Unsetenv("WATCHTOWER_TEST_SECRET")
+
+			project, err := LoadProject([]byte(`
+services:
+  web:
+    image: web:${WATCHTOWER_TEST_SITE}
+    environment:
+      - LEAKED=${WATCHTOWER_TEST_SECRET:-none}
+      - WATCHTOWER_TEST_SECRET
+`), ComposeOptions{AllowedEnv: []string{"WATCHTOWER_TEST_SITE"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(project.Services[0].Image).To(Equal("web:lab"))
+			Expect(project.Services[0].Environment).To(Equal([]string{"LEAKED=none"}))
+		})
+
+		It("should report the host access of services", func() {
+			project, err := LoadProject([]byte(`
+services:
+  app:
+    image: app
+    volumes:
+      - ./config:/config
+  monitor:
+    image: monitor
+    cap_add: [NET_ADMIN]
+    network_mode: host
+    pid: host
+    volumes:
+      - /var/run/docker.sock:/var/run/docker.sock
+  driver:
+    image: driver
+    privileged: true
+    devices: [/dev/ttyUSB0:/dev/ttyUSB0]
+`), ComposeOptions{WorkingDir: dir})
+			Expect(err).NotTo(HaveOccurred())
+
+			app, driver, monitor := project.Services[0], project.Services[1], project.Services[2]
+			Expect(app.HostAccess(dir, project.Volumes)).To(BeEmpty())
+			Expect(app.HostAccess("", project.Volumes)).To(HaveLen(1))
+			Expect(monitor.PidMode).To(Equal("host"))
+			Expect(monitor.HostAccess(dir, project.Volumes)).To(Equal([]string{
+				"cap_add NET_ADMIN",
+				"network_mode host",
+				"pid host",
+				"bind mount of /var/run/docker.sock",
+			}))
+			Expect(driver.HostAccess(dir, project.Volumes)).To(Equal([]string{"privileged", "devices"}))
+		})
+
+		It("should report the host paths bound through named volumes", func() {
+			project, err := LoadProject([]byte(`
+services:
+  recorder:
+    image: recorder
+    volumes:
+      - hostroot:/host
+      - bags:/bags
+      - cache:/cache
+volumes:
+  hostroot:
+    driver_opts:
+      type: none
+      o: bind
+      device: /
+  bags:
+    driver_opts:
+      type: none
+      o: bind
+      device: `+filepath.Join(dir, "bags")+`
+  cache:
+`), ComposeOptions{WorkingDir: dir})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(project.Services[0].HostAccess(dir, project.Volumes)).To(Equal([]string{"bind mount of / through volume hostroot"}))
+		})
+
+		It("should report services with a cgroup parent", func() {
+			project, err := LoadProject([]byte(`
+services:
+  planner:
+    image: planner
+    cgroup_parent: system.slice
+`), ComposeOptions{WorkingDir: dir})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(project.Services[0].HostAccess(dir, project.Volumes)).To(Equal([]string{"cgroup_parent system.slice"}))
+		})
+
+		It("should report services joining the network of another container", func() {
+			project, err := LoadProject([]byte(`
+services:
+  app:
+    image: app
+  proxy:
+    image: proxy
+    network_mode: service:app
+  sniffer:
+    image: sniffer
+    network_mode: container:gateway
+`), ComposeOptions{WorkingDir: dir})
+			Expect(err).NotTo(HaveOccurred())
+			proxy, sniffer := project.Services[1], project.Services[2]
+			Expect(proxy.HostAccess(dir, project.Volumes)).To(Equal([]string{"network_mode service:app"}))
+			Expect(sniffer.HostAccess(dir, project.Volumes)).To(Equal([]string{"network_mode container:gateway"}))
+		})
+
+		It("should report env files outside of the compose directory", func() {
+			service := Service{Name: "app", EnvFile: []string{"web.env", "/etc/shadow", "../secret.env"}}
+			Expect(service.HostAccess(dir, nil)).To(Equal([]string{
+				"env_file /etc/shadow",
+				"env_file " + filepath.Join(filepath.Dir(dir), "secret.env"),
+			}))
+		})
+
+		It("should fail on malformed yaml", func() {
+			_, err := LoadProject([]byte("services: [unterminated"), ComposeOptions{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -32,6 +32,8 @@ type Container struct {
 
 	containerInfo *types.ContainerJSON
 	imageInfo     *types.ImageInspect
+	channel       string
+	versionTag    string
 }
 
 // IsLinkedToRestarting returns the current value of the LinkedToRestarting field for the container
@@ -54,6 +56,18 @@ func (c *Container) SetStale(value bool) {
 	c.Stale = value
 }
 
+// SetChannel sets the release channel of the device, selecting the image tag of the container
+// if it tracks the channel
+func (c *Container) SetChannel(channel string) {
+	c.channel = channel
+}
+
+// SetVersionTag sets the image tag selected by the semantic version policy of the container,
+// which takes precedence over the tag of its release channel
+func (c *Container) SetVersionTag(tag string) {
+	c.versionTag = tag
+}
+
 // ContainerInfo fetches JSON info for the container
 func (c Container) ContainerInfo() *types.ContainerJSON {
 	return c.containerInfo
@@ -100,7 +114,9 @@ func (c Container) SafeImageID() wt.ImageID {
 
 // ImageName returns the name of the Docker image that was used to start the
 // container. If the original image was specified without a particular tag, the
-// "latest" tag is assumed.
+// "latest" tag is assumed. Containers tracking the release channel of the device
+// use the tag of the channel instead, and containers following a semantic version
+// policy the tag selected by it.
 func (c Container) ImageName() string {
 	// Compatibility w/ Zodiac deployments
 	imageName, ok := c.getLabelValue(zodiacLabel)
@@ -112,9 +128,27 @@ func (c Container) ImageName() string {
 		imageName = fmt.Sprintf("%s:latest", imageName)
 	}
 
+	if strings.Contains(imageName, "@") {
+		return imageName
+	}
+	if c.versionTag != "" {
+		return withTag(imageName, c.versionTag)
+	}
+	if tag, tracked := c.ChannelTags()[c.channel]; tracked {
+		return withTag(imageName, tag)
+	}
+
 	return imageName
 }
 
+// withTag replaces the tag of the image name, which may include a registry port
+func withTag(imageName string, tag string) string {
+	if i := strings.LastIndex(imageName, ":"); i > strings.LastIndex(imageName, "/") {
+		imageName = imageName[:i]
+	}
+	return fmt.Sprintf("%s:%s", imageName, tag)
+}
+
 // Enabled returns the value of the container enabled label and if the label
 // was set.
 func (c Container) Enabled() (bool, bool) {
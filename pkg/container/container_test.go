@@ -258,6 +258,30 @@ var _ = Describe("the container", func() {
 				imageName := c.ImageName()
 				Expect(imageName).To(Equal(name + ":latest"))
 			})
+			When("the container tracks release channels", func() {
+				BeforeEach(func() {
+					c = MockContainer(WithImageName("registry:5000/robot/planner:1.0"), WithLabels(map[string]string{
+						"com.centurylinklabs.watchtower.channels": "nightly=nightly, production=stable",
+					}))
+				})
+				It("should use the tag of the channel of the device", func() {
+					c.SetChannel("production")
+					Expect(c.ImageName()).To(Equal("registry:5000/robot/planner:stable"))
+					c.SetChannel("nightly")
+					Expect(c.ImageName()).To(Equal("registry:5000/robot/planner:nightly"))
+				})
+				It("should keep its tag on channels it does not track", func() {
+					c.SetChannel("uat")
+					Expect(c.ImageName()).To(Equal("registry:5000/robot/planner:1.0"))
+				})
+				It("should prefer the tag selected by its version policy", func() {
+					c.SetChannel("production")
+					c.SetVersionTag("1.0.3")
+					Expect(c.ImageName()).To(Equal("registry:5000/robot/planner:1.0.3"))
+					c.SetVersionTag("")
+					Expect(c.ImageName()).To(Equal("registry:5000/robot/planner:stable"))
+				})
+			})
 		})
 
 		When("fetching container links", func() {
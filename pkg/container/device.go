@@ -0,0 +1,105 @@
+package container
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+const defaultDevicePermissions = "rwm"
+
+var devicePermissionsPattern = regexp.MustCompile(`^[rwm]{1,3}$`)
+var deviceCgroupRulePattern = regexp.MustCompile(`^([acb]) ([0-9]+|\*):([0-9]+|\*) ([rwm]{1,3})$`)
+
+// ParseDevice splits a device in the "host[:container][:permissions]" form of a compose file.
+// The container path defaults to the host path, and the permissions to rwm.
+func ParseDevice(device string) (hostPath string, containerPath string, permissions string, err error) {
+	permissions = defaultDevicePermissions
+	parts := strings.Split(device, ":")
+	switch len(parts) {
+	case 3:
+		permissions = parts[2]
+		containerPath = parts[1]
+	case 2:
+		if devicePermissionsPattern.MatchString(parts[1]) {
+			permissions = parts[1]
+		} else {
+			containerPath = parts[1]
+		}
+	case 1:
+	default:
+		return "", "", "", fmt.Errorf("device %q must be in the form host[:container][:permissions]", device)
+	}
+	hostPath = parts[0]
+
+	if !filepath.IsAbs(hostPath) {
+		return "", "", "", fmt.Errorf("device %q: host path must be absolute", device)
+	}
+	if containerPath == "" {
+		containerPath = hostPath
+	} else if !filepath.IsAbs(containerPath) {
+		return "", "", "", fmt.Errorf("device %q: container path must be absolute", device)
+	}
+	if !devicePermissionsPattern.MatchString(permissions) {
+		return "", "", "", fmt.Errorf("device %q: invalid permissions %q", device, permissions)
+	}
+	return hostPath, containerPath, permissions, nil
+}
+
+// ValidateDeviceCgroupRule checks a rule in the "type major:minor permissions" form, e.g. "c 189:* rwm"
+func ValidateDeviceCgroupRule(rule string) error {
+	if !deviceCgroupRulePattern.MatchString(rule) {
+		return fmt.Errorf("device cgroup rule %q must be in the form \"type major:minor permissions\"", rule)
+	}
+	return nil
+}
+
+// ResolveDevice returns the device mappings for a device of a service. The host path may be
+// a glob pattern, e.g. /dev/serial/by-id/*, which is mapped to every matching device. Symlinks,
+// like the ones created by udev, are resolved to the device they point to, so that the right
+// device is mapped even when the enumeration order changes. Unless a container path is given,
+// the device keeps the path it was requested by inside the container.
+func ResolveDevice(device string) ([]container.DeviceMapping, error) {
+	hostPath, containerPath, permissions, err := ParseDevice(device)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{hostPath}
+	if isGlob(hostPath) {
+		if paths, err = filepath.Glob(hostPath); err != nil {
+			return nil, fmt.Errorf("device %q: %w", device, err)
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("device %q: no device matches %s", device, hostPath)
+		}
+		if containerPath != hostPath && len(paths) > 1 {
+			return nil, fmt.Errorf("device %q: %d devices match %s, but only one can be mapped to %s", device, len(paths), hostPath, containerPath)
+		}
+	}
+
+	mappings := make([]container.DeviceMapping, 0, len(paths))
+	for _, path := range paths {
+		mapping := container.DeviceMapping{
+			PathOnHost:        path,
+			PathInContainer:   containerPath,
+			CgroupPermissions: permissions,
+		}
+		if containerPath == hostPath {
+			mapping.PathInContainer = path
+		}
+		// Devices that cannot be resolved are left for the docker daemon to report
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			mapping.PathOnHost = resolved
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
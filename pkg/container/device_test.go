@@ -0,0 +1,96 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types/container"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("devices", func() {
+	Describe("ParseDevice", func() {
+		It("should default the container path and permissions", func() {
+			hostPath, containerPath, permissions, err := ParseDevice("/dev/ttyUSB0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect([]string{hostPath, containerPath, permissions}).To(Equal([]string{"/dev/ttyUSB0", "/dev/ttyUSB0", "rwm"}))
+		})
+		It("should tell permissions apart from container paths", func() {
+			_, containerPath, permissions, err := ParseDevice("/dev/video0:r")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(containerPath).To(Equal("/dev/video0"))
+			Expect(permissions).To(Equal("r"))
+
+			_, containerPath, permissions, err = ParseDevice("/dev/video0:/dev/camera:rw")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(containerPath).To(Equal("/dev/camera"))
+			Expect(permissions).To(Equal("rw"))
+		})
+		It("should refuse relative paths and invalid permissions", func() {
+			_, _, _, err := ParseDevice("ttyUSB0")
+			Expect(err).To(HaveOccurred())
+			_, _, _, err = ParseDevice("/dev/ttyUSB0:/dev/ttyUSB0:x")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("ValidateDeviceCgroupRule", func() {
+		It("should accept valid rules", func() {
+			Expect(ValidateDeviceCgroupRule("c 188:* rwm")).To(Succeed())
+			Expect(ValidateDeviceCgroupRule("a *:* r")).To(Succeed())
+		})
+		It("should refuse malformed rules", func() {
+			Expect(ValidateDeviceCgroupRule("c 188 rwm")).NotTo(Succeed())
+			Expect(ValidateDeviceCgroupRule("x 1:1 rwm")).NotTo(Succeed())
+		})
+	})
+
+	Describe("ResolveDevice", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "devices")
+			Expect(err).NotTo(HaveOccurred())
+			// The temporary directory may itself be behind a symlink
+			dir, err = filepath.EvalSymlinks(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Mkdir(filepath.Join(dir, "by-id"), 0755)).To(Succeed())
+			for _, name := range []string{"ttyUSB0", "ttyUSB1"} {
+				Expect(os.WriteFile(filepath.Join(dir, name), nil, 0644)).To(Succeed())
+			}
+			Expect(os.Symlink("../ttyUSB1", filepath.Join(dir, "by-id", "usb-lidar"))).To(Succeed())
+			Expect(os.Symlink("../ttyUSB0", filepath.Join(dir, "by-id", "usb-gps"))).To(Succeed())
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should map symlinks to the device they point to", func() {
+			mappings, err := ResolveDevice(filepath.Join(dir, "by-id", "usb-lidar") + ":/dev/lidar")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mappings).To(Equal([]container.DeviceMapping{{
+				PathOnHost:        filepath.Join(dir, "ttyUSB1"),
+				PathInContainer:   "/dev/lidar",
+				CgroupPermissions: "rwm",
+			}}))
+		})
+
+		It("should map every device matching a glob to its own path", func() {
+			mappings, err := ResolveDevice(filepath.Join(dir, "by-id", "*") + ":r")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mappings).To(Equal([]container.DeviceMapping{
+				{PathOnHost: filepath.Join(dir, "ttyUSB0"), PathInContainer: filepath.Join(dir, "by-id", "usb-gps"), CgroupPermissions: "r"},
+				{PathOnHost: filepath.Join(dir, "ttyUSB1"), PathInContainer: filepath.Join(dir, "by-id", "usb-lidar"), CgroupPermissions: "r"},
+			}))
+		})
+
+		It("should refuse globs that cannot be mapped to a single container path", func() {
+			_, err := ResolveDevice(filepath.Join(dir, "ttyUSB*") + ":/dev/ttyUSB0")
+			Expect(err).To(HaveOccurred())
+			_, err = ResolveDevice(filepath.Join(dir, "ttyACM*"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -1,8 +1,57 @@
 package container
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 var errorNoImageInfo = errors.New("no available image info")
 var errorNoContainerInfo = errors.New("no available container info")
 var errorInvalidConfig = errors.New("container configuration missing or invalid")
 var errorLabelNotFound = errors.New("label was not found in container")
+
+// ErrContainerNotFound is returned when no container with the requested name exists
+var ErrContainerNotFound = errors.New("cannot find container")
+
+// FieldError describes a single invalid field in a compose file
+type FieldError struct {
+	Service string `json:"service,omitempty"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	if e.Service == "" {
+		return fmt.Sprintf("%s: %s", e.Field, e.Message)
+	}
+	return fmt.Sprintf("service %q: %s: %s", e.Service, e.Field, e.Message)
+}
+
+// ValidationError collects every invalid field found while parsing a compose file
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// Add appends a new FieldError for the given service and field
+func (e *ValidationError) Add(service string, field string, err error) {
+	var nested *ValidationError
+	if errors.As(err, &nested) {
+		e.Errors = append(e.Errors, nested.Errors...)
+		return
+	}
+	e.Errors = append(e.Errors, FieldError{Service: service, Field: field, Message: err.Error()})
+}
+
+// HasErrors returns whether any errors have been collected
+func (e *ValidationError) HasErrors() bool {
+	return len(e.Errors) > 0
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldError := range e.Errors {
+		messages = append(messages, fieldError.Error())
+	}
+	return "invalid compose file: " + strings.Join(messages, "; ")
+}
@@ -1,6 +1,9 @@
 package container
 
-import "strconv"
+import (
+	"strconv"
+	"strings"
+)
 
 const (
 	watchtowerLabel        = "com.centurylinklabs.watchtower"
@@ -17,8 +20,16 @@ const (
 	postUpdateLabel        = "com.centurylinklabs.watchtower.lifecycle.post-update"
 	preUpdateTimeoutLabel  = "com.centurylinklabs.watchtower.lifecycle.pre-update-timeout"
 	postUpdateTimeoutLabel = "com.centurylinklabs.watchtower.lifecycle.post-update-timeout"
+	channelsLabel          = "com.centurylinklabs.watchtower.channels"
+	semverLabel            = "com.centurylinklabs.watchtower.semver"
 )
 
+// StackServiceLabel marks a container as managed by the stack reconciler, with the name of its service as value
+const StackServiceLabel = "com.centurylinklabs.watchtower.stack.service"
+
+// StackConfigHashLabel holds the hash of the service definition a stack container was created from
+const StackConfigHashLabel = "com.centurylinklabs.watchtower.stack.config-hash"
+
 // GetLifecyclePreCheckCommand returns the pre-check command set in the container metadata or an empty string
 func (c Container) GetLifecyclePreCheckCommand() string {
 	return c.getLabelValueOrEmpty(preCheckLabel)
@@ -39,6 +50,26 @@ func (c Container) GetLifecyclePostUpdateCommand() string {
 	return c.getLabelValueOrEmpty(postUpdateLabel)
 }
 
+// ChannelTags returns the image tag of every release channel the container tracks, by device role.
+// The channels label lists them as comma separated role=tag pairs, e.g. "nightly=nightly,production=stable".
+func (c Container) ChannelTags() map[string]string {
+	tags := map[string]string{}
+	for _, pair := range strings.Split(c.getLabelValueOrEmpty(channelsLabel), ",") {
+		role, tag, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || role == "" || tag == "" {
+			continue
+		}
+		tags[strings.TrimSpace(role)] = strings.TrimSpace(tag)
+	}
+	return tags
+}
+
+// VersionPolicy returns the semantic version policy set in the container metadata, e.g. "~1.4" to
+// follow the patch releases of 1.4, or an empty string
+func (c Container) VersionPolicy() string {
+	return strings.TrimSpace(c.getLabelValueOrEmpty(semverLabel))
+}
+
 // ContainsWatchtowerLabel takes a map of labels and values and tells
 // the consumer whether it contains a valid watchtower instance label
 func ContainsWatchtowerLabel(labels map[string]string) bool {
@@ -46,6 +77,14 @@ func ContainsWatchtowerLabel(labels map[string]string) bool {
 	return ok && val == "true"
 }
 
+// Label returns the value of the container label and if the label was set
+func (c Container) Label(name string) (string, bool) {
+	if c.containerInfo == nil || c.containerInfo.Config == nil {
+		return "", false
+	}
+	return c.getLabelValue(name)
+}
+
 func (c Container) getLabelValueOrEmpty(label string) string {
 	if val, ok := c.containerInfo.Config.Labels[label]; ok {
 		return val
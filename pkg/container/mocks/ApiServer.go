@@ -192,6 +192,14 @@ func ListContainersHandler(statuses ...string) http.HandlerFunc {
 	)
 }
 
+// ListAllContainersHandler mocks the GET containers/json endpoint listing the containers in every state
+func ListAllContainersHandler() http.HandlerFunc {
+	return ghttp.CombineHandlers(
+		ghttp.VerifyRequest("GET", O.HaveSuffix("containers/json"), "all=1"),
+		respondWithFilteredContainers(createFilterArgs([]string{"created", "running", "restarting", "exited"})),
+	)
+}
+
 func respondWithFilteredContainers(filters filters.Args) http.HandlerFunc {
 	containersJSON, err := getMockJSONFile("./mocks/data/containers.json")
 	O.ExpectWithOffset(2, err).ShouldNot(O.HaveOccurred())
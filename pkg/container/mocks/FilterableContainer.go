@@ -92,3 +92,26 @@ func (_m *FilterableContainer) ImageName() string {
 
 	return r0
 }
+
+// Label provides a mock function with given fields: name
+func (_m *FilterableContainer) Label(name string) (string, bool) {
+	ret := _m.Called(name)
+
+	var r0 string
+
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(name)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 bool
+
+	if rf, ok := ret.Get(1).(func(string) bool); ok {
+		r1 = rf(name)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	return r0, r1
+}
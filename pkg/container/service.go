@@ -1,11 +1,20 @@
 package container
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	units "github.com/docker/go-units"
 )
 
 type ShellCommand []string
@@ -19,7 +28,12 @@ type Image struct {
 }
 
 type Volume struct {
-	Name string `json:"name"`
+	Name       string            `json:"name"`
+	ID         string            `json:"id"`
+	Driver     string            `json:"driver"`
+	DriverOpts map[string]string `json:"driver_opts"`
+	Labels     Labels            `json:"labels"`
+	External   bool              `json:"external"`
 }
 
 type Network struct {
@@ -30,41 +44,51 @@ type Network struct {
 	Internal       bool
 	Attachable     bool
 	Driver         string `json:"driver"`
+	DriverOpts     map[string]string
 	Ipam           network.IPAM
 	EnableIPv6     bool
+	External       bool
 }
 
 type Service struct {
-	Name          string            `json:"name"`
-	Action        string            `json:"action"`
-	Hostname      string            `json:"hostname"`
-	User          string            `json:"user"`
-	CapAdd        []string          `json:"cap_add"`
-	CapDrop       []string          `json:"cap_drop"`
-	BuildOpt      ServiceBuild      `json:"build_opt"`
-	CgroupParent  string            `json:"cgroup_parent"`
-	Command       ShellCommand      `json:"command"`
-	ContainerName string            `json:"container_name"`
-	Domainname    string            `json:"domain_name"`
-	DependsOn     []string          `json:"depends_on"`
-	Devices       []string          `json:"devices"`
-	EntryPoint    ShellCommand      `json:"entrypoint"`
-	Environment   []string          `json:"environment"`
-	EnvFile       []string          `json:"env_file"`
-	Expose        []string          `json:"expose"`
-	ExtraHosts    []string          `json:"extra_hosts"`
-	IpcMode       string            `json:"ipc_mode"`
-	Resources     ServiceResources  `json:"resources"`
-	Networks      []ServiceNetwork  `json:"networks"`
-	NetworkMode   string            `json:"network_mode"`
-	Ports         []ServicePort     `json:"ports"`
-	Privileged    bool              `json:"privileged"`
-	Sysctls       map[string]string `json:"sysctls"`
-	Restart       string            `json:"restart"`
-	Tty           bool              `json:"tty"`
-	Volumes       []ServiceVolume   `json:"volumes"`
-	WorkingDir    string            `json:"working_dir"`
-	Image         string            `json:"image"`
+	Name          string       `json:"name"`
+	Action        string       `json:"action"`
+	Hostname      string       `json:"hostname"`
+	User          string       `json:"user"`
+	CapAdd        []string     `json:"cap_add"`
+	CapDrop       []string     `json:"cap_drop"`
+	BuildOpt      ServiceBuild `json:"build_opt"`
+	CgroupParent  string       `json:"cgroup_parent"`
+	Command       ShellCommand `json:"command"`
+	ContainerName string       `json:"container_name"`
+	Domainname    string       `json:"domain_name"`
+	DependsOn     []string     `json:"depends_on"`
+
+	// DependsOnCondition maps each dependency to the condition it has to meet before the service is started
+	DependsOnCondition map[string]string   `json:"depends_on_condition"`
+	Healthcheck        *ServiceHealthcheck `json:"healthcheck"`
+	DeviceCgroupRules  []string            `json:"device_cgroup_rules"`
+
+	Devices     []string          `json:"devices"`
+	EntryPoint  ShellCommand      `json:"entrypoint"`
+	Environment []string          `json:"environment"`
+	EnvFile     []string          `json:"env_file"`
+	Expose      []string          `json:"expose"`
+	ExtraHosts  []string          `json:"extra_hosts"`
+	IpcMode     string            `json:"ipc_mode"`
+	PidMode     string            `json:"pid_mode"`
+	Labels      Labels            `json:"labels"`
+	Resources   ServiceResources  `json:"resources"`
+	Networks    []ServiceNetwork  `json:"networks"`
+	NetworkMode string            `json:"network_mode"`
+	Ports       []ServicePort     `json:"ports"`
+	Privileged  bool              `json:"privileged"`
+	Sysctls     map[string]string `json:"sysctls"`
+	Restart     string            `json:"restart"`
+	Tty         bool              `json:"tty"`
+	Volumes     []ServiceVolume   `json:"volumes"`
+	WorkingDir  string            `json:"working_dir"`
+	Image       string            `json:"image"`
 }
 
 type ServiceBuild struct {
@@ -84,7 +108,13 @@ type ServiceVolume struct {
 	Type        string
 	Source      string
 	Destination string
+	// Option holds the mode of bind mounts, e.g. "ro,rshared"
 	Option      string
+	ReadOnly    bool
+	Propagation string
+	NoCopy      bool
+	TmpfsSize   int64
+	TmpfsMode   os.FileMode
 }
 
 type ServicePort struct {
@@ -94,6 +124,14 @@ type ServicePort struct {
 	HostPort string
 }
 
+type ServiceHealthcheck struct {
+	Test        []string
+	Interval    time.Duration
+	Timeout     time.Duration
+	StartPeriod time.Duration
+	Retries     int
+}
+
 type ServiceResources struct {
 	CPUPeriod         int64
 	CPUQuota          int64
@@ -107,8 +145,9 @@ type ServiceResources struct {
 }
 
 const (
-	VolumeTypeBind  = "bind"
-	VolumeTypeMount = "mount"
+	VolumeTypeBind   = "bind"
+	VolumeTypeVolume = "volume"
+	VolumeTypeTmpfs  = "tmpfs"
 )
 
 const (
@@ -118,6 +157,12 @@ const (
 	RestartUnlessStopped = "unless-stopped"
 )
 
+const (
+	DependencyStarted   = "service_started"
+	DependencyHealthy   = "service_healthy"
+	DependencyCompleted = "service_completed_successfully"
+)
+
 const (
 	ActionRun     = "start"
 	ActionPause   = "pause"
@@ -125,6 +170,90 @@ const (
 	ActionRestart = "restart"
 )
 
+// HostAccess returns how the service reaches beyond the isolation of a regular container, e.g. by
+// being privileged, adding capabilities or binding the docker socket. Bind mounts of paths within
+// the compose directory are not counted. The volumes are the named volumes of the project, which
+// may bind host paths through their driver options.
+func (s Service) HostAccess(composeDir string, volumes []Volume) []string {
+	access := []string{}
+	if s.Privileged {
+		access = append(access, "privileged")
+	}
+	if len(s.CapAdd) > 0 {
+		access = append(access, "cap_add "+strings.Join(s.CapAdd, ","))
+	}
+	if len(s.Devices) > 0 || len(s.DeviceCgroupRules) > 0 {
+		access = append(access, "devices")
+	}
+	if s.CgroupParent != "" {
+		access = append(access, "cgroup_parent "+s.CgroupParent)
+	}
+	// Joining the namespace of another container gives access to whatever that container can reach
+	if s.NetworkMode == "host" || strings.HasPrefix(s.NetworkMode, "container:") || strings.HasPrefix(s.NetworkMode, "service:") {
+		access = append(access, "network_mode "+s.NetworkMode)
+	}
+	if s.PidMode == "host" {
+		access = append(access, "pid host")
+	}
+	if s.IpcMode == "host" {
+		access = append(access, "ipc host")
+	}
+	for _, volume := range s.Volumes {
+		if volume.Type == VolumeTypeBind && !isWithinDir(volume.Source, composeDir) {
+			access = append(access, "bind mount of "+volume.Source)
+		} else if device, found := boundDevice(volume, volumes); found && !isWithinDir(device, composeDir) {
+			access = append(access, fmt.Sprintf("bind mount of %s through volume %s", device, volume.Source))
+		}
+	}
+	for _, envFile := range s.EnvFile {
+		if !filepath.IsAbs(envFile) {
+			envFile = filepath.Join(composeDir, envFile)
+		}
+		if !isWithinDir(envFile, composeDir) {
+			access = append(access, "env_file "+envFile)
+		}
+	}
+	return access
+}
+
+// boundDevice returns the host path bound by the named volume mounted by the service, if the
+// volume is defined with the bind option of the local driver
+func boundDevice(mount ServiceVolume, volumes []Volume) (string, bool) {
+	if mount.Type != VolumeTypeVolume || mount.Source == "" {
+		return "", false
+	}
+	for _, volume := range volumes {
+		if volume.Name != mount.Source || (volume.Driver != "" && volume.Driver != "local") {
+			continue
+		}
+		for _, option := range strings.Split(volume.DriverOpts["o"], ",") {
+			if option == "bind" || option == "rbind" {
+				return volume.DriverOpts["device"], true
+			}
+		}
+	}
+	return "", false
+}
+
+// ConfigHash returns a hash of the definition of the service, which changes whenever the container
+// of the service has to be recreated. The action is not part of the definition.
+func (s Service) ConfigHash() string {
+	s.Action = ""
+	// The service only holds plain values, which can always be marshalled
+	data, _ := json.Marshal(s)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// isWithinDir returns whether the path is the directory or below it
+func isWithinDir(path string, dir string) bool {
+	if dir == "" {
+		return false
+	}
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func GetBuildConfig(rawBuildConfig map[string]interface{}) ServiceBuild {
 	return ServiceBuild{
 		Context:    rawBuildConfig["context"].(string),
@@ -132,11 +261,20 @@ func GetBuildConfig(rawBuildConfig map[string]interface{}) ServiceBuild {
 	}
 }
 
+// MakeService converts the raw configuration of a single compose service into a Service.
+// Every invalid field is collected into the returned ValidationError rather than stopping at the first one.
 func MakeService(
 	config map[string]interface{},
-	name string) Service {
+	name string) (Service, error) {
 
 	output := Service{}
+	errs := &ValidationError{}
+	collect := func(field string, err error) {
+		if err != nil {
+			errs.Add(name, field, err)
+		}
+	}
+	var err error
 
 	// Service Name
 	output.Name = name
@@ -145,48 +283,137 @@ func MakeService(
 	// Build options
 	// output.BuildOpt = MakeBuildOpt(config, path)
 	// Image
-	output.Image = MakeImage(config)
+	output.Image, err = MakeImage(config)
+	collect("image", err)
 
 	// Action
-	output.Action = MakeAction(config)
+	output.Action, err = MakeAction(config)
+	collect("action", err)
+
+	// Capabilities
+	output.CapAdd, err = MakeStringList(config, "cap_add")
+	collect("cap_add", err)
+	output.CapDrop, err = MakeStringList(config, "cap_drop")
+	collect("cap_drop", err)
+
+	// Cgroup parent
+	output.CgroupParent, err = MakeString(config, "cgroup_parent")
+	collect("cgroup_parent", err)
 
 	// Container Name
-	output.ContainerName = MakeContainerName(config)
+	output.ContainerName, err = MakeContainerName(config, name)
+	collect("container_name", err)
 
 	// Commands
-	output.Command = MakeCommand(config, "command")
+	output.Command, err = MakeCommand(config, "command")
+	collect("command", err)
 
 	// Dependencies
-	output.DependsOn = MakeDependsOn(config)
+	output.DependsOn, output.DependsOnCondition, err = MakeDependsOn(config)
+	collect("depends_on", err)
 
 	// Deployment and Resources
-	output.Resources = MakeDeployResources(config)
+	output.Resources, err = MakeDeployResources(config)
+	collect("deploy", err)
+
+	// Healthcheck
+	output.Healthcheck, err = MakeHealthcheck(config)
+	collect("healthcheck", err)
+
+	// Devices
+	output.Devices, err = MakeDevices(config)
+	collect("devices", err)
+	output.DeviceCgroupRules, err = MakeDeviceCgroupRules(config)
+	collect("device_cgroup_rules", err)
+
+	// Domain name
+	output.Domainname, err = MakeString(config, "domainname")
+	collect("domainname", err)
 
 	// Entrypoint
-	output.EntryPoint = MakeCommand(config, "entrypoint")
+	output.EntryPoint, err = MakeCommand(config, "entrypoint")
+	collect("entrypoint", err)
+
+	// Env files, resolved into the environment by the compose loader
+	output.EnvFile, err = MakeStringList(config, "env_file")
+	collect("env_file", err)
 
 	// Environment Variables
-	output.Environment = MakeEnviroment(config)
+	output.Environment, err = MakeEnviroment(config)
+	collect("environment", err)
+
+	// Exposed ports
+	output.Expose, err = MakeStringList(config, "expose")
+	collect("expose", err)
+
+	// Extra hosts
+	output.ExtraHosts, err = MakeKeyValueList(config, "extra_hosts", ":")
+	collect("extra_hosts", err)
+
+	// Hostname
+	output.Hostname, err = MakeString(config, "hostname")
+	collect("hostname", err)
+
+	// IPC
+	output.IpcMode, err = MakeString(config, "ipc")
+	collect("ipc", err)
+
+	// PID
+	output.PidMode, err = MakeString(config, "pid")
+	collect("pid", err)
+
+	// Labels
+	output.Labels, err = MakeLabels(config)
+	collect("labels", err)
 
 	// Network
-	output.Networks = MakeNetworks(config)
+	output.Networks, err = MakeNetworks(config)
+	collect("networks", err)
+	output.NetworkMode, err = MakeString(config, "network_mode")
+	collect("network_mode", err)
+	if output.NetworkMode != "" && len(output.Networks) > 0 {
+		collect("network_mode", fmt.Errorf("cannot be combined with networks"))
+	}
 
 	// Ports
-	output.Ports = MakePortBinding(config)
+	output.Ports, err = MakePortBinding(config)
+	collect("ports", err)
 
 	// Privileged
-	output.Privileged = MakePrivileged(config)
+	output.Privileged, err = MakePrivileged(config)
+	collect("privileged", err)
 
 	// Restart
-	output.Restart = MakeRestartOpt(config)
+	output.Restart, err = MakeRestartOpt(config)
+	collect("restart", err)
+
+	// Sysctls
+	output.Sysctls, err = MakeSysctls(config)
+	collect("sysctls", err)
 
 	// TTY
-	output.Tty = MakeTTY(config)
+	output.Tty, err = MakeTTY(config)
+	collect("tty", err)
+
+	// User
+	output.User, err = MakeString(config, "user")
+	collect("user", err)
 
 	// Volumes
-	output.Volumes = MakeVolumes(config)
+	output.Volumes, err = MakeVolumes(config)
+	collect("volumes", err)
+	tmpfs, err := MakeTmpfs(config)
+	collect("tmpfs", err)
+	output.Volumes = append(output.Volumes, tmpfs...)
 
-	return output
+	// Working directory
+	output.WorkingDir, err = MakeString(config, "working_dir")
+	collect("working_dir", err)
+
+	if errs.HasErrors() {
+		return output, errs
+	}
+	return output, nil
 }
 
 func MakeBuildOpt(config map[string]interface{}, path string) ServiceBuild {
@@ -212,74 +439,228 @@ func MakeBuildOpt(config map[string]interface{}, path string) ServiceBuild {
 	return output
 }
 
-func MakeContainerName(config map[string]interface{}) string {
-	return config["container_name"].(string)
+func MakeContainerName(config map[string]interface{}, serviceName string) (string, error) {
+	name, err := MakeString(config, "container_name")
+	if err != nil || name != "" {
+		return name, err
+	}
+	// Default to the service name so that the container can be found again by name
+	return serviceName, nil
 }
 
-func MakeAction(config map[string]interface{}) string {
-	return config["action"].(string)
+func MakeAction(config map[string]interface{}) (string, error) {
+	action, err := MakeString(config, "action")
+	if err != nil {
+		return "", err
+	}
+	switch action {
+	case "":
+		return ActionRun, nil
+	case ActionRun, ActionPause, ActionStop, ActionRestart:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unknown action %q", action)
+	}
 }
 
-func MakeCommand(config map[string]interface{}, cmdType string) ShellCommand {
-	output := make(ShellCommand, 0)
-	if cmdOpt, exist := config[cmdType].([]interface{}); exist {
-		for _, args := range cmdOpt {
-			output = append(output, args.(string))
+func MakeCommand(config map[string]interface{}, cmdType string) (ShellCommand, error) {
+	switch cmdOpt := config[cmdType].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return splitCommand(cmdOpt)
+	case []interface{}:
+		output := make(ShellCommand, 0, len(cmdOpt))
+		for _, arg := range cmdOpt {
+			value, err := toString(arg)
+			if err != nil {
+				return nil, err
+			}
+			output = append(output, value)
 		}
-	} else {
-		return nil
+		return output, nil
+	default:
+		return nil, fmt.Errorf("expected a string or a list, got %T", cmdOpt)
 	}
-	return output
 }
 
-func MakeDependsOn(config map[string]interface{}) []string {
-	output := make([]string, 0)
-	if dependsOnOpt, exist := config["depends_on"].([]interface{}); exist {
-		for _, dependsOn := range dependsOnOpt {
-			output = append(output, dependsOn.(string))
+func MakeDependsOn(config map[string]interface{}) ([]string, map[string]string, error) {
+	conditions := map[string]string{}
+	switch dependsOnOpt := config["depends_on"].(type) {
+	case nil:
+		return []string{}, conditions, nil
+	case []interface{}:
+		output, err := toStringList(dependsOnOpt)
+		for _, name := range output {
+			conditions[name] = DependencyStarted
 		}
+		return output, conditions, err
+	case map[string]interface{}:
+		// Long syntax, e.g. `db: {condition: service_healthy}`
+		output := make([]string, 0, len(dependsOnOpt))
+		for name, rawDependency := range dependsOnOpt {
+			dependency, err := toMap(rawDependency)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", name, err)
+			}
+			condition, err := MakeString(dependency, "condition")
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", name, err)
+			}
+			switch condition {
+			case "":
+				condition = DependencyStarted
+			case DependencyStarted, DependencyHealthy, DependencyCompleted:
+			default:
+				return nil, nil, fmt.Errorf("%s: unknown condition %q", name, condition)
+			}
+			conditions[name] = condition
+			output = append(output, name)
+		}
+		sort.Strings(output)
+		return output, conditions, nil
+	default:
+		return nil, nil, fmt.Errorf("expected a list or a mapping, got %T", dependsOnOpt)
 	}
-	return output
 }
 
-func MakeDeployResources(config map[string]interface{}) ServiceResources {
+func MakeHealthcheck(config map[string]interface{}) (*ServiceHealthcheck, error) {
+	healthcheckOpt, err := toMap(config["healthcheck"])
+	if err != nil || healthcheckOpt == nil {
+		return nil, err
+	}
+
+	healthcheck := &ServiceHealthcheck{}
+	if disable, err := MakeBool(healthcheckOpt, "disable"); err != nil {
+		return nil, fmt.Errorf("disable: %w", err)
+	} else if disable {
+		healthcheck.Test = []string{"NONE"}
+		return healthcheck, nil
+	}
+
+	switch test := healthcheckOpt["test"].(type) {
+	case nil:
+	case string:
+		healthcheck.Test = []string{"CMD-SHELL", test}
+	case []interface{}:
+		if healthcheck.Test, err = toStringList(test); err != nil {
+			return nil, fmt.Errorf("test: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("test: expected a string or a list, got %T", test)
+	}
+
+	durations := map[string]*time.Duration{
+		"interval":     &healthcheck.Interval,
+		"timeout":      &healthcheck.Timeout,
+		"start_period": &healthcheck.StartPeriod,
+	}
+	for field, target := range durations {
+		value, err := MakeString(healthcheckOpt, field)
+		if err != nil || value == "" {
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field, err)
+			}
+			continue
+		}
+		if *target, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+	}
+
+	if retries, found := healthcheckOpt["retries"]; found && retries != nil {
+		value, err := toFloat(retries)
+		if err != nil {
+			return nil, fmt.Errorf("retries: %w", err)
+		}
+		healthcheck.Retries = int(value)
+	}
+	return healthcheck, nil
+}
+
+func MakeDeployResources(config map[string]interface{}) (ServiceResources, error) {
 	resources := ServiceResources{}
-	if deployOpt, exist := config["deploy"].(map[string]interface{}); exist {
-		if resourcesOpt, exist := deployOpt["resources"].(map[string]interface{}); exist {
-			limitOpt := resourcesOpt["limits"].(map[string]interface{})
-			// CPU usage
-			var cpuPeriod float64 = 100000                                   // Default value of 100000
-			cpuQuota, _ := strconv.ParseFloat(limitOpt["cpus"].(string), 64) // Combination of period and quota to determine cpu limitation
+	deployOpt, err := toMap(config["deploy"])
+	if err != nil || deployOpt == nil {
+		return resources, err
+	}
+	resourcesOpt, err := toMap(deployOpt["resources"])
+	if err != nil || resourcesOpt == nil {
+		return resources, err
+	}
+
+	limitOpt, err := toMap(resourcesOpt["limits"])
+	if err != nil {
+		return resources, fmt.Errorf("resources.limits: %w", err)
+	}
+	if limitOpt != nil {
+		// CPU usage
+		if cpus, exist := limitOpt["cpus"]; exist {
+			cpuQuota, err := toFloat(cpus)
+			if err != nil {
+				return resources, fmt.Errorf("resources.limits.cpus: %w", err)
+			}
+			var cpuPeriod float64 = 100000 // Default value of 100000
+			// Combination of period and quota to determine cpu limitation
 			resources.CPUQuota = int64(cpuQuota * cpuPeriod)
 			resources.CPUPeriod = int64(cpuPeriod)
+		}
 
-			// Memory usage
-			memoryInString := limitOpt["memory"].(string)
-			memory, _ := strconv.ParseInt(memoryInString[:len(memoryInString)-1], 10, 64)
-			suffix := string(memoryInString[len(memoryInString)-1])
-			switch {
-			case suffix == "k" || suffix == "K":
-				memory = memory * 1024
-			case suffix == "m" || suffix == "M":
-				memory = memory * 1048576
-			case suffix == "g" || suffix == "G":
-				memory = memory * 1073741824
+		// Memory usage
+		if memory, exist := limitOpt["memory"]; exist {
+			if resources.MemoryLimit, err = toBytes(memory); err != nil {
+				return resources, fmt.Errorf("resources.limits.memory: %w", err)
 			}
-			resources.MemoryLimit = memory
 		}
 	}
-	return resources
+
+	reservationOpt, err := toMap(resourcesOpt["reservations"])
+	if err != nil {
+		return resources, fmt.Errorf("resources.reservations: %w", err)
+	}
+	if memory, exist := reservationOpt["memory"]; exist {
+		if resources.MemoryReservation, err = toBytes(memory); err != nil {
+			return resources, fmt.Errorf("resources.reservations.memory: %w", err)
+		}
+	}
+
+	return resources, nil
+}
+
+func MakeEnviroment(config map[string]interface{}) ([]string, error) {
+	return MakeKeyValueList(config, "environment", "=")
 }
 
-func MakeEnviroment(config map[string]interface{}) []string {
-	env := make([]string, 0)
-	// Environment variables
-	if envVarsOpt, exist := config["environment"].([]interface{}); exist {
-		for _, envVars := range envVarsOpt {
-			env = append(env, envVars.(string))
+// MakeKeyValueList reads a field that can either be a list of `key<sep>value` strings or a mapping
+func MakeKeyValueList(config map[string]interface{}, field string, sep string) ([]string, error) {
+	switch opt := config[field].(type) {
+	case nil:
+		return []string{}, nil
+	case []interface{}:
+		return toStringList(opt)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(opt))
+		for key := range opt {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		output := make([]string, 0, len(opt))
+		for _, key := range keys {
+			if opt[key] == nil {
+				// A key without a value is passed as-is, e.g. to inherit it from the environment
+				output = append(output, key)
+				continue
+			}
+			value, err := toString(opt[key])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			output = append(output, key+sep+value)
 		}
+		return output, nil
+	default:
+		return nil, fmt.Errorf("expected a list or a mapping, got %T", opt)
 	}
-	return env
 }
 
 func MakeExtraHosts(config map[string]interface{}, hostname string) []string {
@@ -295,84 +676,573 @@ func MakeExtraHosts(config map[string]interface{}, hostname string) []string {
 	return hosts
 }
 
-func MakeRestartOpt(config map[string]interface{}) string {
-	output := "no"
-	if restartOpt, exist := config["restart"].(string); exist {
-		output = restartOpt
+func MakeLabels(config map[string]interface{}) (Labels, error) {
+	list, err := MakeKeyValueList(config, "labels", "=")
+	if err != nil {
+		return nil, err
 	}
-	return output
+	labels := Labels{}
+	for _, label := range list {
+		key, value, _ := strings.Cut(label, "=")
+		labels[key] = value
+	}
+	return labels, nil
 }
 
-func MakePortBinding(config map[string]interface{}) []ServicePort {
+func MakeRestartOpt(config map[string]interface{}) (string, error) {
+	output, err := MakeString(config, "restart")
+	if err != nil || output == "" {
+		return RestartNoRetry, err
+	}
+	policy, _, _ := strings.Cut(output, ":")
+	switch policy {
+	case RestartAlways, RestartOnFailure, RestartNoRetry, RestartUnlessStopped:
+		return output, nil
+	default:
+		return "", fmt.Errorf("unknown restart policy %q", output)
+	}
+}
+
+func MakePortBinding(config map[string]interface{}) ([]ServicePort, error) {
 	ports := make([]ServicePort, 0)
-	if portOpt, exist := config["ports"].([]interface{}); exist {
-		for _, portData := range portOpt {
-			// We need to properly split the string to port and host ip address
-			splittedPort := strings.Split(portData.(string), ":")
-			port := ServicePort{
-				Target:   splittedPort[0],
-				Protocol: "tcp",
-				HostIp:   "0.0.0.0",
-				HostPort: splittedPort[1],
+	portOpt, exist := config["ports"]
+	if !exist || portOpt == nil {
+		return ports, nil
+	}
+	portList, ok := portOpt.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list, got %T", portOpt)
+	}
+
+	for _, portData := range portList {
+		if longSyntax, ok := portData.(map[string]interface{}); ok {
+			port, err := makeLongSyntaxPort(longSyntax)
+			if err != nil {
+				return nil, err
 			}
 			ports = append(ports, port)
+			continue
+		}
+
+		// Short syntax: [HOST_IP:][HOST_PORT:]CONTAINER_PORT[/PROTOCOL]
+		rawPort, err := toString(portData)
+		if err != nil {
+			return nil, err
+		}
+		mappings, err := nat.ParsePortSpec(rawPort)
+		if err != nil {
+			return nil, err
+		}
+		for _, mapping := range mappings {
+			ports = append(ports, ServicePort{
+				Target:   mapping.Port.Port(),
+				Protocol: mapping.Port.Proto(),
+				HostIp:   mapping.Binding.HostIP,
+				HostPort: mapping.Binding.HostPort,
+			})
 		}
 	}
-	return ports
+	return ports, nil
 }
 
-func MakePrivileged(config map[string]interface{}) bool {
-	if privileged, exist := config["privileged"].(bool); exist {
-		return privileged
+func makeLongSyntaxPort(config map[string]interface{}) (ServicePort, error) {
+	port := ServicePort{Protocol: "tcp"}
+	var err error
+	if port.Target, err = MakeString(config, "target"); err != nil {
+		return port, err
 	}
-	return false
+	if port.Target == "" {
+		return port, fmt.Errorf("port is missing a target")
+	}
+	if port.HostPort, err = MakeString(config, "published"); err != nil {
+		return port, err
+	}
+	if port.HostIp, err = MakeString(config, "host_ip"); err != nil {
+		return port, err
+	}
+	if protocol, err := MakeString(config, "protocol"); err != nil {
+		return port, err
+	} else if protocol != "" {
+		port.Protocol = protocol
+	}
+	return port, nil
+}
+
+func MakePrivileged(config map[string]interface{}) (bool, error) {
+	return MakeBool(config, "privileged")
 }
 
-func MakeTTY(config map[string]interface{}) bool {
-	if tty, exist := config["tty"].(bool); exist {
-		return tty
+func MakeSysctls(config map[string]interface{}) (map[string]string, error) {
+	list, err := MakeKeyValueList(config, "sysctls", "=")
+	if err != nil {
+		return nil, err
 	}
-	return false
+	sysctls := make(map[string]string, len(list))
+	for _, sysctl := range list {
+		key, value, found := strings.Cut(sysctl, "=")
+		if !found {
+			return nil, fmt.Errorf("sysctl %q has no value", key)
+		}
+		sysctls[key] = value
+	}
+	return sysctls, nil
 }
 
-func MakeNetworks(config map[string]interface{}) []ServiceNetwork {
-	network := make([]ServiceNetwork, 0)
-	if networkOpts, exist := config["networks"].(map[string]interface{}); exist {
-		for name, networkData := range networkOpts {
-			network = append(network, ServiceNetwork{
-				Name: name,
-				IPv4: networkData.(map[string]interface{})["ipv4_address"].(string),
-			})
+// MakeDevices reads the devices of a service in the "host[:container][:permissions]" form
+func MakeDevices(config map[string]interface{}) ([]string, error) {
+	devices, err := MakeStringList(config, "devices")
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		if _, _, _, err := ParseDevice(device); err != nil {
+			return nil, err
+		}
+	}
+	return devices, nil
+}
+
+func MakeDeviceCgroupRules(config map[string]interface{}) ([]string, error) {
+	rules, err := MakeStringList(config, "device_cgroup_rules")
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if err := ValidateDeviceCgroupRule(rule); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+func MakeTTY(config map[string]interface{}) (bool, error) {
+	return MakeBool(config, "tty")
+}
+
+func MakeNetworks(config map[string]interface{}) ([]ServiceNetwork, error) {
+	networks := make([]ServiceNetwork, 0)
+	switch networkOpts := config["networks"].(type) {
+	case nil:
+		return networks, nil
+	case []interface{}:
+		names, err := toStringList(networkOpts)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			networks = append(networks, ServiceNetwork{Name: name})
+		}
+	case map[string]interface{}:
+		names := make([]string, 0, len(networkOpts))
+		for name := range networkOpts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			networkData, err := toMap(networkOpts[name])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			network := ServiceNetwork{Name: name}
+			if network.Aliases, err = MakeStringList(networkData, "aliases"); err != nil {
+				return nil, fmt.Errorf("%s.aliases: %w", name, err)
+			}
+			if network.IPv4, err = MakeString(networkData, "ipv4_address"); err != nil {
+				return nil, fmt.Errorf("%s.ipv4_address: %w", name, err)
+			}
+			if network.IPv6, err = MakeString(networkData, "ipv6_address"); err != nil {
+				return nil, fmt.Errorf("%s.ipv6_address: %w", name, err)
+			}
+			networks = append(networks, network)
 		}
+	default:
+		return nil, fmt.Errorf("expected a list or a mapping, got %T", networkOpts)
 	}
-	return network
+	return networks, nil
 }
 
-func MakeVolumes(config map[string]interface{}) []ServiceVolume {
+// MakeVolumes reads the volumes of a service, in either the short "source:destination[:mode]"
+// syntax or the long syntax. Sources that are not paths refer to named volumes.
+func MakeVolumes(config map[string]interface{}) ([]ServiceVolume, error) {
 	volumes := make([]ServiceVolume, 0)
-	if volumeOpt, exist := config["volumes"].([]interface{}); exist {
-		fromStringToVolume := func(volStr string) ServiceVolume {
-			separateValues := strings.Split(volStr, ":")
-			if len(separateValues) >= 2 {
-				return ServiceVolume{
-					Type:        VolumeTypeBind,
-					Source:      separateValues[0],
-					Destination: separateValues[1],
+	volumeOpt, exist := config["volumes"]
+	if !exist || volumeOpt == nil {
+		return volumes, nil
+	}
+	volumeList, ok := volumeOpt.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list, got %T", volumeOpt)
+	}
+
+	for _, volData := range volumeList {
+		var volume ServiceVolume
+		var err error
+		if volMap, isMap := volData.(map[string]interface{}); isMap {
+			volume, err = makeLongVolume(volMap)
+		} else {
+			volume, err = makeShortVolume(volData)
+		}
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, volume)
+	}
+	return volumes, nil
+}
+
+func makeShortVolume(volData interface{}) (ServiceVolume, error) {
+	volume := ServiceVolume{}
+	volStr, err := toString(volData)
+	if err != nil {
+		return volume, err
+	}
+
+	separateValues := strings.Split(volStr, ":")
+	switch len(separateValues) {
+	case 1:
+		// Anonymous volume
+		volume.Type = VolumeTypeVolume
+		volume.Destination = separateValues[0]
+		return volume, nil
+	case 2, 3:
+	default:
+		return volume, fmt.Errorf("volume %q must be in the form source:destination[:mode]", volStr)
+	}
+
+	volume.Source = separateValues[0]
+	volume.Destination = separateValues[1]
+	volume.Type = VolumeTypeVolume
+	if isPathSource(volume.Source) {
+		volume.Type = VolumeTypeBind
+	}
+	if len(separateValues) > 2 {
+		volume.Option = separateValues[2]
+	}
+
+	for _, option := range strings.Split(volume.Option, ",") {
+		switch option {
+		case "", "rw", "z", "Z":
+		case "ro":
+			volume.ReadOnly = true
+		case "nocopy":
+			if volume.Type != VolumeTypeVolume {
+				return volume, fmt.Errorf("volume %q: nocopy only applies to named volumes", volStr)
+			}
+			volume.NoCopy = true
+		default:
+			if !isPropagation(option) {
+				return volume, fmt.Errorf("volume %q: unknown option %q", volStr, option)
+			}
+			if volume.Type != VolumeTypeBind {
+				return volume, fmt.Errorf("volume %q: propagation only applies to bind mounts", volStr)
+			}
+			volume.Propagation = option
+		}
+	}
+	return volume, nil
+}
+
+func makeLongVolume(config map[string]interface{}) (ServiceVolume, error) {
+	volume := ServiceVolume{}
+	var err error
+
+	if volume.Type, err = MakeString(config, "type"); err != nil {
+		return volume, fmt.Errorf("type: %w", err)
+	}
+	if volume.Source, err = MakeString(config, "source"); err != nil {
+		return volume, fmt.Errorf("source: %w", err)
+	}
+	if volume.Destination, err = MakeString(config, "target"); err != nil {
+		return volume, fmt.Errorf("target: %w", err)
+	}
+	if volume.ReadOnly, err = MakeBool(config, "read_only"); err != nil {
+		return volume, fmt.Errorf("read_only: %w", err)
+	}
+	if volume.Destination == "" {
+		return volume, fmt.Errorf("target is required")
+	}
+
+	switch volume.Type {
+	case VolumeTypeBind:
+		if volume.Source == "" {
+			return volume, fmt.Errorf("source is required for bind mounts")
+		}
+		bindConfig, err := toMap(config["bind"])
+		if err != nil {
+			return volume, fmt.Errorf("bind: %w", err)
+		}
+		if volume.Propagation, err = MakeString(bindConfig, "propagation"); err != nil {
+			return volume, fmt.Errorf("bind.propagation: %w", err)
+		}
+		options := []string{}
+		if volume.ReadOnly {
+			options = append(options, "ro")
+		}
+		if volume.Propagation != "" {
+			if !isPropagation(volume.Propagation) {
+				return volume, fmt.Errorf("bind.propagation: unknown propagation %q", volume.Propagation)
+			}
+			options = append(options, volume.Propagation)
+		}
+		volume.Option = strings.Join(options, ",")
+	case VolumeTypeVolume:
+		volumeConfig, err := toMap(config["volume"])
+		if err != nil {
+			return volume, fmt.Errorf("volume: %w", err)
+		}
+		if volume.NoCopy, err = MakeBool(volumeConfig, "nocopy"); err != nil {
+			return volume, fmt.Errorf("volume.nocopy: %w", err)
+		}
+	case VolumeTypeTmpfs:
+		if volume.Source != "" {
+			return volume, fmt.Errorf("source is not allowed for tmpfs mounts")
+		}
+		tmpfsConfig, err := toMap(config["tmpfs"])
+		if err != nil {
+			return volume, fmt.Errorf("tmpfs: %w", err)
+		}
+		if size, err := MakeString(tmpfsConfig, "size"); err != nil {
+			return volume, fmt.Errorf("tmpfs.size: %w", err)
+		} else if size != "" {
+			if volume.TmpfsSize, err = units.RAMInBytes(size); err != nil {
+				return volume, fmt.Errorf("tmpfs.size: %w", err)
+			}
+		}
+		if mode, err := MakeString(tmpfsConfig, "mode"); err != nil {
+			return volume, fmt.Errorf("tmpfs.mode: %w", err)
+		} else if mode != "" {
+			if volume.TmpfsMode, err = parseFileMode(mode); err != nil {
+				return volume, fmt.Errorf("tmpfs.mode: %w", err)
+			}
+		}
+	case "":
+		return volume, fmt.Errorf("type is required")
+	default:
+		return volume, fmt.Errorf("unsupported volume type %q", volume.Type)
+	}
+	return volume, nil
+}
+
+// MakeTmpfs reads the tmpfs mounts of a service, in the "path[:options]" form of `docker run --tmpfs`
+func MakeTmpfs(config map[string]interface{}) ([]ServiceVolume, error) {
+	entries, err := MakeStringList(config, "tmpfs")
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := make([]ServiceVolume, 0, len(entries))
+	for _, entry := range entries {
+		path, options, _ := strings.Cut(entry, ":")
+		volume := ServiceVolume{Type: VolumeTypeTmpfs, Destination: path}
+		for _, option := range strings.Split(options, ",") {
+			key, value, _ := strings.Cut(option, "=")
+			switch key {
+			case "", "rw":
+			case "ro":
+				volume.ReadOnly = true
+			case "size":
+				if volume.TmpfsSize, err = units.RAMInBytes(value); err != nil {
+					return nil, fmt.Errorf("%s: %w", path, err)
 				}
+			case "mode":
+				if volume.TmpfsMode, err = parseFileMode(value); err != nil {
+					return nil, fmt.Errorf("%s: %w", path, err)
+				}
+			default:
+				return nil, fmt.Errorf("%s: unknown option %q", path, option)
 			}
-			return ServiceVolume{}
 		}
-		for _, volData := range volumeOpt {
-			volumes = append(volumes, fromStringToVolume(volData.(string)))
+		volumes = append(volumes, volume)
+	}
+	return volumes, nil
+}
+
+// isPathSource returns whether the source of a short syntax volume is a host path rather than a volume name
+func isPathSource(source string) bool {
+	return strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~")
+}
+
+func isPropagation(option string) bool {
+	switch option {
+	case "shared", "rshared", "slave", "rslave", "private", "rprivate":
+		return true
+	}
+	return false
+}
+
+// parseFileMode parses octal permission bits, e.g. 1777
+func parseFileMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode %q", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+func MakeImage(config map[string]interface{}) (string, error) {
+	image, err := MakeString(config, "image")
+	if err == nil && image == "" {
+		return "", fmt.Errorf("image is required")
+	}
+	return image, err
+}
+
+// MakeString reads an optional scalar field as a string
+func MakeString(config map[string]interface{}, field string) (string, error) {
+	value, exist := config[field]
+	if !exist || value == nil {
+		return "", nil
+	}
+	return toString(value)
+}
+
+// MakeStringList reads an optional field that can either be a single string or a list of strings
+func MakeStringList(config map[string]interface{}, field string) ([]string, error) {
+	switch value := config[field].(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		return toStringList(value)
+	default:
+		single, err := toString(value)
+		if err != nil {
+			return nil, err
+		}
+		return []string{single}, nil
+	}
+}
+
+// MakeBool reads an optional boolean field
+func MakeBool(config map[string]interface{}, field string) (bool, error) {
+	switch value := config[field].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return value, nil
+	case string:
+		return strconv.ParseBool(value)
+	default:
+		return false, fmt.Errorf("expected a boolean, got %T", value)
+	}
+}
+
+func toString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", fmt.Errorf("expected a string, got %T", value)
+	}
+}
+
+func toStringList(values []interface{}) ([]string, error) {
+	output := make([]string, 0, len(values))
+	for _, value := range values {
+		str, err := toString(value)
+		if err != nil {
+			return nil, err
 		}
+		output = append(output, str)
 	}
-	return volumes
+	return output, nil
 }
 
-func MakeImage(config map[string]interface{}) string {
-	output := ""
-	if image, exist := config["image"].(string); exist {
-		output = image
+func toMap(value interface{}) (map[string]interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("expected a mapping, got %T", value)
 	}
-	return output
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	default:
+		return 0, fmt.Errorf("expected a number, got %T", value)
+	}
+}
+
+// toBytes reads a size either as a plain number of bytes or as a human readable string such as 512m
+func toBytes(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	case string:
+		return units.RAMInBytes(v)
+	default:
+		return 0, fmt.Errorf("expected a size, got %T", value)
+	}
+}
+
+// splitCommand splits a command string into arguments the way a POSIX shell would,
+// honouring single quotes, double quotes and backslash escapes
+func splitCommand(command string) (ShellCommand, error) {
+	output := ShellCommand{}
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && strings.ContainsRune(`"\$`+"`", runes[i+1]) {
+				i++
+				current.WriteRune(runes[i])
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == '\\' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				output = append(output, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", command)
+	}
+	if inArg {
+		output = append(output, current.String())
+	}
+	return output, nil
 }
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -41,7 +42,7 @@ const (
 )
 
 // TODO: Come up with a better way to handle this
-func MakeDevice() (*types.Device, error) {
+func MakeDevice(roles RoleSource) (*types.Device, error) {
 	status, err := getStatus()
 	if err != nil {
 		status = Unknown
@@ -66,7 +67,7 @@ func MakeDevice() (*types.Device, error) {
 		osType = Raspbian
 	}
 
-	deviceRole, err := getDeviceRole()
+	deviceRole, err := roles.Role()
 	if err != nil {
 		deviceRole = Develop
 	}
@@ -92,20 +93,39 @@ func getStatus() (string, error) {
 }
 
 func getUUID() (string, error) {
-	data, err := os.ReadFile("/proc/cpuinfo")
+	return readSerial("/proc/cpuinfo"), nil
+}
+
+// Serial returns the serial number the CPU of the device reports in the cpuinfo of the proc file
+// system mounted at procRoot, e.g. "/proc". On hardware that does not report one, e.g. anything
+// but a Raspberry Pi, the host name is returned instead.
+func Serial(procRoot string) string {
+	if serial := readSerial(filepath.Join(procRoot, "cpuinfo")); serial != "" {
+		return serial
+	}
+	hostname, err := os.Hostname()
 	if err != nil {
-		return "", nil
+		return Unknown
+	}
+	return hostname
+}
+
+// readSerial returns the serial number of the cpuinfo file, or an empty string if it has none
+func readSerial(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
 	}
 
 	lines := strings.Split(string(data), "\n")
 	for _, line := range lines {
 		fields := strings.Fields(line)
-		if len(fields) >= 2 && fields[0] == "Serial" {
-			// The serial number is the second field
-			return fields[2], nil
+		if len(fields) >= 3 && fields[0] == "Serial" {
+			// The serial number follows the colon
+			return fields[2]
 		}
 	}
-	return "", nil
+	return ""
 }
 
 func getDeviceType() (string, error) {
@@ -145,10 +165,6 @@ func getOsType() (string, error) {
 	return "", fmt.Errorf("distribution identifier not found in /etc/os-release")
 }
 
-func getDeviceRole() (string, error) {
-	return Develop, nil
-}
-
 func getInternetStatus() (string, error) {
 	// Define a timeout for the HTTP request
 	client := http.Client{
@@ -0,0 +1,16 @@
+package device_test
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDevice(t *testing.T) {
+	RegisterFailHandler(Fail)
+	logrus.SetOutput(GinkgoWriter)
+	RunSpecs(t, "Device Suite")
+}
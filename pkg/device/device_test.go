@@ -0,0 +1,28 @@
+package device_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/containrrr/watchtower/pkg/device"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the device serial", func() {
+	It("should read the serial number of the CPU", func() {
+		Expect(device.Serial("testdata/proc")).To(Equal("100000002a5f3c1e"))
+	})
+
+	It("should fall back to the host name without a serial number", func() {
+		procRoot, err := os.MkdirTemp("", "proc")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(procRoot)
+		Expect(os.WriteFile(filepath.Join(procRoot, "cpuinfo"), []byte("processor\t: 0\nmodel name\t: Intel(R) Core(TM) i7\n"), 0644)).To(Succeed())
+
+		hostname, err := os.Hostname()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(device.Serial(procRoot)).To(Equal(hostname))
+	})
+})
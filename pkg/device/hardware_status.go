@@ -1,16 +1,374 @@
 package device
 
 import (
-	"math/rand"
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/containrrr/watchtower/pkg/types"
+	log "github.com/sirupsen/logrus"
 )
 
-func GetHardwareStatus() (types.HardwareStatus, error) {
-	return types.HardwareStatus{
-		Cpu:         rand.Float64() * 100.0,
-		Temperature: rand.Float64() * 100.0,
-		Ram:         rand.Float64() * 100.0,
-		Storage:     rand.Float64() * 100.0,
-	}, nil
+const (
+	DefaultProcRoot = "/proc"
+	DefaultSysRoot  = "/sys"
+	// DefaultCPUSampleInterval is how long the first CPU usage is sampled over
+	DefaultCPUSampleInterval = 250 * time.Millisecond
+)
+
+// HardwareOptions contains the options for where the hardware collector reads its data from
+type HardwareOptions struct {
+	// ProcRoot is the mount point of procfs, e.g. /host/proc when running inside a container
+	ProcRoot string
+	// SysRoot is the mount point of sysfs, e.g. /host/sys when running inside a container
+	SysRoot string
+	// MountPoints are the filesystems used to calculate the storage usage
+	MountPoints []string
+	// CPUSampleInterval is how long the first CPU usage is sampled over, as there is no previous
+	// sample to compare it to
+	CPUSampleInterval time.Duration
+}
+
+// HardwareCollector reads hardware telemetry from procfs and sysfs.
+// CPU usage and network traffic are calculated from the delta between two consecutive samples,
+// so a single collector should be reused for the lifetime of the process. The first CPU usage is
+// sampled over the CPU sample interval, so that it reports the current load rather than the
+// average since boot.
+type HardwareCollector struct {
+	HardwareOptions
+	// Power is used to fill in the battery level, if set
+	Power *PowerReader
+	sync.Mutex
+	lastCPU *cpuSample
+	lastNet *netSample
+}
+
+type cpuSample struct {
+	idle  uint64
+	total uint64
+}
+
+type netSample struct {
+	bytes uint64
+	taken time.Time
+}
+
+// NewHardwareCollector returns a new HardwareCollector, falling back to the default
+// procfs and sysfs locations for any root that is not set
+func NewHardwareCollector(opts HardwareOptions) *HardwareCollector {
+	if opts.ProcRoot == "" {
+		opts.ProcRoot = DefaultProcRoot
+	}
+	if opts.SysRoot == "" {
+		opts.SysRoot = DefaultSysRoot
+	}
+	if len(opts.MountPoints) == 0 {
+		opts.MountPoints = []string{"/"}
+	}
+	if opts.CPUSampleInterval <= 0 {
+		opts.CPUSampleInterval = DefaultCPUSampleInterval
+	}
+	return &HardwareCollector{HardwareOptions: opts}
+}
+
+// GetHardwareStatus takes a new sample of the hardware telemetry
+func (h *HardwareCollector) GetHardwareStatus() (types.HardwareStatus, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	status := types.HardwareStatus{}
+
+	cpu, bootTime, err := h.readCPU()
+	if err != nil {
+		return status, err
+	}
+	status.Cpu = cpu
+	status.StartupTime = bootTime
+
+	if status.Ram, err = h.readMemory(); err != nil {
+		return status, err
+	}
+
+	if status.UpTime, err = h.readUptime(); err != nil {
+		return status, err
+	}
+
+	if status.Storage, err = h.readStorage(); err != nil {
+		return status, err
+	}
+
+	if status.NetworkTraffic, err = h.readNetworkTraffic(); err != nil {
+		return status, err
+	}
+
+	// Not every board exposes thermal zones or a routing table, so these are best effort
+	if status.Temperature, err = h.readTemperature(); err != nil {
+		log.WithError(err).Debug("Unable to read temperature")
+	}
+	if status.InternetStatus, err = h.readDefaultRoute(); err != nil {
+		log.WithError(err).Debug("Unable to read routing table")
+	}
+
+	if h.Power != nil {
+		if power, err := h.Power.GetPowerStatus(); err == nil {
+			status.BatteryLevel = power.Capacity
+			status.Power = &power
+		} else if !errors.Is(err, ErrNoPowerSupply) {
+			log.WithError(err).Debug("Unable to read power supply")
+		}
+	}
+
+	return status, nil
+}
+
+// readCPU returns the CPU usage in percent since the previous sample, and the boot time in seconds
+// since epoch. Without a previous sample, the usage is sampled over the CPU sample interval.
+func (h *HardwareCollector) readCPU() (float64, float64, error) {
+	if h.lastCPU == nil {
+		sample, _, err := h.readCPUSample()
+		if err != nil {
+			return 0, 0, err
+		}
+		h.lastCPU = sample
+		time.Sleep(h.CPUSampleInterval)
+	}
+
+	sample, bootTime, err := h.readCPUSample()
+	if err != nil {
+		return 0, 0, err
+	}
+	previous := h.lastCPU
+	h.lastCPU = sample
+
+	totalDelta := sample.total - previous.total
+	if sample.total < previous.total || totalDelta == 0 {
+		return 0, bootTime, nil
+	}
+	idleDelta := sample.idle - previous.idle
+	return 100.0 * float64(totalDelta-idleDelta) / float64(totalDelta), bootTime, nil
+}
+
+// readCPUSample returns the aggregate CPU counters and the boot time in seconds since epoch
+func (h *HardwareCollector) readCPUSample() (*cpuSample, float64, error) {
+	file, err := os.Open(filepath.Join(h.ProcRoot, "stat"))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	var sample *cpuSample
+	var bootTime float64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "cpu":
+			if sample, err = parseCPUSample(fields[1:]); err != nil {
+				return nil, 0, err
+			}
+		case "btime":
+			if bootTime, err = strconv.ParseFloat(fields[1], 64); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	if sample == nil {
+		return nil, 0, fmt.Errorf("no aggregate cpu line found in %s", file.Name())
+	}
+	return sample, bootTime, nil
+}
+
+func parseCPUSample(fields []string) (*cpuSample, error) {
+	sample := &cpuSample{}
+	for i, field := range fields {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		// guest and guest_nice are already accounted for in user and nice
+		if i >= 8 {
+			break
+		}
+		sample.total += value
+		// idle and iowait
+		if i == 3 || i == 4 {
+			sample.idle += value
+		}
+	}
+	return sample, nil
+}
+
+// readMemory returns the RAM usage in percent
+func (h *HardwareCollector) readMemory() (float64, error) {
+	file, err := os.Open(filepath.Join(h.ProcRoot, "meminfo"))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	values := map[string]float64{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		if parsed, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			values[key] = parsed
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	total := values["MemTotal"]
+	if total == 0 {
+		return 0, fmt.Errorf("MemTotal missing from %s", file.Name())
+	}
+	available, found := values["MemAvailable"]
+	if !found {
+		// Kernels older than 3.14 do not report MemAvailable
+		available = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+	return 100.0 * (total - available) / total, nil
+}
+
+// readUptime returns the system uptime in seconds
+func (h *HardwareCollector) readUptime() (float64, error) {
+	data, err := os.ReadFile(filepath.Join(h.ProcRoot, "uptime"))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected uptime format %q", string(data))
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// readStorage returns the combined usage of all configured mount points in percent
+func (h *HardwareCollector) readStorage() (float64, error) {
+	var used, total uint64
+	for _, mountPoint := range h.MountPoints {
+		mountUsed, mountTotal, err := statDisk(mountPoint)
+		if err != nil {
+			return 0, fmt.Errorf("could not stat mount point %q: %w", mountPoint, err)
+		}
+		used += mountUsed
+		total += mountTotal
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	return 100.0 * float64(used) / float64(total), nil
+}
+
+// readTemperature returns the highest temperature reported by any thermal zone in degrees Celsius
+func (h *HardwareCollector) readTemperature() (float64, error) {
+	zones, err := filepath.Glob(filepath.Join(h.SysRoot, "class", "thermal", "thermal_zone*", "temp"))
+	if err != nil {
+		return 0, err
+	}
+	if len(zones) == 0 {
+		return 0, fmt.Errorf("no thermal zones found")
+	}
+
+	highest := 0.0
+	for _, zone := range zones {
+		data, err := os.ReadFile(zone)
+		if err != nil {
+			return 0, err
+		}
+		milliCelsius, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+		if err != nil {
+			return 0, err
+		}
+		if celsius := milliCelsius / 1000.0; celsius > highest {
+			highest = celsius
+		}
+	}
+	return highest, nil
+}
+
+// readNetworkTraffic returns the received and transmitted bytes per second on all
+// non-loopback interfaces since the previous sample
+func (h *HardwareCollector) readNetworkTraffic() (float64, error) {
+	file, err := os.Open(filepath.Join(h.ProcRoot, "net", "dev"))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var bytes uint64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		iface, counters, found := strings.Cut(scanner.Text(), ":")
+		if !found || strings.TrimSpace(iface) == "lo" {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			continue
+		}
+		received, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		transmitted, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		bytes += received + transmitted
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	sample := &netSample{bytes: bytes, taken: time.Now()}
+	previous := h.lastNet
+	h.lastNet = sample
+	if previous == nil || sample.bytes < previous.bytes {
+		return 0, nil
+	}
+
+	elapsed := sample.taken.Sub(previous.taken).Seconds()
+	if elapsed <= 0 {
+		return 0, nil
+	}
+	return float64(sample.bytes-previous.bytes) / elapsed, nil
+}
+
+// readDefaultRoute returns 1 if the host has a default route, and 0 otherwise
+func (h *HardwareCollector) readDefaultRoute() (float64, error) {
+	file, err := os.Open(filepath.Join(h.ProcRoot, "net", "route"))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// Iface Destination Gateway ...
+		if len(fields) > 2 && fields[1] == "00000000" {
+			return 1, nil
+		}
+	}
+	return 0, scanner.Err()
 }
@@ -0,0 +1,137 @@
+package device_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containrrr/watchtower/pkg/device"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the hardware collector", func() {
+	var collector *device.HardwareCollector
+
+	BeforeEach(func() {
+		collector = device.NewHardwareCollector(device.HardwareOptions{
+			ProcRoot:          "testdata/proc",
+			SysRoot:           "testdata/sys",
+			MountPoints:       []string{os.TempDir()},
+			CPUSampleInterval: 10 * time.Millisecond,
+		})
+	})
+
+	It("should populate the status from the fixture files", func() {
+		status, err := collector.GetHardwareStatus()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Ram).To(BeNumerically("~", 25.0, 0.001))
+		Expect(status.UpTime).To(BeNumerically("~", 3600.5, 0.001))
+		Expect(status.StartupTime).To(BeNumerically("==", 1700000000))
+		Expect(status.Temperature).To(BeNumerically("~", 52.5, 0.001))
+		Expect(status.InternetStatus).To(BeNumerically("==", 1))
+		Expect(status.Storage).To(BeNumerically(">", 0))
+		Expect(status.Storage).To(BeNumerically("<=", 100))
+	})
+
+	It("should not report the cpu usage since boot on the first sample", func() {
+		status, err := collector.GetHardwareStatus()
+		Expect(err).NotTo(HaveOccurred())
+		// The counters do not change over the sample interval, although 15% of them are busy since boot
+		Expect(status.Cpu).To(BeNumerically("==", 0))
+	})
+
+	When("taking consecutive samples", func() {
+		var procRoot string
+
+		BeforeEach(func() {
+			var err error
+			procRoot, err = os.MkdirTemp("", "proc")
+			Expect(err).NotTo(HaveOccurred())
+			for _, name := range []string{"stat", "meminfo", "uptime", "net/dev", "net/route"} {
+				data, err := os.ReadFile(filepath.Join("testdata/proc", name))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.MkdirAll(filepath.Dir(filepath.Join(procRoot, name)), 0755)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(procRoot, name), data, 0644)).To(Succeed())
+			}
+			collector.ProcRoot = procRoot
+		})
+		AfterEach(func() {
+			os.RemoveAll(procRoot)
+		})
+
+		It("should calculate the cpu usage from the delta between samples", func() {
+			_, err := collector.GetHardwareStatus()
+			Expect(err).NotTo(HaveOccurred())
+
+			// 750 more busy jiffies and 250 more idle jiffies
+			stat := "cpu  1500 0 750 8200 550 0 0 0 0 0\nbtime 1700000000\n"
+			Expect(os.WriteFile(filepath.Join(procRoot, "stat"), []byte(stat), 0644)).To(Succeed())
+
+			status, err := collector.GetHardwareStatus()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Cpu).To(BeNumerically("~", 75.0, 0.001))
+		})
+
+		It("should sample the first cpu usage over the sample interval", func() {
+			collector.CPUSampleInterval = 500 * time.Millisecond
+			go func() {
+				defer GinkgoRecover()
+				time.Sleep(100 * time.Millisecond)
+				stat := "cpu  1500 0 750 8200 550 0 0 0 0 0\nbtime 1700000000\n"
+				Expect(os.WriteFile(filepath.Join(procRoot, "stat"), []byte(stat), 0644)).To(Succeed())
+			}()
+
+			status, err := collector.GetHardwareStatus()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Cpu).To(BeNumerically("~", 75.0, 0.001))
+		})
+
+		It("should ignore the loopback interface for network traffic", func() {
+			status, err := collector.GetHardwareStatus()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.NetworkTraffic).To(BeNumerically("==", 0))
+
+			dev := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 9999999     100    0    0    0     0          0         0  9999999     100    0    0    0     0       0          0
+  eth0:    5000      10    0    0    0     0          0         0     2000      20    0    0    0     0       0          0
+ wlan0:     500       5    0    0    0     0          0         0      500       5    0    0    0     0       0          0
+`
+			Expect(os.WriteFile(filepath.Join(procRoot, "net/dev"), []byte(dev), 0644)).To(Succeed())
+
+			status, err = collector.GetHardwareStatus()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.NetworkTraffic).To(BeNumerically(">", 0))
+		})
+	})
+
+	When("no thermal zones are available", func() {
+		var sysRoot string
+		BeforeEach(func() {
+			var err error
+			sysRoot, err = os.MkdirTemp("", "sys")
+			Expect(err).NotTo(HaveOccurred())
+		})
+		AfterEach(func() {
+			os.RemoveAll(sysRoot)
+		})
+
+		It("should still report the remaining fields", func() {
+			collector.SysRoot = sysRoot
+			status, err := collector.GetHardwareStatus()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Temperature).To(BeZero())
+			Expect(status.Ram).NotTo(BeZero())
+		})
+	})
+
+	When("a mount point does not exist", func() {
+		It("should return an error", func() {
+			collector.MountPoints = []string{"/this/path/does/not/exist"}
+			_, err := collector.GetHardwareStatus()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,142 @@
+package device
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultMountInfo lists the filesystems mounted in the mount namespace of the supervisor
+const DefaultMountInfo = "/proc/self/mountinfo"
+
+// Mount is a mounted filesystem, as listed in a mountinfo file
+type Mount struct {
+	MountPoint string
+	FSType     string
+	Source     string
+}
+
+// ParseMountInfo reads the mounts of a mountinfo file, see proc(5)
+func ParseMountInfo(r io.Reader) ([]Mount, error) {
+	mounts := []Mount{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		// The optional fields are terminated by a single hyphen, followed by the type and source
+		separator := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+				break
+			}
+		}
+		if len(fields) < 5 || separator < 0 || separator+2 >= len(fields) {
+			return nil, fmt.Errorf("line %d: malformed mountinfo entry", lineNumber)
+		}
+		mounts = append(mounts, Mount{
+			MountPoint: unescapeMountPath(fields[4]),
+			FSType:     fields[separator+1],
+			Source:     unescapeMountPath(fields[separator+2]),
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPath replaces the octal escapes the kernel uses for spaces, tabs, newlines and backslashes
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if value, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// MountSource lists the filesystems mounted below the media roots, e.g. the USB sticks mounted
+// by an automounter. It is a DeviceSource, so that a DeviceWatcher reports media as it is mounted
+// and unmounted. Without a MountInfo file, the directories in the media roots (and the directories
+// in those, for the /media/<user>/<label> layout) are listed instead, for when the media is
+// mounted in a mount namespace the supervisor cannot see.
+type MountSource struct {
+	MountInfo string
+	Roots     []string
+}
+
+// Devices returns the mount points below the media roots
+func (s MountSource) Devices() ([]string, error) {
+	if s.MountInfo == "" {
+		return s.listRoots()
+	}
+
+	file, err := os.Open(s.MountInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	mounts, err := ParseMountInfo(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.MountInfo, err)
+	}
+
+	mountPoints := []string{}
+	for _, mount := range mounts {
+		for _, root := range s.Roots {
+			if isBelow(root, mount.MountPoint) {
+				mountPoints = append(mountPoints, mount.MountPoint)
+				break
+			}
+		}
+	}
+	return mountPoints, nil
+}
+
+func (s MountSource) listRoots() ([]string, error) {
+	directories := []string{}
+	for _, root := range s.Roots {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(root, entry.Name())
+			directories = append(directories, path)
+			children, err := os.ReadDir(path)
+			if err != nil {
+				continue
+			}
+			for _, child := range children {
+				if child.IsDir() {
+					directories = append(directories, filepath.Join(path, child.Name()))
+				}
+			}
+		}
+	}
+	return directories, nil
+}
+
+// isBelow returns whether path is inside, but not the same as, the root directory
+func isBelow(root string, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(path))
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, "../")
+}
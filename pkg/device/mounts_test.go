@@ -0,0 +1,54 @@
+package device_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containrrr/watchtower/pkg/device"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const mountInfo = `22 1 179:2 / / rw,noatime shared:1 - ext4 /dev/root rw
+25 22 0:5 / /dev rw,relatime shared:2 - devtmpfs udev rw,size=1897000k
+120 22 8:1 / /media rw,relatime shared:60 - tmpfs tmpfs rw
+121 120 8:1 / /media/pi/ROBOT\040UPDATE rw,nosuid,nodev,relatime shared:61 - vfat /dev/sda1 rw,fmask=0022
+122 22 8:17 / /mnt/usb rw,relatime shared:62 master:3 - exfat /dev/sdb1 rw
+`
+
+var _ = Describe("the mounted media", func() {
+	It("should parse mountinfo entries", func() {
+		mounts, err := device.ParseMountInfo(strings.NewReader(mountInfo))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mounts).To(HaveLen(5))
+		Expect(mounts[3]).To(Equal(device.Mount{MountPoint: "/media/pi/ROBOT UPDATE", FSType: "vfat", Source: "/dev/sda1"}))
+		Expect(mounts[4]).To(Equal(device.Mount{MountPoint: "/mnt/usb", FSType: "exfat", Source: "/dev/sdb1"}))
+
+		_, err = device.ParseMountInfo(strings.NewReader("22 1 179:2 / / rw\n"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should list the mounts below the media roots", func() {
+		dir, err := os.MkdirTemp("", "mounts")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "mountinfo")
+		Expect(os.WriteFile(path, []byte(mountInfo), 0644)).To(Succeed())
+
+		source := device.MountSource{MountInfo: path, Roots: []string{"/media", "/mnt/"}}
+		Expect(source.Devices()).To(Equal([]string{"/media/pi/ROBOT UPDATE", "/mnt/usb"}))
+	})
+
+	It("should list the directories in the media roots without a mountinfo file", func() {
+		dir, err := os.MkdirTemp("", "media")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		Expect(os.MkdirAll(filepath.Join(dir, "pi", "ROBOT", "nested"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "pi", "file"), nil, 0644)).To(Succeed())
+
+		source := device.MountSource{Roots: []string{dir, filepath.Join(dir, "missing")}}
+		Expect(source.Devices()).To(Equal([]string{filepath.Join(dir, "pi"), filepath.Join(dir, "pi", "ROBOT")}))
+	})
+})
@@ -0,0 +1,333 @@
+package device
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containrrr/watchtower/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	Charging    = "Charging"
+	Discharging = "Discharging"
+	Full        = "Full"
+	NotCharging = "Not charging"
+)
+
+const (
+	PowerSourceSensor = "sensor"
+)
+
+// ErrNoPowerSupply is returned when neither a battery nor a power sensor could be found
+var ErrNoPowerSupply = errors.New("no battery or power sensor found")
+
+// PowerOptions contains the options for where the power reader reads its data from
+type PowerOptions struct {
+	// SysRoot is the mount point of sysfs, used to discover class/power_supply entries
+	SysRoot string
+	// SensorFile is a file containing an INA219-style reading, written by an external sampler.
+	// Each line is a key=value pair, with `voltage` in volts and `current` in amperes
+	// (negative while discharging). When set, it takes precedence over sysfs.
+	SensorFile string
+	// MinVoltage and MaxVoltage are the empty and full voltages of the battery, used to
+	// estimate the charge percentage from a sensor reading
+	MinVoltage float64
+	MaxVoltage float64
+	// BatteryCapacity is the rated capacity of the battery in ampere-hours, used to
+	// estimate the time remaining from a sensor reading
+	BatteryCapacity float64
+}
+
+// Validate returns an error if a sensor file is set without the voltage range needed to
+// estimate the charge of the battery
+func (o PowerOptions) Validate() error {
+	if o.SensorFile != "" && !o.hasVoltageRange() {
+		return fmt.Errorf("the power sensor requires a minimum voltage below the maximum voltage, got %.2fV and %.2fV", o.MinVoltage, o.MaxVoltage)
+	}
+	return nil
+}
+
+func (o PowerOptions) hasVoltageRange() bool {
+	return o.MaxVoltage > o.MinVoltage
+}
+
+// PowerReader reads the state of the power supply powering the device
+type PowerReader struct {
+	PowerOptions
+}
+
+// NewPowerReader returns a new PowerReader, falling back to the default sysfs location if none is set
+func NewPowerReader(opts PowerOptions) *PowerReader {
+	if opts.SysRoot == "" {
+		opts.SysRoot = DefaultSysRoot
+	}
+	return &PowerReader{PowerOptions: opts}
+}
+
+// GetPowerStatus takes a new reading of the power supply
+func (p *PowerReader) GetPowerStatus() (types.PowerStatus, error) {
+	if p.SensorFile != "" {
+		return p.readSensor()
+	}
+
+	batteries, err := p.findBatteries()
+	if err != nil {
+		return types.PowerStatus{}, err
+	}
+	if len(batteries) == 0 {
+		return types.PowerStatus{}, ErrNoPowerSupply
+	}
+	return readPowerSupply(batteries[0])
+}
+
+// findBatteries returns the sysfs directories of all power supplies of type Battery, sorted by name
+func (p *PowerReader) findBatteries() ([]string, error) {
+	supplies, err := filepath.Glob(filepath.Join(p.SysRoot, "class", "power_supply", "*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(supplies)
+
+	batteries := []string{}
+	for _, supply := range supplies {
+		if readString(filepath.Join(supply, "type")) == "Battery" {
+			batteries = append(batteries, supply)
+		}
+	}
+	return batteries, nil
+}
+
+// readPowerSupply reads a single power supply from sysfs, converting the micro units used by the kernel
+func readPowerSupply(dir string) (types.PowerStatus, error) {
+	status := types.PowerStatus{
+		Source: filepath.Base(dir),
+		Status: readString(filepath.Join(dir, "status")),
+	}
+	if status.Status == "" {
+		return status, fmt.Errorf("power supply %q does not report a status", status.Source)
+	}
+
+	voltage, _ := readMicro(filepath.Join(dir, "voltage_now"))
+	current, hasCurrent := readMicro(filepath.Join(dir, "current_now"))
+	power, hasPower := readMicro(filepath.Join(dir, "power_now"))
+	chargeNow, hasCharge := readMicro(filepath.Join(dir, "charge_now"))
+	chargeFull, _ := readMicro(filepath.Join(dir, "charge_full"))
+	energyNow, hasEnergy := readMicro(filepath.Join(dir, "energy_now"))
+	energyFull, _ := readMicro(filepath.Join(dir, "energy_full"))
+
+	status.Voltage = voltage
+	// The sign of current_now is not consistent between drivers, so the status tells the direction
+	status.Current = math.Abs(current)
+	if !hasCurrent && hasPower && voltage > 0 {
+		status.Current = math.Abs(power) / voltage
+	}
+
+	if capacity, found := readFloat(filepath.Join(dir, "capacity")); found {
+		status.Capacity = capacity
+	} else if hasCharge && chargeFull > 0 {
+		status.Capacity = 100.0 * chargeNow / chargeFull
+	} else if hasEnergy && energyFull > 0 {
+		status.Capacity = 100.0 * energyNow / energyFull
+	} else {
+		status.CapacityUnknown = true
+	}
+
+	switch status.Status {
+	case Discharging:
+		if seconds, found := readFloat(filepath.Join(dir, "time_to_empty_now")); found {
+			status.TimeRemaining = seconds
+		} else if hasCharge && status.Current > 0 {
+			status.TimeRemaining = chargeNow / status.Current * 3600
+		} else if hasEnergy && hasPower && power != 0 {
+			status.TimeRemaining = energyNow / math.Abs(power) * 3600
+		}
+	case Charging:
+		if seconds, found := readFloat(filepath.Join(dir, "time_to_full_now")); found {
+			status.TimeRemaining = seconds
+		} else if hasCharge && status.Current > 0 {
+			status.TimeRemaining = (chargeFull - chargeNow) / status.Current * 3600
+		} else if hasEnergy && hasPower && power != 0 {
+			status.TimeRemaining = (energyFull - energyNow) / math.Abs(power) * 3600
+		}
+	}
+
+	return status, nil
+}
+
+// readSensor reads an INA219-style voltage and current reading from the configured sensor file
+func (p *PowerReader) readSensor() (types.PowerStatus, error) {
+	file, err := os.Open(p.SensorFile)
+	if err != nil {
+		return types.PowerStatus{}, err
+	}
+	defer file.Close()
+
+	values := map[string]float64{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return types.PowerStatus{}, fmt.Errorf("invalid sensor value for %q: %w", key, err)
+		}
+		values[strings.TrimSpace(key)] = parsed
+	}
+	if err := scanner.Err(); err != nil {
+		return types.PowerStatus{}, err
+	}
+
+	voltage, found := values["voltage"]
+	if !found {
+		return types.PowerStatus{}, fmt.Errorf("sensor file %q does not contain a voltage", p.SensorFile)
+	}
+	current := values["current"]
+
+	status := types.PowerStatus{
+		Source:  PowerSourceSensor,
+		Voltage: voltage,
+		Current: math.Abs(current),
+	}
+
+	if p.hasVoltageRange() {
+		capacity := 100.0 * (voltage - p.MinVoltage) / (p.MaxVoltage - p.MinVoltage)
+		status.Capacity = math.Max(0, math.Min(100, capacity))
+	} else {
+		status.CapacityUnknown = true
+	}
+
+	switch {
+	case current < 0:
+		status.Status = Discharging
+		if p.BatteryCapacity > 0 && !status.CapacityUnknown {
+			remaining := p.BatteryCapacity * status.Capacity / 100.0
+			status.TimeRemaining = remaining / status.Current * 3600
+		}
+	case current > 0:
+		status.Status = Charging
+		if p.BatteryCapacity > 0 && !status.CapacityUnknown {
+			missing := p.BatteryCapacity * (100.0 - status.Capacity) / 100.0
+			status.TimeRemaining = missing / status.Current * 3600
+		}
+	default:
+		status.Status = NotCharging
+	}
+
+	return status, nil
+}
+
+func readString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readFloat(path string) (float64, bool) {
+	value, err := strconv.ParseFloat(readString(path), 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// readMicro reads a value reported in micro units (µV, µA, µW, µAh, µWh) and converts it to base units
+func readMicro(path string) (float64, bool) {
+	value, found := readFloat(path)
+	return value / 1e6, found
+}
+
+// PowerLevel indicates which battery threshold the device is currently below
+type PowerLevel int
+
+// PowerLevel enum values
+const (
+	PowerLevelNormal PowerLevel = iota
+	PowerLevelLow
+	PowerLevelCritical
+)
+
+// PowerMonitor periodically reads the power supply and sends a notification
+// whenever the battery crosses the low or critical threshold
+type PowerMonitor struct {
+	Reader            *PowerReader
+	Notifier          types.Notifier
+	LowThreshold      float64
+	CriticalThreshold float64
+	level             PowerLevel
+}
+
+// Run checks the power supply once every interval. It never returns.
+func (m *PowerMonitor) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.Check()
+		<-ticker.C
+	}
+}
+
+// Check takes a single reading and notifies if a threshold was crossed since the previous check
+func (m *PowerMonitor) Check() PowerLevel {
+	status, err := m.Reader.GetPowerStatus()
+	if err != nil {
+		if !errors.Is(err, ErrNoPowerSupply) {
+			log.WithError(err).Debug("Unable to read power supply")
+		}
+		return m.level
+	}
+	if status.CapacityUnknown {
+		// Without a capacity reading or a voltage range the charge is unknown, rather than empty
+		return m.level
+	}
+
+	level := PowerLevelNormal
+	if status.Status != Charging && status.Status != Full {
+		if status.Capacity <= m.CriticalThreshold {
+			level = PowerLevelCritical
+		} else if status.Capacity <= m.LowThreshold {
+			level = PowerLevelLow
+		}
+	}
+
+	previous := m.level
+	m.level = level
+	if level <= previous {
+		return level
+	}
+
+	fields := log.Fields{
+		"source":   status.Source,
+		"capacity": fmt.Sprintf("%.0f%%", status.Capacity),
+		"voltage":  fmt.Sprintf("%.2fV", status.Voltage),
+	}
+	if status.TimeRemaining > 0 {
+		fields["remaining"] = (time.Duration(status.TimeRemaining) * time.Second).String()
+	}
+
+	if m.Notifier != nil {
+		m.Notifier.StartNotification()
+	}
+	if level == PowerLevelCritical {
+		log.WithFields(fields).Errorf("Battery is critically low (below %.0f%%)", m.CriticalThreshold)
+	} else {
+		log.WithFields(fields).Warnf("Battery is low (below %.0f%%)", m.LowThreshold)
+	}
+	if m.Notifier != nil {
+		m.Notifier.SendNotification(nil)
+	}
+	return level
+}
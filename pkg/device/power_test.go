@@ -0,0 +1,160 @@
+package device_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/containrrr/watchtower/pkg/device"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the power reader", func() {
+	When("reading a sysfs battery", func() {
+		It("should skip non-battery supplies and convert the micro units", func() {
+			reader := device.NewPowerReader(device.PowerOptions{SysRoot: "testdata/sys"})
+			status, err := reader.GetPowerStatus()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Source).To(Equal("BAT0"))
+			Expect(status.Status).To(Equal(device.Discharging))
+			Expect(status.Voltage).To(BeNumerically("~", 12.0, 0.001))
+			Expect(status.Current).To(BeNumerically("~", 2.0, 0.001))
+			Expect(status.Capacity).To(BeNumerically("~", 50.0, 0.001))
+			// 3Ah left at 2A
+			Expect(status.TimeRemaining).To(BeNumerically("~", 5400, 0.001))
+		})
+	})
+
+	When("no battery is present", func() {
+		It("should return ErrNoPowerSupply", func() {
+			sysRoot, err := os.MkdirTemp("", "sys")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(sysRoot)
+
+			reader := device.NewPowerReader(device.PowerOptions{SysRoot: sysRoot})
+			_, err = reader.GetPowerStatus()
+			Expect(err).To(MatchError(device.ErrNoPowerSupply))
+		})
+	})
+
+	When("reading a power sensor file", func() {
+		var dir, sensorFile string
+		var reader *device.PowerReader
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "power")
+			Expect(err).NotTo(HaveOccurred())
+			sensorFile = filepath.Join(dir, "ina219")
+			reader = device.NewPowerReader(device.PowerOptions{
+				SysRoot:         "testdata/sys",
+				SensorFile:      sensorFile,
+				MinVoltage:      10.0,
+				MaxVoltage:      12.6,
+				BatteryCapacity: 4.0,
+			})
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should estimate the charge from the voltage", func() {
+			Expect(os.WriteFile(sensorFile, []byte("voltage=11.3\ncurrent=-1.0\n"), 0644)).To(Succeed())
+			status, err := reader.GetPowerStatus()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Source).To(Equal(device.PowerSourceSensor))
+			Expect(status.Status).To(Equal(device.Discharging))
+			Expect(status.Capacity).To(BeNumerically("~", 50.0, 0.001))
+			// 2Ah left at 1A
+			Expect(status.TimeRemaining).To(BeNumerically("~", 7200, 0.001))
+		})
+
+		It("should report charging for a positive current", func() {
+			Expect(os.WriteFile(sensorFile, []byte("voltage=12.6\ncurrent=0.5\n"), 0644)).To(Succeed())
+			status, err := reader.GetPowerStatus()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Status).To(Equal(device.Charging))
+			Expect(status.Capacity).To(BeNumerically("~", 100.0, 0.001))
+		})
+
+		It("should fail when the voltage is missing", func() {
+			Expect(os.WriteFile(sensorFile, []byte("current=0.5\n"), 0644)).To(Succeed())
+			_, err := reader.GetPowerStatus()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("the power monitor", func() {
+	var dir, sensorFile string
+	var monitor *device.PowerMonitor
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "power")
+		Expect(err).NotTo(HaveOccurred())
+		sensorFile = filepath.Join(dir, "ina219")
+		monitor = &device.PowerMonitor{
+			Reader: device.NewPowerReader(device.PowerOptions{
+				SensorFile: sensorFile,
+				MinVoltage: 10.0,
+				MaxVoltage: 11.0,
+			}),
+			LowThreshold:      20,
+			CriticalThreshold: 10,
+		}
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	setVoltage := func(voltage string, current string) {
+		data := "voltage=" + voltage + "\ncurrent=" + current + "\n"
+		Expect(os.WriteFile(sensorFile, []byte(data), 0644)).To(Succeed())
+	}
+
+	It("should step through the thresholds as the battery drains", func() {
+		setVoltage("10.5", "-1")
+		Expect(monitor.Check()).To(Equal(device.PowerLevelNormal))
+		setVoltage("10.15", "-1")
+		Expect(monitor.Check()).To(Equal(device.PowerLevelLow))
+		setVoltage("10.05", "-1")
+		Expect(monitor.Check()).To(Equal(device.PowerLevelCritical))
+	})
+
+	It("should reset once the battery is charging", func() {
+		setVoltage("10.05", "-1")
+		Expect(monitor.Check()).To(Equal(device.PowerLevelCritical))
+		setVoltage("10.05", "1")
+		Expect(monitor.Check()).To(Equal(device.PowerLevelNormal))
+	})
+
+	It("should not report a low battery without a voltage range", func() {
+		monitor.Reader = device.NewPowerReader(device.PowerOptions{SensorFile: sensorFile})
+		setVoltage("10.05", "-1")
+		Expect(monitor.Check()).To(Equal(device.PowerLevelNormal))
+	})
+
+	It("should not report a low battery for a battery without a charge reading", func() {
+		battery := filepath.Join(dir, "sys", "class", "power_supply", "BAT0")
+		Expect(os.MkdirAll(battery, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(battery, "type"), []byte("Battery\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(battery, "status"), []byte("Discharging\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(battery, "voltage_now"), []byte("11100000\n"), 0644)).To(Succeed())
+		monitor.Reader = device.NewPowerReader(device.PowerOptions{SysRoot: filepath.Join(dir, "sys")})
+
+		status, err := monitor.Reader.GetPowerStatus()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.CapacityUnknown).To(BeTrue())
+		Expect(monitor.Check()).To(Equal(device.PowerLevelNormal))
+	})
+})
+
+var _ = Describe("the power options", func() {
+	It("should require a voltage range for a sensor file", func() {
+		Expect(device.PowerOptions{SensorFile: "/run/ina219"}.Validate()).To(HaveOccurred())
+		Expect(device.PowerOptions{SensorFile: "/run/ina219", MinVoltage: 10, MaxVoltage: 12.6}.Validate()).To(Succeed())
+		Expect(device.PowerOptions{}.Validate()).To(Succeed())
+	})
+})
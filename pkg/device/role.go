@@ -0,0 +1,42 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RoleSource reads the role of the device, which selects the release channel its containers track.
+// The role file takes precedence over the default role, so that the role can be changed without
+// restarting the supervisor.
+type RoleSource struct {
+	Default string
+	File    string
+}
+
+// Role returns the role of the device
+func (s RoleSource) Role() (string, error) {
+	if s.File != "" {
+		data, err := os.ReadFile(s.File)
+		if err == nil {
+			return ParseRole(string(data))
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	if s.Default == "" {
+		return Develop, nil
+	}
+	return ParseRole(s.Default)
+}
+
+// ParseRole returns the device role with the given name
+func ParseRole(name string) (string, error) {
+	role := strings.ToLower(strings.TrimSpace(name))
+	switch role {
+	case Develop, Nightly, UAT, Prod:
+		return role, nil
+	}
+	return "", fmt.Errorf("unknown device role %q, expected one of %s, %s, %s or %s", name, Develop, Nightly, UAT, Prod)
+}
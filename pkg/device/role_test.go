@@ -0,0 +1,44 @@
+package device_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/containrrr/watchtower/pkg/device"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the device role", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "role")
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should default to develop", func() {
+		role, err := device.RoleSource{}.Role()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(role).To(Equal(device.Develop))
+	})
+
+	It("should prefer the role file over the default role", func() {
+		file := filepath.Join(dir, "role")
+		source := device.RoleSource{Default: "nightly", File: file}
+		Expect(source.Role()).To(Equal(device.Nightly))
+
+		Expect(os.WriteFile(file, []byte("Production\n"), 0644)).To(Succeed())
+		Expect(source.Role()).To(Equal(device.Prod))
+	})
+
+	It("should reject unknown roles", func() {
+		_, err := device.RoleSource{Default: "staging"}.Role()
+		Expect(err).To(HaveOccurred())
+	})
+})
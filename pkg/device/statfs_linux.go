@@ -0,0 +1,16 @@
+package device
+
+import "syscall"
+
+// statDisk returns the used and total bytes of the filesystem mounted at path
+func statDisk(path string) (used uint64, total uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	blockSize := uint64(stat.Bsize)
+	used = (stat.Blocks - stat.Bfree) * blockSize
+	// Mirror df by excluding the blocks reserved for root from the total
+	total = used + stat.Bavail*blockSize
+	return used, total, nil
+}
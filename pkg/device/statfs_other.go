@@ -0,0 +1,10 @@
+//go:build !linux
+
+package device
+
+import "errors"
+
+// statDisk is only supported on linux
+func statDisk(path string) (used uint64, total uint64, err error) {
+	return 0, 0, errors.New("disk statistics are not supported on this platform")
+}
@@ -0,0 +1,125 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Actions of a device event
+const (
+	DeviceAdded   = "add"
+	DeviceRemoved = "remove"
+)
+
+// DeviceEvent is a device that was plugged into or unplugged from the host
+type DeviceEvent struct {
+	Action string    `json:"action"`
+	Device string    `json:"device"`
+	Time   time.Time `json:"time"`
+}
+
+// DeviceSource lists the devices that are currently plugged into the host
+type DeviceSource interface {
+	Devices() ([]string, error)
+}
+
+// SysfsSource lists the devices of a sysfs bus directory, e.g. bus/usb/devices
+type SysfsSource struct {
+	Dir string
+}
+
+// NewUSBSource returns a DeviceSource listing the USB devices, falling back to the default sysfs location if none is set
+func NewUSBSource(sysRoot string) SysfsSource {
+	if sysRoot == "" {
+		sysRoot = DefaultSysRoot
+	}
+	return SysfsSource{Dir: filepath.Join(sysRoot, "bus", "usb", "devices")}
+}
+
+// Devices returns the name of every device in the directory
+func (s SysfsSource) Devices() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		devices = append(devices, entry.Name())
+	}
+	return devices, nil
+}
+
+// DeviceWatcher polls a DeviceSource and reports the devices that were plugged in or unplugged.
+// Changes are only reported once the devices stayed the same for a whole poll, as udev may
+// still be creating the device nodes and symlinks right after a device shows up.
+type DeviceWatcher struct {
+	Source  DeviceSource
+	known   map[string]bool
+	pending []DeviceEvent
+}
+
+// Run checks the devices once every interval and calls handle with every reported change. It never returns.
+func (w *DeviceWatcher) Run(interval time.Duration, handle func([]DeviceEvent)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		events, err := w.Check()
+		if err != nil {
+			log.WithError(err).Debug("Unable to list devices")
+		} else if len(events) > 0 {
+			handle(events)
+		}
+		<-ticker.C
+	}
+}
+
+// Check lists the devices, and returns the changes since the previous checks once the devices
+// have settled. The first check only records the devices that are present.
+func (w *DeviceWatcher) Check() ([]DeviceEvent, error) {
+	devices, err := w.Source.Devices()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(devices)
+
+	current := make(map[string]bool, len(devices))
+	for _, name := range devices {
+		current[name] = true
+	}
+	if w.known == nil {
+		w.known = current
+		return nil, nil
+	}
+
+	now := time.Now()
+	changes := []DeviceEvent{}
+	for _, name := range devices {
+		if !w.known[name] {
+			changes = append(changes, DeviceEvent{Action: DeviceAdded, Device: name, Time: now})
+		}
+	}
+	removed := []string{}
+	for name := range w.known {
+		if !current[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		changes = append(changes, DeviceEvent{Action: DeviceRemoved, Device: name, Time: now})
+	}
+	w.known = current
+
+	if len(changes) > 0 {
+		w.pending = append(w.pending, changes...)
+		return nil, nil
+	}
+	events := w.pending
+	w.pending = nil
+	return events, nil
+}
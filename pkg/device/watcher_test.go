@@ -0,0 +1,75 @@
+package device_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/containrrr/watchtower/pkg/device"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeSource struct {
+	devices []string
+}
+
+func (s *fakeSource) Devices() ([]string, error) {
+	return s.devices, nil
+}
+
+var _ = Describe("the device watcher", func() {
+	var source *fakeSource
+	var watcher *device.DeviceWatcher
+
+	BeforeEach(func() {
+		source = &fakeSource{devices: []string{"1-1", "1-1.2"}}
+		watcher = &device.DeviceWatcher{Source: source}
+	})
+
+	actionsOf := func(events []device.DeviceEvent) []string {
+		output := []string{}
+		for _, event := range events {
+			output = append(output, event.Action+" "+event.Device)
+		}
+		return output
+	}
+
+	It("should only record the devices on the first check", func() {
+		events, err := watcher.Check()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(BeEmpty())
+	})
+
+	It("should report changes once the devices have settled", func() {
+		_, _ = watcher.Check()
+
+		source.devices = []string{"1-1", "1-1.3"}
+		events, err := watcher.Check()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(BeEmpty())
+
+		source.devices = []string{"1-1", "1-1.3", "1-1.4"}
+		events, _ = watcher.Check()
+		Expect(events).To(BeEmpty())
+
+		events, _ = watcher.Check()
+		Expect(actionsOf(events)).To(Equal([]string{"add 1-1.3", "remove 1-1.2", "add 1-1.4"}))
+
+		events, _ = watcher.Check()
+		Expect(events).To(BeEmpty())
+	})
+
+	It("should list the USB devices from sysfs", func() {
+		sysRoot, err := os.MkdirTemp("", "sys")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(sysRoot)
+		usbDir := filepath.Join(sysRoot, "bus", "usb", "devices")
+		Expect(os.MkdirAll(filepath.Join(usbDir, "1-1"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(usbDir, "usb1"), 0755)).To(Succeed())
+
+		devices, err := device.NewUSBSource(sysRoot).Devices()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(devices).To(ConsistOf("1-1", "usb1"))
+	})
+})
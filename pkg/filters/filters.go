@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	t "github.com/containrrr/watchtower/pkg/types"
+	"github.com/distribution/reference"
 )
 
 // WatchtowerContainersFilter filters only watchtower containers
@@ -13,6 +14,20 @@ func WatchtowerContainersFilter(c t.FilterableContainer) bool { return c.IsWatch
 // NoFilter will not filter out any containers
 func NoFilter(t.FilterableContainer) bool { return true }
 
+// FilterByHolds returns all containers that are not held
+func FilterByHolds(holds t.Holds, baseFilter t.Filter) t.Filter {
+	if holds == nil {
+		return baseFilter
+	}
+
+	return func(c t.FilterableContainer) bool {
+		if holds.IsHeld(c.Name()) {
+			return false
+		}
+		return baseFilter(c)
+	}
+}
+
 // FilterByNames returns all containers that match one of the specified names
 func FilterByNames(names []string, baseFilter t.Filter) t.Filter {
 	if len(names) == 0 {
@@ -119,6 +134,62 @@ func FilterByImage(images []string, baseFilter t.Filter) t.Filter {
 	}
 }
 
+// FilterByImageTags returns all containers running one of the image tags. The tags are compared
+// as normalized references, so that "nginx" matches "docker.io/library/nginx:latest".
+func FilterByImageTags(tags []string, baseFilter t.Filter) t.Filter {
+	if tags == nil {
+		return baseFilter
+	}
+	normalized := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		normalized[normalizeImageTag(tag)] = true
+	}
+
+	return func(c t.FilterableContainer) bool {
+		if normalized[normalizeImageTag(c.ImageName())] {
+			return baseFilter(c)
+		}
+		return false
+	}
+}
+
+// FilterByAny returns all containers that match at least one of the filters. No container matches an empty list.
+func FilterByAny(filters []t.Filter, baseFilter t.Filter) t.Filter {
+	return func(c t.FilterableContainer) bool {
+		for _, filter := range filters {
+			if filter(c) {
+				return baseFilter(c)
+			}
+		}
+		return false
+	}
+}
+
+// normalizeImageTag returns the fully qualified reference of the image, or the image itself if it cannot be parsed
+func normalizeImageTag(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return reference.TagNameOnly(named).String()
+}
+
+// FilterByLabel returns all containers that have the label, given as "key" or "key=value"
+func FilterByLabel(label string, baseFilter t.Filter) t.Filter {
+	if label == "" {
+		return baseFilter
+	}
+	key, value, hasValue := strings.Cut(label, "=")
+
+	return func(c t.FilterableContainer) bool {
+		containerValue, found := c.Label(key)
+		if !found || (hasValue && containerValue != value) {
+			return false
+		}
+		return baseFilter(c)
+	}
+}
+
 // BuildFilter creates the needed filter of containers
 func BuildFilter(names []string, disableNames []string, enableLabel bool, scope string) (t.Filter, string) {
 	sb := strings.Builder{}
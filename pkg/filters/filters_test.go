@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/containrrr/watchtower/pkg/container/mocks"
+	"github.com/containrrr/watchtower/pkg/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -215,6 +216,56 @@ func TestFilterByImage(t *testing.T) {
 
 }
 
+func TestFilterByImageTags(t *testing.T) {
+	filter := FilterByImageTags([]string{"registry:5000/robot/base:1.0", "nginx"}, NoFilter)
+	assert.True(t, FilterByImageTags(nil, NoFilter)(new(mocks.FilterableContainer)))
+
+	container := new(mocks.FilterableContainer)
+	container.On("ImageName").Return("registry:5000/robot/base:1.0")
+	assert.True(t, filter(container))
+	container.AssertExpectations(t)
+
+	container = new(mocks.FilterableContainer)
+	container.On("ImageName").Return("registry:5000/robot/base:1.1")
+	assert.False(t, filter(container))
+	container.AssertExpectations(t)
+
+	container = new(mocks.FilterableContainer)
+	container.On("ImageName").Return("docker.io/library/nginx:latest")
+	assert.True(t, filter(container))
+	container.AssertExpectations(t)
+
+	container = new(mocks.FilterableContainer)
+	container.On("ImageName").Return("registry:latest")
+	assert.False(t, filter(container))
+	container.AssertExpectations(t)
+}
+
+func TestFilterByAny(t *testing.T) {
+	filter := FilterByAny([]types.Filter{
+		FilterByNames([]string{"navigation"}, NoFilter),
+		FilterByImageTags([]string{"base:1.0"}, NoFilter),
+	}, NoFilter)
+	assert.False(t, FilterByAny(nil, NoFilter)(new(mocks.FilterableContainer)))
+
+	container := new(mocks.FilterableContainer)
+	container.On("Name").Return("/navigation")
+	assert.True(t, filter(container))
+	container.AssertExpectations(t)
+
+	container = new(mocks.FilterableContainer)
+	container.On("Name").Return("/mapping")
+	container.On("ImageName").Return("base:1.0")
+	assert.True(t, filter(container))
+	container.AssertExpectations(t)
+
+	container = new(mocks.FilterableContainer)
+	container.On("Name").Return("/mapping")
+	container.On("ImageName").Return("base:1.1")
+	assert.False(t, filter(container))
+	container.AssertExpectations(t)
+}
+
 func TestBuildFilter(t *testing.T) {
 	names := []string{"test", "valid"}
 
@@ -331,3 +382,60 @@ func TestBuildFilterDisableContainer(t *testing.T) {
 	assert.False(t, filter(container))
 	container.AssertExpectations(t)
 }
+
+type heldNames []string
+
+func (h heldNames) IsHeld(name string) bool {
+	for _, held := range h {
+		if "/"+held == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFilterByHolds(t *testing.T) {
+	filter := FilterByHolds(nil, nil)
+	assert.Nil(t, filter)
+
+	filter = FilterByHolds(heldNames{"planner"}, NoFilter)
+	assert.NotNil(t, filter)
+
+	container := new(mocks.FilterableContainer)
+	container.On("Name").Return("/planner")
+	assert.False(t, filter(container))
+	container.AssertExpectations(t)
+
+	container = new(mocks.FilterableContainer)
+	container.On("Name").Return("/driver")
+	assert.True(t, filter(container))
+	container.AssertExpectations(t)
+}
+
+func TestFilterByLabel(t *testing.T) {
+	filter := FilterByLabel("", NoFilter)
+	container := new(mocks.FilterableContainer)
+	assert.True(t, filter(container))
+
+	filter = FilterByLabel("robot.role", NoFilter)
+	container = new(mocks.FilterableContainer)
+	container.On("Label", "robot.role").Return("vision", true)
+	assert.True(t, filter(container))
+	container.AssertExpectations(t)
+
+	container = new(mocks.FilterableContainer)
+	container.On("Label", "robot.role").Return("", false)
+	assert.False(t, filter(container))
+	container.AssertExpectations(t)
+
+	filter = FilterByLabel("robot.role=vision", NoFilter)
+	container = new(mocks.FilterableContainer)
+	container.On("Label", "robot.role").Return("vision", true)
+	assert.True(t, filter(container))
+	container.AssertExpectations(t)
+
+	container = new(mocks.FilterableContainer)
+	container.On("Label", "robot.role").Return("arm", true)
+	assert.False(t, filter(container))
+	container.AssertExpectations(t)
+}
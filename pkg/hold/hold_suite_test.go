@@ -0,0 +1,13 @@
+package hold_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestHold(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Hold Suite")
+}
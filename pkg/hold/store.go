@@ -0,0 +1,151 @@
+// Package hold keeps the containers that are held at a specific image, e.g. to freeze a robot
+// at a known version during a trial. Held containers are skipped by updates until released.
+package hold
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containrrr/watchtower/internal/util"
+)
+
+const stateFile = "holds.json"
+
+// ErrNotHeld is returned when releasing or looking up a container that is not held
+var ErrNotHeld = errors.New("container is not held")
+
+// Hold pins a container at an image
+type Hold struct {
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	// Digest is the ID of the image the container is held at
+	Digest    string    `json:"digest"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store persists the holds on disk, so that they survive a restart
+type Store struct {
+	path  string
+	holds map[string]Hold
+	mutex sync.Mutex
+}
+
+// NewStore returns a Store keeping the holds in the given directory
+func NewStore(dir string) (*Store, error) {
+	s := &Store{path: filepath.Join(dir, stateFile), holds: map[string]Hold{}}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	holds := []Hold{}
+	if err := json.Unmarshal(data, &holds); err != nil {
+		return nil, fmt.Errorf("could not parse the holds: %w", err)
+	}
+	for _, hold := range holds {
+		s.holds[hold.Container] = hold
+	}
+	return s, nil
+}
+
+// List returns the holds, ordered by container name
+func (s *Store) List() []Hold {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.list()
+}
+
+// Get returns the hold of the container
+func (s *Store) Get(name string) (Hold, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	hold, found := s.holds[strings.TrimPrefix(name, "/")]
+	if !found {
+		return hold, ErrNotHeld
+	}
+	return hold, nil
+}
+
+// Set holds the container, replacing any previous hold of it
+func (s *Store) Set(hold Hold) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	hold.Container = strings.TrimPrefix(hold.Container, "/")
+	if hold.Container == "" {
+		return errors.New("the container of a hold is required")
+	}
+	if !strings.HasPrefix(hold.Digest, "sha256:") {
+		return fmt.Errorf("the digest of a hold must be an image ID, not %q", hold.Digest)
+	}
+	if hold.CreatedAt.IsZero() {
+		hold.CreatedAt = time.Now()
+	}
+
+	previous, replaced := s.holds[hold.Container]
+	s.holds[hold.Container] = hold
+	if err := s.save(); err != nil {
+		if replaced {
+			s.holds[hold.Container] = previous
+		} else {
+			delete(s.holds, hold.Container)
+		}
+		return err
+	}
+	return nil
+}
+
+// Remove releases the container, so that it is updated again
+func (s *Store) Remove(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	name = strings.TrimPrefix(name, "/")
+	hold, found := s.holds[name]
+	if !found {
+		return ErrNotHeld
+	}
+
+	delete(s.holds, name)
+	if err := s.save(); err != nil {
+		s.holds[name] = hold
+		return err
+	}
+	return nil
+}
+
+// IsHeld returns whether the container with the given name is held
+func (s *Store) IsHeld(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, found := s.holds[strings.TrimPrefix(name, "/")]
+	return found
+}
+
+func (s *Store) list() []Hold {
+	holds := make([]Hold, 0, len(s.holds))
+	for _, hold := range s.holds {
+		holds = append(holds, hold)
+	}
+	sort.Slice(holds, func(i, j int) bool { return holds[i].Container < holds[j].Container })
+	return holds
+}
+
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(s.path, data, 0600)
+}
@@ -0,0 +1,68 @@
+package hold_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/containrrr/watchtower/pkg/hold"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the hold store", func() {
+	var dir string
+	var store *hold.Store
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "hold")
+		Expect(err).NotTo(HaveOccurred())
+		store, err = hold.NewStore(filepath.Join(dir, "state"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should hold no containers before anything is set", func() {
+		Expect(store.List()).To(BeEmpty())
+		Expect(store.IsHeld("planner")).To(BeFalse())
+	})
+
+	It("should keep the holds across restarts", func() {
+		Expect(store.Set(hold.Hold{Container: "/planner", Image: "robot/planner:1.0", Digest: "sha256:abc"})).To(Succeed())
+		Expect(store.IsHeld("/planner")).To(BeTrue())
+
+		reopened, err := hold.NewStore(filepath.Join(dir, "state"))
+		Expect(err).NotTo(HaveOccurred())
+		held, err := reopened.Get("planner")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(held.Digest).To(Equal("sha256:abc"))
+		Expect(held.CreatedAt.IsZero()).To(BeFalse())
+	})
+
+	It("should replace the hold of a container", func() {
+		Expect(store.Set(hold.Hold{Container: "planner", Digest: "sha256:abc"})).To(Succeed())
+		Expect(store.Set(hold.Hold{Container: "planner", Digest: "sha256:def", Reason: "trial"})).To(Succeed())
+		Expect(store.List()).To(HaveLen(1))
+		Expect(store.List()[0].Digest).To(Equal("sha256:def"))
+	})
+
+	It("should release a held container", func() {
+		Expect(store.Set(hold.Hold{Container: "planner", Digest: "sha256:abc"})).To(Succeed())
+		Expect(store.Remove("planner")).To(Succeed())
+		Expect(store.IsHeld("planner")).To(BeFalse())
+		Expect(store.Remove("planner")).To(MatchError(hold.ErrNotHeld))
+	})
+
+	It("should refuse a hold without a container", func() {
+		Expect(store.Set(hold.Hold{Digest: "sha256:abc"})).NotTo(Succeed())
+	})
+
+	It("should refuse a hold that is not at an image ID", func() {
+		Expect(store.Set(hold.Hold{Container: "planner", Digest: "robot/planner:1.0"})).NotTo(Succeed())
+		Expect(store.Set(hold.Hold{Container: "planner"})).NotTo(Succeed())
+		Expect(store.IsHeld("planner")).To(BeFalse())
+	})
+})
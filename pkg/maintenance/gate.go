@@ -0,0 +1,65 @@
+package maintenance
+
+import (
+	"fmt"
+	"time"
+)
+
+// Gate allows updates within the maintenance windows while all the probes report that the robot
+// is idle. Without windows updates are allowed at any time.
+type Gate struct {
+	Windows []Window
+	Probes  []Probe
+	// Now returns the current time, time.Now if not set
+	Now func() time.Time
+}
+
+// Allow returns why updates must be deferred, or nil if they may go ahead. A probe that fails
+// counts as busy, so that containers are never stopped while it is unknown what the robot does.
+func (g *Gate) Allow() error {
+	now := time.Now
+	if g.Now != nil {
+		now = g.Now
+	}
+	if !g.inWindow(now()) {
+		return fmt.Errorf("outside of the maintenance windows %v", g.Windows)
+	}
+
+	for _, probe := range g.Probes {
+		busy, err := probe.Busy()
+		if err != nil {
+			return fmt.Errorf("unable to tell whether the robot is busy (%v): %w", probe, err)
+		}
+		if busy {
+			return fmt.Errorf("the robot is busy (%v)", probe)
+		}
+	}
+	return nil
+}
+
+func (g *Gate) inWindow(t time.Time) bool {
+	if len(g.Windows) == 0 {
+		return true
+	}
+	for _, window := range g.Windows {
+		if window.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextWindow returns when the next maintenance window opens, or the time itself if it falls
+// within a window or there are no windows
+func (g *Gate) NextWindow(t time.Time) time.Time {
+	if g.inWindow(t) {
+		return t
+	}
+	next := time.Time{}
+	for _, window := range g.Windows {
+		if start := window.Next(t); next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	return next
+}
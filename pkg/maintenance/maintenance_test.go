@@ -0,0 +1,135 @@
+package maintenance_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containrrr/watchtower/internal/actions/mocks"
+	"github.com/containrrr/watchtower/pkg/maintenance"
+	"github.com/containrrr/watchtower/pkg/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("maintenance", func() {
+	at := func(hour int, minute int) time.Time {
+		// 2024-01-03 is a Wednesday
+		return time.Date(2024, 1, 3, hour, minute, 30, 0, time.Local)
+	}
+
+	Describe("windows", func() {
+		It("should contain every minute matched by the spec", func() {
+			window, err := maintenance.ParseWindow("* 2-4 * * 1-5")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(window.Contains(at(2, 0))).To(BeTrue())
+			Expect(window.Contains(at(4, 59))).To(BeTrue())
+			Expect(window.Contains(at(5, 0))).To(BeFalse())
+			Expect(window.Contains(at(1, 59))).To(BeFalse())
+		})
+		It("should parse windows separated by semicolons", func() {
+			windows, err := maintenance.ParseWindows("* 2 * * *; 0-29 12 * * 3;")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(windows).To(HaveLen(2))
+			Expect(windows[1].Contains(at(12, 15))).To(BeTrue())
+			Expect(windows[1].Contains(at(12, 45))).To(BeFalse())
+		})
+		It("should reject invalid specs", func() {
+			_, err := maintenance.ParseWindows("* 2 * *; * 25 * * *")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("the gate", func() {
+		It("should only allow updates within the windows", func() {
+			windows, err := maintenance.ParseWindows("* 2-4 * * *")
+			Expect(err).NotTo(HaveOccurred())
+			now := at(3, 0)
+			gate := &maintenance.Gate{Windows: windows, Now: func() time.Time { return now }}
+			Expect(gate.Allow()).To(Succeed())
+			now = at(12, 0)
+			Expect(gate.Allow()).To(MatchError(ContainSubstring("outside of the maintenance windows")))
+		})
+		It("should allow updates at any time without windows", func() {
+			gate := &maintenance.Gate{}
+			Expect(gate.Allow()).To(Succeed())
+		})
+		It("should tell when the next window opens", func() {
+			windows, err := maintenance.ParseWindows("* 2-4 * * *; 0-29 12 * * 3")
+			Expect(err).NotTo(HaveOccurred())
+			gate := &maintenance.Gate{Windows: windows}
+			Expect(gate.NextWindow(at(3, 0))).To(Equal(at(3, 0)))
+			Expect(gate.NextWindow(at(5, 0))).To(Equal(time.Date(2024, 1, 3, 12, 0, 0, 0, time.Local)))
+			Expect(gate.NextWindow(at(13, 0))).To(Equal(time.Date(2024, 1, 4, 2, 0, 0, 0, time.Local)))
+			Expect((&maintenance.Gate{}).NextWindow(at(5, 0))).To(Equal(at(5, 0)))
+		})
+		It("should defer updates while a probe reports the robot as busy", func() {
+			dir, err := os.MkdirTemp("", "maintenance")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			flag := filepath.Join(dir, "busy")
+
+			gate := &maintenance.Gate{Probes: []maintenance.Probe{maintenance.FileProbe{Path: flag}}}
+			Expect(gate.Allow()).To(Succeed())
+			Expect(os.WriteFile(flag, nil, 0644)).To(Succeed())
+			Expect(gate.Allow()).To(MatchError(ContainSubstring("the robot is busy")))
+		})
+	})
+
+	Describe("the HTTP probe", func() {
+		var status int
+		var body string
+		var server *httptest.Server
+		BeforeEach(func() {
+			status, body = http.StatusOK, ""
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(body))
+			}))
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should tell the robot is busy from the status code", func() {
+			probe := maintenance.HTTPProbe{URL: server.URL}
+			Expect(probe.Busy()).To(BeFalse())
+			status = http.StatusServiceUnavailable
+			Expect(probe.Busy()).To(BeTrue())
+		})
+		It("should tell the robot is busy from the JSON body", func() {
+			probe := maintenance.HTTPProbe{URL: server.URL}
+			body = `{"busy": true}`
+			Expect(probe.Busy()).To(BeTrue())
+			body = `{"busy": false}`
+			Expect(probe.Busy()).To(BeFalse())
+		})
+		It("should fail on other responses", func() {
+			status = http.StatusInternalServerError
+			_, err := maintenance.HTTPProbe{URL: server.URL}.Busy()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("the command probe", func() {
+		client := mocks.CreateMockClient(&mocks.TestData{
+			Containers: []types.Container{
+				mocks.CreateMockContainer("arm-id", "/arm", "robot/arm:1.0", time.Now()),
+			},
+		}, false, false)
+
+		It("should tell the robot is busy when the command exits with code 75", func() {
+			probe := maintenance.CommandProbe{Client: client, Container: "arm", Command: "/PreUpdateReturn75.sh"}
+			Expect(probe.Busy()).To(BeTrue())
+			probe.Command = "/PreUpdateReturn0.sh"
+			Expect(probe.Busy()).To(BeFalse())
+		})
+		It("should fail when the container does not exist", func() {
+			_, err := maintenance.CommandProbe{Client: client, Container: "gripper", Command: "/PreUpdateReturn0.sh"}.Busy()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,107 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/containrrr/watchtower/pkg/container"
+)
+
+// Probe tells whether the robot is busy, e.g. because the arm is in motion
+type Probe interface {
+	Busy() (bool, error)
+}
+
+// HTTPProbe asks an endpoint of the robot. It is idle when the endpoint responds with a success
+// status, unless its JSON body has "busy": true, and busy when it responds with 409 Conflict,
+// 423 Locked or 503 Service Unavailable.
+type HTTPProbe struct {
+	URL    string
+	Client *http.Client
+}
+
+func (p HTTPProbe) Busy() (bool, error) {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	res, err := client.Get(p.URL)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusConflict || res.StatusCode == http.StatusLocked || res.StatusCode == http.StatusServiceUnavailable:
+		return true, nil
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		return false, fmt.Errorf("busy probe responded with %q", res.Status)
+	}
+
+	status := struct {
+		Busy bool `json:"busy"`
+	}{}
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<16))
+	if err != nil {
+		return false, err
+	}
+	if json.Unmarshal(body, &status) != nil {
+		// Not a JSON status, the response code is all there is to it
+		return false, nil
+	}
+	return status.Busy, nil
+}
+
+func (p HTTPProbe) String() string {
+	return p.URL
+}
+
+// FileProbe checks a flag file, the robot is busy for as long as it exists
+type FileProbe struct {
+	Path string
+}
+
+func (p FileProbe) Busy() (bool, error) {
+	_, err := os.Stat(p.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (p FileProbe) String() string {
+	return p.Path
+}
+
+// CommandProbe executes a command in a container of the robot. It is busy when the command exits
+// with code 75 (EX_TEMPFAIL), like a pre-update command skipping an update, and idle when it succeeds.
+type CommandProbe struct {
+	Client    container.Client
+	Container string
+	Command   string
+	// Timeout is how many minutes the command may run
+	Timeout int
+}
+
+func (p CommandProbe) Busy() (bool, error) {
+	c, err := p.Client.GetContainerByName(p.Container)
+	if err != nil {
+		return false, err
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = 1
+	}
+	return p.Client.ExecuteCommand(c.ID(), p.Command, timeout)
+}
+
+func (p CommandProbe) String() string {
+	return fmt.Sprintf("%s in %s", p.Command, p.Container)
+}
@@ -0,0 +1,59 @@
+// Package maintenance decides when containers may be stopped for an update: only within the
+// maintenance windows of the robot, and only while it reports that it is idle.
+package maintenance
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+// Window is a period in which updates are allowed, given as a standard five field cron spec that
+// matches every minute of it, e.g. "* 2-4 * * 1-5" for 02:00 to 04:59 on weekdays
+type Window struct {
+	spec     string
+	schedule cron.Schedule
+}
+
+// ParseWindow parses a maintenance window
+func ParseWindow(spec string) (Window, error) {
+	spec = strings.TrimSpace(spec)
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid maintenance window %q: %w", spec, err)
+	}
+	return Window{spec: spec, schedule: schedule}, nil
+}
+
+// ParseWindows parses maintenance windows separated by semicolons
+func ParseWindows(specs string) ([]Window, error) {
+	windows := []Window{}
+	for _, spec := range strings.Split(specs, ";") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		window, err := ParseWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// Contains returns whether the time falls within the window
+func (w Window) Contains(t time.Time) bool {
+	minute := t.Truncate(time.Minute)
+	return w.schedule.Next(minute.Add(-time.Second)).Equal(minute)
+}
+
+// Next returns the start of the next period of the window after the time
+func (w Window) Next(t time.Time) time.Time {
+	return w.schedule.Next(t)
+}
+
+func (w Window) String() string {
+	return w.spec
+}
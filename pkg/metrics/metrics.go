@@ -31,7 +31,8 @@ func NewMetric(report types.Report) *Metric {
 		Scanned: len(report.Scanned()),
 		// Note: This is for backwards compatibility. ideally, stale containers should be counted separately
 		Updated: len(report.Updated()) + len(report.Stale()),
-		Failed:  len(report.Failed()),
+		// Rolled back containers failed to update, even if they are running again
+		Failed: len(report.Failed()) + len(report.RolledBack()),
 	}
 }
 
@@ -6,18 +6,27 @@ var commonTemplates = map[string]string{
 	`default`: `
 {{- if .Report -}}
   {{- with .Report -}}
-    {{- if ( or .Updated .Failed ) -}}
-{{len .Scanned}} Scanned, {{len .Updated}} Updated, {{len .Failed}} Failed
+    {{- if ( or .Updated .Failed .RolledBack .Deferred ) -}}
+{{len .Scanned}} Scanned, {{len .Updated}} Updated, {{len .Failed}} Failed{{with .RolledBack}}, {{len .}} Rolled back{{end}}{{with .Deferred}}, {{len .}} Deferred{{end}}
       {{- range .Updated}}
 - {{.Name}} ({{.ImageName}}): {{.CurrentImageID.ShortID}} updated to {{.LatestImageID.ShortID}}
       {{- end -}}
       {{- range .Fresh}}
 - {{.Name}} ({{.ImageName}}): {{.State}}
 	  {{- end -}}
+      {{- range .Held}}
+- {{.Name}} ({{.ImageName}}): {{.State}} at {{.CurrentImageID.ShortID}}
+	  {{- end -}}
 	  {{- range .Skipped}}
 - {{.Name}} ({{.ImageName}}): {{.State}}: {{.Error}}
 	  {{- end -}}
 	  {{- range .Failed}}
+- {{.Name}} ({{.ImageName}}): {{.State}}: {{.Error}}
+	  {{- end -}}
+	  {{- range .RolledBack}}
+- {{.Name}} ({{.ImageName}}): {{.State}} to {{.CurrentImageID.ShortID}}: {{.Error}}
+	  {{- end -}}
+	  {{- range .Deferred}}
 - {{.Name}} ({{.ImageName}}): {{.State}}: {{.Error}}
 	  {{- end -}}
     {{- end -}}
@@ -88,6 +88,9 @@ var _ = Describe("JSON template", func() {
 				"state": "Skipped"
 			}
 		],
+		"deferred": [],
+		"held": [],
+		"rolledBack": [],
 		"stale": [],
 		"updated": [
 			{
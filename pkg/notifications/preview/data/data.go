@@ -47,7 +47,7 @@ func (pb *previewData) AddFromState(state State) {
 	name := pb.generateName()
 	image := pb.generateImageName(name)
 	var err error
-	if state == FailedState {
+	if state == FailedState || state == RolledBackState || state == DeferredState {
 		err = errors.New(pb.randomEntry(errorMessages))
 	} else if state == SkippedState {
 		err = errors.New(pb.randomEntry(skippedMessages))
@@ -80,6 +80,12 @@ func (pb *previewData) addContainer(c containerStatus) {
 		pb.report.stale = append(pb.report.stale, &c)
 	case FreshState:
 		pb.report.fresh = append(pb.report.fresh, &c)
+	case RolledBackState:
+		pb.report.rolledBack = append(pb.report.rolledBack, &c)
+	case HeldState:
+		pb.report.held = append(pb.report.held, &c)
+	case DeferredState:
+		pb.report.deferred = append(pb.report.deferred, &c)
 	default:
 		return
 	}
@@ -10,12 +10,15 @@ import (
 type State string
 
 const (
-	ScannedState State = "scanned"
-	UpdatedState State = "updated"
-	FailedState  State = "failed"
-	SkippedState State = "skipped"
-	StaleState   State = "stale"
-	FreshState   State = "fresh"
+	ScannedState    State = "scanned"
+	UpdatedState    State = "updated"
+	FailedState     State = "failed"
+	SkippedState    State = "skipped"
+	StaleState      State = "stale"
+	FreshState      State = "fresh"
+	RolledBackState State = "rolledback"
+	HeldState       State = "held"
+	DeferredState   State = "deferred"
 )
 
 // StatesFromString parses a string of state characters and returns a slice of the corresponding report states
@@ -35,6 +38,12 @@ func StatesFromString(str string) []State {
 			states = append(states, StaleState)
 		case 'f':
 			states = append(states, FreshState)
+		case 'r':
+			states = append(states, RolledBackState)
+		case 'h':
+			states = append(states, HeldState)
+		case 'd':
+			states = append(states, DeferredState)
 		default:
 			continue
 		}
@@ -43,12 +52,15 @@ func StatesFromString(str string) []State {
 }
 
 type report struct {
-	scanned []types.ContainerReport
-	updated []types.ContainerReport
-	failed  []types.ContainerReport
-	skipped []types.ContainerReport
-	stale   []types.ContainerReport
-	fresh   []types.ContainerReport
+	scanned    []types.ContainerReport
+	updated    []types.ContainerReport
+	failed     []types.ContainerReport
+	skipped    []types.ContainerReport
+	stale      []types.ContainerReport
+	fresh      []types.ContainerReport
+	rolledBack []types.ContainerReport
+	held       []types.ContainerReport
+	deferred   []types.ContainerReport
 }
 
 func (r *report) Scanned() []types.ContainerReport {
@@ -70,8 +82,20 @@ func (r *report) Fresh() []types.ContainerReport {
 	return r.fresh
 }
 
+func (r *report) RolledBack() []types.ContainerReport {
+	return r.rolledBack
+}
+
+func (r *report) Held() []types.ContainerReport {
+	return r.held
+}
+
+func (r *report) Deferred() []types.ContainerReport {
+	return r.deferred
+}
+
 func (r *report) All() []types.ContainerReport {
-	allLen := len(r.scanned) + len(r.updated) + len(r.failed) + len(r.skipped) + len(r.stale) + len(r.fresh)
+	allLen := len(r.scanned) + len(r.updated) + len(r.failed) + len(r.skipped) + len(r.stale) + len(r.fresh) + len(r.rolledBack) + len(r.held) + len(r.deferred)
 	all := make([]types.ContainerReport, 0, allLen)
 
 	presentIds := map[types.ContainerID][]string{}
@@ -88,6 +112,9 @@ func (r *report) All() []types.ContainerReport {
 
 	appendUnique(r.updated)
 	appendUnique(r.failed)
+	appendUnique(r.rolledBack)
+	appendUnique(r.held)
+	appendUnique(r.deferred)
 	appendUnique(r.skipped)
 	appendUnique(r.stale)
 	appendUnique(r.fresh)
@@ -254,6 +254,31 @@ updt1 (mock/updt1:latest): Updated
 					Expect(getTemplatedResult(``, false, data)).To(Equal(expected))
 				})
 			})
+			When("a container was rolled back", func() {
+				It("should send a report", func() {
+					expected := `1 Scanned, 0 Updated, 0 Failed, 1 Rolled back
+- roll1 (mock/roll1:latest): RolledBack to 01d510000000: container became unhealthy`
+					data := mockDataFromStates(s.RolledBackState)
+					Expect(getTemplatedResult(``, false, data)).To(Equal(expected))
+				})
+			})
+			When("a container is held", func() {
+				It("should list it as held instead of fresh", func() {
+					expected := `2 Scanned, 1 Updated, 0 Failed
+- updt1 (mock/updt1:latest): 01d110000000 updated to d0a110000000
+- hold1 (mock/hold1:latest): Held at 01d610000000`
+					data := mockDataFromStates(s.UpdatedState, s.HeldState)
+					Expect(getTemplatedResult(``, false, data)).To(Equal(expected))
+				})
+			})
+			When("an update is deferred", func() {
+				It("should list the deferred containers with the reason", func() {
+					expected := `1 Scanned, 0 Updated, 0 Failed, 1 Deferred
+- dfrd1 (mock/dfrd1:latest): Deferred: the robot is busy`
+					data := mockDataFromStates(s.DeferredState)
+					Expect(getTemplatedResult(``, false, data)).To(Equal(expected))
+				})
+			})
 			When("the report is nil", func() {
 				It("should return the logged entries", func() {
 					expected := `The situation is under control
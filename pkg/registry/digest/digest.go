@@ -23,41 +23,60 @@ const ContentDigestHeader = "Docker-Content-Digest"
 
 // CompareDigest ...
 func CompareDigest(container types.Container, registryAuth string) (bool, error) {
-	if !container.HasImageInfo() {
-		return false, errors.New("container image info missing")
+	digest, err := FetchDigest(container, registryAuth)
+	if err != nil {
+		return false, err
 	}
+	return MatchesDigest(container.ImageInfo().RepoDigests, digest), nil
+}
 
-	var digest string
+// FetchDigest returns the digest the registry reports for the image of the container
+func FetchDigest(container types.Container, registryAuth string) (string, error) {
+	if !container.HasImageInfo() {
+		return "", errors.New("container image info missing")
+	}
 
 	registryAuth = TransformAuth(registryAuth)
 	token, err := auth.GetToken(container, registryAuth)
 	if err != nil {
-		return false, err
+		return "", err
 	}
 
 	digestURL, err := manifest.BuildManifestURL(container)
 	if err != nil {
-		return false, err
+		return "", err
 	}
 
-	if digest, err = GetDigest(digestURL, token); err != nil {
-		return false, err
+	digest, err := GetDigest(digestURL, token)
+	if err != nil {
+		return "", err
 	}
 
 	logrus.WithField("remote", digest).Debug("Found a remote digest to compare with")
+	return digest, nil
+}
 
-	for _, dig := range container.ImageInfo().RepoDigests {
-		localDigest := strings.Split(dig, "@")[1]
+// MatchesDigest returns whether one of the repo digests of an image, e.g. "alpine@sha256:...", is the digest
+func MatchesDigest(repoDigests []string, digest string) bool {
+	for _, dig := range repoDigests {
+		localDigest := LocalDigest(dig)
 		fields := logrus.Fields{"local": localDigest, "remote": digest}
 		logrus.WithFields(fields).Debug("Comparing")
 
 		if localDigest == digest {
 			logrus.Debug("Found a match")
-			return true, nil
+			return true
 		}
 	}
+	return false
+}
 
-	return false, nil
+// LocalDigest returns the digest part of a repo digest
+func LocalDigest(repoDigest string) string {
+	if i := strings.Index(repoDigest, "@"); i >= 0 {
+		return repoDigest[i+1:]
+	}
+	return repoDigest
 }
 
 // TransformAuth from a base64 encoded json object to base64 encoded string
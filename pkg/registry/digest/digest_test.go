@@ -83,6 +83,15 @@ var _ = Describe("Digests", func() {
 			Expect(matches).To(Equal(false))
 		})
 	})
+	When("matching a remote digest", func() {
+		It("should compare it to the digest part of the repo digests", func() {
+			remote := digest.LocalDigest(mockDigest)
+			Expect(remote).To(HavePrefix("sha256:"))
+			Expect(digest.MatchesDigest([]string{"alpine@sha256:0000", mockDigest}, remote)).To(BeTrue())
+			Expect(digest.MatchesDigest([]string{"alpine@sha256:0000"}, remote)).To(BeFalse())
+			Expect(digest.MatchesDigest(nil, remote)).To(BeFalse())
+		})
+	})
 	When("using different registries", func() {
 		It("should work with DockerHub",
 			SkipIfCredentialsEmpty(DockerHubCredentials, func() {
@@ -43,3 +43,19 @@ func BuildManifestURL(container types.Container) (string, error) {
 	}
 	return url.String(), nil
 }
+
+// BuildTagsURL returns the url listing the tags of the repository of the container image
+func BuildTagsURL(container types.Container) (string, error) {
+	normalizedRef, err := ref.ParseDockerRef(container.ImageName())
+	if err != nil {
+		return "", err
+	}
+
+	host, _ := helpers.GetRegistryAddress(normalizedRef.Name())
+	url := url2.URL{
+		Scheme: "https",
+		Host:   host,
+		Path:   fmt.Sprintf("/v2/%s/tags/list", ref.Path(normalizedRef)),
+	}
+	return url.String(), nil
+}
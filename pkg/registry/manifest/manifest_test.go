@@ -57,6 +57,18 @@ var _ = Describe("the manifest module", func() {
 			Expect(URL).To(BeEmpty())
 		})
 	})
+	Describe("BuildTagsURL", func() {
+		It("should return the tag list of the repository of the image", func() {
+			URL, err := buildMockContainerTagsURL("ghcr.io/containrrr/watchtower:1.4.2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(URL).To(Equal("https://ghcr.io/v2/containrrr/watchtower/tags/list"))
+		})
+		It("should prepend library/ for official images on Docker Hub", func() {
+			URL, err := buildMockContainerTagsURL("alpine:3.18")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(URL).To(Equal("https://index.docker.io/v2/library/alpine/tags/list"))
+		})
+	})
 })
 
 func buildMockContainerManifestURL(imageRef string) (string, error) {
@@ -72,3 +84,8 @@ func buildMockContainerManifestURL(imageRef string) (string, error) {
 
 	return manifest.BuildManifestURL(mock)
 }
+
+func buildMockContainerTagsURL(imageRef string) (string, error) {
+	mock := mocks.CreateMockContainerWithImageInfo("mock-id", "mock-container", imageRef, time.Now(), apiTypes.ImageInspect{})
+	return manifest.BuildTagsURL(mock)
+}
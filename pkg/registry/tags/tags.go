@@ -0,0 +1,118 @@
+// Package tags lists the tags of image repositories in a registry
+package tags
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	url2 "net/url"
+	"strings"
+	"time"
+
+	"github.com/containrrr/watchtower/internal/meta"
+	"github.com/containrrr/watchtower/pkg/registry/auth"
+	"github.com/containrrr/watchtower/pkg/registry/digest"
+	"github.com/containrrr/watchtower/pkg/registry/manifest"
+	"github.com/containrrr/watchtower/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// maxPages limits how many pages of tags are followed for a single repository
+const maxPages = 50
+
+type tagList struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// ListTags returns the tags of the repository of the container image
+func ListTags(container types.Container, registryAuth string) ([]string, error) {
+	registryAuth = digest.TransformAuth(registryAuth)
+	token, err := auth.GetToken(container, registryAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	tagsURL, err := manifest.BuildTagsURL(container)
+	if err != nil {
+		return nil, err
+	}
+	return GetTags(tagsURL, token)
+}
+
+// GetTags fetches the tag list at the url, following the pages the registry splits it into
+func GetTags(url string, token string) ([]string, error) {
+	if token == "" {
+		return nil, errors.New("could not fetch token")
+	}
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	tags := []string{}
+	for page := 0; url != ""; page++ {
+		if page == maxPages {
+			return nil, fmt.Errorf("the tag list has more than %d pages", maxPages)
+		}
+		list, next, err := getPage(client, url, token)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, list.Tags...)
+		url = next
+	}
+	return tags, nil
+}
+
+// getPage fetches a page of the tag list, and returns the url of the next one, if any
+func getPage(client *http.Client, url string, token string) (tagList, string, error) {
+	list := tagList{}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return list, "", err
+	}
+	req.Header.Set("User-Agent", meta.UserAgent)
+	req.Header.Add("Authorization", token)
+	req.Header.Add("Accept", "application/json")
+
+	logrus.WithField("url", url).Debug("Doing a GET request to list the tags")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return list, "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return list, "", fmt.Errorf("registry responded to tag list request with %q", res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		return list, "", fmt.Errorf("could not parse the tag list: %w", err)
+	}
+
+	next, err := nextPage(req.URL, res.Header.Get("Link"))
+	return list, next, err
+}
+
+// nextPage returns the url of the next page from a link header like
+// </v2/robot/planner/tags/list?last=1.4.2&n=100>; rel="next", relative to the current page
+func nextPage(current *url2.URL, link string) (string, error) {
+	if link == "" {
+		return "", nil
+	}
+	target, params, _ := strings.Cut(link, ";")
+	if !strings.Contains(strings.ReplaceAll(params, " ", ""), `rel="next"`) {
+		return "", nil
+	}
+	next, err := current.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+	if err != nil {
+		return "", fmt.Errorf("invalid link to the next page of tags: %w", err)
+	}
+	return next.String(), nil
+}
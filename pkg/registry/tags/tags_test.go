@@ -0,0 +1,68 @@
+package tags_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/containrrr/watchtower/pkg/registry/tags"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+func TestTags(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tags Suite")
+}
+
+var _ = Describe("Tags", func() {
+	var server *ghttp.Server
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+
+	When("listing the tags of a repository", func() {
+		It("should return the tags with the request token", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/v2/robot/planner/tags/list"),
+					ghttp.VerifyHeader(http.Header{"Authorization": []string{"Bearer token"}}),
+					ghttp.RespondWith(http.StatusOK, `{"name":"robot/planner","tags":["1.4.2","1.4.7","1.5.0"]}`),
+				),
+			)
+			list, err := tags.GetTags(server.URL()+"/v2/robot/planner/tags/list", "Bearer token")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(Equal([]string{"1.4.2", "1.4.7", "1.5.0"}))
+		})
+		It("should follow the pages of the list", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/v2/robot/planner/tags/list"),
+					ghttp.RespondWith(http.StatusOK, `{"name":"robot/planner","tags":["1.4.2"]}`, http.Header{
+						"Link": []string{`</v2/robot/planner/tags/list?last=1.4.2&n=1>; rel="next"`},
+					}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/v2/robot/planner/tags/list", "last=1.4.2&n=1"),
+					ghttp.RespondWith(http.StatusOK, `{"name":"robot/planner","tags":["1.4.7"]}`),
+				),
+			)
+			list, err := tags.GetTags(server.URL()+"/v2/robot/planner/tags/list", "Bearer token")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(Equal([]string{"1.4.2", "1.4.7"}))
+		})
+		It("should return an error if the registry refuses the request", func() {
+			server.AppendHandlers(ghttp.RespondWith(http.StatusUnauthorized, ""))
+			_, err := tags.GetTags(server.URL()+"/v2/robot/planner/tags/list", "Bearer token")
+			Expect(err).To(HaveOccurred())
+		})
+		It("should return an error without a token", func() {
+			_, err := tags.GetTags(server.URL()+"/v2/robot/planner/tags/list", "")
+			Expect(err).To(HaveOccurred())
+			Expect(server.ReceivedRequests()).To(BeEmpty())
+		})
+	})
+})
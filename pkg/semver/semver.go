@@ -0,0 +1,144 @@
+// Package semver selects image tags by semantic version, so that containers can follow the newest
+// patch or minor release of an image instead of a moving tag.
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a MAJOR.MINOR.PATCH version parsed from an image tag
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// ParseVersion parses a tag like 1.4.2 or v1.4, where missing parts are zero. Tags with a
+// pre-release or build suffix, e.g. 1.5.0-rc1, are not versions the policies select.
+func ParseVersion(tag string) (Version, error) {
+	parts := strings.Split(strings.TrimPrefix(tag, "v"), ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("%q is not a version", tag)
+	}
+	numbers := [3]int{}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 || part != strconv.Itoa(number) {
+			return Version{}, fmt.Errorf("%q is not a version", tag)
+		}
+		numbers[i] = number
+	}
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}, nil
+}
+
+// Compare returns -1, 0 or 1 when the version is lower than, equal to or higher than the other
+func (v Version) Compare(other Version) int {
+	for _, diff := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if diff < 0 {
+			return -1
+		} else if diff > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Constraint is a version policy
+type Constraint struct {
+	min Version
+	// fixed is how many leading parts of min a matching version must share
+	fixed int
+}
+
+// ParseConstraint parses a version policy:
+//   - ~1.4 or ~1.4.2 allow newer patch releases of 1.4
+//   - ^1.4.2 allows newer minor and patch releases of 1
+//   - 1.4, 1.4.x and 1 allow any release starting with these parts
+//   - * allows any release
+func ParseConstraint(policy string) (Constraint, error) {
+	policy = strings.TrimSpace(policy)
+	switch {
+	case policy == "*" || policy == "x":
+		return Constraint{}, nil
+	case strings.HasPrefix(policy, "~"):
+		v, parts, err := parsePartial(policy[1:])
+		if err != nil {
+			return Constraint{}, err
+		}
+		if parts < 2 {
+			return Constraint{min: v, fixed: 1}, nil
+		}
+		return Constraint{min: v, fixed: 2}, nil
+	case strings.HasPrefix(policy, "^"):
+		v, _, err := parsePartial(policy[1:])
+		if err != nil {
+			return Constraint{}, err
+		}
+		return Constraint{min: v, fixed: 1}, nil
+	default:
+		v, parts, err := parsePartial(policy)
+		if err != nil {
+			return Constraint{}, err
+		}
+		return Constraint{min: v, fixed: parts}, nil
+	}
+}
+
+// parsePartial parses a version whose missing or wildcard parts are zero, and returns how many
+// parts were given
+func parsePartial(value string) (Version, int, error) {
+	parts := strings.Split(value, ".")
+	given := len(parts)
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			given = i
+			break
+		}
+	}
+	v, err := ParseVersion(strings.Join(parts[:given], "."))
+	if err != nil || given == 0 {
+		return v, 0, fmt.Errorf("invalid version policy %q", value)
+	}
+	return v, given, nil
+}
+
+// Matches returns whether the version is allowed by the policy
+func (c Constraint) Matches(v Version) bool {
+	if v.Compare(c.min) < 0 {
+		return false
+	}
+	current := []int{v.Major, v.Minor, v.Patch}
+	required := []int{c.min.Major, c.min.Minor, c.min.Patch}
+	for i := 0; i < c.fixed && i < 3; i++ {
+		if current[i] != required[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Latest returns the tag of the highest version allowed by the policy, if it is higher than the
+// version of the current tag. Tags that are not versions are ignored.
+func (c Constraint) Latest(tags []string, current string) (string, bool) {
+	best, err := ParseVersion(current)
+	if err != nil {
+		return "", false
+	}
+	latest := ""
+	for _, tag := range tags {
+		v, err := ParseVersion(tag)
+		if err != nil || !c.Matches(v) {
+			continue
+		}
+		if v.Compare(best) > 0 {
+			best, latest = v, tag
+		}
+	}
+	return latest, latest != ""
+}
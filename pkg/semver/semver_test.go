@@ -0,0 +1,75 @@
+package semver_test
+
+import (
+	"github.com/containrrr/watchtower/pkg/semver"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("semantic versions", func() {
+	tags := []string{"latest", "1.4.2", "1.4.7", "1.4.10", "1.5.0", "1.6.0-rc1", "2.0.0", "v1.4.9"}
+
+	Describe("ParseVersion", func() {
+		It("should parse partial and prefixed versions", func() {
+			Expect(semver.ParseVersion("v1.4")).To(Equal(semver.Version{Major: 1, Minor: 4}))
+			Expect(semver.ParseVersion("1.4.2")).To(Equal(semver.Version{Major: 1, Minor: 4, Patch: 2}))
+		})
+		It("should not parse other tags", func() {
+			for _, tag := range []string{"latest", "1.6.0-rc1", "1.4.2.1", "01.4", ""} {
+				_, err := semver.ParseVersion(tag)
+				Expect(err).To(HaveOccurred(), tag)
+			}
+		})
+	})
+
+	Describe("Latest", func() {
+		It("should select the highest patch release for a tilde policy", func() {
+			c, err := semver.ParseConstraint("~1.4")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(latest(c, tags, "1.4.2")).To(Equal("1.4.10"))
+		})
+		It("should select the highest minor release for a caret policy", func() {
+			c, err := semver.ParseConstraint("^1.4.2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(latest(c, tags, "1.4.2")).To(Equal("1.5.0"))
+		})
+		It("should select the highest release matching a wildcard policy", func() {
+			c, err := semver.ParseConstraint("1.x")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(latest(c, tags, "1.4.2")).To(Equal("1.5.0"))
+
+			c, err = semver.ParseConstraint("*")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(latest(c, tags, "1.4.2")).To(Equal("2.0.0"))
+		})
+		It("should not select anything when the current tag is the highest match", func() {
+			c, err := semver.ParseConstraint("~1.4")
+			Expect(err).NotTo(HaveOccurred())
+			_, found := c.Latest(tags, "1.4.10")
+			Expect(found).To(BeFalse())
+		})
+		It("should not select anything when the current tag is not a version", func() {
+			c, err := semver.ParseConstraint("~1.4")
+			Expect(err).NotTo(HaveOccurred())
+			_, found := c.Latest(tags, "latest")
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Describe("ParseConstraint", func() {
+		It("should reject invalid policies", func() {
+			for _, policy := range []string{"", "~", "^latest", "1.4.2.1", ">=1.4"} {
+				_, err := semver.ParseConstraint(policy)
+				Expect(err).To(HaveOccurred(), policy)
+			}
+		})
+	})
+})
+
+// latest returns the tag selected by the constraint, or an empty string if there is none
+func latest(c semver.Constraint, tags []string, current string) string {
+	tag, found := c.Latest(tags, current)
+	Expect(found).To(Equal(tag != ""))
+	return tag
+}
@@ -15,6 +15,9 @@ const (
 	FailedState
 	FreshState
 	StaleState
+	RolledBackState
+	HeldState
+	DeferredState
 )
 
 // ContainerStatus contains the container state during a session
@@ -76,6 +79,12 @@ func (u *ContainerStatus) State() string {
 		return "Fresh"
 	case StaleState:
 		return "Stale"
+	case RolledBackState:
+		return "RolledBack"
+	case HeldState:
+		return "Held"
+	case DeferredState:
+		return "Deferred"
 	default:
 		return "Unknown"
 	}
@@ -31,6 +31,11 @@ func (m Progress) AddScanned(cont types.Container, newImage types.ImageID) {
 	m.Add(UpdateFromContainer(cont, newImage, ScannedState))
 }
 
+// AddHeld adds a container to the Progress with the state set as held
+func (m Progress) AddHeld(cont types.Container) {
+	m.Add(UpdateFromContainer(cont, cont.SafeImageID(), HeldState))
+}
+
 // UpdateFailed updates the containers passed, setting their state as failed with the supplied error
 func (m Progress) UpdateFailed(failures map[types.ContainerID]error) {
 	for id, err := range failures {
@@ -40,13 +45,36 @@ func (m Progress) UpdateFailed(failures map[types.ContainerID]error) {
 	}
 }
 
+// UpdateRolledBack updates the containers passed, setting their state as rolled back with the
+// supplied reason for the rollback
+func (m Progress) UpdateRolledBack(rollbacks map[types.ContainerID]error) {
+	for id, err := range rollbacks {
+		update := m[id]
+		update.error = err
+		update.state = RolledBackState
+	}
+}
+
+// UpdateDeferred updates the containers passed, setting their state as deferred with the supplied
+// reason why they could not be updated yet
+func (m Progress) UpdateDeferred(deferrals map[types.ContainerID]error) {
+	for id, err := range deferrals {
+		update := m[id]
+		update.error = err
+		update.state = DeferredState
+	}
+}
+
 // Add a container to the map using container ID as the key
 func (m Progress) Add(update *ContainerStatus) {
 	m[update.containerID] = update
 }
 
-// MarkForUpdate marks the container identified by containerID for update
+// MarkForUpdate marks the container identified by containerID for update, unless it is held
 func (m Progress) MarkForUpdate(containerID types.ContainerID) {
+	if m[containerID].state == HeldState {
+		return
+	}
 	m[containerID].state = UpdatedState
 }
 
@@ -7,12 +7,15 @@ import (
 )
 
 type report struct {
-	scanned []types.ContainerReport
-	updated []types.ContainerReport
-	failed  []types.ContainerReport
-	skipped []types.ContainerReport
-	stale   []types.ContainerReport
-	fresh   []types.ContainerReport
+	scanned    []types.ContainerReport
+	updated    []types.ContainerReport
+	failed     []types.ContainerReport
+	skipped    []types.ContainerReport
+	stale      []types.ContainerReport
+	fresh      []types.ContainerReport
+	rolledBack []types.ContainerReport
+	held       []types.ContainerReport
+	deferred   []types.ContainerReport
 }
 
 func (r *report) Scanned() []types.ContainerReport {
@@ -33,8 +36,17 @@ func (r *report) Stale() []types.ContainerReport {
 func (r *report) Fresh() []types.ContainerReport {
 	return r.fresh
 }
+func (r *report) RolledBack() []types.ContainerReport {
+	return r.rolledBack
+}
+func (r *report) Held() []types.ContainerReport {
+	return r.held
+}
+func (r *report) Deferred() []types.ContainerReport {
+	return r.deferred
+}
 func (r *report) All() []types.ContainerReport {
-	allLen := len(r.scanned) + len(r.updated) + len(r.failed) + len(r.skipped) + len(r.stale) + len(r.fresh)
+	allLen := len(r.scanned) + len(r.updated) + len(r.failed) + len(r.skipped) + len(r.stale) + len(r.fresh) + len(r.rolledBack) + len(r.held) + len(r.deferred)
 	all := make([]types.ContainerReport, 0, allLen)
 
 	presentIds := map[types.ContainerID][]string{}
@@ -51,6 +63,9 @@ func (r *report) All() []types.ContainerReport {
 
 	appendUnique(r.updated)
 	appendUnique(r.failed)
+	appendUnique(r.rolledBack)
+	appendUnique(r.held)
+	appendUnique(r.deferred)
 	appendUnique(r.skipped)
 	appendUnique(r.stale)
 	appendUnique(r.fresh)
@@ -64,12 +79,15 @@ func (r *report) All() []types.ContainerReport {
 // NewReport creates a types.Report from the supplied Progress
 func NewReport(progress Progress) types.Report {
 	report := &report{
-		scanned: []types.ContainerReport{},
-		updated: []types.ContainerReport{},
-		failed:  []types.ContainerReport{},
-		skipped: []types.ContainerReport{},
-		stale:   []types.ContainerReport{},
-		fresh:   []types.ContainerReport{},
+		scanned:    []types.ContainerReport{},
+		updated:    []types.ContainerReport{},
+		failed:     []types.ContainerReport{},
+		skipped:    []types.ContainerReport{},
+		stale:      []types.ContainerReport{},
+		fresh:      []types.ContainerReport{},
+		rolledBack: []types.ContainerReport{},
+		held:       []types.ContainerReport{},
+		deferred:   []types.ContainerReport{},
 	}
 
 	for _, update := range progress {
@@ -79,6 +97,10 @@ func NewReport(progress Progress) types.Report {
 		}
 
 		report.scanned = append(report.scanned, update)
+		if update.state == HeldState {
+			report.held = append(report.held, update)
+			continue
+		}
 		if update.newImage == update.oldImage {
 			update.state = FreshState
 			report.fresh = append(report.fresh, update)
@@ -90,6 +112,10 @@ func NewReport(progress Progress) types.Report {
 			report.updated = append(report.updated, update)
 		case FailedState:
 			report.failed = append(report.failed, update)
+		case RolledBackState:
+			report.rolledBack = append(report.rolledBack, update)
+		case DeferredState:
+			report.deferred = append(report.deferred, update)
 		default:
 			update.state = StaleState
 			report.stale = append(report.stale, update)
@@ -102,6 +128,9 @@ func NewReport(progress Progress) types.Report {
 	sort.Sort(sortableContainers(report.skipped))
 	sort.Sort(sortableContainers(report.stale))
 	sort.Sort(sortableContainers(report.fresh))
+	sort.Sort(sortableContainers(report.rolledBack))
+	sort.Sort(sortableContainers(report.held))
+	sort.Sort(sortableContainers(report.deferred))
 
 	return report
 }
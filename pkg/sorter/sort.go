@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/containrrr/watchtower/pkg/container"
 	"github.com/containrrr/watchtower/pkg/types"
 )
 
@@ -36,73 +37,86 @@ func (c ByCreated) Less(i, j int) bool {
 // of their dependencies. This sort order ensures that linked containers can
 // be started in the correct order.
 func SortByDependencies(containers []types.Container) ([]types.Container, error) {
-	sorter := dependencySorter{}
-	return sorter.Sort(containers)
-}
+	names := make([]string, len(containers))
+	for i, c := range containers {
+		names[i] = c.Name()
+	}
+	order, err := sortByDependencies(names, func(i int) []string { return containers[i].Links() })
+	if err != nil {
+		return nil, err
+	}
 
-type dependencySorter struct {
-	unvisited []types.Container
-	marked    map[string]bool
-	sorted    []types.Container
+	sorted := make([]types.Container, 0, len(order))
+	for _, i := range order {
+		sorted = append(sorted, containers[i])
+	}
+	return sorted, nil
 }
 
-func (ds *dependencySorter) Sort(containers []types.Container) ([]types.Container, error) {
-	ds.unvisited = containers
-	ds.marked = map[string]bool{}
-
-	for len(ds.unvisited) > 0 {
-		if err := ds.visit(ds.unvisited[0]); err != nil {
-			return nil, err
-		}
+// SortServicesByDependencies will sort the list of compose services so that every
+// service comes after all of the services it depends on. Dependencies that are not
+// part of the list are ignored.
+func SortServicesByDependencies(services []container.Service) ([]container.Service, error) {
+	names := make([]string, len(services))
+	for i, s := range services {
+		names[i] = s.Name
+	}
+	order, err := sortByDependencies(names, func(i int) []string { return services[i].DependsOn })
+	if err != nil {
+		return nil, err
 	}
 
-	return ds.sorted, nil
+	sorted := make([]container.Service, 0, len(order))
+	for _, i := range order {
+		sorted = append(sorted, services[i])
+	}
+	return sorted, nil
 }
 
-func (ds *dependencySorter) visit(c types.Container) error {
-
-	if _, ok := ds.marked[c.Name()]; ok {
-		return fmt.Errorf("circular reference to %s", c.Name())
+// sortByDependencies returns the order in which every node comes after the nodes it depends on, as
+// indices into the names of the nodes. Dependencies on names that are not in the list are ignored.
+// The nodes keep their order as far as their dependencies allow it.
+func sortByDependencies(names []string, dependencies func(i int) []string) ([]int, error) {
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		if _, found := index[name]; !found {
+			index[name] = i
+		}
 	}
 
-	// Mark any visited node so that circular references can be detected
-	ds.marked[c.Name()] = true
-	defer delete(ds.marked, c.Name())
+	visited := make([]bool, len(names))
+	// marked are the nodes whose dependencies are being visited, so that circular references can be detected
+	marked := make([]bool, len(names))
+	sorted := make([]int, 0, len(names))
 
-	// Recursively visit links
-	for _, linkName := range c.Links() {
-		if linkedContainer := ds.findUnvisited(linkName); linkedContainer != nil {
-			if err := ds.visit(*linkedContainer); err != nil {
-				return err
+	var visit func(i int) error
+	visit = func(i int) error {
+		if marked[i] {
+			return fmt.Errorf("circular reference to %s", names[i])
+		}
+		marked[i] = true
+		defer func() { marked[i] = false }()
+
+		for _, dependency := range dependencies(i) {
+			if j, found := index[dependency]; found && !visited[j] {
+				if err := visit(j); err != nil {
+					return err
+				}
 			}
 		}
-	}
-
-	// Move container from unvisited to sorted
-	ds.removeUnvisited(c)
-	ds.sorted = append(ds.sorted, c)
-
-	return nil
-}
 
-func (ds *dependencySorter) findUnvisited(name string) *types.Container {
-	for _, c := range ds.unvisited {
-		if c.Name() == name {
-			return &c
-		}
+		visited[i] = true
+		sorted = append(sorted, i)
+		return nil
 	}
 
-	return nil
-}
-
-func (ds *dependencySorter) removeUnvisited(c types.Container) {
-	var idx int
-	for i := range ds.unvisited {
-		if ds.unvisited[i].Name() == c.Name() {
-			idx = i
-			break
+	for i := range names {
+		if visited[i] {
+			continue
+		}
+		if err := visit(i); err != nil {
+			return nil, err
 		}
 	}
-
-	ds.unvisited = append(ds.unvisited[0:idx], ds.unvisited[idx+1:]...)
+	return sorted, nil
 }
@@ -0,0 +1,111 @@
+package sorter_test
+
+import (
+	"time"
+
+	"github.com/containrrr/watchtower/internal/actions/mocks"
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/sorter"
+	"github.com/containrrr/watchtower/pkg/types"
+	dockerContainer "github.com/docker/docker/api/types/container"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the sorter", func() {
+	Describe("SortByDependencies", func() {
+		linked := func(name string, dependsOn string) types.Container {
+			labels := map[string]string{}
+			if dependsOn != "" {
+				labels["com.centurylinklabs.watchtower.depends-on"] = dependsOn
+			}
+			return mocks.CreateMockContainerWithConfig(name, "/"+name, "image:latest", true, false, time.Now(),
+				&dockerContainer.Config{Labels: labels})
+		}
+		names := func(containers []types.Container) []string {
+			var names []string
+			for _, c := range containers {
+				names = append(names, c.Name())
+			}
+			return names
+		}
+
+		It("should sort containers after the containers they depend on", func() {
+			sorted, err := sorter.SortByDependencies([]types.Container{
+				linked("web", "api"),
+				linked("api", "db"),
+				linked("db", ""),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(names(sorted)).To(Equal([]string{"/db", "/api", "/web"}))
+		})
+		It("should ignore dependencies on containers that are not in the list", func() {
+			sorted, err := sorter.SortByDependencies([]types.Container{
+				linked("web", "proxy"),
+				linked("db", ""),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(names(sorted)).To(Equal([]string{"/web", "/db"}))
+		})
+		It("should fail on circular references", func() {
+			_, err := sorter.SortByDependencies([]types.Container{
+				linked("web", "api"),
+				linked("api", "web"),
+			})
+			Expect(err).To(MatchError("circular reference to /web"))
+		})
+	})
+
+	Describe("SortServicesByDependencies", func() {
+		names := func(services []container.Service) []string {
+			var names []string
+			for _, s := range services {
+				names = append(names, s.Name)
+			}
+			return names
+		}
+
+		It("should sort services after the services they depend on", func() {
+			sorted, err := sorter.SortServicesByDependencies([]container.Service{
+				{Name: "web", DependsOn: []string{"api", "cache"}},
+				{Name: "cache"},
+				{Name: "api", DependsOn: []string{"db"}},
+				{Name: "db"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(names(sorted)).To(Equal([]string{"db", "api", "cache", "web"}))
+		})
+		It("should keep the order of services without dependencies", func() {
+			sorted, err := sorter.SortServicesByDependencies([]container.Service{
+				{Name: "b"},
+				{Name: "a"},
+				{Name: "c"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(names(sorted)).To(Equal([]string{"b", "a", "c"}))
+		})
+		It("should ignore dependencies on services that are not in the list", func() {
+			sorted, err := sorter.SortServicesByDependencies([]container.Service{
+				{Name: "web", DependsOn: []string{"external"}},
+				{Name: "db"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(names(sorted)).To(Equal([]string{"web", "db"}))
+		})
+		It("should fail on circular dependencies", func() {
+			_, err := sorter.SortServicesByDependencies([]container.Service{
+				{Name: "a", DependsOn: []string{"c"}},
+				{Name: "b", DependsOn: []string{"a"}},
+				{Name: "c", DependsOn: []string{"b"}},
+			})
+			Expect(err).To(MatchError("circular reference to a"))
+		})
+		It("should fail on services depending on themselves", func() {
+			_, err := sorter.SortServicesByDependencies([]container.Service{
+				{Name: "a", DependsOn: []string{"a"}},
+			})
+			Expect(err).To(MatchError("circular reference to a"))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package sorter_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSorter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Sorter Suite")
+}
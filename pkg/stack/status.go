@@ -0,0 +1,20 @@
+package stack
+
+// Sync states of a service
+const (
+	// StatusInSync means the container matches the stored service definition
+	StatusInSync = "in-sync"
+	// StatusDrifted means the container exists, but its configuration or state differs from the definition
+	StatusDrifted = "drifted"
+	// StatusMissing means the service should be running, but it has no container
+	StatusMissing = "missing"
+)
+
+// ServiceStatus describes how a single service compares to its stored definition
+type ServiceStatus struct {
+	Service   string   `json:"service"`
+	Container string   `json:"container,omitempty"`
+	Action    string   `json:"action"`
+	Status    string   `json:"status"`
+	Drift     []string `json:"drift,omitempty"`
+}
@@ -0,0 +1,145 @@
+package stack
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/containrrr/watchtower/internal/util"
+	"github.com/containrrr/watchtower/pkg/container"
+)
+
+const stateFile = "stack.json"
+
+// State is the last applied definition of the stack
+type State struct {
+	Services []container.Service `json:"services"`
+	Networks []container.Network `json:"networks"`
+	Volumes  []container.Volume  `json:"volumes"`
+}
+
+// Store persists the last applied stack definition on disk, so that it survives a restart
+type Store struct {
+	path string
+	sync.Mutex
+}
+
+// NewStore returns a new Store keeping its state in the given directory
+func NewStore(dir string) *Store {
+	return &Store{path: filepath.Join(dir, stateFile)}
+}
+
+// Load returns the stored state, which is empty if nothing has been applied yet
+func (s *Store) Load() (State, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.load()
+}
+
+// Save replaces the stored state
+func (s *Store) Save(state State) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.save(state)
+}
+
+// Merge adds the services, networks and volumes to the store, replacing any stored entry with the same name
+func (s *Store) Merge(update State) (State, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	state, err := s.load()
+	if err != nil {
+		return state, err
+	}
+
+	serviceIndex := map[string]int{}
+	for i, service := range state.Services {
+		serviceIndex[service.Name] = i
+	}
+	for _, service := range update.Services {
+		if i, found := serviceIndex[service.Name]; found {
+			state.Services[i] = service
+		} else {
+			serviceIndex[service.Name] = len(state.Services)
+			state.Services = append(state.Services, service)
+		}
+	}
+
+	networkIndex := map[string]int{}
+	for i, network := range state.Networks {
+		networkIndex[network.Name] = i
+	}
+	for _, network := range update.Networks {
+		if i, found := networkIndex[network.Name]; found {
+			state.Networks[i] = network
+		} else {
+			networkIndex[network.Name] = len(state.Networks)
+			state.Networks = append(state.Networks, network)
+		}
+	}
+
+	volumeIndex := map[string]int{}
+	for i, volume := range state.Volumes {
+		volumeIndex[volume.Name] = i
+	}
+	for _, volume := range update.Volumes {
+		if i, found := volumeIndex[volume.Name]; found {
+			state.Volumes[i] = volume
+		} else {
+			volumeIndex[volume.Name] = len(state.Volumes)
+			state.Volumes = append(state.Volumes, volume)
+		}
+	}
+
+	return state, s.save(state)
+}
+
+// SetServiceImage replaces the image of the stored service, e.g. once its container was moved to
+// the image of another release channel. Services that are not stored are ignored.
+func (s *Store) SetServiceImage(service string, image string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	state, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range state.Services {
+		if state.Services[i].Name != service {
+			continue
+		}
+		if state.Services[i].Image == image {
+			return nil
+		}
+		state.Services[i].Image = image
+		return s.save(state)
+	}
+	return nil
+}
+
+func (s *Store) load() (State, error) {
+	state := State{}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+func (s *Store) save(state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(s.path, data, 0600)
+}
@@ -0,0 +1,79 @@
+package stack_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/containrrr/watchtower/pkg/container"
+	"github.com/containrrr/watchtower/pkg/stack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the stack store", func() {
+	var dir string
+	var store *stack.Store
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "stack")
+		Expect(err).NotTo(HaveOccurred())
+		store = stack.NewStore(filepath.Join(dir, "state"))
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should return no services before anything is saved", func() {
+		state, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Services).To(BeEmpty())
+	})
+
+	It("should load the saved state", func() {
+		saved := stack.State{
+			Services: []container.Service{{Name: "api", Image: "api:1", Environment: []string{"A=1"}}},
+			Networks: []container.Network{{Name: "backend", Driver: "bridge"}},
+			Volumes:  []container.Volume{{Name: "maps", Driver: "local"}},
+		}
+		Expect(store.Save(saved)).To(Succeed())
+
+		loaded, err := stack.NewStore(filepath.Join(dir, "state")).Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.Services).To(HaveLen(1))
+		Expect(loaded.Services[0].Image).To(Equal("api:1"))
+		Expect(loaded.Services[0].Environment).To(Equal([]string{"A=1"}))
+		Expect(loaded.Networks).To(Equal(saved.Networks))
+		Expect(loaded.Volumes).To(Equal(saved.Volumes))
+	})
+
+	It("should replace services with the same name when merging", func() {
+		Expect(store.Save(stack.State{
+			Services: []container.Service{{Name: "api", Image: "api:1"}, {Name: "db", Image: "db:1"}},
+		})).To(Succeed())
+
+		merged, err := store.Merge(stack.State{
+			Services: []container.Service{{Name: "api", Image: "api:2"}, {Name: "cache", Image: "cache:1"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged.Services).To(HaveLen(3))
+		Expect(merged.Services[0].Image).To(Equal("api:2"))
+		Expect(merged.Services[1].Image).To(Equal("db:1"))
+		Expect(merged.Services[2].Image).To(Equal("cache:1"))
+	})
+	It("should replace the image of a stored service", func() {
+		Expect(store.Save(stack.State{
+			Services: []container.Service{{Name: "api", Image: "api:stable"}, {Name: "db", Image: "db:1"}},
+		})).To(Succeed())
+
+		Expect(store.SetServiceImage("api", "api:nightly")).To(Succeed())
+		Expect(store.SetServiceImage("missing", "missing:1")).To(Succeed())
+
+		state, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Services).To(HaveLen(2))
+		Expect(state.Services[0].Image).To(Equal("api:nightly"))
+		Expect(state.Services[1].Image).To(Equal("db:1"))
+	})
+})
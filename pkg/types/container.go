@@ -66,6 +66,11 @@ type Container interface {
 	GetLifecyclePostUpdateCommand() string
 	VerifyConfiguration() error
 	SetStale(bool)
+	SetChannel(string)
+	ChannelTags() map[string]string
+	SetVersionTag(string)
+	VersionPolicy() string
+	Label(name string) (string, bool)
 	IsStale() bool
 	IsNoPull(UpdateParams) bool
 	SetLinkedToRestarting(bool)
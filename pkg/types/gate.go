@@ -0,0 +1,15 @@
+package types
+
+import "time"
+
+// UpdateGate tells whether containers may be stopped for an update right now
+type UpdateGate interface {
+	// Allow returns why updates must be deferred, or nil if they may go ahead
+	Allow() error
+}
+
+// WindowSchedule tells when updates deferred outside of the maintenance windows may go ahead
+type WindowSchedule interface {
+	// NextWindow returns when the next maintenance window opens, or the time itself if it falls within one
+	NextWindow(t time.Time) time.Time
+}
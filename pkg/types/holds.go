@@ -0,0 +1,6 @@
+package types
+
+// Holds tells which containers are held at their current image, and must not be updated
+type Holds interface {
+	IsHeld(name string) bool
+}
@@ -0,0 +1,14 @@
+package types
+
+// PowerStatus is a reading of the power supply powering the device
+type PowerStatus struct {
+	Source        string  `json:"source"`
+	Capacity      float64 `json:"capacity"`
+	Voltage       float64 `json:"voltage"`
+	Current       float64 `json:"current"`
+	Status        string  `json:"status"`
+	TimeRemaining float64 `json:"time_remaining"`
+	// CapacityUnknown is set when the power supply does not tell its charge, e.g. a battery without
+	// capacity, charge or energy readings. The capacity is 0 then, rather than empty.
+	CapacityUnknown bool `json:"capacity_unknown,omitempty"`
+}
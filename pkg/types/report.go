@@ -8,6 +8,9 @@ type Report interface {
 	Skipped() []ContainerReport
 	Stale() []ContainerReport
 	Fresh() []ContainerReport
+	RolledBack() []ContainerReport
+	Held() []ContainerReport
+	Deferred() []ContainerReport
 	All() []ContainerReport
 }
 
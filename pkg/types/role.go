@@ -0,0 +1,6 @@
+package types
+
+// RoleSource reads the role of the device, which selects the release channel its containers track
+type RoleSource interface {
+	Role() (string, error)
+}
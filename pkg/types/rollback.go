@@ -0,0 +1,23 @@
+package types
+
+// RolledBackImages remembers the images that updated containers were rolled back from
+type RolledBackImages interface {
+	// IsRolledBack returns whether the container was rolled back from the image
+	IsRolledBack(container string, image ImageID) bool
+	// AddRolledBack records that the container was rolled back from the image
+	AddRolledBack(container string, image ImageID) error
+}
+
+// UpdatedContainer is a container that was recreated from a newer image
+type UpdatedContainer struct {
+	// Previous is the container before the update
+	Previous Container
+	// ID is the ID of the recreated container
+	ID ContainerID
+}
+
+// RollbackWatcher watches updated containers for the rollback grace period after the update
+// returned, and rolls back the ones that fail within it
+type RollbackWatcher interface {
+	Watch(updated []UpdatedContainer, params UpdateParams)
+}
@@ -0,0 +1,7 @@
+package types
+
+// StackImages keeps the images of the stack services in step with the images of their containers
+type StackImages interface {
+	// SetServiceImage records the image the container of the service was recreated from
+	SetServiceImage(service string, image string) error
+}
@@ -11,8 +11,28 @@ type UpdateParams struct {
 	NoRestart       bool
 	Timeout         time.Duration
 	MonitorOnly     bool
-	NoPull			bool
+	NoPull          bool
 	LifecycleHooks  bool
 	RollingRestart  bool
 	LabelPrecedence bool
+	// RollbackGracePeriod is how long updated containers are watched before they are considered
+	// healthy. Containers failing within it are rolled back to their previous image, unless it is zero.
+	RollbackGracePeriod time.Duration
+	// RolledBack are the images containers are not updated to again, as they were rolled back from them, if set
+	RolledBack RolledBackImages
+	// Rollbacks watches the updated containers in the background, if set. Otherwise the update
+	// waits for the grace period, and reports the containers it rolled back.
+	Rollbacks RollbackWatcher
+	// Holds are the containers that are not updated, if set
+	Holds Holds
+	// Roles selects the image tags of the containers tracking a release channel, if set
+	Roles RoleSource
+	// VersionTags are the image tags of the containers following a semantic version policy, by
+	// container name. Containers that are not in it look their tag up in the registry.
+	VersionTags map[string]string
+	// Stack records the images of the stack service containers moved to another tag, if set, so
+	// that the stack reconciler does not recreate them from the tag of their service definition
+	Stack StackImages
+	// Gate defers the updates while it does not allow containers to be stopped, if set
+	Gate UpdateGate
 }
@@ -0,0 +1,15 @@
+package types
+
+// UpdateStatus is the result of checking the registry for a newer image of a container
+type UpdateStatus struct {
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	// LocalDigest is the digest of the image the container is running
+	LocalDigest string `json:"local_digest"`
+	// RemoteDigest is the digest the registry reports for the image name
+	RemoteDigest    string `json:"remote_digest"`
+	UpdateAvailable bool   `json:"update_available"`
+	// Downloaded is whether the newer image has already been pulled, so that the update can be applied
+	Downloaded bool   `json:"downloaded"`
+	Error      string `json:"error,omitempty"`
+}
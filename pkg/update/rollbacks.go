@@ -0,0 +1,67 @@
+package update
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/containrrr/watchtower/internal/util"
+	"github.com/containrrr/watchtower/pkg/types"
+)
+
+const rollbacksFile = "rollbacks.json"
+
+// Rollbacks remembers the image every container was last rolled back from, so that the container
+// is not updated to the same failing image again. The container is updated again once the registry
+// has a newer image.
+type Rollbacks struct {
+	path   string
+	images map[string]types.ImageID
+	mutex  sync.Mutex
+}
+
+// NewRollbacks returns the Rollbacks kept in the given directory
+func NewRollbacks(dir string) (*Rollbacks, error) {
+	r := &Rollbacks{path: filepath.Join(dir, rollbacksFile), images: map[string]types.ImageID{}}
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &r.images); err != nil {
+		return nil, fmt.Errorf("could not parse the rolled back images: %w", err)
+	}
+	return r, nil
+}
+
+// IsRolledBack returns whether the container was rolled back from the image
+func (r *Rollbacks) IsRolledBack(container string, image types.ImageID) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	rolledBack, found := r.images[strings.TrimPrefix(container, "/")]
+	return found && image != "" && rolledBack == image
+}
+
+// AddRolledBack records that the container was rolled back from the image
+func (r *Rollbacks) AddRolledBack(container string, image types.ImageID) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.images[strings.TrimPrefix(container, "/")] = image
+	return r.save()
+}
+
+func (r *Rollbacks) save() error {
+	data, err := json.MarshalIndent(r.images, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(r.path, data, 0600)
+}
@@ -0,0 +1,38 @@
+package update_test
+
+import (
+	"os"
+
+	"github.com/containrrr/watchtower/pkg/update"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the rolled back images", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "rollbacks")
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should remember the last image every container was rolled back from across restarts", func() {
+		rollbacks, err := update.NewRollbacks(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rollbacks.AddRolledBack("/planner", "sha256:first")).To(Succeed())
+		Expect(rollbacks.AddRolledBack("planner", "sha256:second")).To(Succeed())
+
+		rollbacks, err = update.NewRollbacks(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rollbacks.IsRolledBack("planner", "sha256:second")).To(BeTrue())
+		Expect(rollbacks.IsRolledBack("/planner", "sha256:second")).To(BeTrue())
+		Expect(rollbacks.IsRolledBack("planner", "sha256:first")).To(BeFalse())
+		Expect(rollbacks.IsRolledBack("driver", "sha256:second")).To(BeFalse())
+		Expect(rollbacks.IsRolledBack("planner", "")).To(BeFalse())
+	})
+})
@@ -0,0 +1,159 @@
+// Package update keeps track of the progress of an update, from checking the registry to applying
+// the downloaded images, on disk. This way the supervisor still knows which images are staged after
+// a reboot, and updates can be applied whenever the operator approves them.
+package update
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/containrrr/watchtower/internal/util"
+)
+
+const stateFile = "update.json"
+
+// Phases of an update
+const (
+	PhaseIdle        = "idle"
+	PhaseChecking    = "checking"
+	PhaseDownloading = "downloading"
+	PhaseDownloaded  = "downloaded"
+	PhaseApplying    = "applying"
+	PhaseVerifying   = "verifying"
+	PhaseDone        = "done"
+	PhaseRolledBack  = "rolled-back"
+	PhaseFailed      = "failed"
+)
+
+// transitions are the phases an update can move to from each phase. An update that is deferred
+// while applying goes back to downloaded, until it is applied again.
+var transitions = map[string][]string{
+	PhaseIdle:        {PhaseChecking},
+	PhaseChecking:    {PhaseIdle, PhaseDownloading, PhaseDownloaded},
+	PhaseDownloading: {PhaseIdle, PhaseDownloaded},
+	PhaseDownloaded:  {PhaseChecking, PhaseApplying},
+	PhaseApplying:    {PhaseVerifying, PhaseFailed, PhaseDownloaded},
+	PhaseVerifying:   {PhaseDone, PhaseRolledBack, PhaseFailed},
+	PhaseDone:        {PhaseChecking, PhaseIdle},
+	PhaseRolledBack:  {PhaseChecking, PhaseIdle},
+	PhaseFailed:      {PhaseChecking, PhaseIdle},
+}
+
+// ErrInvalidTransition is returned when an update cannot move to a phase from its current phase
+var ErrInvalidTransition = errors.New("invalid update transition")
+
+// StagedImage is a downloaded image that waits to be applied to a container
+type StagedImage struct {
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	// CurrentID is the image the container is running
+	CurrentID string `json:"current_id"`
+	// StagedID is the downloaded image the container is updated to
+	StagedID string `json:"staged_id"`
+}
+
+// State is the progress of the current update
+type State struct {
+	Phase  string        `json:"phase"`
+	Staged []StagedImage `json:"staged"`
+	// Error is why the update last failed, if it did
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Machine moves an update through its phases, persisting every transition
+type Machine struct {
+	path  string
+	state State
+	mutex sync.Mutex
+}
+
+// NewMachine returns a Machine keeping its state in the given directory. An update that was
+// interrupted by a restart is recovered: checks and downloads are abandoned, while an update
+// that was being applied returns to downloaded, so that it can be approved again.
+func NewMachine(dir string) (*Machine, error) {
+	m := &Machine{path: filepath.Join(dir, stateFile)}
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		m.state = State{Phase: PhaseIdle, Staged: []StagedImage{}, UpdatedAt: time.Now()}
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m.state); err != nil {
+		return nil, fmt.Errorf("could not parse the update state: %w", err)
+	}
+	if _, known := transitions[m.state.Phase]; !known {
+		return nil, fmt.Errorf("unknown update phase %q", m.state.Phase)
+	}
+
+	switch m.state.Phase {
+	case PhaseChecking, PhaseDownloading:
+		return m, m.set(PhaseIdle, "the supervisor restarted during the download", nil)
+	case PhaseApplying, PhaseVerifying:
+		return m, m.set(PhaseDownloaded, "the supervisor restarted while applying the update", nil)
+	}
+	return m, nil
+}
+
+// State returns the current state of the update
+func (m *Machine) State() State {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.copy()
+}
+
+// Transition moves the update to the phase, with the given error (or none) and, unless nil,
+// the given staged images
+func (m *Machine) Transition(phase string, errorMessage string, staged []StagedImage) (State, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !CanTransition(m.state.Phase, phase) {
+		return m.copy(), fmt.Errorf("%w from %s to %s", ErrInvalidTransition, m.state.Phase, phase)
+	}
+	err := m.set(phase, errorMessage, staged)
+	return m.copy(), err
+}
+
+// CanTransition returns whether an update can move from one phase to the other
+func CanTransition(from string, to string) bool {
+	for _, phase := range transitions[from] {
+		if phase == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Machine) set(phase string, errorMessage string, staged []StagedImage) error {
+	m.state.Phase = phase
+	m.state.Error = errorMessage
+	if staged != nil {
+		m.state.Staged = staged
+	}
+	m.state.UpdatedAt = time.Now()
+	return m.save()
+}
+
+func (m *Machine) copy() State {
+	state := m.state
+	state.Staged = append([]StagedImage{}, m.state.Staged...)
+	return state
+}
+
+func (m *Machine) save() error {
+	data, err := json.MarshalIndent(m.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0700); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(m.path, data, 0600)
+}
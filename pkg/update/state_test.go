@@ -0,0 +1,81 @@
+package update_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/containrrr/watchtower/pkg/update"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("the update state machine", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "update")
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	staged := []update.StagedImage{{Container: "planner", Image: "robot/planner:1.0", CurrentID: "sha256:old", StagedID: "sha256:new"}}
+
+	It("should start idle", func() {
+		machine, err := update.NewMachine(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(machine.State().Phase).To(Equal(update.PhaseIdle))
+		Expect(machine.State().Staged).To(BeEmpty())
+	})
+
+	It("should persist the staged images across restarts", func() {
+		machine, _ := update.NewMachine(dir)
+		_, err := machine.Transition(update.PhaseChecking, "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = machine.Transition(update.PhaseDownloading, "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		state, err := machine.Transition(update.PhaseDownloaded, "", staged)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Staged).To(Equal(staged))
+
+		machine, err = update.NewMachine(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(machine.State().Phase).To(Equal(update.PhaseDownloaded))
+		Expect(machine.State().Staged).To(Equal(staged))
+	})
+
+	It("should refuse invalid transitions", func() {
+		machine, _ := update.NewMachine(dir)
+		_, err := machine.Transition(update.PhaseApplying, "", nil)
+		Expect(err).To(MatchError(update.ErrInvalidTransition))
+		Expect(machine.State().Phase).To(Equal(update.PhaseIdle))
+		Expect(filepath.Join(dir, "update.json")).NotTo(BeAnExistingFile())
+	})
+
+	It("should return interrupted updates to the last stable phase", func() {
+		machine, _ := update.NewMachine(dir)
+		_, _ = machine.Transition(update.PhaseChecking, "", nil)
+		_, _ = machine.Transition(update.PhaseDownloaded, "", staged)
+		_, _ = machine.Transition(update.PhaseApplying, "", nil)
+
+		machine, err := update.NewMachine(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(machine.State().Phase).To(Equal(update.PhaseDownloaded))
+		Expect(machine.State().Error).NotTo(BeEmpty())
+		Expect(machine.State().Staged).To(Equal(staged))
+
+		_, _ = machine.Transition(update.PhaseChecking, "", nil)
+		machine, err = update.NewMachine(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(machine.State().Phase).To(Equal(update.PhaseIdle))
+	})
+
+	It("should fail on a corrupt state", func() {
+		Expect(os.WriteFile(filepath.Join(dir, "update.json"), []byte(`{"phase": "sideways"}`), 0600)).To(Succeed())
+		_, err := update.NewMachine(dir)
+		Expect(err).To(HaveOccurred())
+	})
+})